@@ -59,3 +59,37 @@ func (adminOrg *AdminOrg) GetLdapConfiguration() (*types.OrgLdapSettingsType, er
 
 	return ldapSettings, nil
 }
+
+// GetEmailSettings retrieves the email settings of the Org
+func (adminOrg *AdminOrg) GetEmailSettings() (*types.OrgEmailSettings, error) {
+	util.Logger.Printf("[DEBUG] Reading email settings for Org name %s", adminOrg.AdminOrg.Name)
+
+	emailSettings := &types.OrgEmailSettings{}
+
+	href := adminOrg.AdminOrg.HREF + "/settings/email"
+
+	_, err := adminOrg.client.ExecuteRequest(href, http.MethodGet, types.MimeOrgEmailSettings,
+		"error getting email settings: %s", nil, emailSettings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return emailSettings, nil
+}
+
+// UpdateEmailSettings sets the email settings of the Org
+func (adminOrg *AdminOrg) UpdateEmailSettings(settings *types.OrgEmailSettings) (*types.OrgEmailSettings, error) {
+	util.Logger.Printf("[DEBUG] Updating email settings for Org name %s", adminOrg.AdminOrg.Name)
+
+	settings.Xmlns = types.XMLNamespaceVCloud
+
+	href := adminOrg.AdminOrg.HREF + "/settings/email"
+	_, err := adminOrg.client.ExecuteRequest(href, http.MethodPut, types.MimeOrgEmailSettings,
+		"error updating email settings: %s", settings, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error updating email settings for Org name '%s': %s", adminOrg.AdminOrg.Name, err)
+	}
+
+	return adminOrg.GetEmailSettings()
+}
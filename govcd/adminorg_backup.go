@@ -0,0 +1,1011 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// OrgBackupSchemaVersion is the version of the bundle produced by AdminOrg.Backup
+const OrgBackupSchemaVersion = "1.0"
+
+// OrgBackup is a portable bundle containing the configuration of an organization.
+// References between entities and to provider resources are resolved by name on restore, so that
+// the bundle can be restored in the same or in a different VCD. The original IDs are kept only to
+// build OrgRestoreReport.IdMap
+type OrgBackup struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	SourceVcdHref string    `json:"sourceVcdHref"`
+
+	Org           *types.AdminOrg              `json:"org"`
+	EmailSettings *types.OrgEmailSettings      `json:"emailSettings,omitempty"`
+	LdapSettings  *types.OrgLdapSettingsType   `json:"ldapSettings,omitempty"`
+	SamlSettings  *types.OrgFederationSettings `json:"samlSettings,omitempty"`
+	OidcSettings  *types.OrgOAuthSettings      `json:"oidcSettings,omitempty"`
+	Roles         []*OrgBackupRole             `json:"roles,omitempty"`
+	Users         []*types.User                `json:"users,omitempty"`
+	Groups        []*types.Group               `json:"groups,omitempty"`
+	Vdcs          []*OrgBackupVdc              `json:"vdcs,omitempty"`
+	Catalogs      []*OrgBackupCatalog          `json:"catalogs,omitempty"`
+	Metadata      []*types.MetadataEntry       `json:"metadata,omitempty"`
+
+	// Warnings lists the parts of the organization that could not be exported
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// OrgBackupRole contains a tenant role and the names of its rights
+type OrgBackupRole struct {
+	Role   *types.Role `json:"role"`
+	Rights []string    `json:"rights"`
+}
+
+// OrgBackupVdc contains the definition of an Org VDC. Provider VDC, network pool, storage
+// profiles and compute policies are stored by name. The assigned compute policies and the default
+// one are set on the restored VDC
+type OrgBackupVdc struct {
+	Vdc                  *types.AdminVdc            `json:"vdc"`
+	ProviderVdcName      string                     `json:"providerVdcName"`
+	NetworkPoolName      string                     `json:"networkPoolName,omitempty"`
+	StorageProfiles      []*types.VdcStorageProfile `json:"storageProfiles"`
+	ComputePolicyNames   []string                   `json:"computePolicyNames,omitempty"`
+	DefaultComputePolicy string                     `json:"defaultComputePolicy,omitempty"`
+	Metadata             []*types.MetadataEntry     `json:"metadata,omitempty"`
+}
+
+// OrgBackupCatalog contains the definition of a catalog and its access control settings.
+// Catalog items are not part of the backup
+type OrgBackupCatalog struct {
+	Catalog       *types.AdminCatalog        `json:"catalog"`
+	AccessControl *types.ControlAccessParams `json:"accessControl,omitempty"`
+	Metadata      []*types.MetadataEntry     `json:"metadata,omitempty"`
+}
+
+// OrgRestoreOptions defines how an OrgBackup is restored
+type OrgRestoreOptions struct {
+	// OrgName is the name of the organization to restore into. Defaults to the name of the
+	// organization in the backup. If the organization exists, its settings are updated
+	OrgName string
+	// ProviderVdcNames maps the provider VDC names of the source VCD to the ones of the target
+	// VCD. Names not in the map are used unchanged
+	ProviderVdcNames map[string]string
+	// NetworkPoolNames maps the network pool names of the source VCD to the ones of the target
+	// VCD. Names not in the map are used unchanged
+	NetworkPoolNames map[string]string
+	// UserPasswords contains the passwords for local users, by user name. Passwords are not
+	// exported, and local users without a password are not restored, unless
+	// DefaultUserPassword is set
+	UserPasswords       map[string]string
+	DefaultUserPassword string
+	// LdapPassword is the password of the LDAP bind user, which is not exported
+	LdapPassword string
+	// SmtpPassword is the password of the SMTP server, which is not exported. Email settings using
+	// SMTP authentication are not restored without it
+	SmtpPassword string
+	// OidcClientSecret is the client secret of the OIDC provider, which is not exported
+	OidcClientSecret string
+	// SkipVdcs prevents the creation of VDCs
+	SkipVdcs bool
+}
+
+// OrgRestoreItem is an entry of the restore report
+type OrgRestoreItem struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Message string `json:"message,omitempty"`
+}
+
+// OrgRestoreReport describes the result of a restore operation
+type OrgRestoreReport struct {
+	OrgName string `json:"orgName"`
+	// Restored lists the entities that were created or updated
+	Restored []OrgRestoreItem `json:"restored,omitempty"`
+	// NotRestored lists the entities that could not be recreated, with the reason
+	NotRestored []OrgRestoreItem `json:"notRestored,omitempty"`
+	// IdMap maps the IDs of the entities in the backup to the IDs of the restored ones
+	IdMap map[string]string `json:"idMap,omitempty"`
+}
+
+// Backup exports the configuration of the organization into a portable bundle.
+// It includes the organization settings (leases, email, LDAP, SAML and OIDC), roles with their
+// rights, users, groups, VDC definitions with compute policies, catalogs with their access
+// control, and metadata. Parts that can't be read (for example because of missing rights) are
+// listed in OrgBackup.Warnings.
+// Secrets (user passwords, LDAP and SMTP passwords, OIDC client secret) are not exported.
+// VDC definitions require System Administrator privileges.
+func (adminOrg *AdminOrg) Backup() (*OrgBackup, error) {
+	err := adminOrg.Refresh()
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing Org '%s' for backup: %s", adminOrg.AdminOrg.Name, err)
+	}
+
+	backup := &OrgBackup{
+		SchemaVersion: OrgBackupSchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		SourceVcdHref: adminOrg.client.VCDHREF.String(),
+		Org:           adminOrg.AdminOrg,
+	}
+	warn := func(format string, args ...any) {
+		message := fmt.Sprintf(format, args...)
+		util.Logger.Printf("[WARN] backup of Org '%s': %s", adminOrg.AdminOrg.Name, message)
+		backup.Warnings = append(backup.Warnings, message)
+	}
+
+	backup.EmailSettings, err = adminOrg.GetEmailSettings()
+	if err != nil {
+		warn("email settings: %s", err)
+	} else if backup.EmailSettings.SmtpServerSettings != nil {
+		backup.EmailSettings.SmtpServerSettings.Password = ""
+	}
+	backup.LdapSettings, err = adminOrg.GetLdapConfiguration()
+	if err != nil {
+		warn("LDAP settings: %s", err)
+	} else if backup.LdapSettings.CustomOrgLdapSettings != nil {
+		backup.LdapSettings.CustomOrgLdapSettings.Password = ""
+	}
+	samlSettings, err := adminOrg.GetFederationSettings()
+	if err != nil {
+		warn("SAML settings: %s", err)
+	} else if samlSettings.Enabled {
+		backup.SamlSettings = samlSettings
+	}
+	oidcSettings, err := adminOrg.GetOpenIdConnectSettings()
+	if err != nil {
+		warn("OIDC settings: %s", err)
+	} else if oidcSettings.Enabled {
+		oidcSettings.ClientSecret = ""
+		backup.OidcSettings = oidcSettings
+	}
+
+	roles, err := adminOrg.GetAllRoles(nil)
+	if err != nil {
+		warn("roles: %s", err)
+	}
+	for _, role := range roles {
+		rights, err := role.GetRights(nil)
+		if err != nil {
+			warn("rights of role '%s': %s", role.Role.Name, err)
+			continue
+		}
+		backupRole := &OrgBackupRole{Role: role.Role}
+		for _, right := range rights {
+			backupRole.Rights = append(backupRole.Rights, right.Name)
+		}
+		backup.Roles = append(backup.Roles, backupRole)
+	}
+
+	if adminOrg.AdminOrg.Users != nil {
+		for _, userRef := range adminOrg.AdminOrg.Users.User {
+			user, err := adminOrg.GetUserByHref(userRef.HREF)
+			if err != nil {
+				warn("user '%s': %s", userRef.Name, err)
+				continue
+			}
+			user.User.Password = ""
+			backup.Users = append(backup.Users, user.User)
+		}
+	}
+	if adminOrg.AdminOrg.Groups != nil {
+		for _, groupRef := range adminOrg.AdminOrg.Groups.Group {
+			group, err := adminOrg.GetGroupByHref(groupRef.HREF)
+			if err != nil {
+				warn("group '%s': %s", groupRef.Name, err)
+				continue
+			}
+			backup.Groups = append(backup.Groups, group.Group)
+		}
+	}
+
+	if adminOrg.AdminOrg.Vdcs != nil {
+		for _, vdcRef := range adminOrg.AdminOrg.Vdcs.Vdcs {
+			backupVdc, err := adminOrg.backupVdc(vdcRef.HREF)
+			if err != nil {
+				warn("VDC '%s': %s", vdcRef.Name, err)
+				continue
+			}
+			backup.Vdcs = append(backup.Vdcs, backupVdc)
+		}
+	}
+
+	if adminOrg.AdminOrg.Catalogs != nil {
+		for _, catalogRef := range adminOrg.AdminOrg.Catalogs.Catalog {
+			adminCatalog, err := adminOrg.GetAdminCatalogByHref(catalogRef.HREF)
+			if err != nil {
+				warn("catalog '%s': %s", catalogRef.Name, err)
+				continue
+			}
+			backupCatalog := &OrgBackupCatalog{Catalog: adminCatalog.AdminCatalog}
+			backupCatalog.AccessControl, err = adminCatalog.GetAccessControl(true)
+			if err != nil {
+				warn("access control of catalog '%s': %s", catalogRef.Name, err)
+			}
+			metadata, err := adminCatalog.GetMetadata()
+			if err != nil {
+				warn("metadata of catalog '%s': %s", catalogRef.Name, err)
+			} else {
+				backupCatalog.Metadata = metadata.MetadataEntry
+			}
+			backup.Catalogs = append(backup.Catalogs, backupCatalog)
+		}
+	}
+
+	metadata, err := adminOrg.GetMetadata()
+	if err != nil {
+		warn("metadata: %s", err)
+	} else {
+		backup.Metadata = metadata.MetadataEntry
+	}
+
+	return backup, nil
+}
+
+// backupVdc collects the definition of a VDC, converting the references to the provider
+// resources into names
+func (adminOrg *AdminOrg) backupVdc(vdcHref string) (*OrgBackupVdc, error) {
+	adminVdc, err := adminOrg.GetAdminVDCByHref(vdcHref)
+	if err != nil {
+		return nil, err
+	}
+	backupVdc := &OrgBackupVdc{Vdc: adminVdc.AdminVdc}
+	if adminVdc.AdminVdc.ProviderVdcReference != nil {
+		backupVdc.ProviderVdcName = adminVdc.AdminVdc.ProviderVdcReference.Name
+	}
+	if adminVdc.AdminVdc.NetworkPoolReference != nil {
+		backupVdc.NetworkPoolName = adminVdc.AdminVdc.NetworkPoolReference.Name
+	}
+	if adminVdc.AdminVdc.DefaultComputePolicy != nil {
+		backupVdc.DefaultComputePolicy = adminVdc.AdminVdc.DefaultComputePolicy.Name
+	}
+	if adminVdc.AdminVdc.VdcStorageProfiles != nil {
+		for _, storageProfileRef := range adminVdc.AdminVdc.VdcStorageProfiles.VdcStorageProfile {
+			storageProfile, err := adminOrg.client.GetStorageProfileByHref(storageProfileRef.HREF)
+			if err != nil {
+				return nil, fmt.Errorf("error retrieving storage profile '%s': %s", storageProfileRef.Name, err)
+			}
+			backupVdc.StorageProfiles = append(backupVdc.StorageProfiles, storageProfile)
+		}
+	}
+	computePolicies, err := adminVdc.GetAllAssignedVdcComputePoliciesV2(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving compute policies: %s", err)
+	}
+	for _, computePolicy := range computePolicies {
+		backupVdc.ComputePolicyNames = append(backupVdc.ComputePolicyNames, computePolicy.VdcComputePolicyV2.Name)
+	}
+	metadata, err := adminVdc.GetMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving metadata: %s", err)
+	}
+	backupVdc.Metadata = metadata.MetadataEntry
+	return backupVdc, nil
+}
+
+// Json returns the backup as an indented JSON document
+func (backup *OrgBackup) Json() ([]byte, error) {
+	return json.MarshalIndent(backup, "", "  ")
+}
+
+// NewOrgBackupFromJson decodes a backup previously saved with OrgBackup.Json
+func NewOrgBackupFromJson(data []byte) (*OrgBackup, error) {
+	backup := &OrgBackup{}
+	err := json.Unmarshal(data, backup)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding Org backup: %s", err)
+	}
+	if backup.SchemaVersion != OrgBackupSchemaVersion {
+		return nil, fmt.Errorf("unsupported Org backup schema version '%s' (expected '%s')",
+			backup.SchemaVersion, OrgBackupSchemaVersion)
+	}
+	if backup.Org == nil {
+		return nil, fmt.Errorf("Org backup does not contain an organization")
+	}
+	return backup, nil
+}
+
+// RestoreOrg recreates the organization contained in a backup. When the target organization
+// already exists, its settings are updated and only the missing entities are created. Existing
+// roles are not changed: when their rights differ from the backup, they are listed as not restored.
+// The restore does not stop at the first failure: entities that can't be recreated are listed in
+// the report, together with the reason. An error is returned only when the target organization
+// can't be created or retrieved.
+// Requires System Administrator privileges.
+func (vcdClient *VCDClient) RestoreOrg(backup *OrgBackup, options *OrgRestoreOptions) (*OrgRestoreReport, error) {
+	if backup == nil || backup.Org == nil {
+		return nil, fmt.Errorf("empty Org backup")
+	}
+	if options == nil {
+		options = &OrgRestoreOptions{}
+	}
+	orgName := options.OrgName
+	if orgName == "" {
+		orgName = backup.Org.Name
+	}
+	report := &OrgRestoreReport{OrgName: orgName, IdMap: make(map[string]string)}
+
+	adminOrg, err := vcdClient.restoreOrgEntity(backup, orgName, report)
+	if err != nil {
+		return report, err
+	}
+
+	restorer := &orgRestorer{
+		vcdClient: vcdClient,
+		adminOrg:  adminOrg,
+		backup:    backup,
+		options:   options,
+		report:    report,
+	}
+	restorer.restoreSettings()
+	restorer.restoreRoles()
+	restorer.restoreUsers()
+	restorer.restoreGroups()
+	if !options.SkipVdcs {
+		restorer.restoreVdcs()
+	}
+	restorer.restoreCatalogs()
+	restorer.restoreMetadata("org", orgName, backup.Metadata, adminOrg.MergeMetadataWithMetadataValues)
+
+	return report, nil
+}
+
+// restoreOrgEntity creates the organization, or updates its general settings if it exists
+func (vcdClient *VCDClient) restoreOrgEntity(backup *OrgBackup, orgName string, report *OrgRestoreReport) (*AdminOrg, error) {
+	settings := &types.OrgSettings{}
+	if backup.Org.OrgSettings != nil {
+		settings.OrgGeneralSettings = backup.Org.OrgSettings.OrgGeneralSettings
+		settings.OrgVAppLeaseSettings = backup.Org.OrgSettings.OrgVAppLeaseSettings
+		settings.OrgVAppTemplateSettings = backup.Org.OrgSettings.OrgVAppTemplateSettings
+		settings.OrgPasswordPolicySettings = backup.Org.OrgSettings.OrgPasswordPolicySettings
+		clearOrgSettingsLinks(settings)
+	}
+
+	adminOrg, err := vcdClient.GetAdminOrgByName(orgName)
+	if err == nil {
+		adminOrg.AdminOrg.FullName = backup.Org.FullName
+		adminOrg.AdminOrg.Description = backup.Org.Description
+		adminOrg.AdminOrg.IsEnabled = backup.Org.IsEnabled
+		if adminOrg.AdminOrg.OrgSettings == nil {
+			adminOrg.AdminOrg.OrgSettings = &types.OrgSettings{}
+		}
+		adminOrg.AdminOrg.OrgSettings.OrgGeneralSettings = settings.OrgGeneralSettings
+		adminOrg.AdminOrg.OrgSettings.OrgVAppLeaseSettings = settings.OrgVAppLeaseSettings
+		adminOrg.AdminOrg.OrgSettings.OrgVAppTemplateSettings = settings.OrgVAppTemplateSettings
+		adminOrg.AdminOrg.OrgSettings.OrgPasswordPolicySettings = settings.OrgPasswordPolicySettings
+		task, err := adminOrg.Update()
+		if err == nil {
+			err = task.WaitTaskCompletion()
+		}
+		if err != nil {
+			report.notRestored("org", orgName, "error updating settings of existing Org: %s", err)
+		} else {
+			report.restored("org", orgName, "existing Org updated")
+		}
+		report.IdMap[backup.Org.ID] = adminOrg.AdminOrg.ID
+		return adminOrg, adminOrg.Refresh()
+	}
+	if !ContainsNotFound(err) {
+		return nil, fmt.Errorf("error retrieving Org '%s': %s", orgName, err)
+	}
+
+	task, err := CreateOrg(vcdClient, orgName, backup.Org.FullName, backup.Org.Description, settings, backup.Org.IsEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Org '%s': %s", orgName, err)
+	}
+	err = task.WaitTaskCompletion()
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for creation of Org '%s': %s", orgName, err)
+	}
+	adminOrg, err = vcdClient.GetAdminOrgByName(orgName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Org '%s' after creation: %s", orgName, err)
+	}
+	report.restored("org", orgName, "")
+	report.IdMap[backup.Org.ID] = adminOrg.AdminOrg.ID
+	return adminOrg, nil
+}
+
+// clearOrgSettingsLinks removes the server assigned fields from the Org settings, which would
+// otherwise point to the source organization
+func clearOrgSettingsLinks(settings *types.OrgSettings) {
+	if settings.OrgGeneralSettings != nil {
+		general := *settings.OrgGeneralSettings
+		general.HREF = ""
+		general.Link = nil
+		settings.OrgGeneralSettings = &general
+	}
+	if settings.OrgVAppLeaseSettings != nil {
+		lease := *settings.OrgVAppLeaseSettings
+		lease.HREF = ""
+		lease.Link = nil
+		settings.OrgVAppLeaseSettings = &lease
+	}
+	if settings.OrgVAppTemplateSettings != nil {
+		lease := *settings.OrgVAppTemplateSettings
+		lease.HREF = ""
+		lease.Link = nil
+		settings.OrgVAppTemplateSettings = &lease
+	}
+	if settings.OrgPasswordPolicySettings != nil {
+		policy := *settings.OrgPasswordPolicySettings
+		policy.HREF = ""
+		policy.Link = nil
+		settings.OrgPasswordPolicySettings = &policy
+	}
+}
+
+func (report *OrgRestoreReport) restored(kind, name, format string, args ...any) {
+	report.Restored = append(report.Restored, OrgRestoreItem{Kind: kind, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+func (report *OrgRestoreReport) notRestored(kind, name, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	util.Logger.Printf("[WARN] restore of Org '%s': %s '%s' not restored: %s", report.OrgName, kind, name, message)
+	report.NotRestored = append(report.NotRestored, OrgRestoreItem{Kind: kind, Name: name, Message: message})
+}
+
+// orgRestorer holds the state of a restore operation
+type orgRestorer struct {
+	vcdClient *VCDClient
+	adminOrg  *AdminOrg
+	backup    *OrgBackup
+	options   *OrgRestoreOptions
+	report    *OrgRestoreReport
+}
+
+func (r *orgRestorer) restoreSettings() {
+	if r.backup.EmailSettings != nil {
+		emailSettings, err := restoredEmailSettings(r.backup.EmailSettings, r.options.SmtpPassword)
+		if err == nil {
+			_, err = r.adminOrg.UpdateEmailSettings(emailSettings)
+		}
+		if err != nil {
+			r.report.notRestored("emailSettings", r.report.OrgName, "%s", err)
+		} else {
+			r.report.restored("emailSettings", r.report.OrgName, "")
+		}
+	}
+
+	if r.backup.LdapSettings != nil && r.backup.LdapSettings.OrgLdapMode != "" && r.backup.LdapSettings.OrgLdapMode != types.LdapModeNone {
+		ldapSettings := *r.backup.LdapSettings
+		ldapSettings.HREF = ""
+		ldapSettings.Link = nil
+		if ldapSettings.CustomOrgLdapSettings != nil {
+			customSettings := *ldapSettings.CustomOrgLdapSettings
+			customSettings.Password = r.options.LdapPassword
+			ldapSettings.CustomOrgLdapSettings = &customSettings
+		}
+		_, err := r.adminOrg.LdapConfigure(&ldapSettings)
+		if err != nil {
+			r.report.notRestored("ldapSettings", r.report.OrgName, "%s", err)
+		} else {
+			r.report.restored("ldapSettings", r.report.OrgName, "")
+		}
+	}
+
+	if r.backup.SamlSettings != nil {
+		samlSettings := *r.backup.SamlSettings
+		// The service provider entity ID and the certificates are specific to the source
+		// organization: VCD assigns new ones
+		samlSettings.Href = ""
+		samlSettings.Link = nil
+		samlSettings.SamlSPEntityID = ""
+		samlSettings.CertificateExpiration = ""
+		samlSettings.SigningCertificateExpiration = ""
+		samlSettings.EncryptionCertificateExpiration = ""
+		_, err := r.adminOrg.SetFederationSettings(&samlSettings)
+		if err != nil {
+			r.report.notRestored("samlSettings", r.report.OrgName, "%s", err)
+		} else {
+			r.report.restored("samlSettings", r.report.OrgName, "service provider metadata must be registered again in the identity provider")
+		}
+	}
+
+	if r.backup.OidcSettings != nil {
+		if r.options.OidcClientSecret == "" {
+			r.report.notRestored("oidcSettings", r.report.OrgName, "OIDC client secret was not provided")
+		} else {
+			oidcSettings := *r.backup.OidcSettings
+			oidcSettings.Href = ""
+			oidcSettings.Link = nil
+			oidcSettings.OrgRedirectUri = ""
+			oidcSettings.ClientSecret = r.options.OidcClientSecret
+			_, err := r.adminOrg.SetOpenIdConnectSettings(oidcSettings)
+			if err != nil {
+				r.report.notRestored("oidcSettings", r.report.OrgName, "%s", err)
+			} else {
+				r.report.restored("oidcSettings", r.report.OrgName, "")
+			}
+		}
+	}
+}
+
+// restoredEmailSettings returns the email settings of the backup to be restored, using the given
+// password for the SMTP server
+func restoredEmailSettings(backupSettings *types.OrgEmailSettings, smtpPassword string) (*types.OrgEmailSettings, error) {
+	emailSettings := *backupSettings
+	emailSettings.HREF = ""
+	emailSettings.Link = nil
+	if emailSettings.SmtpServerSettings != nil {
+		smtpSettings := *emailSettings.SmtpServerSettings
+		if smtpSettings.IsUseAuthentication && smtpPassword == "" {
+			return nil, fmt.Errorf("SMTP password was not provided")
+		}
+		smtpSettings.Password = smtpPassword
+		emailSettings.SmtpServerSettings = &smtpSettings
+	}
+	return &emailSettings, nil
+}
+
+func (r *orgRestorer) restoreRoles() {
+	for _, backupRole := range r.backup.Roles {
+		roleName := backupRole.Role.Name
+		existingRole, err := r.adminOrg.GetRoleByName(roleName)
+		if err == nil {
+			// An existing role is kept unchanged: different rights are reported, as restored users get them
+			r.report.IdMap[backupRole.Role.ID] = existingRole.Role.ID
+			existingRights, err := existingRole.GetRights(nil)
+			if err != nil {
+				r.report.notRestored("role", roleName, "error retrieving rights of existing role: %s", err)
+				continue
+			}
+			var existingRightNames []string
+			for _, right := range existingRights {
+				existingRightNames = append(existingRightNames, right.Name)
+			}
+			missingRights, extraRights := rightsDifference(backupRole.Rights, existingRightNames)
+			if len(missingRights) > 0 || len(extraRights) > 0 {
+				r.report.notRestored("role", roleName, "existing role has different rights: missing %v, additional %v", missingRights, extraRights)
+				continue
+			}
+			r.report.restored("role", roleName, "existing role has the same rights")
+			continue
+		}
+		if backupRole.Role.ReadOnly {
+			r.report.notRestored("role", roleName, "read-only role is not available in the target Org: it must be published from a global role")
+			continue
+		}
+
+		var rights []types.OpenApiReference
+		var missingRights []string
+		for _, rightName := range backupRole.Rights {
+			right, err := r.adminOrg.GetRightByName(rightName)
+			if err != nil {
+				missingRights = append(missingRights, rightName)
+				continue
+			}
+			rights = append(rights, types.OpenApiReference{Name: right.Name, ID: right.ID})
+		}
+
+		role, err := r.adminOrg.CreateRole(&types.Role{
+			Name:        roleName,
+			Description: backupRole.Role.Description,
+			BundleKey:   types.VcloudUndefinedKey,
+		})
+		if err != nil {
+			r.report.notRestored("role", roleName, "%s", err)
+			continue
+		}
+		r.report.IdMap[backupRole.Role.ID] = role.Role.ID
+		if len(rights) > 0 {
+			err = role.AddRights(rights)
+			if err != nil {
+				r.report.notRestored("role", roleName, "role created, but rights could not be added: %s", err)
+				continue
+			}
+		}
+		if len(missingRights) > 0 {
+			r.report.notRestored("role", roleName, "role created without rights not available in target: %v", missingRights)
+			continue
+		}
+		r.report.restored("role", roleName, "")
+	}
+}
+
+// rightsDifference returns the rights of the backup which are missing from the existing ones, and the
+// existing rights which are not in the backup
+func rightsDifference(backupRights, existingRights []string) ([]string, []string) {
+	var missing, extra []string
+	for _, right := range backupRights {
+		if !slices.Contains(existingRights, right) {
+			missing = append(missing, right)
+		}
+	}
+	for _, right := range existingRights {
+		if !slices.Contains(backupRights, right) {
+			extra = append(extra, right)
+		}
+	}
+	return missing, extra
+}
+
+// roleReference finds a role in the target organization using the name of a role reference
+// from the backup
+func (r *orgRestorer) roleReference(role *types.Reference) (*types.Reference, error) {
+	if role == nil || role.Name == "" {
+		return nil, fmt.Errorf("no role defined")
+	}
+	return r.adminOrg.GetRoleReference(role.Name)
+}
+
+func (r *orgRestorer) restoreUsers() {
+	for _, backupUser := range r.backup.Users {
+		userName := backupUser.Name
+		existingUser, err := r.adminOrg.GetUserByName(userName, false)
+		if err == nil {
+			r.report.IdMap[backupUser.ID] = existingUser.User.ID
+			continue
+		}
+		roleReference, err := r.roleReference(backupUser.Role)
+		if err != nil {
+			r.report.notRestored("user", userName, "error finding role: %s", err)
+			continue
+		}
+		password := ""
+		if !backupUser.IsExternal {
+			password = r.options.UserPasswords[userName]
+			if password == "" {
+				password = r.options.DefaultUserPassword
+			}
+			if password == "" {
+				r.report.notRestored("user", userName, "no password provided for local user")
+				continue
+			}
+		}
+		user, err := r.adminOrg.CreateUser(&types.User{
+			Xmlns:           types.XMLNamespaceVCloud,
+			Type:            types.MimeAdminUser,
+			Name:            userName,
+			Description:     backupUser.Description,
+			FullName:        backupUser.FullName,
+			EmailAddress:    backupUser.EmailAddress,
+			Telephone:       backupUser.Telephone,
+			IsEnabled:       backupUser.IsEnabled,
+			IM:              backupUser.IM,
+			IsExternal:      backupUser.IsExternal,
+			ProviderType:    backupUser.ProviderType,
+			StoredVmQuota:   backupUser.StoredVmQuota,
+			DeployedVmQuota: backupUser.DeployedVmQuota,
+			Role:            roleReference,
+			Password:        password,
+		})
+		if err != nil {
+			r.report.notRestored("user", userName, "%s", err)
+			continue
+		}
+		r.report.IdMap[backupUser.ID] = user.User.ID
+		r.report.restored("user", userName, "")
+	}
+}
+
+func (r *orgRestorer) restoreGroups() {
+	for _, backupGroup := range r.backup.Groups {
+		groupName := backupGroup.Name
+		existingGroup, err := r.adminOrg.GetGroupByName(groupName, true)
+		if err == nil {
+			r.report.IdMap[backupGroup.ID] = existingGroup.Group.ID
+			continue
+		}
+		roleReference, err := r.roleReference(backupGroup.Role)
+		if err != nil {
+			r.report.notRestored("group", groupName, "error finding role: %s", err)
+			continue
+		}
+		group, err := r.adminOrg.CreateGroup(&types.Group{
+			Name:         groupName,
+			Description:  backupGroup.Description,
+			ProviderType: backupGroup.ProviderType,
+			Role:         roleReference,
+		})
+		if err != nil {
+			r.report.notRestored("group", groupName, "%s", err)
+			continue
+		}
+		r.report.IdMap[backupGroup.ID] = group.Group.ID
+		r.report.restored("group", groupName, "")
+	}
+}
+
+func (r *orgRestorer) restoreVdcs() {
+	for _, backupVdc := range r.backup.Vdcs {
+		vdcName := backupVdc.Vdc.Name
+		existingVdc, err := r.adminOrg.GetAdminVDCByName(vdcName, true)
+		if err == nil {
+			r.report.IdMap[backupVdc.Vdc.ID] = existingVdc.AdminVdc.ID
+			continue
+		}
+		vdcConfiguration, err := r.vdcConfiguration(backupVdc)
+		if err != nil {
+			r.report.notRestored("vdc", vdcName, "%s", err)
+			continue
+		}
+		_, err = r.adminOrg.CreateOrgVdc(vdcConfiguration)
+		if err != nil {
+			r.report.notRestored("vdc", vdcName, "%s", err)
+			continue
+		}
+		adminVdc, err := r.adminOrg.GetAdminVDCByName(vdcName, true)
+		if err != nil {
+			r.report.notRestored("vdc", vdcName, "error retrieving VDC after creation: %s", err)
+			continue
+		}
+		r.report.IdMap[backupVdc.Vdc.ID] = adminVdc.AdminVdc.ID
+		r.report.restored("vdc", vdcName, "")
+
+		err = r.restoreVdcComputePolicies(adminVdc, backupVdc)
+		if err != nil {
+			r.report.notRestored("vdcComputePolicies", vdcName, "%s", err)
+		}
+		r.restoreMetadata("vdc", vdcName, backupVdc.Metadata, adminVdc.MergeMetadataWithMetadataValues)
+	}
+}
+
+// vdcConfiguration builds the VDC creation parameters, resolving the names of provider VDC,
+// network pool and storage profiles in the target VCD
+func (r *orgRestorer) vdcConfiguration(backupVdc *OrgBackupVdc) (*types.VdcConfiguration, error) {
+	source := backupVdc.Vdc
+	providerVdcName := mappedName(r.options.ProviderVdcNames, backupVdc.ProviderVdcName)
+	providerVdc, err := r.vcdClient.GetProviderVdcByName(providerVdcName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving provider VDC '%s': %s", providerVdcName, err)
+	}
+
+	vdcConfiguration := &types.VdcConfiguration{
+		Xmlns:                    types.XMLNamespaceVCloud,
+		Name:                     source.Name,
+		Description:              source.Description,
+		AllocationModel:          source.AllocationModel,
+		NicQuota:                 source.NicQuota,
+		NetworkQuota:             source.NetworkQuota,
+		VmQuota:                  source.VMQuota,
+		IsEnabled:                source.IsEnabled,
+		ResourceGuaranteedMemory: source.ResourceGuaranteedMemory,
+		ResourceGuaranteedCpu:    source.ResourceGuaranteedCpu,
+		OverCommitAllowed:        source.OverCommitAllowed,
+		VmDiscoveryEnabled:       source.VmDiscoveryEnabled,
+		IsElastic:                source.IsElastic,
+		IncludeMemoryOverhead:    source.IncludeMemoryOverhead,
+		ProviderVdcReference:     &types.Reference{HREF: providerVdc.ProviderVdc.HREF},
+	}
+	if source.VCpuInMhz != nil {
+		vdcConfiguration.VCpuInMhz = *source.VCpuInMhz
+	}
+	if source.IsThinProvision != nil {
+		vdcConfiguration.IsThinProvision = *source.IsThinProvision
+	}
+	if source.UsesFastProvisioning != nil {
+		vdcConfiguration.UsesFastProvisioning = *source.UsesFastProvisioning
+	}
+	for _, capacity := range source.ComputeCapacity {
+		vdcConfiguration.ComputeCapacity = append(vdcConfiguration.ComputeCapacity, &types.ComputeCapacity{
+			CPU:    capacityForCreation(capacity.CPU),
+			Memory: capacityForCreation(capacity.Memory),
+		})
+	}
+
+	if backupVdc.NetworkPoolName != "" {
+		networkPoolName := mappedName(r.options.NetworkPoolNames, backupVdc.NetworkPoolName)
+		networkPool, err := r.vcdClient.GetNetworkPoolByName(networkPoolName)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving network pool '%s': %s", networkPoolName, err)
+		}
+		networkPoolHref, err := networkPool.GetOpenApiUrl()
+		if err != nil {
+			return nil, err
+		}
+		vdcConfiguration.NetworkPoolReference = &types.Reference{HREF: networkPoolHref}
+	}
+
+	for _, storageProfile := range backupVdc.StorageProfiles {
+		providerStorageProfile, err := r.vcdClient.QueryProviderVdcStorageProfileByName(storageProfile.Name, providerVdc.ProviderVdc.HREF)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving storage profile '%s' in provider VDC '%s': %s",
+				storageProfile.Name, providerVdcName, err)
+		}
+		vdcConfiguration.VdcStorageProfile = append(vdcConfiguration.VdcStorageProfile, &types.VdcStorageProfileConfiguration{
+			Enabled:                   storageProfile.Enabled,
+			Units:                     storageProfile.Units,
+			Limit:                     storageProfile.Limit,
+			Default:                   storageProfile.Default,
+			ProviderVdcStorageProfile: &types.Reference{HREF: providerStorageProfile.HREF},
+		})
+	}
+	return vdcConfiguration, nil
+}
+
+// capacityForCreation keeps only the fields of a capacity that are accepted on VDC creation
+func capacityForCreation(capacity *types.CapacityWithUsage) *types.CapacityWithUsage {
+	if capacity == nil {
+		return nil
+	}
+	return &types.CapacityWithUsage{
+		Units:     capacity.Units,
+		Allocated: capacity.Allocated,
+		Limit:     capacity.Limit,
+		Reserved:  capacity.Reserved,
+	}
+}
+
+// restoreVdcComputePolicies assigns to the new VDC the compute policies with the same names as
+// the ones in the backup. The current default policy of the VDC is always kept
+func (r *orgRestorer) restoreVdcComputePolicies(adminVdc *AdminVdc, backupVdc *OrgBackupVdc) error {
+	if len(backupVdc.ComputePolicyNames) == 0 && backupVdc.DefaultComputePolicy == "" {
+		return nil
+	}
+	policyHref, err := r.vcdClient.Client.OpenApiBuildEndpoint(types.OpenApiPathVersion1_0_0, types.OpenApiEndpointVdcComputePolicies)
+	if err != nil {
+		return err
+	}
+	var policyIds, missing []string
+	defaultPolicyId := ""
+	policyNames := backupVdc.ComputePolicyNames
+	if backupVdc.DefaultComputePolicy != "" && !slices.Contains(policyNames, backupVdc.DefaultComputePolicy) {
+		policyNames = append(slices.Clone(policyNames), backupVdc.DefaultComputePolicy)
+	}
+	for _, policyName := range policyNames {
+		queryParameters := url.Values{}
+		queryParameters.Add("filter", "name=="+policyName)
+		policies, err := r.vcdClient.GetAllVdcComputePoliciesV2(queryParameters)
+		if err != nil || len(policies) != 1 {
+			missing = append(missing, policyName)
+			continue
+		}
+		policyId := policies[0].VdcComputePolicyV2.ID
+		if !slices.Contains(policyIds, policyId) {
+			policyIds = append(policyIds, policyId)
+		}
+		if policyName == backupVdc.DefaultComputePolicy {
+			defaultPolicyId = policyId
+		}
+	}
+	assign := func(ids []string) error {
+		var references []*types.Reference
+		for _, id := range ids {
+			references = append(references, &types.Reference{HREF: policyHref.String() + id})
+		}
+		_, err := adminVdc.SetAssignedComputePolicies(types.VdcComputePolicyReferences{VdcComputePolicyReference: references})
+		return err
+	}
+
+	// The current default policy of the VDC must stay assigned until it is replaced
+	currentDefaultId := ""
+	if adminVdc.AdminVdc.DefaultComputePolicy != nil {
+		currentDefaultId = adminVdc.AdminVdc.DefaultComputePolicy.ID
+	}
+	assignedIds := policyIds
+	if currentDefaultId != "" && !slices.Contains(policyIds, currentDefaultId) {
+		assignedIds = append(slices.Clone(policyIds), currentDefaultId)
+	}
+	err = assign(assignedIds)
+	if err != nil {
+		return err
+	}
+	if defaultPolicyId != "" && defaultPolicyId != currentDefaultId {
+		adminVdc.AdminVdc.DefaultComputePolicy = &types.Reference{HREF: policyHref.String() + defaultPolicyId, ID: defaultPolicyId}
+		updatedVdc, err := adminVdc.Update()
+		if err != nil {
+			return fmt.Errorf("error setting default compute policy '%s': %s", backupVdc.DefaultComputePolicy, err)
+		}
+		*adminVdc = updatedVdc
+		if len(assignedIds) != len(policyIds) {
+			err = assign(policyIds)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("compute policies not found or ambiguous in target: %v", missing)
+	}
+	return nil
+}
+
+func (r *orgRestorer) restoreCatalogs() {
+	for _, backupCatalog := range r.backup.Catalogs {
+		catalogName := backupCatalog.Catalog.Name
+		adminCatalog, err := r.adminOrg.GetAdminCatalogByName(catalogName, true)
+		if err != nil {
+			if !ContainsNotFound(err) {
+				r.report.notRestored("catalog", catalogName, "%s", err)
+				continue
+			}
+			newCatalog, err := r.adminOrg.CreateCatalog(catalogName, backupCatalog.Catalog.Description)
+			if err != nil {
+				r.report.notRestored("catalog", catalogName, "%s", err)
+				continue
+			}
+			adminCatalog = &newCatalog
+			r.report.restored("catalog", catalogName, "storage profile and items are not restored")
+		}
+		r.report.IdMap[backupCatalog.Catalog.ID] = adminCatalog.AdminCatalog.ID
+
+		if backupCatalog.AccessControl != nil {
+			accessControl, err := r.mapAccessControl(backupCatalog.AccessControl)
+			if err == nil {
+				err = adminCatalog.SetAccessControl(accessControl, true)
+			}
+			if err != nil {
+				r.report.notRestored("catalogAccessControl", catalogName, "%s", err)
+			}
+		}
+		r.restoreMetadata("catalog", catalogName, backupCatalog.Metadata, adminCatalog.MergeMetadataWithMetadataValues)
+	}
+}
+
+// mapAccessControl converts the subjects of access control settings from the backup into the
+// corresponding users, groups and organizations of the target VCD
+func (r *orgRestorer) mapAccessControl(source *types.ControlAccessParams) (*types.ControlAccessParams, error) {
+	result := &types.ControlAccessParams{
+		IsSharedToEveryone:  source.IsSharedToEveryone,
+		EveryoneAccessLevel: source.EveryoneAccessLevel,
+	}
+	if source.AccessSettings == nil {
+		return result, nil
+	}
+	result.AccessSettings = &types.AccessSettingList{}
+	for _, setting := range source.AccessSettings.AccessSetting {
+		if setting.Subject == nil {
+			// External subjects are not bound to an entity of the source VCD
+			result.AccessSettings.AccessSetting = append(result.AccessSettings.AccessSetting, setting)
+			continue
+		}
+		var href string
+		switch setting.Subject.Type {
+		case types.MimeAdminUser:
+			user, err := r.adminOrg.GetUserByName(setting.Subject.Name, false)
+			if err != nil {
+				return nil, fmt.Errorf("error finding user '%s': %s", setting.Subject.Name, err)
+			}
+			href = user.User.Href
+		case types.MimeAdminGroup:
+			group, err := r.adminOrg.GetGroupByName(setting.Subject.Name, false)
+			if err != nil {
+				return nil, fmt.Errorf("error finding group '%s': %s", setting.Subject.Name, err)
+			}
+			href = group.Group.Href
+		case types.MimeOrg, types.MimeAdminOrg:
+			org, err := r.vcdClient.GetAdminOrgByName(setting.Subject.Name)
+			if err != nil {
+				return nil, fmt.Errorf("error finding Org '%s': %s", setting.Subject.Name, err)
+			}
+			href = org.AdminOrg.HREF
+		default:
+			return nil, fmt.Errorf("unhandled subject type '%s' for '%s'", setting.Subject.Type, setting.Subject.Name)
+		}
+		result.AccessSettings.AccessSetting = append(result.AccessSettings.AccessSetting, &types.AccessSetting{
+			Subject:     &types.LocalSubject{HREF: href, Name: setting.Subject.Name, Type: setting.Subject.Type},
+			AccessLevel: setting.AccessLevel,
+		})
+	}
+	return result, nil
+}
+
+// restoreMetadata merges the metadata entries from the backup into a restored entity
+func (r *orgRestorer) restoreMetadata(kind, name string, entries []*types.MetadataEntry, merge func(map[string]types.MetadataValue) error) {
+	if len(entries) == 0 {
+		return
+	}
+	metadata := make(map[string]types.MetadataValue)
+	for _, entry := range entries {
+		metadata[entry.Key] = types.MetadataValue{Domain: entry.Domain, TypedValue: entry.TypedValue}
+	}
+	err := merge(metadata)
+	if err != nil {
+		r.report.notRestored(kind+"Metadata", name, "%s", err)
+	}
+}
+
+// mappedName returns the name found in the map, or the original name if not found
+func mappedName(names map[string]string, name string) string {
+	if mapped, ok := names[name]; ok && mapped != "" {
+		return mapped
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+//go:build org || functional || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test_OrgBackupAndRestore exports the configured Org and restores it, without VDCs, into a new Org
+func (vcd *TestVCD) Test_OrgBackupAndRestore(check *C) {
+	vcd.skipIfNotSysAdmin(check)
+
+	adminOrg, err := vcd.client.GetAdminOrgByName(vcd.config.VCD.Org)
+	check.Assert(err, IsNil)
+
+	backup, err := adminOrg.Backup()
+	check.Assert(err, IsNil)
+	check.Assert(backup.SchemaVersion, Equals, OrgBackupSchemaVersion)
+	check.Assert(backup.Org.Name, Equals, vcd.config.VCD.Org)
+	for _, warning := range backup.Warnings {
+		fmt.Printf("backup warning: %s\n", warning)
+	}
+	for _, user := range backup.Users {
+		check.Assert(user.Password, Equals, "")
+	}
+
+	// The bundle must survive a JSON round trip
+	data, err := backup.Json()
+	check.Assert(err, IsNil)
+	backup, err = NewOrgBackupFromJson(data)
+	check.Assert(err, IsNil)
+
+	newOrgName := check.TestName()
+	report, err := vcd.client.RestoreOrg(backup, &OrgRestoreOptions{
+		OrgName:             newOrgName,
+		DefaultUserPassword: "Restored-Passw0rd!",
+		SkipVdcs:            true,
+	})
+	check.Assert(err, IsNil)
+	AddToCleanupList(newOrgName, "org", "", check.TestName())
+	for _, item := range report.NotRestored {
+		fmt.Printf("not restored: %s '%s': %s\n", item.Kind, item.Name, item.Message)
+	}
+	check.Assert(report.IdMap[backup.Org.ID], Not(Equals), "")
+
+	newOrg, err := vcd.client.GetAdminOrgByName(newOrgName)
+	check.Assert(err, IsNil)
+	check.Assert(newOrg.AdminOrg.FullName, Equals, backup.Org.FullName)
+	for _, backupCatalog := range backup.Catalogs {
+		_, err = newOrg.GetAdminCatalogByName(backupCatalog.Catalog.Name, false)
+		check.Assert(err, IsNil)
+	}
+
+	err = newOrg.Delete(true, true)
+	check.Assert(err, IsNil)
+}
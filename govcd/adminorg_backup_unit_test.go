@@ -0,0 +1,119 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_NewOrgBackupFromJson(t *testing.T) {
+	backup := &OrgBackup{
+		SchemaVersion: OrgBackupSchemaVersion,
+		Org:           &types.AdminOrg{Name: "org1", FullName: "Org One"},
+		Roles:         []*OrgBackupRole{{Role: &types.Role{Name: "role1"}, Rights: []string{"right1", "right2"}}},
+		Users:         []*types.User{{Name: "user1", Role: &types.Reference{Name: "role1"}}},
+	}
+	data, err := backup.Json()
+	if err != nil {
+		t.Fatalf("unexpected error encoding backup: %s", err)
+	}
+	decoded, err := NewOrgBackupFromJson(data)
+	if err != nil {
+		t.Fatalf("unexpected error decoding backup: %s", err)
+	}
+	if decoded.Org.FullName != "Org One" || len(decoded.Roles) != 1 || len(decoded.Roles[0].Rights) != 2 ||
+		len(decoded.Users) != 1 || decoded.Users[0].Role.Name != "role1" {
+		t.Fatalf("backup was not preserved by the JSON round trip: %s", data)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "InvalidJson", data: "{"},
+		{name: "WrongVersion", data: `{"schemaVersion":"0.1","org":{"Name":"org1"}}`},
+		{name: "NoOrg", data: `{"schemaVersion":"` + OrgBackupSchemaVersion + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOrgBackupFromJson([]byte(tt.data))
+			if err == nil {
+				t.Errorf("expected error for %s", tt.data)
+			}
+		})
+	}
+}
+
+func Test_mappedName(t *testing.T) {
+	names := map[string]string{"pvdc-source": "pvdc-target", "empty": ""}
+	tests := map[string]string{
+		"pvdc-source": "pvdc-target",
+		"empty":       "empty",
+		"other":       "other",
+	}
+	for name, want := range tests {
+		if got := mappedName(names, name); got != want {
+			t.Errorf("mappedName(%s) = %s, want %s", name, got, want)
+		}
+	}
+	if got := mappedName(nil, "name"); got != "name" {
+		t.Errorf("mappedName with nil map = %s, want name", got)
+	}
+}
+
+func Test_restoredEmailSettings(t *testing.T) {
+	backupSettings := &types.OrgEmailSettings{
+		HREF:               "https://vcd.example.com/api/admin/org/1/settings/email",
+		FromEmailAddress:   "noreply@example.com",
+		SmtpServerSettings: &types.SmtpServerSettings{IsUseAuthentication: true, Host: "smtp.example.com", Username: "mailer"},
+	}
+
+	_, err := restoredEmailSettings(backupSettings, "")
+	if err == nil {
+		t.Errorf("expected error for SMTP authentication without password")
+	}
+	settings, err := restoredEmailSettings(backupSettings, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if settings.HREF != "" || settings.SmtpServerSettings.Password != "secret" || settings.SmtpServerSettings.Host != "smtp.example.com" {
+		t.Errorf("unexpected settings %+v, SMTP %+v", settings, settings.SmtpServerSettings)
+	}
+	if backupSettings.SmtpServerSettings.Password != "" {
+		t.Errorf("the backup settings were modified")
+	}
+
+	backupSettings.SmtpServerSettings.IsUseAuthentication = false
+	settings, err = restoredEmailSettings(backupSettings, "")
+	if err != nil || settings.SmtpServerSettings.Password != "" {
+		t.Errorf("unexpected result without SMTP authentication: %+v, %v", settings, err)
+	}
+}
+
+func Test_rightsDifference(t *testing.T) {
+	missing, extra := rightsDifference([]string{"Catalog: View", "vApp: Edit"}, []string{"vApp: Edit", "VDC: View"})
+	if !reflect.DeepEqual(missing, []string{"Catalog: View"}) || !reflect.DeepEqual(extra, []string{"VDC: View"}) {
+		t.Errorf("unexpected difference: missing %v, extra %v", missing, extra)
+	}
+	missing, extra = rightsDifference([]string{"vApp: Edit"}, []string{"vApp: Edit"})
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("expected no difference, got missing %v, extra %v", missing, extra)
+	}
+}
+
+func Test_capacityForCreation(t *testing.T) {
+	if capacityForCreation(nil) != nil {
+		t.Errorf("expected nil capacity")
+	}
+	got := capacityForCreation(&types.CapacityWithUsage{Units: "MHz", Allocated: 100, Limit: 200, Reserved: 50, Used: 10})
+	if got.Units != "MHz" || got.Allocated != 100 || got.Limit != 200 || got.Reserved != 50 || got.Used != 0 {
+		t.Errorf("unexpected capacity %+v", got)
+	}
+}
@@ -68,6 +68,14 @@ type Client struct {
 	// IgnoredMetadata allows to ignore metadata entries when using the methods defined in metadata_v2.go
 	IgnoredMetadata []IgnoredMetadata
 
+	// UploadSettings configure the parallelism and the bandwidth of file uploads
+	// Function `WithUploadSettings` contains more details
+	UploadSettings UploadSettings
+
+	// OvaVerifyOptions define how OVF packages are verified before upload
+	// Function `WithOvaVerification` contains more details
+	OvaVerifyOptions OvaVerifyOptions
+
 	supportedVersions SupportedVersions // Versions from /api/versions endpoint
 	customHeader      http.Header
 }
@@ -930,6 +938,19 @@ func (client *Client) buildUrl(elements ...string) (string, error) {
 	return url.JoinPath(baseUrl, elements...)
 }
 
+// hrefForRel returns the HREF of the link with the given relation, if the entity has it, or the
+// default HREF otherwise. The links of an entity retrieved before an operation may not reflect its
+// current state, so a missing link is not an error.
+func hrefForRel(links types.LinkList, rel, defaultHref string) string {
+	link := links.Find(func(link *types.Link) bool {
+		return link != nil && link.Rel == rel
+	})
+	if link != nil && link.HREF != "" {
+		return link.HREF
+	}
+	return defaultHref
+}
+
 // ---------------------------------------------------------------------
 // The following functions are needed to avoid strict Coverity warnings
 // ---------------------------------------------------------------------
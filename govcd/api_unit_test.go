@@ -0,0 +1,35 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_hrefForRel(t *testing.T) {
+	vmHref := "https://vcd.example.com/api/vApp/vm-1"
+	links := types.LinkList{
+		nil,
+		{Rel: types.RelScreenThumbnail},
+		{Rel: types.RelScreenAcquireTicket, HREF: "https://other.example.com/api/vApp/vm-1/screen/action/acquireTicket"},
+	}
+
+	href := hrefForRel(links, types.RelScreenAcquireTicket, vmHref+"/screen/action/acquireTicket")
+	if href != links[2].HREF {
+		t.Errorf("expected link HREF %s, got %s", links[2].HREF, href)
+	}
+	href = hrefForRel(links, types.RelScreenThumbnail, vmHref+"/screen")
+	if href != vmHref+"/screen" {
+		t.Errorf("expected default HREF for link without HREF, got %s", href)
+	}
+	href = hrefForRel(nil, types.RelScreenAcquireMksTicket, "")
+	if href != "" {
+		t.Errorf("expected empty default HREF, got %s", href)
+	}
+}
@@ -403,6 +403,32 @@ func WithIgnoredMetadata(ignoredMetadata []IgnoredMetadata) VCDClientOption {
 	}
 }
 
+// WithUploadSettings configures how OVF packages, media and Content Library Items are uploaded:
+// several files of an OVF package and several pieces of a file can be sent at the same time, which
+// improves the throughput on links with a high latency, and the bandwidth of each upload can be limited
+// so that uploads don't saturate shared links. Sending pieces of a file in parallel requires a transfer
+// service that accepts them out of order
+func WithUploadSettings(settings UploadSettings) VCDClientOption {
+	return func(vcdClient *VCDClient) error {
+		err := settings.validate()
+		if err != nil {
+			return err
+		}
+		vcdClient.Client.UploadSettings = settings
+		return nil
+	}
+}
+
+// WithOvaVerification configures how Catalog.UploadOvf verifies OVF packages before uploading them:
+// a manifest can be required, and a package can be required to be signed by a certificate chaining to
+// trusted certificates. Without this option, only the packages with a manifest are verified
+func WithOvaVerification(options OvaVerifyOptions) VCDClientOption {
+	return func(vcdClient *VCDClient) error {
+		vcdClient.Client.OvaVerifyOptions = options
+		return nil
+	}
+}
+
 // WithVcloudRequestIdFunc enables sending 'X-VMWARE-VCLOUD-CLIENT-REQUEST-ID' header by supplying a
 // function that will return unique value for each time it is executed. The code of this SDK will
 // make sure that the header is populated every time.
@@ -177,7 +177,34 @@ func (cat *Catalog) FindCatalogItem(catalogItemName string) (CatalogItem, error)
 // Returns errors if any occur during upload from vCD or upload process. On upload fail client may need to
 // remove vCD catalog item which waits for files to be uploaded. Files from ova are extracted to system
 // temp folder "govcd+random number" and left for inspection on error.
+// Before upload, the files are checked against the manifest of the package, as configured by WithOvaVerification
 func (cat *Catalog) UploadOvf(ovaFileName, itemName, description string, uploadPieceSize int64) (UploadTask, error) {
+	return cat.uploadOvf(ovaFileName, itemName, description, uploadPieceSize, nil, nil)
+}
+
+// UploadOvfWithEditors uploads an ova/ovf file to a catalog like UploadOvf, changing the OVF descriptor
+// with the editors before it is sent to vCD, for example to rename networks with RenameOvfNetwork, to
+// strip unsupported hardware with RemoveOvfHardware or to set property defaults with SetOvfPropertyDefaults.
+// The files of the package are checked against its manifest before the descriptor is changed
+func (cat *Catalog) UploadOvfWithEditors(ovaFileName, itemName, description string, uploadPieceSize int64, editors ...OvfDescriptorEditor) (UploadTask, error) {
+	return cat.uploadOvf(ovaFileName, itemName, description, uploadPieceSize, nil, editors)
+}
+
+// UploadOvfResumable uploads an ova/ovf file to a catalog like UploadOvf, recording the progress in
+// stateFile. When the upload fails, the catalog item is kept: calling UploadOvfResumable again with the
+// same arguments continues the upload from the bytes already received by vCD, even from another process.
+// The state file is removed once all files are uploaded
+func (cat *Catalog) UploadOvfResumable(ovaFileName, itemName, description string, uploadPieceSize int64, stateFile string) (UploadTask, error) {
+	state, err := LoadUploadState(stateFile)
+	if err != nil {
+		return UploadTask{}, err
+	}
+	return cat.uploadOvf(ovaFileName, itemName, description, uploadPieceSize, state, nil)
+}
+
+// uploadOvf uploads an ova/ovf file to a catalog. When state is not nil, the upload is resumable.
+// The editors change the OVF descriptor before it is uploaded
+func (cat *Catalog) uploadOvf(ovaFileName, itemName, description string, uploadPieceSize int64, state *UploadState, editors []OvfDescriptorEditor) (UploadTask, error) {
 
 	//	On a very high level the flow is as follows
 	//	1. Makes a POST call to vCD to create the catalog item (also creates a transfer folder in the spool area and as result will give a sparse catalog item resource XML).
@@ -194,9 +221,17 @@ func (cat *Catalog) UploadOvf(ovaFileName, itemName, description string, uploadP
 		return UploadTask{}, err
 	}
 
-	for _, catalogItemName := range getExistingCatalogItems(cat) {
-		if catalogItemName == itemName {
-			return UploadTask{}, fmt.Errorf("catalog item '%s' already exists. Upload with different name", itemName)
+	resuming := state != nil && state.IsStarted()
+	if resuming {
+		err = state.checkResumable(UploadKindVAppTemplate, itemName, ovaFileName)
+		if err != nil {
+			return UploadTask{}, err
+		}
+	} else {
+		for _, catalogItemName := range getExistingCatalogItems(cat) {
+			if catalogItemName == itemName {
+				return UploadTask{}, fmt.Errorf("catalog item '%s' already exists. Upload with different name", itemName)
+			}
 		}
 	}
 
@@ -244,36 +279,78 @@ func (cat *Catalog) UploadOvf(ovaFileName, itemName, description string, uploadP
 		}
 	}
 
-	catalogItemUploadURL, err := findCatalogItemUploadLink(cat, "application/vnd.vmware.vcloud.uploadVAppTemplateParams+xml")
+	err = verifyOvfDirectory(ovfFilePath, cat.client.OvaVerifyOptions)
 	if err != nil {
-		return UploadTask{}, err
+		return UploadTask{}, fmt.Errorf("%s. OVF/Unpacked files for checking are accessible in: %s", err, tmpDir)
 	}
 
-	vappTemplateUrl, err := createItemForUpload(cat.client, catalogItemUploadURL, itemName, description)
-	if err != nil {
-		return UploadTask{}, err
+	// The edited descriptor is uploaded instead of the file of the package
+	var editedDescriptor []byte
+	if len(editors) > 0 {
+		editedDescriptor, ovfFileDesc, err = editOvfFile(ovfFilePath, &ovfFileDesc, editors)
+		if err != nil {
+			return UploadTask{}, fmt.Errorf("%s. OVF/Unpacked files for checking are accessible in: %s", err, tmpDir)
+		}
 	}
 
-	vappTemplate, err := queryVappTemplateAndVerifyTask(cat.client, vappTemplateUrl, itemName)
-	if err != nil {
-		return UploadTask{}, err
+	var vappTemplateUrl *url.URL
+	if resuming {
+		vappTemplateUrl, err = url.ParseRequestURI(state.ItemHref)
+		if err != nil {
+			return UploadTask{}, fmt.Errorf("error parsing vApp template HREF of upload state: %s", err)
+		}
+	} else {
+		catalogItemUploadURL, err := findCatalogItemUploadLink(cat, "application/vnd.vmware.vcloud.uploadVAppTemplateParams+xml")
+		if err != nil {
+			return UploadTask{}, err
+		}
+
+		vappTemplateUrl, err = createItemForUpload(cat.client, catalogItemUploadURL, itemName, description)
+		if err != nil {
+			return UploadTask{}, err
+		}
+		if state != nil {
+			err = state.start(UploadKindVAppTemplate, itemName, vappTemplateUrl.String(), ovaFileName)
+			if err != nil {
+				return UploadTask{}, err
+			}
+		}
 	}
 
-	ovfUploadHref, err := getUploadLink(vappTemplate.Files)
-	if err != nil {
-		return UploadTask{}, err
+	// A resumable upload keeps the catalog item on failure, so that it can be resumed
+	removeOnError := func() {
+		if state == nil {
+			removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+		}
 	}
 
-	err = uploadOvfDescription(cat.client, ovfFilePath, ovfUploadHref)
+	vappTemplate, err := queryVappTemplateAndVerifyTask(cat.client, vappTemplateUrl, itemName)
 	if err != nil {
-		removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
 		return UploadTask{}, err
 	}
 
-	vappTemplate, err = waitForTempUploadLinks(cat.client, vappTemplateUrl, itemName)
-	if err != nil {
-		removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
-		return UploadTask{}, err
+	// The links to upload the files appear once the descriptor is uploaded
+	if vappTemplate.Files == nil || len(vappTemplate.Files.File) <= 1 {
+		ovfUploadHref, err := getUploadLink(vappTemplate.Files)
+		if err != nil {
+			return UploadTask{}, err
+		}
+
+		if editedDescriptor != nil {
+			err = uploadOvfDescriptionContent(cat.client, bytes.NewReader(editedDescriptor), ovfUploadHref)
+		} else {
+			err = uploadOvfDescription(cat.client, ovfFilePath, ovfUploadHref)
+		}
+		if err != nil {
+			removeOnError()
+			return UploadTask{}, err
+		}
+
+		vappTemplate, err = waitForTempUploadLinks(cat.client, vappTemplateUrl, itemName)
+		if err != nil {
+			removeOnError()
+			return UploadTask{}, err
+		}
 	}
 
 	progressCallBack, uploadProgress := getProgressCallBackFunction()
@@ -284,11 +361,15 @@ func (cat *Catalog) UploadOvf(ovaFileName, itemName, description string, uploadP
 	// The error should be captured in uploadError, but just in case, we add a logging for the
 	// main error
 	go func() {
-		err = uploadFiles(cat.client, vappTemplate, &ovfFileDesc, tmpDir, filesAbsPaths, uploadPieceSize, progressCallBack, &uploadError, isOvf)
+		err := uploadFiles(cat.client, vappTemplate, &ovfFileDesc, tmpDir, filesAbsPaths, uploadPieceSize, progressCallBack, &uploadError, isOvf, state)
 		if err != nil {
 			util.Logger.Println(strings.Repeat("*", 80))
 			util.Logger.Printf("*** [DEBUG - UploadOvf] error calling uploadFiles: %s\n", err)
 			util.Logger.Println(strings.Repeat("*", 80))
+			return
+		}
+		if state != nil {
+			state.complete()
 		}
 	}()
 
@@ -296,11 +377,11 @@ func (cat *Catalog) UploadOvf(ovaFileName, itemName, description string, uploadP
 	for _, item := range vappTemplate.Tasks.Task {
 		task, err = createTaskForVcdImport(cat.client, item.HREF)
 		if err != nil {
-			removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+			removeOnError()
 			return UploadTask{}, err
 		}
 		if task.Task.Status == "error" {
-			removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+			removeOnError()
 			return UploadTask{}, fmt.Errorf("task did not complete succesfully: %s", task.Task.Description)
 		}
 	}
@@ -419,57 +500,73 @@ func (cat *Catalog) CaptureVappTemplateAsync(captureParams *types.CaptureVAppPar
 // uploadPieceSize - size of chunks in which the file will be uploaded to the catalog.
 // callBack a function with signature //function(bytesUpload, totalSize) to let the caller monitor progress of the upload operation.
 // uploadError - error to be ready be task
-func uploadFiles(client *Client, vappTemplate *types.VAppTemplate, ovfFileDesc *Envelope, tempPath string, filesAbsPaths []string, uploadPieceSize int64, progressCallBack func(bytesUpload, totalSize int64), uploadError *error, isOvf bool) error {
-	var uploadedBytes int64
+// state - when not nil, the upload is resumable: files partially received by vCD are completed and the progress is recorded
+func uploadFiles(client *Client, vappTemplate *types.VAppTemplate, ovfFileDesc *Envelope, tempPath string, filesAbsPaths []string, uploadPieceSize int64, progressCallBack func(bytesUpload, totalSize int64), uploadError *error, isOvf bool, state *UploadState) error {
+	pieceRetries := 0
+	if state != nil {
+		pieceRetries = uploadPieceRetries
+	}
+	// The files are uploaded by parallel jobs, which share the progress and the bandwidth limit
+	progress := &uploadProgress{}
+	limiter := newBandwidthLimiter(client.UploadSettings.MaxBytesPerSecond)
+	var jobs []func() error
 	for _, item := range vappTemplate.Files.File {
-		if item.BytesTransferred == 0 {
+		resumed := state != nil && item.BytesTransferred > 0 && item.BytesTransferred < item.Size
+		if state != nil && item.BytesTransferred > 0 && !resumed {
+			if _, err := getFileFromDescription(item.Name, ovfFileDesc); err == nil {
+				progress.uploaded += item.BytesTransferred
+			}
+		}
+		if item.BytesTransferred == 0 || resumed {
 			number, err := getFileFromDescription(item.Name, ovfFileDesc)
 			if err != nil {
 				util.Logger.Printf("[Error] Error uploading files: %#v", err)
 				*uploadError = err
 				return err
 			}
+			fileOffset := int64(0)
+			if resumed {
+				fileOffset = state.resumeOffset(item.Name, item.BytesTransferred)
+			}
+			details := uploadDetails{
+				uploadLink:       item.Link[0].HREF,
+				uploadedBytes:    0,
+				fileSizeToUpload: item.Size,
+				uploadPieceSize:  uploadPieceSize,
+				allFilesSize:     getAllFileSizeSum(ovfFileDesc),
+				callBack:         progressCallBack,
+				uploadError:      new(error),
+				fileOffset:       fileOffset,
+				onProgress:       state.fileProgress(item.Name, item.Link[0].HREF, item.Size),
+				pieceRetries:     pieceRetries,
+				limiter:          limiter,
+				sharedProgress:   progress,
+			}
+			applyUploadSettings(client, &details)
 			if ovfFileDesc.File[number].ChunkSize != 0 {
 				chunkFilePaths := getChunkedFilePaths(tempPath, ovfFileDesc.File[number].HREF, ovfFileDesc.File[number].Size, ovfFileDesc.File[number].ChunkSize)
-				details := uploadDetails{
-					uploadLink:               item.Link[0].HREF,
-					uploadedBytes:            uploadedBytes,
-					fileSizeToUpload:         int64(ovfFileDesc.File[number].Size),
-					uploadPieceSize:          uploadPieceSize,
-					uploadedBytesForCallback: uploadedBytes,
-					allFilesSize:             getAllFileSizeSum(ovfFileDesc),
-					callBack:                 progressCallBack,
-					uploadError:              uploadError,
-				}
-				tempVar, err := uploadMultiPartFile(client, chunkFilePaths, details)
-				if err != nil {
-					util.Logger.Printf("[Error] Error uploading files: %#v", err)
-					*uploadError = err
+				details.fileSizeToUpload = int64(ovfFileDesc.File[number].Size)
+				jobs = append(jobs, func() error {
+					_, err := uploadMultiPartFile(client, chunkFilePaths, details)
 					return err
-				}
-				uploadedBytes += tempVar
+				})
 			} else {
-				details := uploadDetails{
-					uploadLink:               item.Link[0].HREF,
-					uploadedBytes:            0,
-					fileSizeToUpload:         item.Size,
-					uploadPieceSize:          uploadPieceSize,
-					uploadedBytesForCallback: uploadedBytes,
-					allFilesSize:             getAllFileSizeSum(ovfFileDesc),
-					callBack:                 progressCallBack,
-					uploadError:              uploadError,
-				}
-				tempVar, err := uploadFile(client, findFilePath(filesAbsPaths, item.Name), details)
-				if err != nil {
-					util.Logger.Printf("[Error] Error uploading files: %#v", err)
-					*uploadError = err
+				filePath := findFilePath(filesAbsPaths, item.Name)
+				jobs = append(jobs, func() error {
+					_, err := uploadFile(client, filePath, details)
 					return err
-				}
-				uploadedBytes += tempVar
+				})
 			}
 		}
 	}
 
+	err := runParallel(client.UploadSettings.ParallelFiles, jobs)
+	if err != nil {
+		util.Logger.Printf("[Error] Error uploading files: %#v", err)
+		*uploadError = err
+		return err
+	}
+
 	//remove extracted files with temp dir
 	//If isOvf flag is true, means tempPath is origin OVF folder, not extracted, won't delete
 	if !isOvf {
@@ -512,11 +609,14 @@ func uploadMultiPartFile(client *Client, filePaths []string, uDetails uploadDeta
 	util.Logger.Printf("[TRACE] Upload multi part file: %v\n, href: %s, size: %v", filePaths, uDetails.uploadLink, uDetails.fileSizeToUpload)
 
 	var uploadedBytes int64
+	// when resuming, the chunks already received are skipped
+	resumeOffset := uDetails.fileOffset
 
 	for i, filePath := range filePaths {
 		util.Logger.Printf("[TRACE] Uploading file: %v\n", i+1)
 		uDetails.uploadedBytesForCallback += uploadedBytes // previous files uploaded size plus current upload size
 		uDetails.uploadedBytes = uploadedBytes
+		uDetails.fileOffset = max(resumeOffset-uploadedBytes, 0)
 		tempVar, err := uploadFile(client, filePath, uDetails)
 		if err != nil {
 			return uploadedBytes, err
@@ -591,14 +691,9 @@ func uploadOvfDescription(client *Client, ovfFile string, ovfUploadUrl *url.URL)
 		return err
 	}
 
-	var buf bytes.Buffer
-	ovfReader := io.TeeReader(openedFile, &buf)
-
-	request := client.NewRequest(map[string]string{}, http.MethodPut, *ovfUploadUrl, ovfReader)
-	request.Header.Add("Content-Type", "text/xml")
-
-	_, err = checkResp(client.Http.Do(request))
+	err = uploadOvfDescriptionContent(client, openedFile, ovfUploadUrl)
 	if err != nil {
+		safeClose(openedFile)
 		return err
 	}
 
@@ -611,6 +706,15 @@ func uploadOvfDescription(client *Client, ovfFile string, ovfUploadUrl *url.URL)
 	return nil
 }
 
+// uploadOvfDescriptionContent uploads the ovf description read from the reader
+func uploadOvfDescriptionContent(client *Client, ovfReader io.Reader, ovfUploadUrl *url.URL) error {
+	request := client.NewRequest(map[string]string{}, http.MethodPut, *ovfUploadUrl, ovfReader)
+	request.Header.Add("Content-Type", "text/xml")
+
+	_, err := checkResp(client.Http.Do(request))
+	return err
+}
+
 func parseOvfFileDesc(file *os.File, ovfFileDesc *Envelope) error {
 	ovfXml, err := io.ReadAll(file)
 	if err != nil {
@@ -882,9 +986,26 @@ func (cat *Catalog) UploadMediaImage(mediaName, mediaDescription, filePath strin
 	return cat.UploadMediaFile(mediaName, mediaDescription, filePath, uploadPieceSize, true)
 }
 
+// UploadMediaImageResumable uploads a media image to the catalog like UploadMediaImage, recording the
+// progress in stateFile. When the upload fails, the media is kept: calling UploadMediaImageResumable again
+// with the same arguments continues the upload from the bytes already received by vCD, even from another
+// process. The state file is removed once the image is uploaded
+func (cat *Catalog) UploadMediaImageResumable(mediaName, mediaDescription, filePath string, uploadPieceSize int64, stateFile string) (UploadTask, error) {
+	state, err := LoadUploadState(stateFile)
+	if err != nil {
+		return UploadTask{}, err
+	}
+	return cat.uploadMediaFile(mediaName, mediaDescription, filePath, uploadPieceSize, true, state)
+}
+
 // UploadMediaFile uploads any file to the catalog.
 // However, if checkFileIsIso is true, only .ISO are allowed.
 func (cat *Catalog) UploadMediaFile(fileName, mediaDescription, filePath string, uploadPieceSize int64, checkFileIsIso bool) (UploadTask, error) {
+	return cat.uploadMediaFile(fileName, mediaDescription, filePath, uploadPieceSize, checkFileIsIso, nil)
+}
+
+// uploadMediaFile uploads a file to the catalog. When state is not nil, the upload is resumable
+func (cat *Catalog) uploadMediaFile(fileName, mediaDescription, filePath string, uploadPieceSize int64, checkFileIsIso bool, state *UploadState) (UploadTask, error) {
 
 	if *cat == (Catalog{}) {
 		return UploadTask{}, errors.New("catalog can not be empty or nil")
@@ -908,6 +1029,21 @@ func (cat *Catalog) UploadMediaFile(fileName, mediaDescription, filePath string,
 	}
 	fileSize := file.Size()
 
+	if state != nil && state.IsStarted() {
+		err = state.checkResumable(UploadKindMedia, fileName, mediaFilePath)
+		if err != nil {
+			return UploadTask{}, err
+		}
+		createdMedia, err := queryMedia(cat.client, state.ItemHref, fileName)
+		if err != nil {
+			return UploadTask{}, err
+		}
+		if createdMedia.Tasks == nil || createdMedia.Files == nil || len(createdMedia.Files.File) == 0 {
+			return UploadTask{}, fmt.Errorf("the upload of media '%s' can't be resumed: vCD is not waiting for its file any more", fileName)
+		}
+		return executeUpload(cat.client, createdMedia, mediaFilePath, fileName, fileSize, uploadPieceSize, state)
+	}
+
 	for _, catalogItemName := range getExistingCatalogItems(cat) {
 		if catalogItemName == fileName {
 			return UploadTask{}, fmt.Errorf("media item '%s' already exists. Upload with different name", fileName)
@@ -928,8 +1064,14 @@ func (cat *Catalog) UploadMediaFile(fileName, mediaDescription, filePath string,
 	if err != nil {
 		return UploadTask{}, err
 	}
+	if state != nil {
+		err = state.start(UploadKindMedia, fileName, createdMedia.HREF, mediaFilePath)
+		if err != nil {
+			return UploadTask{}, err
+		}
+	}
 
-	return executeUpload(cat.client, createdMedia, mediaFilePath, fileName, fileSize, uploadPieceSize)
+	return executeUpload(cat.client, createdMedia, mediaFilePath, fileName, fileSize, uploadPieceSize, state)
 }
 
 // Refresh gets a fresh copy of the catalog from vCD
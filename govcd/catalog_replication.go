@@ -0,0 +1,626 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// DefaultCatalogReplicationChecksumKey is the metadata key holding the checksum of catalog items,
+// used by CatalogReplicator when CatalogReplicationOptions.ChecksumMetadataKey is not set
+const DefaultCatalogReplicationChecksumKey = "checksum.sha256"
+
+// CatalogReplicationAction is what a CatalogReplicator did, or would do in a dry run, with an item
+// of the source catalog
+type CatalogReplicationAction string
+
+const (
+	// CatalogReplicationCreated is set for items missing from the target catalog, which are copied
+	CatalogReplicationCreated CatalogReplicationAction = "created"
+	// CatalogReplicationReplaced is set for items whose checksum differs in the target catalog, and
+	// for target items without checksum, such as partial copies. The item is copied under a temporary
+	// name, which replaces the target item once the copy is complete
+	CatalogReplicationReplaced CatalogReplicationAction = "replaced"
+	// CatalogReplicationUnchanged is set for items with the same checksum in both catalogs
+	CatalogReplicationUnchanged CatalogReplicationAction = "unchanged"
+	// CatalogReplicationUnverified is set for items present in both catalogs which can't be compared,
+	// because the source item has no checksum while the target item has one, recorded when it was
+	// copied. They are left unchanged
+	CatalogReplicationUnverified CatalogReplicationAction = "unverified"
+	// CatalogReplicationFailed is set for items which could not be compared or copied
+	CatalogReplicationFailed CatalogReplicationAction = "failed"
+)
+
+// CatalogReplicationOptions defines how a CatalogReplicator compares and copies catalog items
+type CatalogReplicationOptions struct {
+	// ChecksumMetadataKey is the metadata key of the checksum of the items. Defaults to
+	// DefaultCatalogReplicationChecksumKey. Checksums are compared as opaque values
+	ChecksumMetadataKey string
+	// ComputeChecksums downloads the source items without checksum metadata to compute their
+	// checksum (the SHA-256 of the media, or of the OVA archive of vApp templates), instead of
+	// reporting them as unverified when they are present in the target catalog
+	ComputeChecksums bool
+	// ItemNames restricts the replication to the items with these names. All the vApp templates and
+	// media items are replicated when it is empty
+	ItemNames []string
+	// DryRun compares the catalogs and fills the report without changing the target catalog
+	DryRun bool
+	// UploadPieceSize is the size of the parts of the files uploaded to the target. Defaults to 1MB
+	UploadPieceSize int64
+}
+
+// CatalogReplicationItem is an entry of the replication report
+type CatalogReplicationItem struct {
+	// Kind is types.QtVappTemplate or types.QtMedia
+	Kind   string                   `json:"kind"`
+	Name   string                   `json:"name"`
+	Action CatalogReplicationAction `json:"action"`
+	// Checksum is the checksum of the source item, from its metadata or computed while it is copied
+	Checksum string `json:"checksum,omitempty"`
+	// TransferredBytes is the number of bytes streamed from the source to the target catalog
+	TransferredBytes int64 `json:"transferredBytes,omitempty"`
+	// MetadataUpdated is set when metadata entries of the source item were merged into the target one
+	MetadataUpdated bool   `json:"metadataUpdated,omitempty"`
+	Message         string `json:"message,omitempty"`
+}
+
+// CatalogReplicationReport describes the result of a replication
+type CatalogReplicationReport struct {
+	SourceVcdHref string                   `json:"sourceVcdHref"`
+	SourceCatalog string                   `json:"sourceCatalog"`
+	TargetVcdHref string                   `json:"targetVcdHref"`
+	TargetCatalog string                   `json:"targetCatalog"`
+	DryRun        bool                     `json:"dryRun,omitempty"`
+	StartedAt     time.Time                `json:"startedAt"`
+	FinishedAt    time.Time                `json:"finishedAt"`
+	Items         []CatalogReplicationItem `json:"items,omitempty"`
+}
+
+// Count returns the number of items of the report with the given action
+func (report *CatalogReplicationReport) Count(action CatalogReplicationAction) int {
+	count := 0
+	for _, item := range report.Items {
+		if item.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// CatalogReplicator pushes the vApp templates and media items of a catalog to another catalog, which
+// can belong to another organization or to another VCD reached with a different VCDClient. Unlike
+// catalog subscriptions, the source catalog doesn't need to be published and the two VCDs don't need
+// to reach each other: the content is downloaded from the source and uploaded to the target by the
+// client, streaming it without storing it on disk
+type CatalogReplicator struct {
+	source  *Catalog
+	target  *Catalog
+	options CatalogReplicationOptions
+}
+
+// NewCatalogReplicator returns a replicator from the source to the target catalog. options can be nil
+func NewCatalogReplicator(source, target *Catalog, options *CatalogReplicationOptions) (*CatalogReplicator, error) {
+	if source == nil || source.Catalog == nil || target == nil || target.Catalog == nil {
+		return nil, fmt.Errorf("the source and target catalogs can not be empty or nil")
+	}
+	if source.client.VCDHREF.String() == target.client.VCDHREF.String() && source.Catalog.ID == target.Catalog.ID {
+		return nil, fmt.Errorf("the source and target catalogs are the same catalog '%s'", source.Catalog.Name)
+	}
+	replicator := &CatalogReplicator{source: source, target: target}
+	if options != nil {
+		replicator.options = *options
+	}
+	if replicator.options.ChecksumMetadataKey == "" {
+		replicator.options.ChecksumMetadataKey = DefaultCatalogReplicationChecksumKey
+	}
+	if replicator.options.UploadPieceSize <= 0 {
+		replicator.options.UploadPieceSize = 1024 * 1024
+	}
+	return replicator, nil
+}
+
+// Replicate compares the items of the source and target catalogs by name and checksum metadata, then
+// copies the vApp templates and media items which are missing or changed in the target catalog,
+// followed by their metadata. Changed items are copied under a temporary name, and replace the target
+// items only once the copy is complete. The metadata entries of unchanged items are merged into the target items when they differ.
+// Entries of the SYSTEM domain are carried over only when the target client is System Administrator.
+// When the source item has no checksum metadata, the SHA-256 of the copied content is stored in the
+// metadata of the target item.
+// The replication does not stop at the first failure: items which can't be compared or copied are
+// reported with the reason. An error is returned only when the catalogs can't be listed, or when the
+// context is cancelled, together with the report of the items processed so far
+func (replicator *CatalogReplicator) Replicate(ctx context.Context) (*CatalogReplicationReport, error) {
+	report := &CatalogReplicationReport{
+		SourceVcdHref: replicator.source.client.VCDHREF.String(),
+		SourceCatalog: replicator.source.Catalog.Name,
+		TargetVcdHref: replicator.target.client.VCDHREF.String(),
+		TargetCatalog: replicator.target.Catalog.Name,
+		DryRun:        replicator.options.DryRun,
+		StartedAt:     time.Now().UTC(),
+	}
+	defer func() { report.FinishedAt = time.Now().UTC() }()
+
+	sourceItems, err := replicatedCatalogItems(replicator.source)
+	if err != nil {
+		return report, fmt.Errorf("error listing items of source catalog '%s': %s", replicator.source.Catalog.Name, err)
+	}
+	targetItems, err := replicatedCatalogItems(replicator.target)
+	if err != nil {
+		return report, fmt.Errorf("error listing items of target catalog '%s': %s", replicator.target.Catalog.Name, err)
+	}
+
+	names := slices.Sorted(maps.Keys(sourceItems))
+	for _, name := range names {
+		if len(replicator.options.ItemNames) > 0 && !slices.Contains(replicator.options.ItemNames, name) {
+			continue
+		}
+		sourceItem := sourceItems[name]
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		item := replicator.replicateItem(ctx, sourceItem, targetItems[sourceItem.Name])
+		util.Logger.Printf("[TRACE] catalog replication of %s '%s': %s %s", item.Kind, item.Name, item.Action, item.Message)
+		report.Items = append(report.Items, item)
+	}
+	return report, nil
+}
+
+// replicatedCatalogItems returns the vApp templates and media items of a catalog, by name
+func replicatedCatalogItems(catalog *Catalog) (map[string]*types.QueryResultCatalogItemType, error) {
+	records, err := catalog.QueryCatalogItemList()
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*types.QueryResultCatalogItemType)
+	for _, record := range records {
+		if replicatedItemKind(record.EntityType) != "" {
+			items[record.Name] = record
+		}
+	}
+	return items, nil
+}
+
+// replicatedItemKind returns the kind of the entity of a catalog item, or an empty string when the
+// entity can't be replicated
+func replicatedItemKind(entityType string) string {
+	for _, kind := range []string{types.QtVappTemplate, types.QtMedia} {
+		if strings.EqualFold(entityType, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// replicateItem compares an item of the source catalog with the item of the same name in the target
+// catalog, which is nil when missing, and copies it when needed
+func (replicator *CatalogReplicator) replicateItem(ctx context.Context, sourceRecord, targetRecord *types.QueryResultCatalogItemType) CatalogReplicationItem {
+	kind := replicatedItemKind(sourceRecord.EntityType)
+	item := CatalogReplicationItem{Kind: kind, Name: sourceRecord.Name}
+	fail := func(format string, args ...any) CatalogReplicationItem {
+		item.Action = CatalogReplicationFailed
+		item.Message = fmt.Sprintf(format, args...)
+		return item
+	}
+
+	source, err := getReplicatedEntity(ctx, replicator.source, kind, sourceRecord.Name)
+	if err != nil {
+		return fail("error retrieving source item: %s", err)
+	}
+	item.Checksum = metadataEntryValue(source.metadata, replicator.options.ChecksumMetadataKey)
+
+	var target *replicatedEntity
+	if targetRecord != nil {
+		targetKind := replicatedItemKind(targetRecord.EntityType)
+		target, err = getReplicatedEntity(ctx, replicator.target, targetKind, targetRecord.Name)
+		if err != nil {
+			return fail("error retrieving target item: %s", err)
+		}
+		if item.Checksum == "" && replicator.options.ComputeChecksums {
+			item.Checksum, _, err = copyCatalogItemContent(source.download, func(reader io.Reader) error {
+				_, err := io.Copy(io.Discard, reader)
+				return err
+			})
+			if err != nil {
+				return fail("error computing checksum of source item: %s", err)
+			}
+		}
+		targetChecksum := metadataEntryValue(target.metadata, replicator.options.ChecksumMetadataKey)
+		item.Action = catalogReplicationAction(item.Checksum, targetChecksum, kind == targetKind)
+	} else {
+		item.Action = CatalogReplicationCreated
+	}
+
+	if replicator.options.DryRun {
+		return item
+	}
+
+	if item.Action == CatalogReplicationUnchanged || item.Action == CatalogReplicationUnverified {
+		item.MetadataUpdated, err = replicator.mergeMetadata(source, target, "")
+		if err != nil {
+			item.Message = fmt.Sprintf("error merging metadata: %s", err)
+		}
+		return item
+	}
+
+	// A changed item is kept until its new copy is complete
+	copyName := source.name
+	if item.Action == CatalogReplicationReplaced {
+		copyName = source.name + catalogReplicationSuffix
+		err = replicator.deleteTargetItem(copyName)
+		if err != nil {
+			return fail("error deleting previous copy '%s' from target catalog: %s", copyName, err)
+		}
+	}
+	checksum, size, err := copyCatalogItemContent(source.download, replicator.uploadFunction(ctx, source, copyName))
+	item.TransferredBytes = size
+	if err != nil {
+		return fail("error copying item: %s", err)
+	}
+	if item.Action == CatalogReplicationReplaced {
+		err = replicator.swapTargetItem(ctx, kind, copyName, source.name)
+		if err != nil {
+			return fail("error replacing changed item with its copy '%s': %s", copyName, err)
+		}
+	}
+	stampedChecksum := ""
+	if item.Checksum == "" {
+		item.Checksum = checksum
+		stampedChecksum = checksum
+	}
+
+	target, err = getReplicatedEntity(ctx, replicator.target, kind, source.name)
+	if err != nil {
+		item.Message = fmt.Sprintf("error retrieving copied item: %s", err)
+		return item
+	}
+	item.MetadataUpdated, err = replicator.mergeMetadata(source, target, stampedChecksum)
+	if err != nil {
+		item.Message = fmt.Sprintf("error merging metadata: %s", err)
+	}
+	return item
+}
+
+// catalogReplicationAction returns the action for an item present in both catalogs
+func catalogReplicationAction(sourceChecksum, targetChecksum string, sameKind bool) CatalogReplicationAction {
+	switch {
+	case !sameKind:
+		return CatalogReplicationReplaced
+	case sourceChecksum == "" && targetChecksum == "":
+		// The target item was not copied completely by the replicator, or not copied by it at all
+		return CatalogReplicationReplaced
+	case sourceChecksum == "":
+		return CatalogReplicationUnverified
+	case strings.EqualFold(sourceChecksum, targetChecksum):
+		return CatalogReplicationUnchanged
+	default:
+		return CatalogReplicationReplaced
+	}
+}
+
+// catalogReplicationSuffix is appended to the name of the copies of changed items, until they replace
+// the target items
+const catalogReplicationSuffix = ".replicating"
+
+// deleteTargetItem deletes an item of the target catalog when it exists, and refreshes the catalog so
+// that an item with the same name can be uploaded
+func (replicator *CatalogReplicator) deleteTargetItem(name string) error {
+	catalogItem, err := replicator.target.GetCatalogItemByName(name, true)
+	if ContainsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = catalogItem.Delete()
+	if err != nil {
+		return err
+	}
+	return replicator.target.Refresh()
+}
+
+// swapTargetItem deletes an item of the target catalog and gives its name to the complete copy
+func (replicator *CatalogReplicator) swapTargetItem(ctx context.Context, kind, copyName, name string) error {
+	err := replicator.deleteTargetItem(name)
+	if err != nil {
+		return fmt.Errorf("error deleting changed item: %s", err)
+	}
+	copied, err := getReplicatedEntity(ctx, replicator.target, kind, copyName)
+	if err != nil {
+		return err
+	}
+	err = copied.rename(name)
+	if err != nil {
+		return err
+	}
+	return replicator.target.Refresh()
+}
+
+// replicationTaskInterval is the interval between two checks of the import task of a copied item
+var replicationTaskInterval = 3 * time.Second
+
+// uploadFunction returns the function uploading the content of the source entity to the target
+// catalog, and waiting for the end of the import. When the upload fails or the context is cancelled,
+// the import task is cancelled and the partial item is removed from the target catalog
+func (replicator *CatalogReplicator) uploadFunction(ctx context.Context, source *replicatedEntity, name string) func(io.Reader) error {
+	return func(reader io.Reader) error {
+		var uploadTask UploadTask
+		var err error
+		if source.kind == types.QtMedia {
+			uploadTask, err = replicator.target.UploadMediaFromReader(name, source.description, reader, source.size,
+				replicator.options.UploadPieceSize, false)
+		} else {
+			uploadTask, err = replicator.target.UploadOvfFromReader(reader, name, source.description,
+				replicator.options.UploadPieceSize)
+		}
+		if err != nil {
+			return err
+		}
+		err = waitReplicationUpload(ctx, &uploadTask)
+		if err != nil {
+			return replicator.removeFailedCopy(&uploadTask, name, err)
+		}
+		return nil
+	}
+}
+
+// waitReplicationUpload waits for the import task of an upload. Unlike UploadTask.WaitTaskCompletion,
+// it returns as soon as the upload of the content fails or the context is cancelled
+func waitReplicationUpload(ctx context.Context, uploadTask *UploadTask) error {
+	for {
+		err := uploadTask.GetUploadError()
+		if err != nil {
+			return err
+		}
+		err = uploadTask.Refresh()
+		if err != nil {
+			return err
+		}
+		switch status := uploadTask.Task.Task.Status; status {
+		case "success":
+			return uploadTask.GetUploadError()
+		case "error", "aborted", "canceled":
+			message := ""
+			if uploadTask.Task.Task.Error != nil {
+				message = uploadTask.Task.Task.Error.Message
+			}
+			return fmt.Errorf("import task ended with status '%s': %s", status, message)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(replicationTaskInterval):
+		}
+	}
+}
+
+// removeFailedCopy cancels the import task of a failed copy and removes the partial item from the
+// target catalog. It returns the error of the copy, with the reason why the item was not removed
+func (replicator *CatalogReplicator) removeFailedCopy(uploadTask *UploadTask, name string, copyErr error) error {
+	err := uploadTask.CancelTask()
+	if err != nil {
+		util.Logger.Printf("[WARN] error cancelling import of '%s': %s", name, err)
+	}
+	catalogItem, err := replicator.target.GetCatalogItemByName(name, true)
+	if ContainsNotFound(err) {
+		return copyErr
+	}
+	if err == nil {
+		err = catalogItem.Delete()
+	}
+	if err != nil {
+		return fmt.Errorf("%s; the partial item '%s' could not be removed: %s", copyErr, name, err)
+	}
+	err = replicator.target.Refresh()
+	if err != nil {
+		util.Logger.Printf("[WARN] error refreshing target catalog: %s", err)
+	}
+	return copyErr
+}
+
+// mergeMetadata merges into the target entity the metadata entries of the source entity which are
+// missing or different, together with the checksum when it is not empty. It returns whether
+// entries were merged
+func (replicator *CatalogReplicator) mergeMetadata(source, target *replicatedEntity, checksum string) (bool, error) {
+	metadata := replicatedMetadata(source.metadata, target.metadata, replicator.target.client.IsSysAdmin)
+	if checksum != "" {
+		metadata[replicator.options.ChecksumMetadataKey] = types.MetadataValue{
+			Domain:     &types.MetadataDomainTag{Visibility: types.MetadataReadWriteVisibility, Domain: "GENERAL"},
+			TypedValue: &types.MetadataTypedValue{XsiType: types.MetadataStringValue, Value: checksum},
+		}
+	}
+	if len(metadata) == 0 {
+		return false, nil
+	}
+	err := target.merge(metadata)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// replicatedMetadata returns the source entries which are missing or different in the target entries.
+// Entries of the SYSTEM domain are included only when withSystem is set
+func replicatedMetadata(source, target []*types.MetadataEntry, withSystem bool) map[string]types.MetadataValue {
+	metadata := make(map[string]types.MetadataValue)
+	for _, entry := range source {
+		if entry == nil || entry.TypedValue == nil {
+			continue
+		}
+		if isSystemMetadataEntry(entry) && !withSystem {
+			continue
+		}
+		index := slices.IndexFunc(target, func(existing *types.MetadataEntry) bool {
+			return existing != nil && existing.Key == entry.Key && isSystemMetadataEntry(existing) == isSystemMetadataEntry(entry)
+		})
+		if index >= 0 && target[index].TypedValue != nil && *target[index].TypedValue == *entry.TypedValue &&
+			metadataVisibility(target[index]) == metadataVisibility(entry) {
+			continue
+		}
+		metadata[entry.Key] = types.MetadataValue{Domain: entry.Domain, TypedValue: entry.TypedValue}
+	}
+	return metadata
+}
+
+func isSystemMetadataEntry(entry *types.MetadataEntry) bool {
+	return entry.Domain != nil && entry.Domain.Domain == "SYSTEM"
+}
+
+func metadataVisibility(entry *types.MetadataEntry) string {
+	if entry.Domain == nil {
+		return ""
+	}
+	return entry.Domain.Visibility
+}
+
+// metadataEntryValue returns the value of the GENERAL metadata entry with the given key, or an empty
+// string when it is missing
+func metadataEntryValue(entries []*types.MetadataEntry, key string) string {
+	for _, entry := range entries {
+		if entry != nil && entry.Key == key && !isSystemMetadataEntry(entry) && entry.TypedValue != nil {
+			return entry.TypedValue.Value
+		}
+	}
+	return ""
+}
+
+// copyCatalogItemContent streams the content written by download to upload through a pipe, and
+// returns the hex-encoded SHA-256 of the content and its size
+func copyCatalogItemContent(download func(io.Writer) error, upload func(io.Reader) error) (string, int64, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	downloaded := make(chan error, 1)
+	go func() {
+		err := download(pipeWriter)
+		// A nil error makes the reader receive io.EOF
+		pipeWriter.CloseWithError(err)
+		downloaded <- err
+	}()
+
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	reader := io.TeeReader(pipeReader, io.MultiWriter(hasher, counter))
+	uploadErr := upload(reader)
+	if uploadErr == nil {
+		// The upload can end before the stream, such as the padding at the end of an OVA archive
+		_, uploadErr = io.Copy(io.Discard, reader)
+	}
+	// Unblocks the download when the upload stopped before the end of the stream
+	_ = pipeReader.Close()
+	downloadErr := <-downloaded
+
+	if downloadErr != nil && !errors.Is(downloadErr, io.ErrClosedPipe) {
+		return "", counter.written, fmt.Errorf("error downloading: %s", downloadErr)
+	}
+	if uploadErr != nil {
+		return "", counter.written, fmt.Errorf("error uploading: %s", uploadErr)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), counter.written, nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	written int64
+}
+
+func (writer *countingWriter) Write(content []byte) (int, error) {
+	writer.written += int64(len(content))
+	return len(content), nil
+}
+
+// replicatedEntity is a vApp template or a media item of a catalog
+type replicatedEntity struct {
+	kind        string
+	name        string
+	description string
+	// size is the size of media items
+	size     int64
+	metadata []*types.MetadataEntry
+	download func(io.Writer) error
+	merge    func(map[string]types.MetadataValue) error
+	rename   func(name string) error
+}
+
+// getReplicatedEntity retrieves the vApp template or the media item of a catalog with its metadata
+func getReplicatedEntity(ctx context.Context, catalog *Catalog, kind, name string) (*replicatedEntity, error) {
+	var entity *replicatedEntity
+	var metadata *types.Metadata
+	var err error
+	switch kind {
+	case types.QtVappTemplate:
+		var vAppTemplate *VAppTemplate
+		vAppTemplate, err = catalog.GetVAppTemplateByName(name)
+		if err != nil {
+			return nil, err
+		}
+		entity = &replicatedEntity{
+			kind:        kind,
+			name:        vAppTemplate.VAppTemplate.Name,
+			description: vAppTemplate.VAppTemplate.Description,
+			download:    func(writer io.Writer) error { return vAppTemplate.DownloadOvaContext(ctx, writer) },
+			merge:       vAppTemplate.MergeMetadataWithMetadataValues,
+			rename: func(name string) error {
+				vAppTemplate.VAppTemplate.Name = name
+				_, err := vAppTemplate.Update()
+				return err
+			},
+		}
+		metadata, err = vAppTemplate.GetMetadata()
+	case types.QtMedia:
+		var media *Media
+		media, err = catalog.GetMediaByName(name, true)
+		if err != nil {
+			return nil, err
+		}
+		entity = &replicatedEntity{
+			kind:        kind,
+			name:        media.Media.Name,
+			description: media.Media.Description,
+			size:        media.Media.Size,
+			download: func(writer io.Writer) error {
+				_, err := media.DownloadTo(ctx, writer, nil)
+				return err
+			},
+			merge:  media.MergeMetadataWithMetadataValues,
+			rename: func(name string) error { return renameMedia(media, name) },
+		}
+		metadata, err = media.GetMetadata()
+	default:
+		return nil, fmt.Errorf("unsupported catalog item type '%s'", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving metadata of %s '%s': %s", kind, name, err)
+	}
+	entity.metadata = metadata.MetadataEntry
+	return entity, nil
+}
+
+// renameMedia changes the name of a media item
+func renameMedia(media *Media, name string) error {
+	payload := struct {
+		XMLName     xml.Name `xml:"Media"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		Name        string   `xml:"name,attr"`
+		Description string   `xml:"Description,omitempty"`
+	}{Xmlns: types.XMLNamespaceVCloud, Name: name, Description: media.Media.Description}
+	task, err := media.client.ExecuteTaskRequest(media.Media.HREF, http.MethodPut, types.MimeMediaItem,
+		"error renaming media: %s", payload)
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
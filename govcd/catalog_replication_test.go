@@ -0,0 +1,98 @@
+//go:build catalog || functional || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	. "gopkg.in/check.v1"
+)
+
+// Tests CatalogReplicator by replicating a media item between two catalogs of the organization
+func (vcd *TestVCD) Test_CatalogReplicator(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	org := getOrg(vcd, check)
+	catalogs := make([]*Catalog, 2)
+	for idx, catalogName := range []string{check.TestName() + "-source", check.TestName() + "-target"} {
+		adminCatalog, err := org.CreateCatalog(catalogName, catalogName)
+		check.Assert(err, IsNil)
+		AddToCleanupList(catalogName, "catalog", vcd.config.VCD.Org, check.TestName())
+		defer func() {
+			err := adminCatalog.Delete(true, true)
+			check.Assert(err, IsNil)
+		}()
+		catalogs[idx], err = org.GetCatalogByName(catalogName, true)
+		check.Assert(err, IsNil)
+	}
+	source, target := catalogs[0], catalogs[1]
+
+	itemName := check.TestName()
+	uploadTask, err := source.UploadMediaFromFiles(itemName, "replication source", map[string][]byte{
+		"meta-data": []byte("instance-id: " + itemName + "\n"),
+	}, IsoImageOptions{VolumeIdentifier: "cidata"}, 1024*1024)
+	check.Assert(err, IsNil)
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	sourceMedia, err := source.GetMediaByName(itemName, true)
+	check.Assert(err, IsNil)
+	err = sourceMedia.AddMetadataEntryWithVisibility("owner", "replication", types.MetadataStringValue, types.MetadataReadWriteVisibility, false)
+	check.Assert(err, IsNil)
+
+	replicator, err := NewCatalogReplicator(source, target, &CatalogReplicationOptions{DryRun: true})
+	check.Assert(err, IsNil)
+	report, err := replicator.Replicate(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(report.Items, HasLen, 1)
+	check.Assert(report.Items[0].Action, Equals, CatalogReplicationCreated)
+	_, err = target.GetMediaByName(itemName, true)
+	check.Assert(ContainsNotFound(err), Equals, true)
+
+	replicator, err = NewCatalogReplicator(source, target, nil)
+	check.Assert(err, IsNil)
+	report, err = replicator.Replicate(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(report.Items, HasLen, 1)
+	item := report.Items[0]
+	check.Assert(item.Action, Equals, CatalogReplicationCreated)
+	check.Assert(item.Message, Equals, "")
+	check.Assert(item.TransferredBytes, Equals, sourceMedia.Media.Size)
+
+	targetMedia, err := target.GetMediaByName(itemName, true)
+	check.Assert(err, IsNil)
+	value, err := targetMedia.GetMetadataByKey("owner", false)
+	check.Assert(err, IsNil)
+	check.Assert(value.TypedValue.Value, Equals, "replication")
+	value, err = targetMedia.GetMetadataByKey(DefaultCatalogReplicationChecksumKey, false)
+	check.Assert(err, IsNil)
+	check.Assert(value.TypedValue.Value, Equals, item.Checksum)
+
+	// Without checksum on the source item, the items can only be compared by computing it
+	report, err = replicator.Replicate(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(report.Items[0].Action, Equals, CatalogReplicationUnverified)
+	replicator, err = NewCatalogReplicator(source, target, &CatalogReplicationOptions{ComputeChecksums: true})
+	check.Assert(err, IsNil)
+	report, err = replicator.Replicate(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(report.Items[0].Action, Equals, CatalogReplicationUnchanged)
+
+	// A different checksum on the source item replaces the target item
+	err = sourceMedia.AddMetadataEntryWithVisibility(DefaultCatalogReplicationChecksumKey, "changed", types.MetadataStringValue, types.MetadataReadWriteVisibility, false)
+	check.Assert(err, IsNil)
+	report, err = replicator.Replicate(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(report.Items[0].Action, Equals, CatalogReplicationReplaced)
+	check.Assert(report.Items[0].Checksum, Equals, "changed")
+	targetMedia, err = target.GetMediaByName(itemName, true)
+	check.Assert(err, IsNil)
+	value, err = targetMedia.GetMetadataByKey(DefaultCatalogReplicationChecksumKey, false)
+	check.Assert(err, IsNil)
+	check.Assert(value.TypedValue.Value, Equals, "changed")
+}
@@ -0,0 +1,243 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_NewCatalogReplicator(t *testing.T) {
+	client1 := &Client{VCDHREF: url.URL{Scheme: "https", Host: "vcd1.example.com", Path: "/api"}}
+	client2 := &Client{VCDHREF: url.URL{Scheme: "https", Host: "vcd2.example.com", Path: "/api"}}
+	source := &Catalog{Catalog: &types.Catalog{ID: "urn:vcloud:catalog:1", Name: "source"}, client: client1}
+
+	replicator, err := NewCatalogReplicator(source, &Catalog{Catalog: &types.Catalog{ID: "urn:vcloud:catalog:1"}, client: client2}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error for catalogs of different VCDs: %s", err)
+	}
+	if replicator.options.ChecksumMetadataKey != DefaultCatalogReplicationChecksumKey || replicator.options.UploadPieceSize != 1024*1024 {
+		t.Errorf("unexpected default options %+v", replicator.options)
+	}
+	replicator, err = NewCatalogReplicator(source, &Catalog{Catalog: &types.Catalog{ID: "urn:vcloud:catalog:2"}, client: client1},
+		&CatalogReplicationOptions{ChecksumMetadataKey: "digest", UploadPieceSize: 10})
+	if err != nil {
+		t.Fatalf("unexpected error for catalogs of the same VCD: %s", err)
+	}
+	if replicator.options.ChecksumMetadataKey != "digest" || replicator.options.UploadPieceSize != 10 {
+		t.Errorf("unexpected options %+v", replicator.options)
+	}
+
+	_, err = NewCatalogReplicator(source, &Catalog{Catalog: &types.Catalog{ID: "urn:vcloud:catalog:1"}, client: client1}, nil)
+	if err == nil {
+		t.Errorf("expected error for the same catalog")
+	}
+	_, err = NewCatalogReplicator(source, nil, nil)
+	if err == nil {
+		t.Errorf("expected error for a nil catalog")
+	}
+}
+
+func Test_catalogReplicationAction(t *testing.T) {
+	tests := []struct {
+		sourceChecksum string
+		targetChecksum string
+		sameKind       bool
+		expected       CatalogReplicationAction
+	}{
+		{"abc", "abc", true, CatalogReplicationUnchanged},
+		{"ABC", "abc", true, CatalogReplicationUnchanged},
+		{"abc", "def", true, CatalogReplicationReplaced},
+		{"abc", "", true, CatalogReplicationReplaced},
+		{"", "abc", true, CatalogReplicationUnverified},
+		{"", "", true, CatalogReplicationReplaced},
+		{"abc", "abc", false, CatalogReplicationReplaced},
+	}
+	for _, tt := range tests {
+		action := catalogReplicationAction(tt.sourceChecksum, tt.targetChecksum, tt.sameKind)
+		if action != tt.expected {
+			t.Errorf("%q/%q/%v: expected %s, got %s", tt.sourceChecksum, tt.targetChecksum, tt.sameKind, tt.expected, action)
+		}
+	}
+}
+
+func Test_replicatedMetadata(t *testing.T) {
+	entry := func(key, value, domain string) *types.MetadataEntry {
+		return &types.MetadataEntry{
+			Key:        key,
+			Domain:     &types.MetadataDomainTag{Visibility: types.MetadataReadWriteVisibility, Domain: domain},
+			TypedValue: &types.MetadataTypedValue{XsiType: types.MetadataStringValue, Value: value},
+		}
+	}
+	source := []*types.MetadataEntry{
+		entry("same", "1", "GENERAL"),
+		entry("changed", "2", "GENERAL"),
+		entry("missing", "3", "GENERAL"),
+		entry("system", "4", "SYSTEM"),
+		entry(DefaultCatalogReplicationChecksumKey, "abc", "GENERAL"),
+	}
+	target := []*types.MetadataEntry{
+		entry("same", "1", "GENERAL"),
+		entry("changed", "old", "GENERAL"),
+		entry("extra", "5", "GENERAL"),
+		entry("missing", "3", "SYSTEM"),
+	}
+
+	metadata := replicatedMetadata(source, target, false)
+	for _, key := range []string{"changed", "missing", DefaultCatalogReplicationChecksumKey} {
+		if _, found := metadata[key]; !found {
+			t.Errorf("expected entry '%s' to be merged", key)
+		}
+	}
+	if len(metadata) != 3 {
+		t.Errorf("unexpected entries %v", metadata)
+	}
+	if metadata["changed"].TypedValue.Value != "2" {
+		t.Errorf("expected value of the source entry, got %s", metadata["changed"].TypedValue.Value)
+	}
+	if _, found := replicatedMetadata(source, target, true)["system"]; !found {
+		t.Errorf("expected SYSTEM entry to be merged by System Administrators")
+	}
+
+	if value := metadataEntryValue(source, DefaultCatalogReplicationChecksumKey); value != "abc" {
+		t.Errorf("expected checksum 'abc', got '%s'", value)
+	}
+	if value := metadataEntryValue(source, "system"); value != "" {
+		t.Errorf("expected no value for SYSTEM entry, got '%s'", value)
+	}
+}
+
+func Test_copyCatalogItemContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	download := func(writer io.Writer) error {
+		for offset := 0; offset < len(content); offset += 4096 {
+			_, err := writer.Write(content[offset:min(offset+4096, len(content))])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var uploaded bytes.Buffer
+	checksum, size, err := copyCatalogItemContent(download, func(reader io.Reader) error {
+		_, err := io.Copy(&uploaded, reader)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if checksum != testChecksum(content) || size != int64(len(content)) || !bytes.Equal(uploaded.Bytes(), content) {
+		t.Errorf("unexpected copy of %d bytes with checksum %s", size, checksum)
+	}
+
+	// An upload which doesn't read the end of the stream doesn't block the download
+	checksum, size, err = copyCatalogItemContent(download, func(reader io.Reader) error {
+		_, err := io.CopyN(io.Discard, reader, 1000)
+		return err
+	})
+	if err != nil || checksum != testChecksum(content) || size != int64(len(content)) {
+		t.Errorf("unexpected result for partial upload: %s, %d, %v", checksum, size, err)
+	}
+
+	_, _, err = copyCatalogItemContent(download, func(reader io.Reader) error {
+		_, _ = io.CopyN(io.Discard, reader, 1000)
+		return errors.New("upload refused")
+	})
+	if err == nil || !strings.Contains(err.Error(), "upload refused") {
+		t.Errorf("expected upload error, got %v", err)
+	}
+
+	_, _, err = copyCatalogItemContent(func(writer io.Writer) error {
+		_, _ = writer.Write(content[:100])
+		return errors.New("connection reset")
+	}, func(reader io.Reader) error {
+		_, err := io.Copy(io.Discard, reader)
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "error downloading: connection reset") {
+		t.Errorf("expected download error, got %v", err)
+	}
+}
+
+func Test_CatalogReplicationReportCount(t *testing.T) {
+	report := &CatalogReplicationReport{Items: []CatalogReplicationItem{
+		{Name: "a", Action: CatalogReplicationCreated},
+		{Name: "b", Action: CatalogReplicationUnchanged},
+		{Name: "c", Action: CatalogReplicationCreated},
+	}}
+	if report.Count(CatalogReplicationCreated) != 2 || report.Count(CatalogReplicationFailed) != 0 {
+		t.Errorf("unexpected counts")
+	}
+}
+
+func Test_waitReplicationUpload(t *testing.T) {
+	defaultInterval := replicationTaskInterval
+	replicationTaskInterval = 10 * time.Millisecond
+	defer func() { replicationTaskInterval = defaultInterval }()
+
+	var mutex sync.Mutex
+	status := "running"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		body, _ := xml.Marshal(&types.Task{HREF: "http://" + r.Host + r.URL.Path, Status: status,
+			Error: &types.Error{Message: "import failed"}})
+		w.Header().Set("Content-Type", types.MimeTask)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	client := &Client{Http: *server.Client(), APIVersion: "37.0"}
+	newUploadTask := func(uploadError *error) *UploadTask {
+		task := NewTask(client)
+		task.Task = &types.Task{HREF: server.URL + "/api/task/1"}
+		return NewUploadTask(task, &mutexedProgress{}, uploadError)
+	}
+	setStatus := func(value string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status = value
+	}
+
+	// The upload error is returned while the import task is still running
+	uploadError := errors.New("stream interrupted")
+	err := waitReplicationUpload(context.Background(), newUploadTask(&uploadError))
+	if err == nil || err.Error() != "stream interrupted" {
+		t.Errorf("expected upload error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var noError error
+	err = waitReplicationUpload(ctx, newUploadTask(&noError))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context error, got %v", err)
+	}
+
+	setStatus("error")
+	err = waitReplicationUpload(context.Background(), newUploadTask(&noError))
+	if err == nil || !strings.Contains(err.Error(), "import failed") {
+		t.Errorf("expected task error, got %v", err)
+	}
+	setStatus("success")
+	err = waitReplicationUpload(context.Background(), newUploadTask(&noError))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
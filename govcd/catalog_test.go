@@ -7,6 +7,7 @@
 package govcd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -437,6 +438,56 @@ func (vcd *TestVCD) Test_UploadOvf_withoutVMDKSize(check *C) {
 	checkUploadOvf(vcd, check, vcd.config.OVA.OvaWithoutSizePath, vcd.config.VCD.Catalog.Name, TestUploadOvf+"8", true)
 }
 
+// Tests Catalog.UploadOvfFromReader by streaming the OVA file without giving access to its path
+func (vcd *TestVCD) Test_UploadOvfFromReader(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	skipWhenOvaPathMissing(vcd.config.OVA.OvaPath, check)
+	itemName := TestUploadOvf + "FromReader"
+
+	catalog, org := findCatalog(vcd, check, vcd.config.VCD.Catalog.Name)
+
+	ovaFile, err := os.Open(vcd.config.OVA.OvaPath)
+	check.Assert(err, IsNil)
+	defer safeClose(ovaFile)
+
+	// Only the io.Reader interface of the file is visible to the upload
+	uploadTask, err := catalog.UploadOvfFromReader(struct{ io.Reader }{ovaFile}, itemName, "upload from test", 1024*1024)
+	check.Assert(err, IsNil)
+	AddToCleanupList(itemName, "catalogItem", vcd.org.Org.Name+"|"+vcd.config.VCD.Catalog.Name, check.TestName())
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	check.Assert(uploadTask.GetUploadError(), IsNil)
+
+	catalog, err = org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	check.Assert(err, IsNil)
+	verifyCatalogItemUploaded(check, catalog, itemName)
+	deleteCatalogItem(check, catalog, itemName)
+}
+
+// Tests Catalog.UploadOvfWithEditors by uploading the OVA with a changed descriptor
+func (vcd *TestVCD) Test_UploadOvfWithEditors(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	skipWhenOvaPathMissing(vcd.config.OVA.OvaPath, check)
+	itemName := TestUploadOvf + "WithEditors"
+
+	catalog, org := findCatalog(vcd, check, vcd.config.VCD.Catalog.Name)
+
+	uploadTask, err := catalog.UploadOvfWithEditors(vcd.config.OVA.OvaPath, itemName, "upload from test", 1024*1024,
+		RemoveOvfHardware(14), SetOvfPropertyDefaults(map[string]string{"test.property": "edited"}))
+	check.Assert(err, IsNil)
+	AddToCleanupList(itemName, "catalogItem", vcd.org.Org.Name+"|"+vcd.config.VCD.Catalog.Name, check.TestName())
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	check.Assert(uploadTask.GetUploadError(), IsNil)
+
+	catalog, err = org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	check.Assert(err, IsNil)
+	verifyCatalogItemUploaded(check, catalog, itemName)
+	deleteCatalogItem(check, catalog, itemName)
+}
+
 func countFolders() int {
 	files, err := os.ReadDir(os.TempDir())
 	if err != nil {
@@ -538,6 +589,105 @@ func (vcd *TestVCD) Test_CatalogUploadMediaImage(check *C) {
 	deleteCatalogItem(check, catalog, TestCatalogUploadMedia)
 }
 
+// Tests Catalog.UploadMediaImageResumable: the state file records the upload and is removed once it is complete
+func (vcd *TestVCD) Test_CatalogUploadMediaImageResumable(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	skipWhenMediaPathMissing(vcd, check)
+	itemName := TestCatalogUploadMedia + "Resumable"
+
+	catalog, org := findCatalog(vcd, check, vcd.config.VCD.Catalog.Name)
+
+	stateFile := check.MkDir() + "/upload-state.json"
+	uploadTask, err := catalog.UploadMediaImageResumable(itemName, "upload from test", vcd.config.Media.MediaPath, 1024*1024, stateFile)
+	check.Assert(err, IsNil)
+	AddToCleanupList(itemName, "mediaCatalogImage", vcd.org.Org.Name+"|"+vcd.config.VCD.Catalog.Name, check.TestName())
+
+	state, err := LoadUploadState(stateFile)
+	check.Assert(err, IsNil)
+	check.Assert(state.IsStarted(), Equals, true)
+	check.Assert(state.Kind, Equals, UploadKindMedia)
+	check.Assert(state.ItemName, Equals, itemName)
+
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	_, err = os.Stat(stateFile)
+	check.Assert(os.IsNotExist(err), Equals, true)
+
+	// Without state, a new upload with the same name is rejected
+	_, err = catalog.UploadMediaImageResumable(itemName, "upload from test", vcd.config.Media.MediaPath, 1024*1024, stateFile)
+	check.Assert(err, NotNil)
+
+	catalog, err = org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	check.Assert(err, IsNil)
+	verifyCatalogItemUploaded(check, catalog, itemName)
+	deleteCatalogItem(check, catalog, itemName)
+}
+
+// Tests Catalog.UploadMediaFromReader by streaming the ISO file without giving access to its path
+func (vcd *TestVCD) Test_CatalogUploadMediaFromReader(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	skipWhenMediaPathMissing(vcd, check)
+	itemName := TestCatalogUploadMedia + "FromReader"
+
+	catalog, org := findCatalog(vcd, check, vcd.config.VCD.Catalog.Name)
+
+	mediaFile, err := os.Open(vcd.config.Media.MediaPath)
+	check.Assert(err, IsNil)
+	defer safeClose(mediaFile)
+	fileInfo, err := mediaFile.Stat()
+	check.Assert(err, IsNil)
+
+	uploadTask, err := catalog.UploadMediaFromReader(itemName, "upload from test", struct{ io.Reader }{mediaFile}, fileInfo.Size(), 1024*1024, true)
+	check.Assert(err, IsNil)
+	AddToCleanupList(itemName, "mediaCatalogImage", vcd.org.Org.Name+"|"+vcd.config.VCD.Catalog.Name, check.TestName())
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	check.Assert(uploadTask.GetUploadError(), IsNil)
+
+	catalog, err = org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	check.Assert(err, IsNil)
+	verifyCatalogItemUploaded(check, catalog, itemName)
+	deleteCatalogItem(check, catalog, itemName)
+}
+
+// Tests Catalog.UploadMediaFromFiles by uploading a cloud-init NoCloud seed image built from memory
+func (vcd *TestVCD) Test_CatalogUploadMediaFromFiles(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+
+	itemName := TestCatalogUploadMedia + "FromFiles"
+
+	catalog, org := findCatalog(vcd, check, vcd.config.VCD.Catalog.Name)
+
+	files := map[string][]byte{
+		"meta-data": []byte("instance-id: " + itemName + "\n"),
+		"user-data": []byte("#cloud-config\nhostname: " + itemName + "\n"),
+	}
+	uploadTask, err := catalog.UploadMediaFromFiles(itemName, "upload from test", files, IsoImageOptions{VolumeIdentifier: "cidata", Udf: true}, 1024*1024)
+	check.Assert(err, IsNil)
+	AddToCleanupList(itemName, "mediaCatalogImage", vcd.org.Org.Name+"|"+vcd.config.VCD.Catalog.Name, check.TestName())
+	err = uploadTask.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	check.Assert(uploadTask.GetUploadError(), IsNil)
+
+	catalog, err = org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	check.Assert(err, IsNil)
+	verifyCatalogItemUploaded(check, catalog, itemName)
+
+	// The uploaded image is inspected with range requests
+	media, err := catalog.GetMediaByName(itemName, true)
+	check.Assert(err, IsNil)
+	image, err := media.OpenIso(context.Background())
+	check.Assert(err, IsNil)
+	check.Assert(image.Volume().Label, Equals, "cidata")
+	userData, err := image.ReadFile("user-data")
+	check.Assert(err, IsNil)
+	check.Assert(userData, DeepEquals, files["user-data"])
+
+	deleteCatalogItem(check, catalog, itemName)
+}
+
 // Tests System function UploadMediaImage by checking UploadTask.GetUploadProgress returns values of progress.
 func (vcd *TestVCD) Test_CatalogUploadMediaImage_progress_works(check *C) {
 	fmt.Printf("Running: %s\n", check.TestName())
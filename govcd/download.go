@@ -0,0 +1,463 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"context"
+	"crypto/md5"  // #nosec G501 -- MD5 is only used to compare checksums published by the server
+	"crypto/sha1" // #nosec G505 -- SHA1 is only used to compare checksums published by the server
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// DownloadOptions define how a file is downloaded from a transfer URL
+type DownloadOptions struct {
+	// Offset is the number of bytes of the file that the writer already holds. The download
+	// resumes from this offset using an HTTP range request. Ignored by the file variants, which
+	// resume from the size of the existing file when Resume is set
+	Offset int64
+	// Resume makes the file variants keep the existing file and download only the missing part
+	Resume bool
+	// Retries is the number of times an interrupted download is resumed from the last byte
+	// received before giving up
+	Retries int
+	// ProgressCallback, when set, receives the number of bytes held by the writer and the total
+	// size of the file after every write. The total size is -1 when the server does not report it
+	ProgressCallback func(downloadedBytes, totalSize int64)
+	// ChecksumAlgorithm is one of "md5", "sha1", "sha256" or "sha512". When set, the hex-encoded
+	// digest of the whole file is compared with Checksum once the download is complete
+	ChecksumAlgorithm string
+	Checksum          string
+}
+
+// rangeDownload is a download of a transfer URL, which can be resumed with HTTP range requests
+type rangeDownload struct {
+	client *Client
+	href   string
+	writer io.Writer
+	// offset is the number of bytes of the file held by the writer
+	offset int64
+	// expectedSize is the size of the file when known in advance, 0 otherwise
+	expectedSize int64
+	// total is the size of the file reported by the server, -1 when unknown
+	total int64
+	// hasher receives the content of the file, including the bytes held by the writer before
+	// the download started
+	hasher  hash.Hash
+	options DownloadOptions
+}
+
+// errNotRetriable marks download errors which resuming the download can't solve
+var errNotRetriable = errors.New("download error")
+
+// downloadTransferUrl downloads the content of a transfer URL to the writer, which already holds
+// options.Offset bytes. It returns the number of bytes held by the writer at the end of the download
+func downloadTransferUrl(ctx context.Context, client *Client, href string, writer io.Writer, options *DownloadOptions) (int64, error) {
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	if options.Offset > 0 && options.ChecksumAlgorithm != "" {
+		return 0, fmt.Errorf("the checksum of a download resumed into a writer can't be verified")
+	}
+	download := &rangeDownload{client: client, href: href, writer: writer, offset: options.Offset, options: *options}
+	return download.run(ctx)
+}
+
+// downloadTransferUrlToFile downloads the content of a transfer URL to a file. With options.Resume,
+// the existing content of the file is kept and only the missing part is downloaded.
+// It returns the size of the file at the end of the download
+func downloadTransferUrlToFile(ctx context.Context, client *Client, href, filePath string, options *DownloadOptions) (int64, error) {
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if options.Resume {
+		flags = os.O_CREATE | os.O_RDWR
+	}
+	file, err := os.OpenFile(filepath.Clean(filePath), flags, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file '%s': %s", filePath, err)
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			util.Logger.Printf("[WARN] error closing file '%s': %s", filePath, err)
+		}
+	}()
+
+	download := &rangeDownload{client: client, href: href, writer: file, options: *options}
+	if options.Resume {
+		hasher, err := newChecksumHash(options.ChecksumAlgorithm)
+		if err != nil {
+			return 0, err
+		}
+		var existing io.Writer = io.Discard
+		if hasher != nil {
+			existing = hasher
+		}
+		// Reading the existing content positions the file at its end and seeds the checksum
+		download.offset, err = io.Copy(existing, file)
+		if err != nil {
+			return 0, fmt.Errorf("error reading file '%s': %s", filePath, err)
+		}
+		download.hasher = hasher
+	}
+	return download.run(ctx)
+}
+
+func (download *rangeDownload) run(ctx context.Context) (int64, error) {
+	downloadUrl, err := url.ParseRequestURI(download.href)
+	if err != nil {
+		return download.offset, fmt.Errorf("error parsing download URL '%s': %s", download.href, err)
+	}
+	if download.options.ChecksumAlgorithm != "" && download.options.Checksum == "" {
+		return download.offset, fmt.Errorf("a checksum algorithm is set without checksum")
+	}
+	if download.hasher == nil {
+		download.hasher, err = newChecksumHash(download.options.ChecksumAlgorithm)
+		if err != nil {
+			return download.offset, err
+		}
+	}
+	download.total = -1
+
+	for attempt := 0; ; attempt++ {
+		err = download.attempt(ctx, downloadUrl)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errNotRetriable) || ctx.Err() != nil || attempt >= download.options.Retries {
+			return download.offset, err
+		}
+		util.Logger.Printf("[DEBUG] download of %s interrupted at byte %d, resuming: %s", downloadUrl.Path, download.offset, err)
+	}
+
+	if download.hasher != nil {
+		checksum := hex.EncodeToString(download.hasher.Sum(nil))
+		if !strings.EqualFold(checksum, download.options.Checksum) {
+			return download.offset, fmt.Errorf("%s checksum mismatch: expected %s, got %s",
+				download.options.ChecksumAlgorithm, download.options.Checksum, checksum)
+		}
+	}
+	return download.offset, nil
+}
+
+// attempt requests the file from the current offset and copies the response to the writer
+func (download *rangeDownload) attempt(ctx context.Context, downloadUrl *url.URL) error {
+	request := download.client.NewRequest(map[string]string{}, http.MethodGet, *downloadUrl, nil).WithContext(ctx)
+	if download.offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", download.offset))
+	}
+	resp, err := download.client.Http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return fmt.Errorf("%w: %s", errNotRetriable, err)
+		}
+		if start != download.offset {
+			return fmt.Errorf("%w: requested byte %d, received content from byte %d", errNotRetriable, download.offset, start)
+		}
+		err = download.setTotal(total)
+		if err != nil {
+			return err
+		}
+	case http.StatusOK:
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+		err = download.setTotal(total)
+		if err != nil {
+			return err
+		}
+		// The server ignored the range: the bytes already held by the writer are skipped
+		if download.offset > 0 {
+			_, err = io.CopyN(io.Discard, resp.Body, download.offset)
+			if err != nil {
+				return err
+			}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The writer already holds the whole file
+		_, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err == nil && total == download.offset {
+			return download.setTotal(total)
+		}
+		return fmt.Errorf("%w: range from byte %d not satisfiable", errNotRetriable, download.offset)
+	default:
+		_, err = checkResp(resp, nil)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errNotRetriable, err)
+	}
+
+	progress := &progressWriter{download: download}
+	_, err = io.Copy(progress, resp.Body)
+	if progress.err != nil {
+		return fmt.Errorf("%w: error writing downloaded content: %s", errNotRetriable, progress.err)
+	}
+	if err != nil {
+		return err
+	}
+	if download.total >= 0 && download.offset != download.total {
+		return fmt.Errorf("received %d of %d bytes: %w", download.offset, download.total, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// setTotal records the size of the file reported by the server, checking it against the expected size
+func (download *rangeDownload) setTotal(total int64) error {
+	if total >= 0 && download.expectedSize > 0 && total != download.expectedSize {
+		return fmt.Errorf("%w: the server reports %d bytes, but %d are expected", errNotRetriable, total, download.expectedSize)
+	}
+	if total >= 0 && total < download.offset {
+		return fmt.Errorf("%w: the server reports %d bytes, but %d are already downloaded", errNotRetriable, total, download.offset)
+	}
+	download.total = total
+	return nil
+}
+
+// progressWriter writes the downloaded content to the writer and the checksum, keeping track of
+// the offset and reporting progress
+type progressWriter struct {
+	download *rangeDownload
+	err      error
+}
+
+func (progress *progressWriter) Write(content []byte) (int, error) {
+	download := progress.download
+	written, err := download.writer.Write(content)
+	if download.hasher != nil {
+		_, _ = download.hasher.Write(content[:written])
+	}
+	download.offset += int64(written)
+	if download.options.ProgressCallback != nil {
+		download.options.ProgressCallback(download.offset, download.total)
+	}
+	if err != nil {
+		progress.err = err
+	}
+	return written, err
+}
+
+// parseContentRange parses a Content-Range header such as "bytes 100-199/200" or "bytes */200",
+// returning the first byte and the total size, which is -1 when unknown
+func parseContentRange(contentRange string) (int64, int64, error) {
+	rangeSpec, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	byteRange, size, found := strings.Cut(rangeSpec, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+	total := int64(-1)
+	var err error
+	if size != "*" {
+		total, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid size in Content-Range '%s'", contentRange)
+		}
+	}
+	if byteRange == "*" {
+		return 0, total, nil
+	}
+	first, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range in Content-Range '%s'", contentRange)
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range in Content-Range '%s'", contentRange)
+	}
+	return start, total, nil
+}
+
+// newChecksumHash returns the hash for a checksum algorithm, or nil when no algorithm is given
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "":
+		return nil, nil
+	case "md5":
+		return md5.New(), nil // #nosec G401 -- see import
+	case "sha1":
+		return sha1.New(), nil // #nosec G401 -- see import
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm '%s'", algorithm)
+}
+
+const (
+	// transferRangeChunkSize is the size of the parts of a file requested by a transferRangeReader
+	transferRangeChunkSize = 256 * 1024
+	// transferRangeCachedChunks is the number of parts kept by a transferRangeReader for the following reads
+	transferRangeCachedChunks = 16
+)
+
+// transferRangeReader reads parts of a file of the transfer service with HTTP range requests, so that
+// the parts of a large file which are not read are not downloaded. The file is requested by chunks,
+// and the last chunks read are kept for the following reads
+type transferRangeReader struct {
+	ctx    context.Context
+	client *Client
+	href   string
+	// size is the size of the file, learned from the first response when it is not known in advance
+	size int64
+
+	mutex sync.Mutex
+	// chunks holds the cached chunks by index, and order their indexes from the least recently used
+	chunks map[int64][]byte
+	order  []int64
+}
+
+// newTransferRangeReader returns a reader of a transfer URL. size is 0 when it is unknown
+func newTransferRangeReader(ctx context.Context, client *Client, href string, size int64) *transferRangeReader {
+	return &transferRangeReader{
+		ctx:    ctx,
+		client: client,
+		href:   href,
+		size:   size,
+		chunks: make(map[int64][]byte),
+	}
+}
+
+// ReadAt implements io.ReaderAt
+func (reader *transferRangeReader) ReadAt(content []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset %d", offset)
+	}
+	read := 0
+	for read < len(content) {
+		position := offset + int64(read)
+		index := position / transferRangeChunkSize
+		chunk, err := reader.chunk(index)
+		if err != nil {
+			return read, err
+		}
+		start := position - index*transferRangeChunkSize
+		if start >= int64(len(chunk)) {
+			return read, io.EOF
+		}
+		read += copy(content[read:], chunk[start:])
+	}
+	return read, nil
+}
+
+// chunk returns the chunk of the file at the given index, which is shorter than transferRangeChunkSize
+// at the end of the file
+func (reader *transferRangeReader) chunk(index int64) ([]byte, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	if chunk, found := reader.chunks[index]; found {
+		reader.order = append(slices.DeleteFunc(reader.order, func(cached int64) bool { return cached == index }), index)
+		return chunk, nil
+	}
+	start := index * transferRangeChunkSize
+	if reader.size > 0 && start >= reader.size {
+		return nil, nil
+	}
+	end := start + transferRangeChunkSize
+	var chunk []byte
+	for {
+		// The server may send fewer bytes than requested: the rest of the chunk is requested again,
+		// so that a chunk is only short at the end of the file
+		position := start + int64(len(chunk))
+		part, err := reader.request(position, end)
+		if err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, part...)
+		if int64(len(chunk)) == transferRangeChunkSize || reader.size <= 0 || start+int64(len(chunk)) >= reader.size {
+			break
+		}
+		if len(part) == 0 {
+			return nil, fmt.Errorf("no content received from byte %d of %d", position, reader.size)
+		}
+	}
+	reader.chunks[index] = chunk
+	reader.order = append(reader.order, index)
+	if len(reader.order) > transferRangeCachedChunks {
+		delete(reader.chunks, reader.order[0])
+		reader.order = reader.order[1:]
+	}
+	return chunk, nil
+}
+
+// request downloads the bytes from start up to end, excluded. It can return fewer bytes when the server
+// sends a shorter range or when the file ends before
+func (reader *transferRangeReader) request(start, end int64) ([]byte, error) {
+	downloadUrl, err := url.ParseRequestURI(reader.href)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing download URL '%s': %s", reader.href, err)
+	}
+	request := reader.client.NewRequest(map[string]string{}, http.MethodGet, *downloadUrl, nil).WithContext(reader.ctx)
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := reader.client.Http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		received, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		if received != start {
+			return nil, fmt.Errorf("requested byte %d, received content from byte %d", start, received)
+		}
+		if total >= 0 {
+			reader.size = total
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The chunk starts after the end of the file
+		return nil, nil
+	case http.StatusOK:
+		// The server ignored the range, which is only acceptable for files of a single chunk
+		if start > 0 || resp.ContentLength < 0 || resp.ContentLength > end {
+			return nil, fmt.Errorf("the transfer server doesn't support range requests")
+		}
+		reader.size = resp.ContentLength
+	default:
+		_, err = checkResp(resp, nil)
+		if err == nil {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil, err
+	}
+
+	chunk, err := io.ReadAll(io.LimitReader(resp.Body, end-start))
+	if err != nil {
+		return nil, fmt.Errorf("error reading bytes from %d: %s", start, err)
+	}
+	return chunk, nil
+}
@@ -0,0 +1,293 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/iso"
+)
+
+// testDownloadServer serves content with range support. The first 'interruptions' requests are
+// cut after half of the requested content, and ranges are ignored when ignoreRange is set
+func testDownloadServer(t *testing.T, content []byte, interruptions int, ignoreRange bool) (*Client, string, *[]string) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if ignoreRange {
+			r.Header.Del("Range")
+		}
+		if interruptions > 0 {
+			interruptions--
+			start := 0
+			if r.Header.Get("Range") != "" {
+				start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-"))
+				w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+				w.WriteHeader(http.StatusPartialContent)
+			} else {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			}
+			_, _ = w.Write(content[start : start+(len(content)-start)/2])
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return &Client{Http: *server.Client(), APIVersion: "37.0"}, server.URL + "/transfer/abc/file", &ranges
+}
+
+func testChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_downloadTransferUrl(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	client, href, _ := testDownloadServer(t, content, 0, false)
+
+	var reported, total int64
+	var buffer bytes.Buffer
+	size, err := downloadTransferUrl(context.Background(), client, href, &buffer, &DownloadOptions{
+		ProgressCallback:  func(downloaded, size int64) { reported, total = downloaded, size },
+		ChecksumAlgorithm: "sha256",
+		Checksum:          testChecksum(content),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != int64(len(content)) || !bytes.Equal(buffer.Bytes(), content) {
+		t.Errorf("unexpected content of %d bytes", size)
+	}
+	if reported != size || total != size {
+		t.Errorf("unexpected progress: %d/%d", reported, total)
+	}
+
+	_, err = downloadTransferUrl(context.Background(), client, href, &bytes.Buffer{}, &DownloadOptions{
+		ChecksumAlgorithm: "sha256",
+		Checksum:          testChecksum([]byte("other")),
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	_, err = downloadTransferUrl(context.Background(), client, href, &bytes.Buffer{}, &DownloadOptions{ChecksumAlgorithm: "crc"})
+	if err == nil {
+		t.Errorf("expected error for checksum algorithm without checksum")
+	}
+}
+
+func Test_downloadTransferUrlResume(t *testing.T) {
+	content := bytes.Repeat([]byte("abcdefghij"), 10000)
+
+	for _, ignoreRange := range []bool{false, true} {
+		client, href, ranges := testDownloadServer(t, content, 0, ignoreRange)
+		buffer := bytes.NewBuffer(append([]byte{}, content[:1234]...))
+		size, err := downloadTransferUrl(context.Background(), client, href, buffer, &DownloadOptions{Offset: 1234})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if size != int64(len(content)) || !bytes.Equal(buffer.Bytes(), content) || (*ranges)[0] != "bytes=1234-" {
+			t.Errorf("ignoreRange=%t: unexpected resumed download of %d bytes, ranges %v", ignoreRange, size, *ranges)
+		}
+	}
+
+	// Interrupted downloads are resumed from the last byte received
+	client, href, ranges := testDownloadServer(t, content, 2, false)
+	var buffer bytes.Buffer
+	_, err := downloadTransferUrl(context.Background(), client, href, &buffer, &DownloadOptions{Retries: 1})
+	if err == nil {
+		t.Errorf("expected error after exhausting retries")
+	}
+	size, err := downloadTransferUrl(context.Background(), client, href, &buffer, &DownloadOptions{Offset: int64(buffer.Len()), Retries: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != int64(len(content)) || !bytes.Equal(buffer.Bytes(), content) || strings.Join(*ranges, ",") != ",bytes=50000-,bytes=75000-" {
+		t.Errorf("unexpected download of %d bytes, ranges %v", size, *ranges)
+	}
+
+	_, err = downloadTransferUrl(context.Background(), client, href, &buffer, &DownloadOptions{
+		Offset: 10, ChecksumAlgorithm: "sha256", Checksum: testChecksum(content),
+	})
+	if err == nil {
+		t.Errorf("expected error for checksum of download resumed into a writer")
+	}
+}
+
+func Test_downloadTransferUrlToFile(t *testing.T) {
+	content := bytes.Repeat([]byte("klmnopqrst"), 10000)
+	client, href, ranges := testDownloadServer(t, content, 0, false)
+	filePath := filepath.Join(t.TempDir(), "file.iso")
+
+	err := os.WriteFile(filePath, content[:5000], 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	options := &DownloadOptions{Resume: true, ChecksumAlgorithm: "sha256", Checksum: testChecksum(content)}
+	size, err := downloadTransferUrlToFile(context.Background(), client, href, filePath, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	written, _ := os.ReadFile(filePath)
+	if size != int64(len(content)) || !bytes.Equal(written, content) || (*ranges)[0] != "bytes=5000-" {
+		t.Errorf("unexpected resumed file of %d bytes, ranges %v", size, *ranges)
+	}
+
+	// A complete file is not downloaded again
+	size, err = downloadTransferUrlToFile(context.Background(), client, href, filePath, options)
+	if err != nil || size != int64(len(content)) {
+		t.Errorf("unexpected result for complete file: %d, %v", size, err)
+	}
+
+	// Without resume, the file is overwritten
+	size, err = downloadTransferUrlToFile(context.Background(), client, href, filePath, nil)
+	written, _ = os.ReadFile(filePath)
+	if err != nil || size != int64(len(content)) || !bytes.Equal(written, content) {
+		t.Errorf("unexpected overwritten file: %d, %v", size, err)
+	}
+}
+
+func Test_parseContentRange(t *testing.T) {
+	tests := []struct {
+		header string
+		start  int64
+		total  int64
+		valid  bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", 0, 200, true},
+		{"bytes 100/200", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"bytes a-b/200", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, err := parseContentRange(tt.header)
+		if (err == nil) != tt.valid || (tt.valid && (start != tt.start || total != tt.total)) {
+			t.Errorf("%s: unexpected result %d, %d, %v", tt.header, start, total, err)
+		}
+	}
+}
+
+func Test_transferRangeReader(t *testing.T) {
+	content := make([]byte, 3*transferRangeChunkSize+100)
+	for idx := range content {
+		content[idx] = byte(idx % 251)
+	}
+	client, href, ranges := testDownloadServer(t, content, 0, false)
+
+	reader := newTransferRangeReader(context.Background(), client, href, 0)
+	for _, offset := range []int64{10, transferRangeChunkSize - 5, 3 * transferRangeChunkSize, 10} {
+		buffer := make([]byte, 50)
+		n, err := reader.ReadAt(buffer, offset)
+		if err != nil || n != 50 || !bytes.Equal(buffer, content[offset:offset+50]) {
+			t.Errorf("unexpected read at %d: %d bytes, %v", offset, n, err)
+		}
+	}
+	// The chunks 0, 1 and 3 are requested once
+	if len(*ranges) != 3 {
+		t.Errorf("expected 3 range requests, got %v", *ranges)
+	}
+	if reader.size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), reader.size)
+	}
+
+	buffer := make([]byte, 200)
+	n, err := reader.ReadAt(buffer, int64(len(content)-100))
+	if err != io.EOF || n != 100 || !bytes.Equal(buffer[:n], content[len(content)-100:]) {
+		t.Errorf("expected 100 bytes and EOF at the end of the file, got %d bytes, %v", n, err)
+	}
+
+	client, href, _ = testDownloadServer(t, content, 0, true)
+	_, err = newTransferRangeReader(context.Background(), client, href, 0).ReadAt(buffer, transferRangeChunkSize)
+	if err == nil || !strings.Contains(err.Error(), "doesn't support range requests") {
+		t.Errorf("expected error when ranges are ignored, got %v", err)
+	}
+}
+
+func Test_transferRangeReaderShortRanges(t *testing.T) {
+	content := make([]byte, 2*transferRangeChunkSize+100)
+	for idx := range content {
+		content[idx] = byte(idx % 251)
+	}
+	// The server sends at most maxRange bytes for each request
+	maxRange := 100000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		if err != nil || start >= len(content) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		end = min(end+1, len(content), start+maxRange)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[start:end])
+	}))
+	defer server.Close()
+	client := &Client{Http: *server.Client(), APIVersion: "37.0"}
+
+	reader := newTransferRangeReader(context.Background(), client, server.URL+"/transfer/abc/file", 0)
+	read, err := io.ReadAll(io.NewSectionReader(reader, 0, int64(len(content))))
+	if err != nil || !bytes.Equal(read, content) {
+		t.Errorf("unexpected content: %d bytes, %v", len(read), err)
+	}
+
+	// A range without content in the middle of the file is an error
+	maxRange = 0
+	reader = newTransferRangeReader(context.Background(), client, server.URL+"/transfer/abc/file", int64(len(content)))
+	_, err = reader.ReadAt(make([]byte, 10), 10)
+	if err == nil || !strings.Contains(err.Error(), "no content received") {
+		t.Errorf("expected error for missing content, got %v", err)
+	}
+}
+
+func Test_transferRangeReaderIsoImage(t *testing.T) {
+	image, err := NewIsoImage(map[string][]byte{
+		"user-data": []byte("#cloud-config\n"),
+		"large.bin": bytes.Repeat([]byte{1}, 8*transferRangeChunkSize),
+	}, IsoImageOptions{VolumeIdentifier: "cidata", Udf: true})
+	if err != nil {
+		t.Fatalf("error creating image: %s", err)
+	}
+	var content bytes.Buffer
+	_, err = image.WriteTo(&content)
+	if err != nil {
+		t.Fatalf("error writing image: %s", err)
+	}
+	client, href, ranges := testDownloadServer(t, content.Bytes(), 0, false)
+
+	opened, err := iso.Open(newTransferRangeReader(context.Background(), client, href, int64(content.Len())))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	if opened.Volume().Label != "cidata" {
+		t.Errorf("unexpected label '%s'", opened.Volume().Label)
+	}
+	userData, err := opened.ReadFile("user-data")
+	if err != nil || string(userData) != "#cloud-config\n" {
+		t.Errorf("unexpected user-data '%s', %v", userData, err)
+	}
+	// Only the chunks holding the descriptors, the directories and user-data are requested, and not the
+	// content of large.bin
+	if len(*ranges)*transferRangeChunkSize > content.Len()/2 {
+		t.Errorf("too many range requests for an image of %d bytes: %v", content.Len(), *ranges)
+	}
+}
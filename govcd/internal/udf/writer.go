@@ -0,0 +1,1031 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package udf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// The UDF volume descriptor sequences and the logical volume integrity sequence are recorded
+	// between the volume recognition sequence and the anchor, as mkisofs does
+	udfMainVolumeDescriptorSequenceSector    = 32
+	udfReserveVolumeDescriptorSequenceSector = 48
+	udfVolumeDescriptorSequenceLength        = 16 * sectorSize
+	udfIntegritySequenceSector               = 64
+	udfPartitionStartSector                  = anchorVolumeDescriptorSectorNumber + 1
+
+	// A short allocation descriptor holds at most 2^30-1 bytes
+	udfMaxExtentLength = (1 << 30) - sectorSize
+
+	isoPrimary = 0
+	isoJoliet  = 1
+
+	isoMaxFileSize       = 1<<32 - 1
+	isoDirectoryFlag     = 0x02
+	jolietMaxNameLength  = 64
+	udfMaxIdentifierSize = 255
+
+	defaultVolumeIdentifier   = "CDROM"
+	maxVolumeIdentifierLength = 32
+	implementationIdentifier  = "*go-vcloud-director"
+	applicationIdentifier     = "GO-VCLOUD-DIRECTOR"
+)
+
+// udfRevision is the UDF revision of the written file system, 1.02, in the suffix of the entity identifiers
+var udfRevision = []byte{0x02, 0x01}
+
+// ImageFile is a file or a directory written to an image by an ImageWriter
+type ImageFile struct {
+	// Path is the slash separated path of the file in the image, such as "openstack/latest/user_data"
+	Path string
+	// Directory marks a directory. Only empty directories need to be listed: the parent directories
+	// of the files are created
+	Directory bool
+	Size      int64
+	// ModTime is the modification time of the file. The recording time of the image is used when it is zero
+	ModTime time.Time
+	// Executable marks the files that can be executed, in the UDF file system
+	Executable bool
+	// Open returns the content of the file, which must be Size bytes long. It can be nil for empty files
+	Open func() (io.ReadCloser, error)
+}
+
+// WriterOptions are the options of an ImageWriter
+type WriterOptions struct {
+	// VolumeIdentifier is the label of the image, such as "cidata" for cloud-init NoCloud seed images.
+	// It is made of at most 32 ASCII characters
+	VolumeIdentifier string
+	// Udf adds a UDF 1.02 file system to the ISO9660 and Joliet ones. They share the content of the files
+	Udf bool
+	// RecordingTime is the creation time of the image. The current time is used when it is zero
+	RecordingTime time.Time
+}
+
+// ImageWriter writes ISO9660 images with Joliet extensions, and optionally a UDF bridge, from a list of
+// files. The layout of the image is computed when the writer is created, so that its size is known
+// before the files are read
+type ImageWriter struct {
+	options       WriterOptions
+	recordingTime time.Time
+	root          *imageNode
+	// nodes holds every node in depth first order: the order of the UDF file entries and of the file contents
+	nodes []*imageNode
+
+	// directories holds the directories of each ISO9660 tree in path table order
+	directories       [2][]*imageNode
+	pathTableSize     [2]uint32
+	pathTableLocation [2][2]uint32
+
+	dataLocation     uint32
+	partitionLength  uint32
+	nextUniqueId     uint64
+	directoryCount   uint32
+	fileCount        uint32
+	totalSectorCount uint32
+}
+
+type imageNode struct {
+	name     string
+	file     *ImageFile
+	modTime  time.Time
+	parent   *imageNode
+	children []*imageNode
+
+	isoIdentifier [2][]byte
+	isoChildren   [2][]*imageNode
+	isoNumber     [2]uint16
+	isoLocation   [2]uint32
+	isoSize       [2]uint32
+
+	dataLocation uint32
+
+	udfEntry        uint32
+	udfDataLocation uint32
+	udfDataSize     uint32
+	udfUniqueId     uint64
+}
+
+func (node *imageNode) isDir() bool {
+	return node.file == nil
+}
+
+func (node *imageNode) size() int64 {
+	if node.isDir() {
+		return 0
+	}
+	return node.file.Size
+}
+
+// NewImageWriter validates the files and computes the layout of their image
+func NewImageWriter(files []ImageFile, options WriterOptions) (*ImageWriter, error) {
+	if options.VolumeIdentifier == "" {
+		options.VolumeIdentifier = defaultVolumeIdentifier
+	}
+	if len(options.VolumeIdentifier) > maxVolumeIdentifierLength {
+		return nil, fmt.Errorf("volume identifier '%s' is longer than %d characters", options.VolumeIdentifier, maxVolumeIdentifierLength)
+	}
+	for _, c := range options.VolumeIdentifier {
+		if c < 0x20 || c > 0x7e {
+			return nil, fmt.Errorf("volume identifier '%s' must be made of printable ASCII characters", options.VolumeIdentifier)
+		}
+	}
+	recordingTime := options.RecordingTime
+	if recordingTime.IsZero() {
+		recordingTime = time.Now()
+	}
+
+	w := &ImageWriter{
+		options:       options,
+		recordingTime: recordingTime.UTC().Truncate(time.Second),
+	}
+	w.root = &imageNode{modTime: w.recordingTime}
+	for idx := range files {
+		err := w.addFile(&files[idx])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := w.nameNodes(w.root)
+	if err != nil {
+		return nil, err
+	}
+	w.layout()
+	return w, nil
+}
+
+// Size returns the size of the image, in bytes
+func (w *ImageWriter) Size() int64 {
+	return int64(w.totalSectorCount) * sectorSize
+}
+
+// WriteTo writes the image, opening the files in turn
+func (w *ImageWriter) WriteTo(writer io.Writer) (int64, error) {
+	reader := w.NewReader()
+	defer reader.Close()
+	return io.Copy(writer, reader)
+}
+
+// NewReader returns the content of the image, which is Size bytes long. The files are opened when
+// their content is reached, and closed once it is read
+func (w *ImageWriter) NewReader() io.ReadCloser {
+	parts := []func() (io.Reader, error){
+		func() (io.Reader, error) { return bytes.NewReader(w.header()), nil },
+	}
+	for _, node := range w.nodes {
+		if node.isDir() || node.file.Size == 0 {
+			continue
+		}
+		parts = append(parts, func() (io.Reader, error) {
+			file, err := node.file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("error opening file '%s': %s", node.file.Path, err)
+			}
+			return &imageFileReader{
+				path:      node.file.Path,
+				file:      file,
+				remaining: node.file.Size,
+				padding:   int64(sectorCount(node.file.Size))*sectorSize - node.file.Size,
+			}, nil
+		})
+	}
+	if w.options.Udf {
+		parts = append(parts, func() (io.Reader, error) {
+			sector := make([]byte, sectorSize)
+			w.putAnchorVolumeDescriptorPointer(sector, w.totalSectorCount-1)
+			return bytes.NewReader(sector), nil
+		})
+	}
+	return &imageReader{parts: parts}
+}
+
+// addFile adds a file, and its parent directories, to the tree of the image
+func (w *ImageWriter) addFile(file *ImageFile) error {
+	filePath := strings.TrimPrefix(file.Path, "/")
+	if filePath == "" || filePath == "." || !fs.ValidPath(filePath) {
+		return fmt.Errorf("invalid path '%s' in image", file.Path)
+	}
+	if !file.Directory {
+		if file.Size < 0 || file.Size > isoMaxFileSize {
+			return fmt.Errorf("invalid size %d of file '%s': files must be smaller than 4 GiB", file.Size, file.Path)
+		}
+		if file.Size > 0 && file.Open == nil {
+			return fmt.Errorf("file '%s' has no content", file.Path)
+		}
+	}
+	modTime := file.ModTime
+	if modTime.IsZero() {
+		modTime = w.recordingTime
+	}
+
+	parent := w.root
+	names := strings.Split(filePath, "/")
+	for idx, name := range names {
+		var node *imageNode
+		for _, child := range parent.children {
+			if child.name == name {
+				node = child
+				break
+			}
+		}
+		last := idx == len(names)-1
+		if node != nil {
+			// A directory added with its children is a conflict, whatever the order of the paths
+			if !node.isDir() && !last || last && file.Directory != node.isDir() {
+				return fmt.Errorf("path '%s' is both a file and a directory in image", strings.Join(names[:idx+1], "/"))
+			}
+			if last && !file.Directory {
+				return fmt.Errorf("duplicate path '%s' in image", file.Path)
+			}
+			if last {
+				node.modTime = modTime
+			}
+			parent = node
+			continue
+		}
+		node = &imageNode{name: name, parent: parent, modTime: w.recordingTime}
+		if last {
+			node.modTime = modTime
+			if !file.Directory {
+				node.file = file
+			}
+		}
+		parent.children = append(parent.children, node)
+		parent = node
+	}
+	return nil
+}
+
+// nameNodes sets the identifiers of the children of a directory in each file system
+func (w *ImageWriter) nameNodes(dir *imageNode) error {
+	slices.SortFunc(dir.children, func(a, b *imageNode) int { return strings.Compare(a.name, b.name) })
+
+	primaryNames := make(map[string]bool)
+	jolietNames := make(map[string]*imageNode)
+	for _, child := range dir.children {
+		if len(encodeDCharacters(child.name)) > udfMaxIdentifierSize {
+			return fmt.Errorf("the name of '%s' is too long", child.name)
+		}
+
+		primary := isoPrimaryIdentifier(child.name, child.isDir(), primaryNames)
+		primaryNames[primary] = true
+		child.isoIdentifier[isoPrimary] = []byte(primary)
+
+		joliet := jolietIdentifier(child.name, child.isDir())
+		if other, found := jolietNames[string(joliet)]; found {
+			return fmt.Errorf("names '%s' and '%s' are the same in the Joliet file system, which keeps %d characters", other.name, child.name, jolietMaxNameLength)
+		}
+		jolietNames[string(joliet)] = child
+		child.isoIdentifier[isoJoliet] = joliet
+
+		if child.isDir() {
+			err := w.nameNodes(child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for tree := range dir.isoChildren {
+		dir.isoChildren[tree] = slices.Clone(dir.children)
+		slices.SortFunc(dir.isoChildren[tree], func(a, b *imageNode) int {
+			return bytes.Compare(a.isoIdentifier[tree], b.isoIdentifier[tree])
+		})
+	}
+	return nil
+}
+
+// isoPrimaryIdentifier returns the ISO9660 level 1 identifier of a file, which is made of an 8
+// characters name and a 3 characters extension, unique in its directory
+func isoPrimaryIdentifier(name string, isDir bool, used map[string]bool) string {
+	base, extension := name, ""
+	if !isDir {
+		if idx := strings.LastIndex(name, "."); idx > 0 {
+			base, extension = name[:idx], name[idx+1:]
+		}
+	}
+	base = isoDCharacters(base, 8)
+	extension = isoDCharacters(extension, 3)
+	if base == "" {
+		base = "_"
+	}
+	identifier := func(base string) string {
+		if isDir {
+			return base
+		}
+		return base + "." + extension + ";1"
+	}
+	for n := 1; used[identifier(base)]; n++ {
+		suffix := "~" + strconv.Itoa(n)
+		base = base[:min(len(base), 8-len(suffix))] + suffix
+	}
+	return identifier(base)
+}
+
+// isoDCharacters returns the value with upper case letters, digits and underscores only
+func isoDCharacters(value string, maxLength int) string {
+	var result strings.Builder
+	for _, c := range strings.ToUpper(value) {
+		if result.Len() == maxLength {
+			break
+		}
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			result.WriteRune(c)
+		} else {
+			result.WriteByte('_')
+		}
+	}
+	return result.String()
+}
+
+// jolietIdentifier returns the UCS-2 identifier of a file in the Joliet file system, which keeps the
+// first 64 characters of names
+func jolietIdentifier(name string, isDir bool) []byte {
+	characters := utf16.Encode([]rune(name))
+	characters = characters[:min(len(characters), jolietMaxNameLength)]
+	for idx, c := range characters {
+		if c < 0x20 || strings.ContainsRune(`*/:;?\`, rune(c)) {
+			characters[idx] = '_'
+		}
+	}
+	if !isDir {
+		characters = append(characters, ';', '1')
+	}
+	return ucs2(characters)
+}
+
+func ucs2(characters []uint16) []byte {
+	result := make([]byte, 2*len(characters))
+	for idx, c := range characters {
+		binary.BigEndian.PutUint16(result[2*idx:], c)
+	}
+	return result
+}
+
+// layout sets the location of the structures of the file systems and of the file contents
+func (w *ImageWriter) layout() {
+	w.collectNodes(w.root)
+
+	// Primary volume descriptor, Joliet supplementary volume descriptor and terminator
+	sector := uint32(cdromVolumeDescriptorSectorNumber + 3)
+	if w.options.Udf {
+		// The partition holds the file set descriptor and its terminator, the file entries and the
+		// identifiers of the directories. The ISO9660 structures and the file contents follow
+		block := uint32(2)
+		for _, node := range w.nodes {
+			node.udfEntry = block
+			block++
+		}
+		for _, node := range w.nodes {
+			if node.isDir() {
+				node.udfDataLocation = block
+				node.udfDataSize = uint32(len(w.fileIdentifiers(node)))
+				block += sectorCount(int64(node.udfDataSize))
+			}
+		}
+		sector = udfPartitionStartSector + block
+	}
+
+	for tree := range w.directories {
+		w.directories[tree] = []*imageNode{w.root}
+		for idx := 0; idx < len(w.directories[tree]); idx++ {
+			dir := w.directories[tree][idx]
+			dir.isoNumber[tree] = uint16(idx + 1)
+			for _, child := range dir.isoChildren[tree] {
+				if child.isDir() {
+					w.directories[tree] = append(w.directories[tree], child)
+				}
+			}
+		}
+		w.pathTableSize[tree] = uint32(len(w.pathTable(tree, binary.LittleEndian)))
+		for order := range w.pathTableLocation[tree] {
+			w.pathTableLocation[tree][order] = sector
+			sector += sectorCount(int64(w.pathTableSize[tree]))
+		}
+	}
+	for tree := range w.directories {
+		for _, dir := range w.directories[tree] {
+			dir.isoSize[tree] = uint32(w.putDirectory(nil, tree, dir))
+			dir.isoLocation[tree] = sector
+			sector += sectorCount(int64(dir.isoSize[tree]))
+		}
+	}
+
+	w.dataLocation = sector
+	for _, node := range w.nodes {
+		if !node.isDir() {
+			node.dataLocation = sector
+			sector += sectorCount(node.file.Size)
+		}
+	}
+	if w.options.Udf {
+		w.partitionLength = sector - udfPartitionStartSector
+		// Second anchor volume descriptor pointer, in the last sector
+		sector++
+	}
+	w.totalSectorCount = sector
+}
+
+// collectNodes lists the nodes in depth first order and sets their UDF unique identifiers
+func (w *ImageWriter) collectNodes(node *imageNode) {
+	if node == w.root {
+		// The root directory has the unique identifier 0, and the others start at 16
+		w.nextUniqueId = 16
+	} else {
+		node.udfUniqueId = w.nextUniqueId
+		w.nextUniqueId++
+	}
+	w.nodes = append(w.nodes, node)
+	if node.isDir() {
+		w.directoryCount++
+	} else {
+		w.fileCount++
+	}
+	for _, child := range node.children {
+		w.collectNodes(child)
+	}
+}
+
+func sectorCount(size int64) uint32 {
+	return uint32((size + sectorSize - 1) / sectorSize)
+}
+
+// header returns the content of the image up to the file contents
+func (w *ImageWriter) header() []byte {
+	image := make([]byte, w.dataLocation*sectorSize)
+	sector := func(number uint32) []byte {
+		return image[number*sectorSize : (number+1)*sectorSize]
+	}
+
+	w.putVolumeDescriptor(sector(cdromVolumeDescriptorSectorNumber), isoPrimary)
+	w.putVolumeDescriptor(sector(cdromVolumeDescriptorSectorNumber+1), isoJoliet)
+	putCdromVolumeDescriptorHeader(sector(cdromVolumeDescriptorSectorNumber+2), 255, cdromVolumeIdentifierCD001)
+
+	for tree := range w.directories {
+		copy(sector(w.pathTableLocation[tree][0]), w.pathTable(tree, binary.LittleEndian))
+		copy(sector(w.pathTableLocation[tree][1]), w.pathTable(tree, binary.BigEndian))
+		for _, dir := range w.directories[tree] {
+			w.putDirectory(image[dir.isoLocation[tree]*sectorSize:], tree, dir)
+		}
+	}
+
+	if w.options.Udf {
+		putCdromVolumeDescriptorHeader(sector(cdromVolumeDescriptorSectorNumber+3), 0, cdromVolumeIdentifierBEA01)
+		putCdromVolumeDescriptorHeader(sector(cdromVolumeDescriptorSectorNumber+4), 0, cdromVolumeIdentifierNSR02)
+		putCdromVolumeDescriptorHeader(sector(cdromVolumeDescriptorSectorNumber+5), 0, cdromVolumeIdentifierTEA01)
+
+		for _, start := range []uint32{udfMainVolumeDescriptorSequenceSector, udfReserveVolumeDescriptorSequenceSector} {
+			w.putPrimaryVolumeDescriptor(sector(start), start)
+			w.putImplementationUseVolumeDescriptor(sector(start+1), start+1)
+			w.putPartitionDescriptor(sector(start+2), start+2)
+			w.putLogicalVolumeDescriptor(sector(start+3), start+3)
+			putUnallocatedSpaceDescriptor(sector(start+4), start+4)
+			putTerminatingDescriptor(sector(start+5), start+5)
+		}
+		w.putLogicalVolumeIntegrityDescriptor(sector(udfIntegritySequenceSector), udfIntegritySequenceSector)
+		putTerminatingDescriptor(sector(udfIntegritySequenceSector+1), udfIntegritySequenceSector+1)
+		w.putAnchorVolumeDescriptorPointer(sector(anchorVolumeDescriptorSectorNumber), anchorVolumeDescriptorSectorNumber)
+
+		// The locations in the partition are block numbers from its start
+		w.putFileSetDescriptor(sector(udfPartitionStartSector), 0)
+		putTerminatingDescriptor(sector(udfPartitionStartSector+1), 1)
+		for _, node := range w.nodes {
+			w.putFileEntry(sector(udfPartitionStartSector+node.udfEntry), node)
+			if node.isDir() {
+				copy(image[(udfPartitionStartSector+node.udfDataLocation)*sectorSize:], w.fileIdentifiers(node))
+			}
+		}
+	}
+	return image
+}
+
+func putCdromVolumeDescriptorHeader(b []byte, descriptorType uint8, identifier string) {
+	b[0] = descriptorType
+	copy(b[1:6], identifier)
+	b[6] = 1
+}
+
+// putVolumeDescriptor writes the primary volume descriptor of the ISO9660 tree, or the supplementary
+// volume descriptor of the Joliet tree
+func (w *ImageWriter) putVolumeDescriptor(b []byte, tree int) {
+	putText := putPaddedText
+	if tree == isoPrimary {
+		putCdromVolumeDescriptorHeader(b, 1, cdromVolumeIdentifierCD001)
+	} else {
+		putCdromVolumeDescriptorHeader(b, 2, cdromVolumeIdentifierCD001)
+		// UCS-2 level 3
+		copy(b[88:91], "%/E")
+		putText = putPaddedUcs2Text
+	}
+	putText(b[8:40], "")
+	putText(b[40:72], w.options.VolumeIdentifier)
+	putBothEndianUint32(b[80:88], w.totalSectorCount)
+	putBothEndianUint16(b[120:124], 1)
+	putBothEndianUint16(b[124:128], 1)
+	putBothEndianUint16(b[128:132], sectorSize)
+	putBothEndianUint32(b[132:140], w.pathTableSize[tree])
+	binary.LittleEndian.PutUint32(b[140:144], w.pathTableLocation[tree][0])
+	binary.BigEndian.PutUint32(b[148:152], w.pathTableLocation[tree][1])
+	w.putDirectoryRecord(b[156:190], tree, w.root, []byte{0})
+	putText(b[190:318], w.options.VolumeIdentifier)
+	putText(b[318:446], "")
+	putText(b[446:574], "")
+	putText(b[574:702], applicationIdentifier)
+	putText(b[702:813], "")
+	putIsoDateTime(b[813:830], w.recordingTime)
+	putIsoDateTime(b[830:847], w.recordingTime)
+	putIsoDateTime(b[847:864], time.Time{})
+	putIsoDateTime(b[864:881], time.Time{})
+	b[881] = 1
+}
+
+// pathTable returns the path table of a tree, with its numbers in the given byte order
+func (w *ImageWriter) pathTable(tree int, order binary.ByteOrder) []byte {
+	var table []byte
+	for _, dir := range w.directories[tree] {
+		identifier, parent := dir.isoIdentifier[tree], dir.parent
+		if dir == w.root {
+			identifier, parent = []byte{0}, dir
+		}
+		record := make([]byte, 8+len(identifier)+len(identifier)%2)
+		record[0] = byte(len(identifier))
+		order.PutUint32(record[2:6], dir.isoLocation[tree])
+		order.PutUint16(record[6:8], parent.isoNumber[tree])
+		copy(record[8:], identifier)
+		table = append(table, record...)
+	}
+	return table
+}
+
+// putDirectory writes the records of a directory, when b is not nil, and returns their size. The
+// records don't cross sector boundaries
+func (w *ImageWriter) putDirectory(b []byte, tree int, dir *imageNode) int {
+	parent := dir.parent
+	if parent == nil {
+		parent = dir
+	}
+	offset := 0
+	putRecord := func(node *imageNode, identifier []byte) {
+		length := directoryRecordLength(identifier)
+		if offset%sectorSize+length > sectorSize {
+			offset = int(sectorCount(int64(offset))) * sectorSize
+		}
+		if b != nil {
+			w.putDirectoryRecord(b[offset:offset+length], tree, node, identifier)
+		}
+		offset += length
+	}
+	putRecord(dir, []byte{0})
+	putRecord(parent, []byte{1})
+	for _, child := range dir.isoChildren[tree] {
+		putRecord(child, child.isoIdentifier[tree])
+	}
+	return int(sectorCount(int64(offset))) * sectorSize
+}
+
+func directoryRecordLength(identifier []byte) int {
+	return 33 + len(identifier) + (len(identifier)+1)%2
+}
+
+func (w *ImageWriter) putDirectoryRecord(b []byte, tree int, node *imageNode, identifier []byte) {
+	b[0] = byte(directoryRecordLength(identifier))
+	if node.isDir() {
+		putBothEndianUint32(b[2:10], node.isoLocation[tree])
+		putBothEndianUint32(b[10:18], node.isoSize[tree])
+		b[25] = isoDirectoryFlag
+	} else {
+		putBothEndianUint32(b[2:10], node.dataLocation)
+		putBothEndianUint32(b[10:18], uint32(node.file.Size))
+	}
+	modTime := node.modTime.UTC()
+	b[18] = byte(modTime.Year() - 1900)
+	b[19] = byte(modTime.Month())
+	b[20] = byte(modTime.Day())
+	b[21] = byte(modTime.Hour())
+	b[22] = byte(modTime.Minute())
+	b[23] = byte(modTime.Second())
+	putBothEndianUint16(b[28:32], 1)
+	b[32] = byte(len(identifier))
+	copy(b[33:], identifier)
+}
+
+func putBothEndianUint16(b []byte, value uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], value)
+	binary.BigEndian.PutUint16(b[2:4], value)
+}
+
+func putBothEndianUint32(b []byte, value uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], value)
+	binary.BigEndian.PutUint32(b[4:8], value)
+}
+
+func putPaddedText(b []byte, value string) {
+	n := copy(b, value)
+	for idx := n; idx < len(b); idx++ {
+		b[idx] = ' '
+	}
+}
+
+func putPaddedUcs2Text(b []byte, value string) {
+	characters := utf16.Encode([]rune(value))
+	for idx := 0; idx+1 < len(b); idx += 2 {
+		c := uint16(' ')
+		if idx/2 < len(characters) {
+			c = characters[idx/2]
+		}
+		binary.BigEndian.PutUint16(b[idx:], c)
+	}
+}
+
+// putIsoDateTime writes the 17 bytes date and time of volume descriptors. The zero time is written as
+// not specified
+func putIsoDateTime(b []byte, t time.Time) {
+	if t.IsZero() {
+		copy(b, "0000000000000000")
+		b[16] = 0
+		return
+	}
+	t = t.UTC()
+	copy(b, fmt.Sprintf("%04d%02d%02d%02d%02d%02d%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e7))
+	b[16] = 0
+}
+
+// putTag writes the tag of a descriptor, which is the whole b slice, with its checksum and CRC
+func putTag(b []byte, tagId uint16, location uint32) {
+	binary.LittleEndian.PutUint16(b[0:2], tagId)
+	binary.LittleEndian.PutUint16(b[2:4], tagVersion2)
+	binary.LittleEndian.PutUint16(b[6:8], 1)
+	binary.LittleEndian.PutUint16(b[8:10], crcItuT(b[tagSize:]))
+	binary.LittleEndian.PutUint16(b[10:12], uint16(len(b)-tagSize))
+	binary.LittleEndian.PutUint32(b[12:16], location)
+	var checksum uint8
+	for idx := range tagSize {
+		if idx != 4 {
+			checksum += b[idx]
+		}
+	}
+	b[4] = checksum
+}
+
+// crcItuT returns the CRC of the data with the CRC-ITU-T polynomial x^16 + x^12 + x^5 + 1
+func crcItuT(data []byte) uint16 {
+	var crc uint16
+	for _, c := range data {
+		crc ^= uint16(c) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// putDString writes an ASCII value as a dstring, with 8 bits characters and its length in the last byte
+func putDString(b []byte, value string) {
+	if value == "" {
+		return
+	}
+	b[0] = dcharEncodingType8
+	n := copy(b[1:len(b)-1], value)
+	b[len(b)-1] = byte(n + 1)
+}
+
+func putCharspec(b []byte) {
+	b[0] = 0
+	copy(b[1:64], "OSTA Compressed Unicode")
+}
+
+func putEntityId(b []byte, identifier string, suffix []byte) {
+	copy(b[1:24], identifier)
+	copy(b[24:32], suffix)
+}
+
+func putTimestamp(b []byte, t time.Time) {
+	t = t.UTC()
+	// Type 1, local time, with a zero offset from UTC
+	binary.LittleEndian.PutUint16(b[0:2], 1<<12)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(t.Year()))
+	b[4] = byte(t.Month())
+	b[5] = byte(t.Day())
+	b[6] = byte(t.Hour())
+	b[7] = byte(t.Minute())
+	b[8] = byte(t.Second())
+	b[9] = byte(t.Nanosecond() / 1e7)
+	b[10] = byte(t.Nanosecond() / 1e5 % 100)
+	b[11] = byte(t.Nanosecond() / 1e3 % 100)
+}
+
+// putLongAllocationDescriptor writes the address of a file entry in the partition, with its UDF unique identifier
+func putLongAllocationDescriptor(b []byte, length, block uint32, uniqueId uint64) {
+	binary.LittleEndian.PutUint32(b[0:4], length)
+	binary.LittleEndian.PutUint32(b[4:8], block)
+	binary.LittleEndian.PutUint32(b[12:16], uint32(uniqueId))
+}
+
+func (w *ImageWriter) volumeSetIdentifier() string {
+	// The first 16 characters of the volume set identifier should be unique
+	return fmt.Sprintf("%016X%s", w.recordingTime.Unix(), w.options.VolumeIdentifier)
+}
+
+func (w *ImageWriter) putPrimaryVolumeDescriptor(b []byte, location uint32) {
+	d := b[:512]
+	binary.LittleEndian.PutUint32(d[16:20], 0)
+	putDString(d[24:56], w.options.VolumeIdentifier)
+	binary.LittleEndian.PutUint16(d[56:58], 1)
+	binary.LittleEndian.PutUint16(d[58:60], 1)
+	binary.LittleEndian.PutUint16(d[60:62], 2)
+	binary.LittleEndian.PutUint16(d[62:64], 2)
+	binary.LittleEndian.PutUint32(d[64:68], 1)
+	binary.LittleEndian.PutUint32(d[68:72], 1)
+	putDString(d[72:200], w.volumeSetIdentifier())
+	putCharspec(d[200:264])
+	putCharspec(d[264:328])
+	putTimestamp(d[376:388], w.recordingTime)
+	putEntityId(d[388:420], implementationIdentifier, nil)
+	putTag(d, tagPrimaryVolumeDescriptor, location)
+}
+
+func (w *ImageWriter) putImplementationUseVolumeDescriptor(b []byte, location uint32) {
+	d := b[:512]
+	binary.LittleEndian.PutUint32(d[16:20], 1)
+	putEntityId(d[20:52], entityIdentifierLVInfo, udfRevision)
+	putCharspec(d[52:116])
+	putDString(d[116:244], w.options.VolumeIdentifier)
+	putEntityId(d[352:384], implementationIdentifier, nil)
+	putTag(d, tagImplementationUseVolumeDescriptor, location)
+}
+
+func (w *ImageWriter) putPartitionDescriptor(b []byte, location uint32) {
+	d := b[:512]
+	binary.LittleEndian.PutUint32(d[16:20], 2)
+	// Allocated partition number 0
+	binary.LittleEndian.PutUint16(d[20:22], 1)
+	putEntityId(d[24:56], "+NSR02", nil)
+	// Read only access
+	binary.LittleEndian.PutUint32(d[184:188], 1)
+	binary.LittleEndian.PutUint32(d[188:192], udfPartitionStartSector)
+	binary.LittleEndian.PutUint32(d[192:196], w.partitionLength)
+	putEntityId(d[196:228], implementationIdentifier, nil)
+	putTag(d, tagPartitionDescriptor, location)
+}
+
+func (w *ImageWriter) putLogicalVolumeDescriptor(b []byte, location uint32) {
+	d := b[:446]
+	binary.LittleEndian.PutUint32(d[16:20], 3)
+	putCharspec(d[20:84])
+	putDString(d[84:212], w.options.VolumeIdentifier)
+	binary.LittleEndian.PutUint32(d[212:216], sectorSize)
+	putEntityId(d[216:248], entityIdentifierOSTACompliant, udfRevision)
+	// The file set descriptor is the first block of the partition
+	putLongAllocationDescriptor(d[248:264], sectorSize, 0, 0)
+	binary.LittleEndian.PutUint32(d[264:268], 6)
+	binary.LittleEndian.PutUint32(d[268:272], 1)
+	putEntityId(d[272:304], implementationIdentifier, nil)
+	binary.LittleEndian.PutUint32(d[432:436], 2*sectorSize)
+	binary.LittleEndian.PutUint32(d[436:440], udfIntegritySequenceSector)
+	// Type 1 partition map of partition 0 of volume 1
+	d[440] = 1
+	d[441] = 6
+	binary.LittleEndian.PutUint16(d[442:444], 1)
+	putTag(d, tagLogicalVolumeDescriptor, location)
+}
+
+func putUnallocatedSpaceDescriptor(b []byte, location uint32) {
+	d := b[:24]
+	binary.LittleEndian.PutUint32(d[16:20], 4)
+	putTag(d, tagUnallocatedSpaceDescriptor, location)
+}
+
+func putTerminatingDescriptor(b []byte, location uint32) {
+	putTag(b[:512], tagTerminatingDescriptor, location)
+}
+
+func (w *ImageWriter) putLogicalVolumeIntegrityDescriptor(b []byte, location uint32) {
+	d := b[:134]
+	putTimestamp(d[16:28], w.recordingTime)
+	// Closed integrity entry
+	binary.LittleEndian.PutUint32(d[28:32], 1)
+	binary.LittleEndian.PutUint64(d[40:48], w.nextUniqueId)
+	binary.LittleEndian.PutUint32(d[72:76], 1)
+	binary.LittleEndian.PutUint32(d[76:80], 46)
+	binary.LittleEndian.PutUint32(d[84:88], w.partitionLength)
+	putEntityId(d[88:120], implementationIdentifier, nil)
+	binary.LittleEndian.PutUint32(d[120:124], w.fileCount)
+	binary.LittleEndian.PutUint32(d[124:128], w.directoryCount)
+	binary.LittleEndian.PutUint16(d[128:130], 0x0102)
+	binary.LittleEndian.PutUint16(d[130:132], 0x0102)
+	binary.LittleEndian.PutUint16(d[132:134], 0x0102)
+	putTag(d, tagLogicalVolumeIntegrityDescriptor, location)
+}
+
+func (w *ImageWriter) putAnchorVolumeDescriptorPointer(b []byte, location uint32) {
+	d := b[:512]
+	binary.LittleEndian.PutUint32(d[16:20], udfVolumeDescriptorSequenceLength)
+	binary.LittleEndian.PutUint32(d[20:24], udfMainVolumeDescriptorSequenceSector)
+	binary.LittleEndian.PutUint32(d[24:28], udfVolumeDescriptorSequenceLength)
+	binary.LittleEndian.PutUint32(d[28:32], udfReserveVolumeDescriptorSequenceSector)
+	putTag(d, tagAnchorVolumeDescriptorPointer, location)
+}
+
+func (w *ImageWriter) putFileSetDescriptor(b []byte, location uint32) {
+	d := b[:512]
+	putTimestamp(d[16:28], w.recordingTime)
+	binary.LittleEndian.PutUint16(d[28:30], 3)
+	binary.LittleEndian.PutUint16(d[30:32], 3)
+	binary.LittleEndian.PutUint32(d[32:36], 1)
+	binary.LittleEndian.PutUint32(d[36:40], 1)
+	putCharspec(d[48:112])
+	putDString(d[112:240], w.options.VolumeIdentifier)
+	putCharspec(d[240:304])
+	putDString(d[304:336], w.options.VolumeIdentifier)
+	putLongAllocationDescriptor(d[400:416], sectorSize, w.root.udfEntry, w.root.udfUniqueId)
+	putEntityId(d[416:448], entityIdentifierOSTACompliant, udfRevision)
+	putTag(d, tagFileSetDescriptor, location)
+}
+
+// putFileEntry writes the file entry of a node, with short allocation descriptors of its content
+func (w *ImageWriter) putFileEntry(b []byte, node *imageNode) {
+	var extents []Extent
+	var mode fs.FileMode = 0444
+	var fileType uint8 = fileTypeBytes
+	linkCount := uint16(1)
+	size := uint64(node.size())
+	if node.isDir() {
+		mode, fileType, size = 0555, fileTypeDirectory, uint64(node.udfDataSize)
+		extents = []Extent{{Length: node.udfDataSize, Location: node.udfDataLocation}}
+		for _, child := range node.children {
+			if child.isDir() {
+				linkCount++
+			}
+		}
+	} else {
+		if node.file.Executable {
+			mode = 0555
+		}
+		for offset := uint64(0); offset < size; offset += udfMaxExtentLength {
+			extents = append(extents, Extent{
+				Length:   uint32(min(size-offset, udfMaxExtentLength)),
+				Location: node.dataLocation - udfPartitionStartSector + uint32(offset/sectorSize),
+			})
+		}
+	}
+
+	d := b[:176+8*len(extents)]
+	// Strategy 4 ICB tag, with short allocation descriptors
+	binary.LittleEndian.PutUint16(d[20:22], 4)
+	binary.LittleEndian.PutUint16(d[24:26], 1)
+	d[27] = fileType
+	binary.LittleEndian.PutUint32(d[36:40], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(d[40:44], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(d[44:48], uint32(ToFileMode(mode)))
+	binary.LittleEndian.PutUint16(d[48:50], linkCount)
+	binary.LittleEndian.PutUint64(d[56:64], size)
+	binary.LittleEndian.PutUint64(d[64:72], uint64(sectorCount(int64(size))))
+	putTimestamp(d[72:84], node.modTime)
+	putTimestamp(d[84:96], node.modTime)
+	putTimestamp(d[96:108], node.modTime)
+	binary.LittleEndian.PutUint32(d[108:112], 1)
+	putEntityId(d[128:160], implementationIdentifier, nil)
+	binary.LittleEndian.PutUint64(d[160:168], node.udfUniqueId)
+	binary.LittleEndian.PutUint32(d[172:176], uint32(8*len(extents)))
+	for idx, extent := range extents {
+		binary.LittleEndian.PutUint32(d[176+8*idx:], extent.Length)
+		binary.LittleEndian.PutUint32(d[180+8*idx:], extent.Location)
+	}
+	putTag(d, tagFileEntry, node.udfEntry)
+}
+
+// fileIdentifiers returns the file identifier descriptors of a directory: its parent, then its children
+func (w *ImageWriter) fileIdentifiers(dir *imageNode) []byte {
+	var identifiers []byte
+	put := func(node *imageNode, characteristics FileCharacteristics, identifier []byte) {
+		length := 38 + len(identifier)
+		d := make([]byte, 4*((length+3)/4))
+		binary.LittleEndian.PutUint16(d[16:18], 1)
+		d[18] = uint8(characteristics)
+		d[19] = uint8(len(identifier))
+		putLongAllocationDescriptor(d[20:36], sectorSize, node.udfEntry, node.udfUniqueId)
+		copy(d[38:], identifier)
+		putTag(d, tagFileIdentifierDescriptor, dir.udfDataLocation+uint32(len(identifiers)/sectorSize))
+		identifiers = append(identifiers, d...)
+	}
+
+	parent := dir.parent
+	if parent == nil {
+		parent = dir
+	}
+	put(parent, FileCharacteristicDirectory|FileCharacteristicParent, nil)
+	for _, child := range dir.children {
+		var characteristics FileCharacteristics
+		if child.isDir() {
+			characteristics = FileCharacteristicDirectory
+		}
+		put(child, characteristics, encodeDCharacters(child.name))
+	}
+	return identifiers
+}
+
+// imageReader reads the parts of an image in turn
+type imageReader struct {
+	parts   []func() (io.Reader, error)
+	current io.Reader
+	err     error
+}
+
+func (r *imageReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			r.current, r.err = r.parts[0]()
+			r.parts = r.parts[1:]
+			continue
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		r.err = err
+		return n, err
+	}
+	return 0, r.err
+}
+
+// Close closes the file being read, if any
+func (r *imageReader) Close() error {
+	if closer, ok := r.current.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// imageFileReader reads the content of a file, which must be as long as its declared size, followed
+// by the padding to the end of its last sector
+type imageFileReader struct {
+	path      string
+	file      io.ReadCloser
+	remaining int64
+	padding   int64
+}
+
+func (r *imageFileReader) Read(p []byte) (int, error) {
+	if r.remaining > 0 {
+		n, err := r.file.Read(p[:min(int64(len(p)), r.remaining)])
+		r.remaining -= int64(n)
+		if err == io.EOF && r.remaining > 0 {
+			return n, fmt.Errorf("file '%s' is shorter than its size", r.path)
+		}
+		if err != nil && err != io.EOF {
+			return n, fmt.Errorf("error reading file '%s': %s", r.path, err)
+		}
+		return n, nil
+	}
+	if r.file != nil {
+		_, err := io.ReadFull(r.file, make([]byte, 1))
+		if err == nil {
+			return 0, fmt.Errorf("file '%s' is longer than its size", r.path)
+		}
+		if err != io.EOF {
+			return 0, fmt.Errorf("error reading file '%s': %s", r.path, err)
+		}
+		err = r.Close()
+		if err != nil {
+			return 0, fmt.Errorf("error closing file '%s': %s", r.path, err)
+		}
+	}
+	if r.padding > 0 {
+		n := int(min(int64(len(p)), r.padding))
+		clear(p[:n])
+		r.padding -= int64(n)
+		return n, nil
+	}
+	return 0, io.EOF
+}
+
+// Close closes the file, when it is still open
+func (r *imageFileReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,593 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// InventorySchemaVersion is the version of the JSON document produced by VCDClient.GetInventory.
+// It must be increased whenever the structure of Inventory or InventoryEntity changes in a way
+// that is not backwards compatible
+const InventorySchemaVersion = "1.0"
+
+// defaultInventoryConcurrency is the number of concurrent API calls used by the inventory walker
+// when InventoryOptions.Concurrency is not set
+const defaultInventoryConcurrency = 8
+
+// InventoryEntityKind identifies the type of entity stored in an Inventory
+type InventoryEntityKind string
+
+const (
+	InventoryKindOrg                InventoryEntityKind = "org"
+	InventoryKindVdc                InventoryEntityKind = "vdc"
+	InventoryKindVdcGroup           InventoryEntityKind = "vdcGroup"
+	InventoryKindVApp               InventoryEntityKind = "vapp"
+	InventoryKindVm                 InventoryEntityKind = "vm"
+	InventoryKindCatalog            InventoryEntityKind = "catalog"
+	InventoryKindCatalogItem        InventoryEntityKind = "catalogItem"
+	InventoryKindOrgVdcNetwork      InventoryEntityKind = "orgVdcNetwork"
+	InventoryKindNsxtEdgeGateway    InventoryEntityKind = "nsxtEdgeGateway"
+	InventoryKindNsxtNatRule        InventoryEntityKind = "nsxtNatRule"
+	InventoryKindNsxtFirewallRule   InventoryEntityKind = "nsxtFirewallRule"
+	InventoryKindNsxtIpSecVpnTunnel InventoryEntityKind = "nsxtIpSecVpnTunnel"
+	InventoryKindIpSpace            InventoryEntityKind = "ipSpace"
+	InventoryKindUser               InventoryEntityKind = "user"
+	InventoryKindRole               InventoryEntityKind = "role"
+	// InventoryKindMetadata is not stored as a separate entity. When included, metadata is
+	// attached to each entity that supports it (InventoryEntity.Metadata)
+	InventoryKindMetadata InventoryEntityKind = "metadata"
+)
+
+// AllInventoryKinds lists all the entity kinds that the inventory walker knows about
+var AllInventoryKinds = []InventoryEntityKind{
+	InventoryKindOrg,
+	InventoryKindVdc,
+	InventoryKindVdcGroup,
+	InventoryKindVApp,
+	InventoryKindVm,
+	InventoryKindCatalog,
+	InventoryKindCatalogItem,
+	InventoryKindOrgVdcNetwork,
+	InventoryKindNsxtEdgeGateway,
+	InventoryKindNsxtNatRule,
+	InventoryKindNsxtFirewallRule,
+	InventoryKindNsxtIpSecVpnTunnel,
+	InventoryKindIpSpace,
+	InventoryKindUser,
+	InventoryKindRole,
+	InventoryKindMetadata,
+}
+
+// InventoryOptions defines the scope of an inventory walk
+type InventoryOptions struct {
+	// OrgName restricts the inventory to a single organization. When empty, all organizations
+	// visible to the current user are walked
+	OrgName string
+	// IncludeKinds, when not empty, restricts the inventory to the given entity kinds
+	IncludeKinds []InventoryEntityKind
+	// ExcludeKinds removes the given entity kinds from the inventory. It is evaluated after
+	// IncludeKinds
+	ExcludeKinds []InventoryEntityKind
+	// Concurrency is the maximum number of API calls running at the same time. Defaults to 8
+	Concurrency int
+}
+
+// InventoryEntity is a single node of the inventory graph
+type InventoryEntity struct {
+	// Id is the URN of the entity. For entities that don't have a URN (such as NAT rules), a
+	// synthetic one is built using the entity kind (see inventoryKey)
+	Id       string              `json:"id"`
+	Kind     InventoryEntityKind `json:"kind"`
+	Name     string              `json:"name"`
+	ParentId string              `json:"parentId,omitempty"`
+	// Data contains the entity definition as returned by the API (e.g. *types.Vm)
+	Data     any                    `json:"data"`
+	Metadata []*types.MetadataEntry `json:"metadata,omitempty"`
+}
+
+// InventoryError records a failure that happened while walking the inventory.
+// A failure does not stop the walk: the inventory is returned with all the entities that could
+// be retrieved, and the list of errors
+type InventoryError struct {
+	Kind     InventoryEntityKind `json:"kind"`
+	ParentId string              `json:"parentId,omitempty"`
+	Message  string              `json:"message"`
+}
+
+// Inventory is a point-in-time snapshot of a VCD instance or a single organization.
+// Entities are stored as a graph, keyed by URN, where each entity refers to its parent
+type Inventory struct {
+	SchemaVersion string                      `json:"schemaVersion"`
+	GeneratedAt   time.Time                   `json:"generatedAt"`
+	VcdHref       string                      `json:"vcdHref"`
+	ApiVersion    string                      `json:"apiVersion"`
+	Kinds         []InventoryEntityKind       `json:"kinds"`
+	Entities      map[string]*InventoryEntity `json:"entities"`
+	Errors        []InventoryError            `json:"errors,omitempty"`
+}
+
+// GetInventory walks the VCD instance (or the single organization defined in options.OrgName) and
+// returns a point-in-time snapshot of the entities selected by options.
+// Calls to the API are run concurrently. Failures to retrieve a given entity or list of entities
+// are recorded in Inventory.Errors and do not stop the walk. An error is only returned when the
+// list of organizations can't be retrieved.
+func (vcdClient *VCDClient) GetInventory(options *InventoryOptions) (*Inventory, error) {
+	if options == nil {
+		options = &InventoryOptions{}
+	}
+	kinds, err := inventoryKinds(options.IncludeKinds, options.ExcludeKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	var orgRefs []*types.Org
+	if options.OrgName != "" {
+		orgRefs = append(orgRefs, &types.Org{Name: options.OrgName})
+	} else {
+		orgList, err := vcdClient.GetOrgList()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving list of organizations for inventory: %s", err)
+		}
+		orgRefs = orgList.Org
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultInventoryConcurrency
+	}
+
+	walker := &inventoryWalker{
+		vcdClient: vcdClient,
+		kinds:     kinds,
+		semaphore: make(chan struct{}, concurrency),
+		inventory: &Inventory{
+			SchemaVersion: InventorySchemaVersion,
+			GeneratedAt:   time.Now().UTC(),
+			VcdHref:       vcdClient.Client.VCDHREF.String(),
+			ApiVersion:    vcdClient.Client.APIVersion,
+			Kinds:         kinds,
+			Entities:      make(map[string]*InventoryEntity),
+		},
+	}
+
+	for _, orgRef := range orgRefs {
+		orgName := orgRef.Name
+		walker.spawn(func() { walker.walkOrg(orgName) })
+	}
+	if walker.wants(InventoryKindIpSpace) {
+		walker.spawn(func() { walker.walkIpSpaces(options.OrgName) })
+	}
+	walker.wg.Wait()
+
+	util.Logger.Printf("[TRACE] inventory completed with %d entities and %d errors",
+		len(walker.inventory.Entities), len(walker.inventory.Errors))
+	return walker.inventory, nil
+}
+
+// Json returns the inventory as an indented JSON document
+func (inventory *Inventory) Json() ([]byte, error) {
+	return json.MarshalIndent(inventory, "", "  ")
+}
+
+// GetEntitiesByKind returns all the entities of a given kind, sorted by ID
+func (inventory *Inventory) GetEntitiesByKind(kind InventoryEntityKind) []*InventoryEntity {
+	var result []*InventoryEntity
+	for _, entity := range inventory.Entities {
+		if entity.Kind == kind {
+			result = append(result, entity)
+		}
+	}
+	slices.SortFunc(result, func(a, b *InventoryEntity) int { return strings.Compare(a.Id, b.Id) })
+	return result
+}
+
+// GetChildren returns all the entities having the given parent ID, sorted by ID
+func (inventory *Inventory) GetChildren(parentId string) []*InventoryEntity {
+	var result []*InventoryEntity
+	for _, entity := range inventory.Entities {
+		if entity.ParentId == parentId {
+			result = append(result, entity)
+		}
+	}
+	slices.SortFunc(result, func(a, b *InventoryEntity) int { return strings.Compare(a.Id, b.Id) })
+	return result
+}
+
+// inventoryKinds evaluates the include and exclude lists, returning the kinds that should be
+// collected
+func inventoryKinds(include, exclude []InventoryEntityKind) ([]InventoryEntityKind, error) {
+	for _, kind := range slices.Concat(include, exclude) {
+		if !slices.Contains(AllInventoryKinds, kind) {
+			return nil, fmt.Errorf("unknown inventory kind '%s'", kind)
+		}
+	}
+	var result []InventoryEntityKind
+	for _, kind := range AllInventoryKinds {
+		if len(include) > 0 && !slices.Contains(include, kind) {
+			continue
+		}
+		if slices.Contains(exclude, kind) {
+			continue
+		}
+		result = append(result, kind)
+	}
+	return result, nil
+}
+
+// inventoryKey returns the key used to store an entity in the inventory. IDs that are already a
+// URN are returned unchanged. Other IDs are converted to a synthetic URN using the entity kind
+func inventoryKey(kind InventoryEntityKind, id string) string {
+	if strings.HasPrefix(id, "urn:") {
+		return id
+	}
+	return fmt.Sprintf("urn:vcloud:%s:%s", kind, id)
+}
+
+// inventoryWalker holds the state of a running inventory walk
+type inventoryWalker struct {
+	vcdClient *VCDClient
+	kinds     []InventoryEntityKind
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	inventory *Inventory
+}
+
+// wants returns true if the given kind was requested
+func (w *inventoryWalker) wants(kind InventoryEntityKind) bool {
+	return slices.Contains(w.kinds, kind)
+}
+
+// wantsAny returns true if at least one of the given kinds was requested
+func (w *inventoryWalker) wantsAny(kinds ...InventoryEntityKind) bool {
+	for _, kind := range kinds {
+		if w.wants(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// spawn runs the given function in a goroutine, limiting the number of functions running at the
+// same time to the size of the semaphore. Functions run by spawn must not wait for other spawned
+// functions
+func (w *inventoryWalker) spawn(f func()) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.semaphore <- struct{}{}
+		defer func() { <-w.semaphore }()
+		f()
+	}()
+}
+
+// add stores an entity in the inventory
+func (w *inventoryWalker) add(kind InventoryEntityKind, id, name, parentId string, data any) *InventoryEntity {
+	entity := &InventoryEntity{
+		Id:       inventoryKey(kind, id),
+		Kind:     kind,
+		Name:     name,
+		ParentId: parentId,
+		Data:     data,
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.inventory.Entities[entity.Id] = entity
+	return entity
+}
+
+// addError records a failure without stopping the walk
+func (w *inventoryWalker) addError(kind InventoryEntityKind, parentId string, err error) {
+	util.Logger.Printf("[ERROR] inventory: error retrieving %s (parent '%s'): %s", kind, parentId, err)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.inventory.Errors = append(w.inventory.Errors, InventoryError{
+		Kind:     kind,
+		ParentId: parentId,
+		Message:  err.Error(),
+	})
+}
+
+// addMetadata retrieves the metadata for an entity in a separate goroutine, if metadata was
+// requested
+func (w *inventoryWalker) addMetadata(entity *InventoryEntity, getMetadata func() (*types.Metadata, error)) {
+	if !w.wants(InventoryKindMetadata) {
+		return
+	}
+	w.spawn(func() {
+		metadata, err := getMetadata()
+		if err != nil {
+			w.addError(InventoryKindMetadata, entity.Id, err)
+			return
+		}
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		entity.Metadata = metadata.MetadataEntry
+	})
+}
+
+func (w *inventoryWalker) walkOrg(orgName string) {
+	adminOrg, err := w.vcdClient.GetAdminOrgByName(orgName)
+	if err != nil {
+		w.addError(InventoryKindOrg, "", fmt.Errorf("error retrieving organization '%s': %s", orgName, err))
+		return
+	}
+	orgId := adminOrg.AdminOrg.ID
+	// The tenant context is initialized lazily. Setting it here prevents concurrent functions
+	// from initializing it at the same time
+	_, err = adminOrg.getTenantContext()
+	if err != nil {
+		w.addError(InventoryKindOrg, orgId, err)
+		return
+	}
+	if w.wants(InventoryKindOrg) {
+		entity := w.add(InventoryKindOrg, orgId, adminOrg.AdminOrg.Name, "", adminOrg.AdminOrg)
+		w.addMetadata(entity, adminOrg.GetMetadata)
+	}
+
+	if adminOrg.AdminOrg.Vdcs != nil {
+		for _, vdcRef := range adminOrg.AdminOrg.Vdcs.Vdcs {
+			vdcHref := vdcRef.HREF
+			w.spawn(func() { w.walkVdc(adminOrg, vdcHref) })
+		}
+	}
+	if w.wantsAny(InventoryKindVdcGroup, InventoryKindOrgVdcNetwork, InventoryKindNsxtEdgeGateway,
+		InventoryKindNsxtNatRule, InventoryKindNsxtFirewallRule, InventoryKindNsxtIpSecVpnTunnel) {
+		w.spawn(func() { w.walkVdcGroups(adminOrg) })
+	}
+	if w.wantsAny(InventoryKindCatalog, InventoryKindCatalogItem) && adminOrg.AdminOrg.Catalogs != nil {
+		for _, catalogRef := range adminOrg.AdminOrg.Catalogs.Catalog {
+			catalogHref := catalogRef.HREF
+			w.spawn(func() { w.walkCatalog(adminOrg, catalogHref) })
+		}
+	}
+	if w.wants(InventoryKindUser) && adminOrg.AdminOrg.Users != nil {
+		for _, userRef := range adminOrg.AdminOrg.Users.User {
+			userHref := userRef.HREF
+			w.spawn(func() {
+				user, err := adminOrg.GetUserByHref(userHref)
+				if err != nil {
+					w.addError(InventoryKindUser, orgId, err)
+					return
+				}
+				w.add(InventoryKindUser, user.User.ID, user.User.Name, orgId, user.User)
+			})
+		}
+	}
+	if w.wants(InventoryKindRole) {
+		w.spawn(func() {
+			roles, err := adminOrg.GetAllRoles(nil)
+			if err != nil {
+				w.addError(InventoryKindRole, orgId, err)
+				return
+			}
+			for _, role := range roles {
+				w.add(InventoryKindRole, role.Role.ID, role.Role.Name, orgId, role.Role)
+			}
+		})
+	}
+}
+
+func (w *inventoryWalker) walkVdc(adminOrg *AdminOrg, vdcHref string) {
+	orgId := adminOrg.AdminOrg.ID
+	vdc, err := adminOrg.GetVDCByHref(vdcHref)
+	if err != nil {
+		w.addError(InventoryKindVdc, orgId, err)
+		return
+	}
+	vdcId := vdc.Vdc.ID
+	if w.wants(InventoryKindVdc) {
+		entity := w.add(InventoryKindVdc, vdcId, vdc.Vdc.Name, orgId, vdc.Vdc)
+		w.addMetadata(entity, vdc.GetMetadata)
+	}
+
+	if w.wantsAny(InventoryKindVApp, InventoryKindVm) {
+		for _, vappRef := range vdc.GetVappList() {
+			vappHref := vappRef.HREF
+			w.spawn(func() { w.walkVApp(vdc, vappHref) })
+		}
+	}
+
+	if !vdc.IsNsxt() {
+		return
+	}
+	if w.wants(InventoryKindOrgVdcNetwork) {
+		w.spawn(func() {
+			networks, err := vdc.GetAllOpenApiOrgVdcNetworks(nil)
+			if err != nil {
+				w.addError(InventoryKindOrgVdcNetwork, vdcId, err)
+				return
+			}
+			w.addNetworks(networks, vdcId)
+		})
+	}
+	if w.wantsAny(InventoryKindNsxtEdgeGateway, InventoryKindNsxtNatRule, InventoryKindNsxtFirewallRule, InventoryKindNsxtIpSecVpnTunnel) {
+		w.spawn(func() {
+			edgeGateways, err := vdc.GetAllNsxtEdgeGateways(nil)
+			if err != nil {
+				w.addError(InventoryKindNsxtEdgeGateway, vdcId, err)
+				return
+			}
+			w.addEdgeGateways(edgeGateways, vdcId)
+		})
+	}
+}
+
+// walkVdcGroups collects VDC groups and the networking entities that they own
+func (w *inventoryWalker) walkVdcGroups(adminOrg *AdminOrg) {
+	orgId := adminOrg.AdminOrg.ID
+	vdcGroups, err := adminOrg.GetAllVdcGroups(nil)
+	if err != nil {
+		w.addError(InventoryKindVdcGroup, orgId, err)
+		return
+	}
+	for _, vdcGroup := range vdcGroups {
+		vdcGroupId := vdcGroup.VdcGroup.Id
+		if w.wants(InventoryKindVdcGroup) {
+			w.add(InventoryKindVdcGroup, vdcGroupId, vdcGroup.VdcGroup.Name, orgId, vdcGroup.VdcGroup)
+		}
+		if w.wants(InventoryKindOrgVdcNetwork) {
+			w.spawn(func() {
+				networks, err := vdcGroup.GetAllOpenApiOrgVdcNetworks(nil)
+				if err != nil {
+					w.addError(InventoryKindOrgVdcNetwork, vdcGroupId, err)
+					return
+				}
+				w.addNetworks(networks, vdcGroupId)
+			})
+		}
+		if w.wantsAny(InventoryKindNsxtEdgeGateway, InventoryKindNsxtNatRule, InventoryKindNsxtFirewallRule, InventoryKindNsxtIpSecVpnTunnel) {
+			w.spawn(func() {
+				edgeGateways, err := vdcGroup.GetAllNsxtEdgeGateways(nil)
+				if err != nil {
+					w.addError(InventoryKindNsxtEdgeGateway, vdcGroupId, err)
+					return
+				}
+				w.addEdgeGateways(edgeGateways, vdcGroupId)
+			})
+		}
+	}
+}
+
+func (w *inventoryWalker) addNetworks(networks []*OpenApiOrgVdcNetwork, parentId string) {
+	for _, network := range networks {
+		entity := w.add(InventoryKindOrgVdcNetwork, network.OpenApiOrgVdcNetwork.ID,
+			network.OpenApiOrgVdcNetwork.Name, parentId, network.OpenApiOrgVdcNetwork)
+		w.addMetadata(entity, network.GetMetadata)
+	}
+}
+
+func (w *inventoryWalker) addEdgeGateways(edgeGateways []*NsxtEdgeGateway, parentId string) {
+	for _, edgeGateway := range edgeGateways {
+		edgeId := edgeGateway.EdgeGateway.ID
+		if w.wants(InventoryKindNsxtEdgeGateway) {
+			w.add(InventoryKindNsxtEdgeGateway, edgeId, edgeGateway.EdgeGateway.Name, parentId, edgeGateway.EdgeGateway)
+		}
+		if w.wants(InventoryKindNsxtNatRule) {
+			w.spawn(func() {
+				natRules, err := edgeGateway.GetAllNatRules(nil)
+				if err != nil {
+					w.addError(InventoryKindNsxtNatRule, edgeId, err)
+					return
+				}
+				for _, rule := range natRules {
+					w.add(InventoryKindNsxtNatRule, rule.NsxtNatRule.ID, rule.NsxtNatRule.Name, edgeId, rule.NsxtNatRule)
+				}
+			})
+		}
+		if w.wants(InventoryKindNsxtFirewallRule) {
+			w.spawn(func() {
+				firewall, err := edgeGateway.GetNsxtFirewall()
+				if err != nil {
+					w.addError(InventoryKindNsxtFirewallRule, edgeId, err)
+					return
+				}
+				// Only user defined rules are collected, as system and default rules are managed by VCD
+				for _, rule := range firewall.NsxtFirewallRuleContainer.UserDefinedRules {
+					w.add(InventoryKindNsxtFirewallRule, rule.ID, rule.Name, edgeId, rule)
+				}
+			})
+		}
+		if w.wants(InventoryKindNsxtIpSecVpnTunnel) {
+			w.spawn(func() {
+				tunnels, err := edgeGateway.GetAllIpSecVpnTunnels(nil)
+				if err != nil {
+					w.addError(InventoryKindNsxtIpSecVpnTunnel, edgeId, err)
+					return
+				}
+				for _, tunnel := range tunnels {
+					w.add(InventoryKindNsxtIpSecVpnTunnel, tunnel.NsxtIpSecVpn.ID, tunnel.NsxtIpSecVpn.Name, edgeId, tunnel.NsxtIpSecVpn)
+				}
+			})
+		}
+	}
+}
+
+func (w *inventoryWalker) walkVApp(vdc *Vdc, vappHref string) {
+	vdcId := vdc.Vdc.ID
+	vapp, err := vdc.GetVAppByHref(vappHref)
+	if err != nil {
+		w.addError(InventoryKindVApp, vdcId, err)
+		return
+	}
+	vappId := vapp.VApp.ID
+	if w.wants(InventoryKindVApp) {
+		// VMs are stored as separate entities. Removing them from the vApp definition avoids
+		// storing the same data twice
+		vappData := *vapp.VApp
+		vappData.Children = nil
+		entity := w.add(InventoryKindVApp, vappId, vapp.VApp.Name, vdcId, &vappData)
+		w.addMetadata(entity, vapp.GetMetadata)
+	}
+	if !w.wants(InventoryKindVm) || vapp.VApp.Children == nil {
+		return
+	}
+	for _, vmDefinition := range vapp.VApp.Children.VM {
+		vm := NewVM(vapp.client)
+		vm.VM = vmDefinition
+		entity := w.add(InventoryKindVm, vmDefinition.ID, vmDefinition.Name, vappId, vmDefinition)
+		w.addMetadata(entity, vm.GetMetadata)
+	}
+}
+
+func (w *inventoryWalker) walkCatalog(adminOrg *AdminOrg, catalogHref string) {
+	orgId := adminOrg.AdminOrg.ID
+	catalog, err := adminOrg.GetAdminCatalogByHref(catalogHref)
+	if err != nil {
+		w.addError(InventoryKindCatalog, orgId, err)
+		return
+	}
+	catalogId := catalog.AdminCatalog.ID
+	if w.wants(InventoryKindCatalog) {
+		entity := w.add(InventoryKindCatalog, catalogId, catalog.AdminCatalog.Name, orgId, catalog.AdminCatalog)
+		w.addMetadata(entity, catalog.GetMetadata)
+	}
+	if !w.wants(InventoryKindCatalogItem) {
+		return
+	}
+	for _, catalogItems := range catalog.AdminCatalog.CatalogItems {
+		for _, itemRef := range catalogItems.CatalogItem {
+			itemHref := itemRef.HREF
+			w.spawn(func() {
+				item, err := catalog.GetCatalogItemByHref(itemHref)
+				if err != nil {
+					w.addError(InventoryKindCatalogItem, catalogId, err)
+					return
+				}
+				entity := w.add(InventoryKindCatalogItem, item.CatalogItem.ID, item.CatalogItem.Name, catalogId, item.CatalogItem)
+				w.addMetadata(entity, item.GetMetadata)
+			})
+		}
+	}
+}
+
+// walkIpSpaces collects IP Spaces. When orgName is set, only the private IP Spaces belonging to
+// that organization are included
+func (w *inventoryWalker) walkIpSpaces(orgName string) {
+	ipSpaces, err := w.vcdClient.GetAllIpSpaceSummaries(nil)
+	if err != nil {
+		w.addError(InventoryKindIpSpace, "", err)
+		return
+	}
+	for _, ipSpace := range ipSpaces {
+		parentId := ""
+		if ipSpace.IpSpace.OrgRef != nil {
+			parentId = ipSpace.IpSpace.OrgRef.ID
+		}
+		if orgName != "" && (ipSpace.IpSpace.OrgRef == nil || ipSpace.IpSpace.OrgRef.Name != orgName) {
+			continue
+		}
+		w.add(InventoryKindIpSpace, ipSpace.IpSpace.ID, ipSpace.IpSpace.Name, parentId, ipSpace.IpSpace)
+	}
+}
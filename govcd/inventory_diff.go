@@ -0,0 +1,419 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultDiffIgnoredFields contains the fields that are assigned by the server and are not
+// considered when comparing two entities. Field names are compared case-insensitively with the
+// JSON key of the field (which, for XML based types, is the Go field name)
+var defaultDiffIgnoredFields = []string{
+	"id",
+	"href",
+	"link",
+	"links",
+	"version",
+	"operationkey",
+	"tasks",
+	"xmlname",
+}
+
+// DiffOptions define how entities are compared
+type DiffOptions struct {
+	// MatchByName matches entities by kind and by the chain of names of their parents, instead of
+	// matching them by URN. It is useful when comparing entities that were created separately,
+	// such as an intended state with the real one. Entities of the same kind with the same chain of
+	// names in one of the inventories can't be matched: they are listed in InventoryDiff.Unmatched
+	MatchByName bool
+	// IgnoreFields contains additional field names to exclude from the comparison, in addition
+	// to the server assigned fields that are always ignored (ID, HREF, links, version)
+	IgnoreFields []string
+}
+
+// FieldDiff is a single difference between two entities
+type FieldDiff struct {
+	// Path identifies the field, such as "VmSpecSection.NumCpus" or
+	// "NetworkConnectionSection.NetworkConnection[0].IPAddress". Slice elements that have a name
+	// are identified by name, such as "Rules[name=web].Action"
+	Path   string `json:"path"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// EntityDiff contains the differences found for one entity
+type EntityDiff struct {
+	Id      string              `json:"id"`
+	Kind    InventoryEntityKind `json:"kind"`
+	Name    string              `json:"name"`
+	Changes []*FieldDiff        `json:"changes,omitempty"`
+}
+
+// InventoryDiff is the result of the comparison between two inventories
+type InventoryDiff struct {
+	Added    []*EntityDiff `json:"added,omitempty"`
+	Removed  []*EntityDiff `json:"removed,omitempty"`
+	Modified []*EntityDiff `json:"modified,omitempty"`
+	// Unmatched lists the entities of both inventories which were not compared, because they share
+	// their kind and chain of names with other entities when matching by name
+	Unmatched []*EntityDiff `json:"unmatched,omitempty"`
+}
+
+// IsEmpty returns true when no differences were found. Unmatched entities count as differences, as
+// they could not be compared
+func (diff *InventoryDiff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Modified) == 0 && len(diff.Unmatched) == 0
+}
+
+// DiffInventories compares two inventories and reports the entities that were added, removed or
+// modified in 'after' compared to 'before'. Both inventories can be the result of
+// VCDClient.GetInventory or a document previously saved with Inventory.Json
+func DiffInventories(before, after *Inventory, options *DiffOptions) (*InventoryDiff, error) {
+	if before == nil || after == nil {
+		return nil, fmt.Errorf("both inventories are needed for comparison")
+	}
+	if options == nil {
+		options = &DiffOptions{}
+	}
+	beforeEntities := diffIndex(before, options.MatchByName)
+	afterEntities := diffIndex(after, options.MatchByName)
+
+	result := &InventoryDiff{}
+	entityDiff := func(entity *InventoryEntity) *EntityDiff {
+		return &EntityDiff{Id: entity.Id, Kind: entity.Kind, Name: entity.Name}
+	}
+	unmatched := func(key string) bool {
+		if len(beforeEntities[key]) < 2 && len(afterEntities[key]) < 2 {
+			return false
+		}
+		for _, entity := range append(slices.Clone(beforeEntities[key]), afterEntities[key]...) {
+			result.Unmatched = append(result.Unmatched, entityDiff(entity))
+		}
+		return true
+	}
+	for _, key := range sortedKeys(beforeEntities) {
+		if unmatched(key) {
+			continue
+		}
+		beforeEntity := beforeEntities[key][0]
+		if len(afterEntities[key]) == 0 {
+			result.Removed = append(result.Removed, entityDiff(beforeEntity))
+			continue
+		}
+		afterEntity := afterEntities[key][0]
+		changes, err := diffEntityContent(beforeEntity, afterEntity, options)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing %s '%s': %s", beforeEntity.Kind, beforeEntity.Name, err)
+		}
+		if len(changes) > 0 {
+			result.Modified = append(result.Modified, &EntityDiff{Id: afterEntity.Id, Kind: afterEntity.Kind, Name: afterEntity.Name, Changes: changes})
+		}
+	}
+	for _, key := range sortedKeys(afterEntities) {
+		if _, found := beforeEntities[key]; found || unmatched(key) {
+			continue
+		}
+		result.Added = append(result.Added, entityDiff(afterEntities[key][0]))
+	}
+	return result, nil
+}
+
+// DiffEntities compares two definitions of the same entity type (such as two *types.Vm or two
+// *types.NsxtFirewallRule) and returns the list of modified fields, ignoring the fields that are
+// assigned by the server
+func DiffEntities(before, after any, options *DiffOptions) ([]*FieldDiff, error) {
+	if options == nil {
+		options = &DiffOptions{}
+	}
+	if before != nil && after != nil && reflect.TypeOf(before) != reflect.TypeOf(after) {
+		return nil, fmt.Errorf("cannot compare entities of different types %T and %T", before, after)
+	}
+	return diffAny(before, after, options)
+}
+
+// diffAny compares two values of any type, including a typed entity with its decoded JSON form
+func diffAny(before, after any, options *DiffOptions) ([]*FieldDiff, error) {
+	beforeTree, err := normalizeForDiff(before, options)
+	if err != nil {
+		return nil, err
+	}
+	afterTree, err := normalizeForDiff(after, options)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*FieldDiff
+	diffValues("", beforeTree, afterTree, &changes)
+	return changes, nil
+}
+
+// String returns a human-readable representation of the differences
+func (diff *InventoryDiff) String() string {
+	if diff.IsEmpty() {
+		return "no differences found\n"
+	}
+	var sb strings.Builder
+	for _, entity := range diff.Added {
+		fmt.Fprintf(&sb, "+ %s '%s' (%s)\n", entity.Kind, entity.Name, entity.Id)
+	}
+	for _, entity := range diff.Removed {
+		fmt.Fprintf(&sb, "- %s '%s' (%s)\n", entity.Kind, entity.Name, entity.Id)
+	}
+	for _, entity := range diff.Modified {
+		fmt.Fprintf(&sb, "~ %s '%s' (%s)\n", entity.Kind, entity.Name, entity.Id)
+		for _, change := range entity.Changes {
+			fmt.Fprintf(&sb, "    %s: %s -> %s\n", change.Path, diffValueString(change.Before), diffValueString(change.After))
+		}
+	}
+	for _, entity := range diff.Unmatched {
+		fmt.Fprintf(&sb, "? %s '%s' (%s): same names as other entities\n", entity.Kind, entity.Name, entity.Id)
+	}
+	return sb.String()
+}
+
+// Json returns the differences as an indented JSON document
+func (diff *InventoryDiff) Json() ([]byte, error) {
+	return json.MarshalIndent(diff, "", "  ")
+}
+
+func diffValueString(value any) string {
+	if value == nil {
+		return "<none>"
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+		text, err := json.Marshal(value)
+		if err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// diffEntityContent compares the data and the metadata of two inventory entities
+func diffEntityContent(before, after *InventoryEntity, options *DiffOptions) ([]*FieldDiff, error) {
+	changes, err := diffAny(before.Data, after.Data, options)
+	if err != nil {
+		return nil, err
+	}
+	beforeMetadata := make(map[string]any)
+	for _, entry := range before.Metadata {
+		beforeMetadata[entry.Key] = entry.TypedValue
+	}
+	afterMetadata := make(map[string]any)
+	for _, entry := range after.Metadata {
+		afterMetadata[entry.Key] = entry.TypedValue
+	}
+	metadataChanges, err := diffAny(beforeMetadata, afterMetadata, options)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range metadataChanges {
+		change.Path = "metadata." + change.Path
+	}
+	return append(changes, metadataChanges...), nil
+}
+
+// diffIndex returns the entities of an inventory keyed by URN or, when matching by name, by kind
+// and the chain of names of the entity and its parents. Several entities can have the same key
+// when matching by name
+func diffIndex(inventory *Inventory, matchByName bool) map[string][]*InventoryEntity {
+	result := make(map[string][]*InventoryEntity, len(inventory.Entities))
+	for _, id := range sortedKeys(inventory.Entities) {
+		entity := inventory.Entities[id]
+		if !matchByName {
+			result[id] = []*InventoryEntity{entity}
+			continue
+		}
+		var names []string
+		visited := make(map[string]bool)
+		for current := entity; current != nil && !visited[current.Id]; current = inventory.Entities[current.ParentId] {
+			visited[current.Id] = true
+			names = append([]string{current.Name}, names...)
+		}
+		key := string(entity.Kind) + ":" + strings.Join(names, "/")
+		result[key] = append(result[key], entity)
+	}
+	return result
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeForDiff converts any entity to a tree of maps, slices and scalars by passing it through
+// JSON, and removes the ignored fields. Using JSON allows comparing entities that were retrieved
+// from the API with entities decoded from a saved inventory
+func normalizeForDiff(value any, options *DiffOptions) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	text, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding entity for comparison: %s", err)
+	}
+	var tree any
+	err = json.Unmarshal(text, &tree)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding entity for comparison: %s", err)
+	}
+	ignored := slices.Clone(defaultDiffIgnoredFields)
+	for _, field := range options.IgnoreFields {
+		ignored = append(ignored, strings.ToLower(field))
+	}
+	return stripIgnoredFields(tree, ignored), nil
+}
+
+func stripIgnoredFields(tree any, ignored []string) any {
+	switch typed := tree.(type) {
+	case map[string]any:
+		for key, value := range typed {
+			lowerKey := strings.ToLower(key)
+			if slices.Contains(ignored, lowerKey) || strings.HasPrefix(lowerKey, "xmlns") {
+				delete(typed, key)
+				continue
+			}
+			typed[key] = stripIgnoredFields(value, ignored)
+		}
+		// Empty values are equivalent to missing ones
+		for key, value := range typed {
+			if isEmptyDiffValue(value) {
+				delete(typed, key)
+			}
+		}
+	case []any:
+		for i, value := range typed {
+			typed[i] = stripIgnoredFields(value, ignored)
+		}
+	}
+	return tree
+}
+
+func isEmptyDiffValue(value any) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case string:
+		return typed == ""
+	case map[string]any:
+		return len(typed) == 0
+	case []any:
+		return len(typed) == 0
+	}
+	return false
+}
+
+// diffValues compares two normalized trees, adding the differences to changes
+func diffValues(path string, before, after any, changes *[]*FieldDiff) {
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if beforeIsMap && afterIsMap {
+		keys := sortedKeys(beforeMap)
+		for _, key := range sortedKeys(afterMap) {
+			if _, found := beforeMap[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffValues(joinDiffPath(path, key), beforeMap[key], afterMap[key], changes)
+		}
+		return
+	}
+
+	beforeSlice, beforeIsSlice := before.([]any)
+	afterSlice, afterIsSlice := after.([]any)
+	if beforeIsSlice && afterIsSlice {
+		diffSlices(path, beforeSlice, afterSlice, changes)
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, &FieldDiff{Path: path, Before: before, After: after})
+	}
+}
+
+// diffSlices compares two slices. When all the elements have a name, they are matched by name,
+// so that a change of order or an element inserted in the middle don't show as changes of all
+// the following elements. Otherwise, they are compared by position
+func diffSlices(path string, before, after []any, changes *[]*FieldDiff) {
+	beforeNames, beforeNamed := diffElementNames(before)
+	afterNames, afterNamed := diffElementNames(after)
+	if beforeNamed && afterNamed {
+		beforeByName := make(map[string]any)
+		for i, name := range beforeNames {
+			beforeByName[name] = before[i]
+		}
+		afterByName := make(map[string]any)
+		for i, name := range afterNames {
+			afterByName[name] = after[i]
+		}
+		names := sortedKeys(beforeByName)
+		for _, name := range sortedKeys(afterByName) {
+			if _, found := beforeByName[name]; !found {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			diffValues(fmt.Sprintf("%s[name=%s]", path, name), beforeByName[name], afterByName[name], changes)
+		}
+		return
+	}
+
+	for i := 0; i < max(len(before), len(after)); i++ {
+		var beforeElement, afterElement any
+		if i < len(before) {
+			beforeElement = before[i]
+		}
+		if i < len(after) {
+			afterElement = after[i]
+		}
+		diffValues(fmt.Sprintf("%s[%d]", path, i), beforeElement, afterElement, changes)
+	}
+}
+
+// diffElementNames returns the names of all the elements in a slice, and true if all the elements
+// are objects with a unique, non-empty name
+func diffElementNames(elements []any) ([]string, bool) {
+	if len(elements) == 0 {
+		return nil, true
+	}
+	names := make([]string, len(elements))
+	seen := make(map[string]bool)
+	for i, element := range elements {
+		object, ok := element.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		name, _ := object["name"].(string)
+		if name == "" {
+			name, _ = object["Name"].(string)
+		}
+		if name == "" || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, true
+}
+
+func joinDiffPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,183 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_DiffEntities(t *testing.T) {
+	before := &types.NsxtFirewallRule{
+		ID:        "rule-1",
+		Name:      "web",
+		Action:    "ALLOW",
+		Direction: "IN",
+		Enabled:   true,
+	}
+	after := &types.NsxtFirewallRule{
+		ID:        "rule-2",
+		Name:      "web",
+		Action:    "DROP",
+		Direction: "IN",
+		Enabled:   true,
+		Logging:   true,
+	}
+
+	changes, err := DiffEntities(before, after, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d: %v", len(changes), changes)
+	}
+	if changes[0].Path != "action" || changes[0].Before != "ALLOW" || changes[0].After != "DROP" {
+		t.Errorf("unexpected change: %+v", changes[0])
+	}
+	if changes[1].Path != "logging" {
+		t.Errorf("unexpected change: %+v", changes[1])
+	}
+
+	changes, err = DiffEntities(before, after, &DiffOptions{IgnoreFields: []string{"action", "logging"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+
+	_, err = DiffEntities(before, &types.NsxtNatRule{}, nil)
+	if err == nil {
+		t.Errorf("expected error when comparing different types")
+	}
+}
+
+func Test_DiffEntitiesSlices(t *testing.T) {
+	before := &types.Vm{
+		Name: "vm1",
+		HREF: "https://vcd/api/vApp/vm-1",
+		NetworkConnectionSection: &types.NetworkConnectionSection{
+			NetworkConnection: []*types.NetworkConnection{
+				{Network: "net1", IPAddress: "10.0.0.1"},
+				{Network: "net2", IPAddress: "10.0.1.1"},
+			},
+		},
+	}
+	after := &types.Vm{
+		Name: "vm1",
+		HREF: "https://vcd/api/vApp/vm-2",
+		NetworkConnectionSection: &types.NetworkConnectionSection{
+			NetworkConnection: []*types.NetworkConnection{
+				{Network: "net1", IPAddress: "10.0.0.2"},
+			},
+		},
+	}
+	changes, err := DiffEntities(before, after, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.Path
+	}
+	expected := []string{
+		"NetworkConnectionSection.NetworkConnection[0].IPAddress",
+		"NetworkConnectionSection.NetworkConnection[1]",
+	}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+}
+
+func Test_DiffInventories(t *testing.T) {
+	newInventory := func() *Inventory {
+		return &Inventory{SchemaVersion: InventorySchemaVersion, Entities: make(map[string]*InventoryEntity)}
+	}
+	addEntity := func(inventory *Inventory, kind InventoryEntityKind, id, name, parentId string, data any) {
+		inventory.Entities[id] = &InventoryEntity{Id: id, Kind: kind, Name: name, ParentId: parentId, Data: data}
+	}
+
+	before := newInventory()
+	addEntity(before, InventoryKindOrg, "urn:vcloud:org:1", "org", "", &types.AdminOrg{Name: "org"})
+	addEntity(before, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:1", "nat1", "urn:vcloud:org:1",
+		&types.NsxtNatRule{Name: "nat1", ExternalAddresses: "1.1.1.1"})
+	addEntity(before, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:2", "nat2", "urn:vcloud:org:1",
+		&types.NsxtNatRule{Name: "nat2"})
+
+	// The second inventory is decoded from JSON, to make sure that typed data and decoded data
+	// are compared correctly
+	after := newInventory()
+	addEntity(after, InventoryKindOrg, "urn:vcloud:org:1", "org", "", &types.AdminOrg{Name: "org"})
+	addEntity(after, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:1", "nat1", "urn:vcloud:org:1",
+		&types.NsxtNatRule{Name: "nat1", ExternalAddresses: "2.2.2.2"})
+	addEntity(after, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:3", "nat3", "urn:vcloud:org:1",
+		&types.NsxtNatRule{Name: "nat3"})
+	text, err := after.Json()
+	if err != nil {
+		t.Fatalf("error encoding inventory: %s", err)
+	}
+	decoded := &Inventory{}
+	err = json.Unmarshal(text, decoded)
+	if err != nil {
+		t.Fatalf("error decoding inventory: %s", err)
+	}
+
+	diff, err := DiffInventories(before, decoded, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Name != "nat3" {
+		t.Errorf("unexpected added entities: %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "nat2" {
+		t.Errorf("unexpected removed entities: %v", diff.Removed)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].Name != "nat1" || diff.Modified[0].Changes[0].Path != "externalAddresses" {
+		t.Fatalf("unexpected modified entities: %v", diff.Modified)
+	}
+	text = []byte(diff.String())
+	if !strings.Contains(string(text), "externalAddresses: 1.1.1.1 -> 2.2.2.2") {
+		t.Errorf("unexpected text output: %s", text)
+	}
+
+	// When matching by name, entities with different IDs and the same name are compared
+	renamed := newInventory()
+	addEntity(renamed, InventoryKindOrg, "urn:vcloud:org:9", "org", "", &types.AdminOrg{Name: "org"})
+	addEntity(renamed, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:8", "nat1", "urn:vcloud:org:9",
+		&types.NsxtNatRule{Name: "nat1", ExternalAddresses: "1.1.1.1"})
+	addEntity(renamed, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:7", "nat2", "urn:vcloud:org:9",
+		&types.NsxtNatRule{Name: "nat2"})
+	diff, err = DiffInventories(before, renamed, &DiffOptions{MatchByName: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !diff.IsEmpty() {
+		t.Errorf("expected no differences, got %s", diff.String())
+	}
+
+	// Entities sharing kind and names can't be matched by name
+	addEntity(renamed, InventoryKindNsxtNatRule, "urn:vcloud:nsxtNatRule:6", "nat2", "urn:vcloud:org:9",
+		&types.NsxtNatRule{Name: "nat2", ExternalAddresses: "3.3.3.3"})
+	diff, err = DiffInventories(before, renamed, &DiffOptions{MatchByName: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var unmatchedIds []string
+	for _, entity := range diff.Unmatched {
+		unmatchedIds = append(unmatchedIds, entity.Id)
+	}
+	if !reflect.DeepEqual(unmatchedIds, []string{"urn:vcloud:nsxtNatRule:2", "urn:vcloud:nsxtNatRule:6", "urn:vcloud:nsxtNatRule:7"}) {
+		t.Errorf("unexpected unmatched entities: %v", unmatchedIds)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Modified) != 0 || !strings.Contains(diff.String(), "? nsxtNatRule 'nat2'") {
+		t.Errorf("expected only unmatched entities, got %s", diff.String())
+	}
+}
@@ -0,0 +1,56 @@
+//go:build org || functional || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func (vcd *TestVCD) Test_GetInventory(check *C) {
+	vcd.skipIfNotSysAdmin(check)
+
+	inventory, err := vcd.client.GetInventory(&InventoryOptions{
+		OrgName:      vcd.config.VCD.Org,
+		ExcludeKinds: []InventoryEntityKind{InventoryKindIpSpace},
+	})
+	check.Assert(err, IsNil)
+	check.Assert(inventory, NotNil)
+	check.Assert(inventory.SchemaVersion, Equals, InventorySchemaVersion)
+	for _, inventoryError := range inventory.Errors {
+		fmt.Printf("inventory error: %s %s %s\n", inventoryError.Kind, inventoryError.ParentId, inventoryError.Message)
+	}
+
+	orgs := inventory.GetEntitiesByKind(InventoryKindOrg)
+	check.Assert(len(orgs), Equals, 1)
+	check.Assert(orgs[0].Name, Equals, vcd.config.VCD.Org)
+	check.Assert(len(inventory.GetEntitiesByKind(InventoryKindIpSpace)), Equals, 0)
+
+	// Every VDC in the configured org must be found, with the org as parent
+	vdcs := inventory.GetEntitiesByKind(InventoryKindVdc)
+	check.Assert(len(vdcs) > 0, Equals, true)
+	foundVdc := false
+	for _, vdc := range vdcs {
+		check.Assert(vdc.ParentId, Equals, orgs[0].Id)
+		if vdc.Name == vcd.config.VCD.Vdc {
+			foundVdc = true
+		}
+	}
+	check.Assert(foundVdc, Equals, true)
+
+	// Every entity except the org must have a parent
+	for _, entity := range inventory.Entities {
+		if entity.Kind != InventoryKindOrg && entity.Kind != InventoryKindIpSpace {
+			check.Assert(entity.ParentId, Not(Equals), "")
+		}
+	}
+
+	text, err := inventory.Json()
+	check.Assert(err, IsNil)
+	check.Assert(len(text) > 0, Equals, true)
+}
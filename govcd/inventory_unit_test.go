@@ -0,0 +1,110 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_inventoryKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []InventoryEntityKind
+		exclude []InventoryEntityKind
+		want    []InventoryEntityKind
+		wantErr bool
+	}{
+		{
+			name: "AllKinds",
+			want: AllInventoryKinds,
+		},
+		{
+			name:    "IncludeOnly",
+			include: []InventoryEntityKind{InventoryKindVm, InventoryKindOrg},
+			want:    []InventoryEntityKind{InventoryKindOrg, InventoryKindVm},
+		},
+		{
+			name:    "IncludeAndExclude",
+			include: []InventoryEntityKind{InventoryKindVm, InventoryKindOrg, InventoryKindVdc},
+			exclude: []InventoryEntityKind{InventoryKindOrg},
+			want:    []InventoryEntityKind{InventoryKindVdc, InventoryKindVm},
+		},
+		{
+			name:    "ExcludeAll",
+			include: []InventoryEntityKind{InventoryKindVm},
+			exclude: []InventoryEntityKind{InventoryKindVm},
+			want:    nil,
+		},
+		{
+			name:    "UnknownKind",
+			include: []InventoryEntityKind{"vmx"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inventoryKinds(tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inventoryKinds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inventoryKinds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inventoryKey(t *testing.T) {
+	if got := inventoryKey(InventoryKindVm, "urn:vcloud:vm:1234"); got != "urn:vcloud:vm:1234" {
+		t.Errorf("expected URN to be unchanged, got %s", got)
+	}
+	if got := inventoryKey(InventoryKindNsxtNatRule, "1234"); got != "urn:vcloud:nsxtNatRule:1234" {
+		t.Errorf("expected synthetic URN, got %s", got)
+	}
+}
+
+func Test_InventoryGraph(t *testing.T) {
+	walker := &inventoryWalker{
+		kinds:     AllInventoryKinds,
+		semaphore: make(chan struct{}, 2),
+		inventory: &Inventory{
+			SchemaVersion: InventorySchemaVersion,
+			Entities:      make(map[string]*InventoryEntity),
+		},
+	}
+	walker.add(InventoryKindOrg, "urn:vcloud:org:1", "org1", "", nil)
+	walker.add(InventoryKindVdc, "urn:vcloud:vdc:2", "vdc2", "urn:vcloud:org:1", nil)
+	walker.add(InventoryKindVdc, "urn:vcloud:vdc:1", "vdc1", "urn:vcloud:org:1", nil)
+	walker.add(InventoryKindNsxtNatRule, "abc", "nat", "urn:vcloud:gateway:1", nil)
+
+	vdcs := walker.inventory.GetEntitiesByKind(InventoryKindVdc)
+	if len(vdcs) != 2 || vdcs[0].Name != "vdc1" || vdcs[1].Name != "vdc2" {
+		t.Fatalf("unexpected VDCs: %v", vdcs)
+	}
+	children := walker.inventory.GetChildren("urn:vcloud:org:1")
+	if len(children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(children))
+	}
+	if walker.inventory.Entities["urn:vcloud:nsxtNatRule:abc"] == nil {
+		t.Fatalf("NAT rule not found by synthetic URN")
+	}
+
+	text, err := walker.inventory.Json()
+	if err != nil {
+		t.Fatalf("error marshalling inventory: %s", err)
+	}
+	var decoded Inventory
+	err = json.Unmarshal(text, &decoded)
+	if err != nil {
+		t.Fatalf("error unmarshalling inventory: %s", err)
+	}
+	if decoded.SchemaVersion != InventorySchemaVersion || len(decoded.Entities) != 4 {
+		t.Errorf("unexpected decoded inventory: %+v", decoded)
+	}
+}
@@ -0,0 +1,408 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package iso
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/internal/udf"
+)
+
+const (
+	isoFlagDirectory   = 0x02
+	isoFlagMultiExtent = 0x80
+
+	// maxDirectorySize protects from directory extents whose size is corrupted
+	maxDirectorySize = 64 * 1024 * 1024
+)
+
+var (
+	_ fs.ReadDirFS  = (*Image)(nil)
+	_ fs.ReadFileFS = (*Image)(nil)
+	_ fs.StatFS     = (*Image)(nil)
+)
+
+// Open opens a file or a directory of the image, by its slash separated path such as
+// "openstack/latest/user_data". The root directory is "."
+func (image *Image) Open(name string) (fs.File, error) {
+	found, err := image.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{image: image, node: found, path: name}, nil
+}
+
+// ReadDir returns the entries of a directory of the image, sorted by name
+func (image *Image) ReadDir(name string) ([]fs.DirEntry, error) {
+	found, err := image.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !found.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	children, err := image.files.readDir(found)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(children))
+	for idx, child := range children {
+		entries[idx] = fs.FileInfoToDirEntry(&fileInfo{child})
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// ReadFile returns the content of a file of the image
+func (image *Image) ReadFile(name string) ([]byte, error) {
+	opened, err := image.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer opened.Close()
+	stat, err := opened.Stat()
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, 0, stat.Size())
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := opened.Read(buffer)
+		content = append(content, buffer[:n]...)
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Stat returns the description of a file or a directory of the image
+func (image *Image) Stat(name string) (fs.FileInfo, error) {
+	found, err := image.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{found}, nil
+}
+
+// lookup returns the node at a path of the image
+func (image *Image) lookup(operation, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrInvalid}
+	}
+	current, err := image.files.root()
+	if err != nil {
+		return nil, &fs.PathError{Op: operation, Path: name, Err: err}
+	}
+	if name == "." {
+		return current, nil
+	}
+	for _, element := range strings.Split(name, "/") {
+		if !current.mode.IsDir() {
+			return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrNotExist}
+		}
+		children, err := image.files.readDir(current)
+		if err != nil {
+			return nil, &fs.PathError{Op: operation, Path: name, Err: err}
+		}
+		index := slices.IndexFunc(children, func(child *node) bool { return child.name == element })
+		if index < 0 {
+			return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrNotExist}
+		}
+		current = children[index]
+	}
+	return current, nil
+}
+
+// file is a file or a directory of an image opened for reading
+type file struct {
+	image  *Image
+	node   *node
+	path   string
+	reader io.Reader
+	// children holds the entries of a directory which are not read yet
+	children []*node
+	listed   bool
+	closed   bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return &fileInfo{f.node}, nil
+}
+
+func (f *file) Read(content []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fmt.Errorf("is a directory")}
+	}
+	if f.reader == nil {
+		reader, err := f.image.files.openFile(f.node)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+		f.reader = reader
+	}
+	return f.reader.Read(content)
+}
+
+// ReadDir returns the next count entries of a directory, or all the remaining ones when count is not positive
+func (f *file) ReadDir(count int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: fs.ErrClosed}
+	}
+	if !f.node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: fmt.Errorf("not a directory")}
+	}
+	if !f.listed {
+		children, err := f.image.files.readDir(f.node)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: err}
+		}
+		slices.SortFunc(children, func(a, b *node) int { return strings.Compare(a.name, b.name) })
+		f.children = children
+		f.listed = true
+	}
+	if count > 0 && len(f.children) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(f.children) {
+		count = len(f.children)
+	}
+	entries := make([]fs.DirEntry, count)
+	for idx, child := range f.children[:count] {
+		entries[idx] = fs.FileInfoToDirEntry(&fileInfo{child})
+	}
+	f.children = f.children[count:]
+	return entries, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// fileInfo describes a node as fs.FileInfo
+type fileInfo struct {
+	node *node
+}
+
+func (info *fileInfo) Name() string {
+	return info.node.name
+}
+
+func (info *fileInfo) Size() int64 {
+	return info.node.size
+}
+
+func (info *fileInfo) Mode() fs.FileMode {
+	return info.node.mode
+}
+
+func (info *fileInfo) ModTime() time.Time {
+	return info.node.modTime
+}
+
+func (info *fileInfo) IsDir() bool {
+	return info.node.mode.IsDir()
+}
+
+func (info *fileInfo) Sys() any {
+	return nil
+}
+
+// isoFileSystem is the tree of the primary or the Joliet volume descriptor
+type isoFileSystem struct {
+	reader     io.ReaderAt
+	rootRecord []byte
+	joliet     bool
+}
+
+func (f *isoFileSystem) root() (*node, error) {
+	root, err := f.recordNode(f.rootRecord)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root directory record: %s", err)
+	}
+	root.name = "."
+	return root, nil
+}
+
+func (f *isoFileSystem) readDir(dir *node) ([]*node, error) {
+	directory := dir.extents[0]
+	if directory.length > maxDirectorySize {
+		return nil, fmt.Errorf("directory of %d bytes is too large", directory.length)
+	}
+	records := make([]byte, directory.length)
+	_, err := f.reader.ReadAt(records, directory.offset)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %s", err)
+	}
+
+	var children []*node
+	var multiExtent *node
+	for offset := 0; offset < len(records); {
+		length := int(records[offset])
+		if length == 0 {
+			// Records don't cross sector boundaries: the rest of the sector is padding
+			offset = (offset/sectorSize + 1) * sectorSize
+			continue
+		}
+		if offset+length > len(records) {
+			return nil, fmt.Errorf("directory record at byte %d exceeds the directory", offset)
+		}
+		record := records[offset : offset+length]
+		offset += length
+
+		child, err := f.recordNode(record)
+		if err != nil {
+			return nil, err
+		}
+		// The self and parent records
+		if child.name == "\x00" || child.name == "\x01" {
+			continue
+		}
+		// The extents of a file larger than 4 GiB are recorded with the same name
+		if multiExtent != nil && multiExtent.name == child.name {
+			multiExtent.extents = append(multiExtent.extents, child.extents...)
+			multiExtent.size += child.size
+		} else {
+			children = append(children, child)
+			multiExtent = child
+		}
+		if record[25]&isoFlagMultiExtent == 0 {
+			multiExtent = nil
+		}
+	}
+	return children, nil
+}
+
+// recordNode returns the node of a directory record
+func (f *isoFileSystem) recordNode(record []byte) (*node, error) {
+	if len(record) < 34 || record[32] == 0 || len(record) < 33+int(record[32]) {
+		return nil, fmt.Errorf("invalid directory record of %d bytes", len(record))
+	}
+	identifier := record[33 : 33+int(record[32])]
+	name := string(identifier)
+	if len(identifier) > 1 || identifier[0] > 1 {
+		if f.joliet {
+			name = ucs2Name(identifier)
+		}
+		// Names are recorded with a version and, in ISO9660, with a separator when they have no extension
+		if base, version, found := strings.Cut(name, ";"); found && version != "" {
+			name = base
+		}
+		if !f.joliet {
+			name = strings.TrimSuffix(name, ".")
+		}
+	}
+
+	location := int64(binary.LittleEndian.Uint32(record[2:6]))
+	size := int64(binary.LittleEndian.Uint32(record[10:14]))
+	current := &node{
+		name:    name,
+		size:    size,
+		modTime: recordingDateTime(record[18:25]),
+		mode:    0444,
+		extents: []extent{{offset: location * sectorSize, length: size}},
+	}
+	if record[25]&isoFlagDirectory != 0 {
+		current.mode = fs.ModeDir | 0555
+		current.size = 0
+	}
+	return current, nil
+}
+
+// recordingDateTime returns the time of a 7 bytes date and time field of a directory record
+func recordingDateTime(field []byte) time.Time {
+	if field[1] == 0 {
+		return time.Time{}
+	}
+	return time.Date(1900+int(field[0]), time.Month(field[1]), int(field[2]), int(field[3]), int(field[4]),
+		int(field[5]), 0, timeZone(field[6]))
+}
+
+func (f *isoFileSystem) openFile(file *node) (io.Reader, error) {
+	readers := make([]io.Reader, len(file.extents))
+	for idx, fileExtent := range file.extents {
+		readers[idx] = io.NewSectionReader(f.reader, fileExtent.offset, fileExtent.length)
+	}
+	return io.MultiReader(readers...), nil
+}
+
+// udfFileSystem is the tree of the UDF file system
+type udfFileSystem struct {
+	reader *udf.ImageReader
+}
+
+// openUdfFileSystem returns the UDF file system of an image and its label, checking that its root
+// directory can be read
+func openUdfFileSystem(reader io.ReaderAt) (*udfFileSystem, string, error) {
+	udfReader, err := udf.Open(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading UDF file system: %s", err)
+	}
+	files := &udfFileSystem{reader: udfReader}
+	root, err := udfReader.RootDir()
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = udfReader.ReadDir(root)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, root.Name(), nil
+}
+
+func (f *udfFileSystem) root() (*node, error) {
+	root, err := f.reader.RootDir()
+	if err != nil {
+		return nil, err
+	}
+	rootNode := udfNode(root)
+	rootNode.name = "."
+	return rootNode, nil
+}
+
+func (f *udfFileSystem) readDir(dir *node) ([]*node, error) {
+	children, err := f.reader.ReadDir(dir.udfFile)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*node, len(children))
+	for idx := range children {
+		nodes[idx] = udfNode(&children[idx])
+	}
+	return nodes, nil
+}
+
+func udfNode(udfFile *udf.FileInfo) *node {
+	current := &node{
+		name:    udfFile.Name(),
+		size:    udfFile.Size(),
+		modTime: udfFile.ModTime(),
+		mode:    udfFile.FileMode(),
+		udfFile: udfFile,
+	}
+	if current.mode.IsDir() {
+		current.size = 0
+	}
+	return current
+}
+
+func (f *udfFileSystem) openFile(file *node) (io.Reader, error) {
+	return f.reader.NewFileReader(file.udfFile)
+}
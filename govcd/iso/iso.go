@@ -0,0 +1,352 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package iso reads ISO9660 images, with their Joliet extensions and UDF file systems, without
+// extracting them. An Image implements the io/fs interfaces, so that its directories can be listed
+// with fs.ReadDir or fs.WalkDir and its files read with fs.ReadFile. Images are read from any
+// io.ReaderAt: a local file, or a media item of VCD with govcd.Media.OpenIso
+package iso
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/internal/udf"
+)
+
+const (
+	sectorSize = 2048
+	// The volume descriptors are recorded from sector 16
+	volumeDescriptorSector = 16
+	maxVolumeDescriptors   = 64
+
+	descriptorTypeBootRecord    = 0
+	descriptorTypePrimary       = 1
+	descriptorTypeSupplementary = 2
+
+	elToritoSystemIdentifier = "EL TORITO SPECIFICATION"
+)
+
+// FileSystem is a file system of an image
+type FileSystem string
+
+const (
+	FileSystemUdf     FileSystem = "UDF"
+	FileSystemJoliet  FileSystem = "Joliet"
+	FileSystemIso9660 FileSystem = "ISO9660"
+)
+
+// Volume describes the volume of an image, from its volume descriptors
+type Volume struct {
+	// Label is the name of the volume shown by operating systems: the UDF logical volume identifier,
+	// or the Joliet volume identifier, or the primary one
+	Label                   string
+	PrimaryVolumeIdentifier string
+	JolietVolumeIdentifier  string
+	UdfVolumeIdentifier     string
+	SystemIdentifier        string
+	VolumeSetIdentifier     string
+	PublisherIdentifier     string
+	DataPreparerIdentifier  string
+	ApplicationIdentifier   string
+	CreationTime            time.Time
+	ModificationTime        time.Time
+	// Size is the size of the ISO9660 volume, in bytes
+	Size int64
+	// FileSystems lists the file systems of the image, in order of preference. The files are read
+	// from the first one
+	FileSystems []FileSystem
+}
+
+// BootEntry is a boot image of the El Torito boot catalog of an image
+type BootEntry struct {
+	// Platform is "x86", "PowerPC", "Mac" or "EFI", or the hexadecimal platform identifier
+	Platform string
+	Bootable bool
+	// Emulation is "none", "1.2M floppy", "1.44M floppy", "2.88M floppy" or "hard disk"
+	Emulation   string
+	LoadSegment uint16
+	SystemType  uint8
+	// SectorCount is the number of 512 bytes sectors loaded at boot
+	SectorCount uint16
+	// Offset is the location of the boot image in the image, in bytes
+	Offset int64
+}
+
+// Image is an ISO9660 or UDF image opened for reading. Its methods can be called concurrently when
+// its reader supports concurrent reads
+type Image struct {
+	reader          io.ReaderAt
+	closer          io.Closer
+	volume          Volume
+	bootCatalog     int64
+	hasBootCatalog  bool
+	files           fileSystem
+	hasUdfStructure bool
+}
+
+// fileSystem is the tree of files of an image, from one of its file systems
+type fileSystem interface {
+	root() (*node, error)
+	readDir(dir *node) ([]*node, error)
+	openFile(file *node) (io.Reader, error)
+}
+
+// node is a file or a directory of a file system
+type node struct {
+	name    string
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+	// extents holds the locations of the content of ISO9660 nodes
+	extents []extent
+	// udfFile is the file of UDF nodes
+	udfFile *udf.FileInfo
+}
+
+type extent struct {
+	offset int64
+	length int64
+}
+
+// Open opens the image read from the reader
+func Open(reader io.ReaderAt) (*Image, error) {
+	image := &Image{reader: reader}
+	err := image.readVolumeDescriptors()
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// OpenFile opens the image of a local file, which is closed by Image.Close
+func OpenFile(name string) (*Image, error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	image, err := Open(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error opening image '%s': %s", name, err)
+	}
+	image.closer = file
+	return image, nil
+}
+
+// Close closes the file of images opened with OpenFile
+func (image *Image) Close() error {
+	if image.closer == nil {
+		return nil
+	}
+	return image.closer.Close()
+}
+
+// Volume returns the description of the volume of the image
+func (image *Image) Volume() Volume {
+	volume := image.volume
+	volume.FileSystems = append([]FileSystem(nil), image.volume.FileSystems...)
+	return volume
+}
+
+// readVolumeDescriptors reads the ISO9660 volume descriptors and the UDF volume recognition sequence,
+// and selects the file system the files are read from
+func (image *Image) readVolumeDescriptors() error {
+	var primary, joliet []byte
+	for sector := int64(volumeDescriptorSector); sector < volumeDescriptorSector+maxVolumeDescriptors; sector++ {
+		descriptor := make([]byte, sectorSize)
+		_, err := image.reader.ReadAt(descriptor, sector*sectorSize)
+		if err != nil {
+			if sector == volumeDescriptorSector {
+				return fmt.Errorf("error reading volume descriptors: %s", err)
+			}
+			break
+		}
+		identifier := string(descriptor[1:6])
+		if identifier == "NSR02" || identifier == "NSR03" {
+			image.hasUdfStructure = true
+		}
+		if identifier == "TEA01" || (identifier != "CD001" && identifier != "BEA01" && identifier != "NSR02" &&
+			identifier != "NSR03" && identifier != "BOOT2" && identifier != "CDW02") {
+			break
+		}
+		if identifier != "CD001" {
+			continue
+		}
+		switch descriptor[0] {
+		case descriptorTypeBootRecord:
+			if strings.TrimRight(string(descriptor[7:39]), "\x00 ") == elToritoSystemIdentifier {
+				image.bootCatalog = int64(binary.LittleEndian.Uint32(descriptor[71:75])) * sectorSize
+				image.hasBootCatalog = true
+			}
+		case descriptorTypePrimary:
+			primary = descriptor
+		case descriptorTypeSupplementary:
+			// UCS-2 levels 1, 2 and 3
+			if escape := string(descriptor[88:91]); escape == "%/@" || escape == "%/C" || escape == "%/E" {
+				joliet = descriptor
+			}
+		}
+	}
+	if primary == nil && !image.hasUdfStructure {
+		return fmt.Errorf("not an ISO9660 or UDF image")
+	}
+
+	volume := &image.volume
+	if image.hasUdfStructure {
+		files, label, err := openUdfFileSystem(image.reader)
+		// Images with UDF structures not supported by the reader are read from their ISO9660 file systems
+		if err == nil {
+			image.files = files
+			volume.UdfVolumeIdentifier = label
+			volume.FileSystems = append(volume.FileSystems, FileSystemUdf)
+		} else if primary == nil {
+			return err
+		}
+	}
+	if joliet != nil {
+		volume.JolietVolumeIdentifier = ucs2Text(joliet[40:72])
+		volume.FileSystems = append(volume.FileSystems, FileSystemJoliet)
+		if image.files == nil {
+			image.files = &isoFileSystem{reader: image.reader, rootRecord: joliet[156:190], joliet: true}
+		}
+	}
+	if primary != nil {
+		volume.PrimaryVolumeIdentifier = text(primary[40:72])
+		volume.SystemIdentifier = text(primary[8:40])
+		volume.VolumeSetIdentifier = text(primary[190:318])
+		volume.PublisherIdentifier = text(primary[318:446])
+		volume.DataPreparerIdentifier = text(primary[446:574])
+		volume.ApplicationIdentifier = text(primary[574:702])
+		volume.CreationTime = decimalDateTime(primary[813:830])
+		volume.ModificationTime = decimalDateTime(primary[830:847])
+		volume.Size = int64(binary.LittleEndian.Uint32(primary[80:84])) * int64(binary.LittleEndian.Uint16(primary[128:130]))
+		volume.FileSystems = append(volume.FileSystems, FileSystemIso9660)
+		if image.files == nil {
+			image.files = &isoFileSystem{reader: image.reader, rootRecord: primary[156:190]}
+		}
+	}
+	for _, label := range []string{volume.UdfVolumeIdentifier, volume.JolietVolumeIdentifier, volume.PrimaryVolumeIdentifier} {
+		if label != "" {
+			volume.Label = label
+			break
+		}
+	}
+	return nil
+}
+
+// text returns the value of a text field of a volume descriptor, without its padding
+func text(field []byte) string {
+	return strings.TrimRight(string(field), " \x00")
+}
+
+// ucs2Text returns the value of a text field of a Joliet volume descriptor, without its padding
+func ucs2Text(field []byte) string {
+	return strings.TrimRight(ucs2Name(field), " \x00")
+}
+
+func ucs2Name(field []byte) string {
+	characters := make([]uint16, len(field)/2)
+	for idx := range characters {
+		characters[idx] = binary.BigEndian.Uint16(field[2*idx:])
+	}
+	return string(utf16.Decode(characters))
+}
+
+// decimalDateTime returns the time of a 17 bytes date and time field of a volume descriptor, or the
+// zero time when it is not specified
+func decimalDateTime(field []byte) time.Time {
+	value := string(field[:16])
+	if strings.Trim(value, "0\x00 ") == "" {
+		return time.Time{}
+	}
+	parsed, err := time.ParseInLocation("20060102150405", value[:14], timeZone(field[16]))
+	if err != nil {
+		return time.Time{}
+	}
+	var hundredths int
+	_, _ = fmt.Sscanf(value[14:16], "%d", &hundredths)
+	return parsed.Add(time.Duration(hundredths) * 10 * time.Millisecond)
+}
+
+// timeZone returns the zone of an offset from UTC in intervals of 15 minutes
+func timeZone(offset byte) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", int(int8(offset))*15*60)
+}
+
+// BootEntries returns the boot images of the El Torito boot catalog of the image, or no entry when
+// the image is not bootable
+func (image *Image) BootEntries() ([]BootEntry, error) {
+	if !image.hasBootCatalog {
+		return nil, nil
+	}
+	catalog := make([]byte, sectorSize)
+	_, err := image.reader.ReadAt(catalog, image.bootCatalog)
+	if err != nil {
+		return nil, fmt.Errorf("error reading boot catalog: %s", err)
+	}
+
+	// The validation entry, with its key and a checksum making the sum of its words zero
+	var sum uint16
+	for idx := 0; idx < 32; idx += 2 {
+		sum += binary.LittleEndian.Uint16(catalog[idx:])
+	}
+	if catalog[0] != 1 || catalog[30] != 0x55 || catalog[31] != 0xAA || sum != 0 {
+		return nil, fmt.Errorf("invalid validation entry in boot catalog")
+	}
+	entries := []BootEntry{bootEntry(catalog[32:64], catalog[1])}
+
+	// Section headers, each followed by its entries and their extensions
+	for offset := 64; offset+32 <= len(catalog); {
+		header := catalog[offset]
+		if header != 0x90 && header != 0x91 {
+			break
+		}
+		platform := catalog[offset+1]
+		count := int(binary.LittleEndian.Uint16(catalog[offset+2:]))
+		offset += 32
+		for range count {
+			if offset+32 > len(catalog) {
+				break
+			}
+			entries = append(entries, bootEntry(catalog[offset:offset+32], platform))
+			offset += 32
+			for offset+32 <= len(catalog) && catalog[offset] == 0x44 {
+				offset += 32
+			}
+		}
+		if header == 0x91 {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func bootEntry(entry []byte, platform byte) BootEntry {
+	platforms := map[byte]string{0x00: "x86", 0x01: "PowerPC", 0x02: "Mac", 0xEF: "EFI"}
+	emulations := map[byte]string{0: "none", 1: "1.2M floppy", 2: "1.44M floppy", 3: "2.88M floppy", 4: "hard disk"}
+	bootEntry := BootEntry{
+		Platform:    platforms[platform],
+		Bootable:    entry[0] == 0x88,
+		Emulation:   emulations[entry[1]&0x0F],
+		LoadSegment: binary.LittleEndian.Uint16(entry[2:4]),
+		SystemType:  entry[4],
+		SectorCount: binary.LittleEndian.Uint16(entry[6:8]),
+		Offset:      int64(binary.LittleEndian.Uint32(entry[8:12])) * sectorSize,
+	}
+	if bootEntry.Platform == "" {
+		bootEntry.Platform = fmt.Sprintf("0x%02X", platform)
+	}
+	return bootEntry
+}
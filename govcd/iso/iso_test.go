@@ -0,0 +1,228 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package iso
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/internal/udf"
+)
+
+var testImageFiles = map[string]string{
+	"meta-data":                  "instance-id: test\n",
+	"user-data":                  "#cloud-config\nhostname: test\n",
+	"openstack/latest/user_data": strings.Repeat("0123456789", 500),
+	"drivers/network/README.txt": "drivers\n",
+}
+
+// buildTestImage returns an image of testImageFiles written by the UDF writer
+func buildTestImage(t *testing.T, withUdf bool) []byte {
+	var files []udf.ImageFile
+	for name, content := range testImageFiles {
+		files = append(files, udf.ImageFile{
+			Path: name,
+			Size: int64(len(content)),
+			Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(content)), nil },
+		})
+	}
+	files = append(files, udf.ImageFile{Path: "empty", Directory: true})
+	writer, err := udf.NewImageWriter(files, udf.WriterOptions{
+		VolumeIdentifier: "cidata",
+		Udf:              withUdf,
+		RecordingTime:    time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("error creating image writer: %s", err)
+	}
+	var image bytes.Buffer
+	_, err = writer.WriteTo(&image)
+	if err != nil {
+		t.Fatalf("error writing image: %s", err)
+	}
+	return image.Bytes()
+}
+
+// readTestImageFiles returns the content of the files of an image, by path
+func readTestImageFiles(t *testing.T, image *Image) map[string]string {
+	files := make(map[string]string)
+	err := fs.WalkDir(image, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(image, name)
+		files[name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("error reading files of image: %s", err)
+	}
+	return files
+}
+
+func Test_OpenUdfImage(t *testing.T) {
+	image, err := Open(bytes.NewReader(buildTestImage(t, true)))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+
+	volume := image.Volume()
+	if volume.Label != "cidata" || volume.UdfVolumeIdentifier != "cidata" || volume.JolietVolumeIdentifier != "cidata" ||
+		volume.PrimaryVolumeIdentifier != "cidata" || volume.ApplicationIdentifier != "GO-VCLOUD-DIRECTOR" {
+		t.Errorf("unexpected volume identifiers %+v", volume)
+	}
+	if !reflect.DeepEqual(volume.FileSystems, []FileSystem{FileSystemUdf, FileSystemJoliet, FileSystemIso9660}) {
+		t.Errorf("unexpected file systems %v", volume.FileSystems)
+	}
+	if !volume.CreationTime.Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Errorf("unexpected creation time %s", volume.CreationTime)
+	}
+
+	if files := readTestImageFiles(t, image); !reflect.DeepEqual(files, testImageFiles) {
+		t.Errorf("unexpected files %v", files)
+	}
+	info, err := fs.Stat(image, "empty")
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0555 {
+		t.Errorf("expected directory 'empty', got %v, %v", info, err)
+	}
+
+	err = fstest.TestFS(image, "meta-data", "user-data", "openstack/latest/user_data", "drivers/network/README.txt", "empty")
+	if err != nil {
+		t.Errorf("the image is not a valid file system: %s", err)
+	}
+}
+
+func Test_OpenIsoImage(t *testing.T) {
+	content := buildTestImage(t, false)
+	image, err := Open(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	volume := image.Volume()
+	if volume.Label != "cidata" || volume.UdfVolumeIdentifier != "" {
+		t.Errorf("unexpected volume identifiers %+v", volume)
+	}
+	if !reflect.DeepEqual(volume.FileSystems, []FileSystem{FileSystemJoliet, FileSystemIso9660}) {
+		t.Errorf("unexpected file systems %v", volume.FileSystems)
+	}
+	if files := readTestImageFiles(t, image); !reflect.DeepEqual(files, testImageFiles) {
+		t.Errorf("unexpected Joliet files %v", files)
+	}
+
+	// Without the escape sequences of Joliet, the names of the primary volume descriptor are used
+	copy(content[17*sectorSize+88:], "\x00\x00\x00")
+	image, err = Open(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	if !reflect.DeepEqual(image.Volume().FileSystems, []FileSystem{FileSystemIso9660}) {
+		t.Errorf("unexpected file systems %v", image.Volume().FileSystems)
+	}
+	files := readTestImageFiles(t, image)
+	expected := map[string]string{
+		"META_DAT":                   testImageFiles["meta-data"],
+		"USER_DAT":                   testImageFiles["user-data"],
+		"OPENSTAC/LATEST/USER_DAT":   testImageFiles["openstack/latest/user_data"],
+		"DRIVERS/NETWORK/README.TXT": testImageFiles["drivers/network/README.txt"],
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected ISO9660 files %v", files)
+	}
+}
+
+func Test_BootEntries(t *testing.T) {
+	content := buildTestImage(t, false)
+	image, err := Open(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	entries, err := image.BootEntries()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no boot entry, got %v, %v", entries, err)
+	}
+
+	// A boot record replacing the terminator of the volume descriptors, and a catalog in a new last sector
+	catalogSector := uint32(len(content) / sectorSize)
+	record := content[18*sectorSize : 19*sectorSize]
+	clear(record)
+	record[0] = descriptorTypeBootRecord
+	copy(record[1:7], "CD001\x01")
+	copy(record[7:], elToritoSystemIdentifier)
+	binary.LittleEndian.PutUint32(record[71:75], catalogSector)
+
+	catalog := make([]byte, sectorSize)
+	validation := catalog[0:32]
+	validation[0] = 1
+	validation[30], validation[31] = 0x55, 0xAA
+	var sum uint16
+	for idx := 0; idx < 32; idx += 2 {
+		sum += binary.LittleEndian.Uint16(validation[idx:])
+	}
+	binary.LittleEndian.PutUint16(validation[28:30], -sum)
+	defaultEntry := catalog[32:64]
+	defaultEntry[0] = 0x88
+	binary.LittleEndian.PutUint16(defaultEntry[6:8], 4)
+	binary.LittleEndian.PutUint32(defaultEntry[8:12], 30)
+	header := catalog[64:96]
+	header[0], header[1] = 0x91, 0xEF
+	binary.LittleEndian.PutUint16(header[2:4], 1)
+	efiEntry := catalog[96:128]
+	efiEntry[0] = 0x88
+	binary.LittleEndian.PutUint16(efiEntry[6:8], 2880)
+	binary.LittleEndian.PutUint32(efiEntry[8:12], 31)
+	content = append(content, catalog...)
+
+	image, err = Open(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	entries, err = image.BootEntries()
+	if err != nil {
+		t.Fatalf("error reading boot entries: %s", err)
+	}
+	expected := []BootEntry{
+		{Platform: "x86", Bootable: true, Emulation: "none", SectorCount: 4, Offset: 30 * sectorSize},
+		{Platform: "EFI", Bootable: true, Emulation: "none", SectorCount: 2880, Offset: 31 * sectorSize},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected boot entries %+v, got %+v", expected, entries)
+	}
+}
+
+func Test_OpenErrors(t *testing.T) {
+	_, err := Open(bytes.NewReader(make([]byte, 40*sectorSize)))
+	if err == nil || !strings.Contains(err.Error(), "not an ISO9660 or UDF image") {
+		t.Errorf("expected error for an image without volume descriptors, got %v", err)
+	}
+	_, err = Open(bytes.NewReader(make([]byte, 100)))
+	if err == nil {
+		t.Errorf("expected error for a short image")
+	}
+
+	image, err := Open(bytes.NewReader(buildTestImage(t, true)))
+	if err != nil {
+		t.Fatalf("error opening image: %s", err)
+	}
+	_, err = image.ReadFile("missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+	_, err = image.ReadFile("user-data/child")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+	_, err = image.ReadFile("../user-data")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected invalid path error, got %v", err)
+	}
+}
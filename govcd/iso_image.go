@@ -0,0 +1,136 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/internal/udf"
+)
+
+// IsoImageOptions are the options of the images built by NewIsoImage and NewIsoImageFromDirectory
+type IsoImageOptions struct {
+	// VolumeIdentifier is the label of the image, made of at most 32 ASCII characters, such as "cidata"
+	// for cloud-init NoCloud seed images. It defaults to "CDROM"
+	VolumeIdentifier string
+	// Udf adds a UDF file system to the ISO9660 and Joliet ones, for the systems which only read UDF
+	// and for the names longer than the 64 characters kept by Joliet
+	Udf bool
+}
+
+// IsoImage is an ISO9660 image with Joliet extensions, and optionally UDF, built from files. The
+// image is produced when it is read, without temporary files
+type IsoImage struct {
+	writer *udf.ImageWriter
+}
+
+// NewIsoImage returns an image of the given files, by their slash separated path in the image, such
+// as "openstack/latest/user_data". The parent directories of the files are created
+func NewIsoImage(files map[string][]byte, options IsoImageOptions) (*IsoImage, error) {
+	imageFiles := make([]udf.ImageFile, 0, len(files))
+	// The files are added in a stable order, so that the image is the same for the same files
+	for _, filePath := range slices.Sorted(maps.Keys(files)) {
+		content := files[filePath]
+		imageFiles = append(imageFiles, udf.ImageFile{
+			Path: filePath,
+			Size: int64(len(content)),
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(content)), nil
+			},
+		})
+	}
+	return newIsoImage(imageFiles, options)
+}
+
+// NewIsoImageFromDirectory returns an image of the files and directories of a local directory, which
+// becomes the root of the image. The files are read when the image is
+func NewIsoImageFromDirectory(directory string, options IsoImageOptions) (*IsoImage, error) {
+	var imageFiles []udf.ImageFile
+	err := filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == directory {
+			return nil
+		}
+		relativePath, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+		// Symbolic links are replaced by their target
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		imageFile := udf.ImageFile{
+			Path:    filepath.ToSlash(relativePath),
+			ModTime: info.ModTime(),
+		}
+		switch {
+		case entry.IsDir():
+			imageFile.Directory = true
+		case info.Mode().IsRegular():
+			imageFile.Size = info.Size()
+			imageFile.Executable = info.Mode().Perm()&0111 != 0
+			imageFile.Open = func() (io.ReadCloser, error) {
+				return os.Open(filepath.Clean(filePath))
+			}
+		default:
+			return fmt.Errorf("'%s' is not a regular file or a directory", filePath)
+		}
+		imageFiles = append(imageFiles, imageFile)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory '%s': %s", directory, err)
+	}
+	return newIsoImage(imageFiles, options)
+}
+
+func newIsoImage(files []udf.ImageFile, options IsoImageOptions) (*IsoImage, error) {
+	writer, err := udf.NewImageWriter(files, udf.WriterOptions{
+		VolumeIdentifier: options.VolumeIdentifier,
+		Udf:              options.Udf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error building ISO image: %s", err)
+	}
+	return &IsoImage{writer: writer}, nil
+}
+
+// Size returns the size of the image, in bytes
+func (image *IsoImage) Size() int64 {
+	return image.writer.Size()
+}
+
+// NewReader returns the content of the image, which is Size bytes long, such as for
+// Catalog.UploadMediaFromReader. The files are opened when their content is reached
+func (image *IsoImage) NewReader() io.ReadCloser {
+	return image.writer.NewReader()
+}
+
+// WriteTo writes the image, such as to a local file
+func (image *IsoImage) WriteTo(writer io.Writer) (int64, error) {
+	return image.writer.WriteTo(writer)
+}
+
+// UploadMediaFromFiles builds an ISO image of the given files, as NewIsoImage does, and uploads it
+// as a media while it is built, without temporary files. The files must not change until the
+// returned task completes. Images of local directories can be uploaded with NewIsoImageFromDirectory
+// and UploadMediaFromReader
+func (cat *Catalog) UploadMediaFromFiles(mediaName, mediaDescription string, files map[string][]byte, options IsoImageOptions, uploadPieceSize int64) (UploadTask, error) {
+	image, err := NewIsoImage(files, options)
+	if err != nil {
+		return UploadTask{}, err
+	}
+	return cat.UploadMediaFromReader(mediaName, mediaDescription, image.NewReader(), image.Size(), uploadPieceSize, false)
+}
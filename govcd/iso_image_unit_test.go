@@ -0,0 +1,406 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/vmware/go-vcloud-director/v3/govcd/internal/udf"
+)
+
+const testIsoSectorSize = 2048
+
+// writeTestIsoImage returns the content of an image, checking it is as long as its size
+func writeTestIsoImage(t *testing.T, image *IsoImage) []byte {
+	var buffer bytes.Buffer
+	written, err := image.WriteTo(&buffer)
+	if err != nil {
+		t.Fatalf("error writing image: %s", err)
+	}
+	if written != image.Size() || int64(buffer.Len()) != image.Size() || image.Size()%testIsoSectorSize != 0 {
+		t.Fatalf("expected an image of %d bytes, got %d written and %d in buffer", image.Size(), written, buffer.Len())
+	}
+	return buffer.Bytes()
+}
+
+// readTestIsoTree returns the files of the ISO9660 tree of the volume descriptor recorded at the given
+// sector, by path. The versions of the file names are removed from the Joliet tree
+func readTestIsoTree(t *testing.T, image []byte, descriptorSector int, joliet bool) map[string][]byte {
+	files := make(map[string][]byte)
+	var readDirectory func(record []byte, directoryPath string)
+	readDirectory = func(record []byte, directoryPath string) {
+		location := int(binary.LittleEndian.Uint32(record[2:6]))
+		size := int(binary.LittleEndian.Uint32(record[10:14]))
+		if binary.BigEndian.Uint32(record[6:10]) != uint32(location) || binary.BigEndian.Uint32(record[14:18]) != uint32(size) {
+			t.Fatalf("both endian fields of directory '%s' differ", directoryPath)
+		}
+		extent := image[location*testIsoSectorSize : location*testIsoSectorSize+size]
+		for offset := 0; offset < size; {
+			length := int(extent[offset])
+			if length == 0 {
+				offset = (offset/testIsoSectorSize + 1) * testIsoSectorSize
+				continue
+			}
+			child := extent[offset : offset+length]
+			offset += length
+			identifier := child[33 : 33+int(child[32])]
+			if len(identifier) == 1 && identifier[0] <= 1 {
+				continue
+			}
+			name := string(identifier)
+			if joliet {
+				characters := make([]uint16, len(identifier)/2)
+				for idx := range characters {
+					characters[idx] = binary.BigEndian.Uint16(identifier[2*idx:])
+				}
+				name = strings.TrimSuffix(string(utf16.Decode(characters)), ";1")
+			}
+			childPath := path.Join(directoryPath, name)
+			if child[25]&0x02 != 0 {
+				readDirectory(child, childPath)
+				continue
+			}
+			fileLocation := int(binary.LittleEndian.Uint32(child[2:6])) * testIsoSectorSize
+			files[childPath] = image[fileLocation : fileLocation+int(binary.LittleEndian.Uint32(child[10:14]))]
+		}
+	}
+	descriptor := image[descriptorSector*testIsoSectorSize:]
+	if string(descriptor[1:6]) != "CD001" {
+		t.Fatalf("no volume descriptor at sector %d", descriptorSector)
+	}
+	readDirectory(descriptor[156:190], "")
+	return files
+}
+
+// readTestUdfTree returns the files of the UDF file system of an image, by path, and the modes of its
+// files and directories
+func readTestUdfTree(t *testing.T, image []byte) (string, map[string][]byte, map[string]fs.FileMode) {
+	reader, err := udf.Open(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("error opening UDF file system: %s", err)
+	}
+	root, err := reader.RootDir()
+	if err != nil {
+		t.Fatalf("error reading UDF root directory: %s", err)
+	}
+	files := make(map[string][]byte)
+	modes := make(map[string]fs.FileMode)
+	var readDirectory func(directory *udf.FileInfo)
+	readDirectory = func(directory *udf.FileInfo) {
+		children, err := reader.ReadDir(directory)
+		if err != nil {
+			t.Fatalf("error reading UDF directory '%s': %s", directory.Path(), err)
+		}
+		for idx := range children {
+			child := &children[idx]
+			childPath := filepath.ToSlash(child.Path())
+			modes[childPath] = child.FileMode()
+			if child.IsDir() {
+				readDirectory(child)
+				continue
+			}
+			fileReader, err := reader.NewFileReader(child)
+			if err != nil {
+				t.Fatalf("error opening UDF file '%s': %s", childPath, err)
+			}
+			files[childPath], err = io.ReadAll(fileReader)
+			if err != nil {
+				t.Fatalf("error reading UDF file '%s': %s", childPath, err)
+			}
+		}
+	}
+	readDirectory(root)
+	return root.Name(), files, modes
+}
+
+func Test_NewIsoImage(t *testing.T) {
+	longName := strings.Repeat("long-name-", 7) + ".txt"
+	files := map[string][]byte{
+		"meta-data":                  []byte("instance-id: test\n"),
+		"user-data":                  []byte("#cloud-config\nhostname: test\n"),
+		"openstack/latest/user_data": bytes.Repeat([]byte("0123456789"), 500),
+		"empty":                      nil,
+		"UPPER.txt":                  []byte("upper"),
+		"upper.txt":                  []byte("lower"),
+		longName:                     []byte("long"),
+	}
+	// A directory with records over several sectors
+	for idx := range 150 {
+		files[fmt.Sprintf("many/file-%03d.txt", idx)] = []byte(fmt.Sprintf("file %d", idx))
+	}
+
+	image, err := NewIsoImage(files, IsoImageOptions{VolumeIdentifier: "cidata", Udf: true})
+	if err != nil {
+		t.Fatalf("error building image: %s", err)
+	}
+	content := writeTestIsoImage(t, image)
+
+	isIso, err := readHeader(bytes.NewReader(content))
+	if err != nil || !isIso {
+		t.Fatalf("expected the image to be recognized as ISO: %v", err)
+	}
+
+	// Joliet keeps the first 64 characters of names
+	expectedJoliet := make(map[string][]byte)
+	for name, fileContent := range files {
+		if name == longName {
+			name = name[:64]
+		}
+		expectedJoliet[name] = fileContent
+	}
+	jolietFiles := readTestIsoTree(t, content, 17, true)
+	if !reflect.DeepEqual(normalizeTestIsoFiles(jolietFiles), normalizeTestIsoFiles(expectedJoliet)) {
+		t.Errorf("unexpected Joliet files %v", testIsoFileNames(jolietFiles))
+	}
+
+	primaryFiles := readTestIsoTree(t, content, 16, false)
+	if len(primaryFiles) != len(files) {
+		t.Errorf("expected %d ISO9660 files, got %d", len(files), len(primaryFiles))
+	}
+	for name, expected := range map[string]string{
+		"USER_DAT.;1":                 "#cloud-config\nhostname: test\n",
+		"UPPER.TXT;1":                 "upper",
+		"UPPER~1.TXT;1":               "lower",
+		"LONG_NAM.TXT;1":              "long",
+		"MANY/FILE_149.TXT;1":         "file 149",
+		"OPENSTAC/LATEST/USER_DAT.;1": string(files["openstack/latest/user_data"]),
+	} {
+		if string(primaryFiles[name]) != expected {
+			t.Errorf("expected ISO9660 file '%s' to hold '%s', got '%s'", name, expected, primaryFiles[name])
+		}
+	}
+
+	volumeIdentifier, udfFiles, modes := readTestUdfTree(t, content)
+	if volumeIdentifier != "cidata" {
+		t.Errorf("expected UDF volume identifier 'cidata', got '%s'", volumeIdentifier)
+	}
+	if !reflect.DeepEqual(normalizeTestIsoFiles(udfFiles), normalizeTestIsoFiles(files)) {
+		t.Errorf("unexpected UDF files %v", testIsoFileNames(udfFiles))
+	}
+	if modes["user-data"] != 0444 || modes["openstack/latest"] != fs.ModeDir|0555 {
+		t.Errorf("unexpected UDF modes %v", modes)
+	}
+}
+
+func Test_NewIsoImageWithoutUdf(t *testing.T) {
+	files := map[string][]byte{
+		"meta-data": []byte("instance-id: test\n"),
+		"user-data": []byte("#cloud-config\n"),
+	}
+	image, err := NewIsoImage(files, IsoImageOptions{VolumeIdentifier: "cidata"})
+	if err != nil {
+		t.Fatalf("error building image: %s", err)
+	}
+	content := writeTestIsoImage(t, image)
+
+	if !reflect.DeepEqual(readTestIsoTree(t, content, 17, true), files) {
+		t.Errorf("unexpected Joliet files")
+	}
+	if _, err = udf.Open(bytes.NewReader(content)); err == nil {
+		t.Errorf("expected no UDF file system")
+	}
+	if label := strings.TrimSpace(string(content[16*testIsoSectorSize+40 : 16*testIsoSectorSize+72])); label != "cidata" {
+		t.Errorf("expected volume identifier 'cidata', got '%s'", label)
+	}
+}
+
+func Test_NewIsoImageFromDirectory(t *testing.T) {
+	directory := t.TempDir()
+	for name, content := range map[string]string{
+		"user-data":      "#cloud-config\n",
+		"scripts/run.sh": "#!/bin/sh\n",
+	} {
+		filePath := filepath.Join(directory, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(filePath), 0750)
+		if err == nil {
+			err = os.WriteFile(filePath, []byte(content), 0600)
+		}
+		if err != nil {
+			t.Fatalf("error writing '%s': %s", name, err)
+		}
+	}
+	err := os.Chmod(filepath.Join(directory, "scripts", "run.sh"), 0700)
+	if err == nil {
+		err = os.Mkdir(filepath.Join(directory, "empty"), 0750)
+	}
+	if err != nil {
+		t.Fatalf("error preparing directory: %s", err)
+	}
+
+	image, err := NewIsoImageFromDirectory(directory, IsoImageOptions{Udf: true})
+	if err != nil {
+		t.Fatalf("error building image: %s", err)
+	}
+	content := writeTestIsoImage(t, image)
+
+	_, udfFiles, modes := readTestUdfTree(t, content)
+	expected := map[string][]byte{
+		"user-data":      []byte("#cloud-config\n"),
+		"scripts/run.sh": []byte("#!/bin/sh\n"),
+	}
+	if !reflect.DeepEqual(udfFiles, expected) {
+		t.Errorf("unexpected UDF files %v", testIsoFileNames(udfFiles))
+	}
+	expectedModes := map[string]fs.FileMode{
+		"user-data":      0444,
+		"scripts":        fs.ModeDir | 0555,
+		"scripts/run.sh": 0555,
+		"empty":          fs.ModeDir | 0555,
+	}
+	if !reflect.DeepEqual(modes, expectedModes) {
+		t.Errorf("expected UDF modes %v, got %v", expectedModes, modes)
+	}
+	if !reflect.DeepEqual(readTestIsoTree(t, content, 17, true), expected) {
+		t.Errorf("unexpected Joliet files")
+	}
+}
+
+func Test_NewIsoImageErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string][]byte
+		options       IsoImageOptions
+		expectedError string
+	}{
+		{
+			name:          "parent path",
+			files:         map[string][]byte{"../user-data": nil},
+			expectedError: "invalid path '../user-data'",
+		},
+		{
+			name:          "file and directory",
+			files:         map[string][]byte{"openstack": nil, "openstack/latest/user_data": nil},
+			expectedError: "is both a file and a directory",
+		},
+		{
+			name:          "long volume identifier",
+			files:         map[string][]byte{"user-data": nil},
+			options:       IsoImageOptions{VolumeIdentifier: strings.Repeat("v", 33)},
+			expectedError: "longer than 32 characters",
+		},
+		{
+			name: "same Joliet names",
+			files: map[string][]byte{
+				strings.Repeat("n", 64) + "-1": nil,
+				strings.Repeat("n", 64) + "-2": nil,
+			},
+			expectedError: "are the same in the Joliet file system",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewIsoImage(test.files, test.options)
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing '%s', got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+// Test_ImageWriterPathConflicts checks that the conflicts between paths don't depend on their order,
+// and that the layout of an image doesn't depend on the order of the files
+func Test_ImageWriterPathConflicts(t *testing.T) {
+	for _, paths := range [][]string{{"openstack", "openstack/latest/user_data"}, {"openstack/latest/user_data", "openstack"}} {
+		var files []udf.ImageFile
+		for _, filePath := range paths {
+			files = append(files, udf.ImageFile{Path: filePath})
+		}
+		_, err := udf.NewImageWriter(files, udf.WriterOptions{})
+		if err == nil || !strings.Contains(err.Error(), "is both a file and a directory") {
+			t.Errorf("%v: expected file and directory error, got %v", paths, err)
+		}
+	}
+	_, err := udf.NewImageWriter([]udf.ImageFile{{Path: "user-data"}, {Path: "user-data"}}, udf.WriterOptions{})
+	if err == nil || !strings.Contains(err.Error(), "duplicate path") {
+		t.Errorf("expected duplicate path error, got %v", err)
+	}
+	_, err = udf.NewImageWriter([]udf.ImageFile{{Path: "scripts/run.sh"}, {Path: "scripts", Directory: true}}, udf.WriterOptions{})
+	if err != nil {
+		t.Errorf("unexpected error for a directory added after its children: %s", err)
+	}
+
+	// The files are at the same place in every image of the same files, which only differ by their
+	// recording time
+	files := make(map[string][]byte)
+	for _, name := range []string{"b/file", "a/file", "c", "a/b/c/d", "e/f", "g"} {
+		files[name] = []byte("content of " + name)
+	}
+	var layouts []map[string]int
+	for range 10 {
+		image, err := NewIsoImage(files, IsoImageOptions{Udf: true})
+		if err != nil {
+			t.Fatalf("error creating image: %s", err)
+		}
+		var content bytes.Buffer
+		_, err = image.WriteTo(&content)
+		if err != nil {
+			t.Fatalf("error writing image: %s", err)
+		}
+		layout := make(map[string]int)
+		for name, fileContent := range files {
+			layout[name] = bytes.Index(content.Bytes(), fileContent)
+		}
+		layouts = append(layouts, layout)
+	}
+	for _, layout := range layouts[1:] {
+		if !reflect.DeepEqual(layout, layouts[0]) {
+			t.Fatalf("files are at different places in images of the same files: %v, %v", layouts[0], layout)
+		}
+	}
+}
+
+// Test_ImageWriterFileSize checks that files which don't match their declared size fail the image
+func Test_ImageWriterFileSize(t *testing.T) {
+	for content, expectedError := range map[string]string{
+		"short":                        "is shorter than its size",
+		"longer than the size of file": "is longer than its size",
+	} {
+		writer, err := udf.NewImageWriter([]udf.ImageFile{{
+			Path: "file",
+			Size: 10,
+			Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(content)), nil },
+		}}, udf.WriterOptions{Udf: true})
+		if err != nil {
+			t.Fatalf("error creating writer: %s", err)
+		}
+		_, err = writer.WriteTo(io.Discard)
+		if err == nil || !strings.Contains(err.Error(), expectedError) {
+			t.Errorf("expected error containing '%s', got %v", expectedError, err)
+		}
+	}
+}
+
+// normalizeTestIsoFiles returns the files with empty contents as nil, for comparisons
+func normalizeTestIsoFiles(files map[string][]byte) map[string][]byte {
+	normalized := make(map[string][]byte, len(files))
+	for name, content := range files {
+		if len(content) == 0 {
+			content = nil
+		}
+		normalized[name] = content
+	}
+	return normalized
+}
+
+func testIsoFileNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
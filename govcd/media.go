@@ -6,6 +6,7 @@ package govcd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/vmware/go-vcloud-director/v3/govcd/iso"
 	"github.com/vmware/go-vcloud-director/v3/types/v56"
 	"github.com/vmware/go-vcloud-director/v3/util"
 )
@@ -109,14 +111,33 @@ func (vdc *Vdc) UploadMediaImage(mediaName, mediaDescription, filePath string, u
 		return UploadTask{}, fmt.Errorf("[ERROR] Issue creating media: %s", err)
 	}
 
-	return executeUpload(vdc.client, media, mediaFilePath, mediaName, fileSize, uploadPieceSize)
+	return executeUpload(vdc.client, media, mediaFilePath, mediaName, fileSize, uploadPieceSize, nil)
 }
 
-func executeUpload(client *Client, media *types.Media, mediaFilePath, mediaName string, fileSize, uploadPieceSize int64) (UploadTask, error) {
+// executeUpload uploads the file of a media in the background. When state is not nil, the upload is
+// resumable: it continues from the bytes already received by vCD, and the media is kept on failure
+func executeUpload(client *Client, media *types.Media, mediaFilePath, mediaName string, fileSize, uploadPieceSize int64, state *UploadState) (UploadTask, error) {
+	return executeMediaUpload(client, media, mediaName, fileSize, uploadPieceSize, state, func(details uploadDetails) error {
+		_, err := uploadFile(client, mediaFilePath, details)
+		if err != nil {
+			return fmt.Errorf("error calling uploadFile: %s", err)
+		}
+		return nil
+	})
+}
+
+// executeMediaUpload sends the content of the media in the background with the upload function,
+// which records its error in details.uploadError
+func executeMediaUpload(client *Client, media *types.Media, mediaName string, fileSize, uploadPieceSize int64, state *UploadState, upload func(details uploadDetails) error) (UploadTask, error) {
 	uploadLink, err := getUploadLink(media.Files)
 	if err != nil {
 		return UploadTask{}, fmt.Errorf("[ERROR] Issue getting upload link: %s", err)
 	}
+	removeOnError := func() {
+		if state == nil {
+			removeImageOnError(client, media, mediaName)
+		}
+	}
 
 	callBack, uploadProgress := getProgressCallBackFunction()
 
@@ -132,16 +153,27 @@ func executeUpload(client *Client, media *types.Media, mediaFilePath, mediaName
 		callBack:                 callBack,
 		uploadError:              &uploadError,
 	}
+	applyUploadSettings(client, &details)
+	if state != nil {
+		file := media.Files.File[0]
+		details.fileOffset = state.resumeOffset(file.Name, file.BytesTransferred)
+		details.onProgress = state.fileProgress(file.Name, uploadLink.String(), fileSize)
+		details.pieceRetries = uploadPieceRetries
+	}
 
 	// sending upload process to background, this allows not to lock and return task to client
 	// The error should be captured in details.uploadError, but just in case, we add a logging for the
 	// main error
 	go func() {
-		_, err = uploadFile(client, mediaFilePath, details)
+		err := upload(details)
 		if err != nil {
 			util.Logger.Println(strings.Repeat("*", 80))
-			util.Logger.Printf("*** [DEBUG - executeUpload] error calling uploadFile: %s\n", err)
+			util.Logger.Printf("*** [DEBUG - executeUpload] %s\n", err)
 			util.Logger.Println(strings.Repeat("*", 80))
+			return
+		}
+		if state != nil {
+			state.complete()
 		}
 	}()
 
@@ -149,11 +181,11 @@ func executeUpload(client *Client, media *types.Media, mediaFilePath, mediaName
 	for _, item := range media.Tasks.Task {
 		task, err = createTaskForVcdImport(client, item.HREF)
 		if err != nil {
-			removeImageOnError(client, media, mediaName)
+			removeOnError()
 			return UploadTask{}, err
 		}
 		if task.Task.Status == "error" {
-			removeImageOnError(client, media, mediaName)
+			removeOnError()
 			return UploadTask{}, fmt.Errorf("task did not complete succesfully: %s", task.Task.Description)
 		}
 	}
@@ -255,6 +287,9 @@ func queryMedia(client *Client, mediaUrl string, newItemName string) (*types.Med
 		return nil, err
 	}
 
+	if mediaParsed.Tasks == nil {
+		return mediaParsed, nil
+	}
 	for _, task := range mediaParsed.Tasks.Task {
 		if task.Status == "error" && newItemName == task.Owner.Name {
 			util.Logger.Printf("[Error] %#v", task.Error)
@@ -276,8 +311,11 @@ func verifyIso(filePath string) (bool, error) {
 	return readHeader(file)
 }
 
+// isoHeaderSize is the number of bytes at the beginning of a file which identify an ISO or UDF image
+const isoHeaderSize = 37000
+
 func readHeader(reader io.Reader) (bool, error) {
-	buffer := make([]byte, 37000)
+	buffer := make([]byte, isoHeaderSize)
 
 	_, err := reader.Read(buffer)
 	if err != nil && err != io.EOF {
@@ -807,39 +845,58 @@ func (media *Media) enableDownload() (string, error) {
 }
 
 // Download gets the contents of a media item as a byte stream
-// NOTE: the whole item will be saved in local memory. Do not attempt this operation for very large items
+// NOTE: the whole item will be saved in local memory. Do not attempt this operation for very large items:
+// use DownloadTo or DownloadToFile instead
 func (media *Media) Download() ([]byte, error) {
-
-	downloadHref, err := media.enableDownload()
+	var content bytes.Buffer
+	_, err := media.DownloadTo(context.Background(), &content, nil)
 	if err != nil {
 		return nil, err
 	}
+	return content.Bytes(), nil
+}
 
-	downloadUrl, err := url.ParseRequestURI(downloadHref)
+// DownloadTo streams the contents of a media item to the writer and returns the number of bytes
+// held by the writer at the end. With options.Offset, the download resumes from that byte
+// using an HTTP range request. options can be nil
+func (media *Media) DownloadTo(ctx context.Context, writer io.Writer, options *DownloadOptions) (int64, error) {
+	downloadHref, err := media.enableDownload()
 	if err != nil {
-		return nil, fmt.Errorf("error getting download URL: %s", err)
+		return 0, err
 	}
-
-	request := media.client.NewRequest(map[string]string{}, http.MethodGet, *downloadUrl, nil)
-	resp, err := media.client.Http.Do(request)
+	size, err := downloadTransferUrl(ctx, media.client, downloadHref, writer, options)
 	if err != nil {
-		return nil, fmt.Errorf("error getting media download: %s", err)
+		return size, fmt.Errorf("error downloading media '%s': %w", media.Media.Name, err)
 	}
+	return size, nil
+}
 
-	if !isSuccessStatus(resp.StatusCode) {
-		return nil, fmt.Errorf("error downloading media: %s", resp.Status)
+// DownloadToFile downloads the contents of a media item to a file and returns its size. With
+// options.Resume, an existing partial file is completed instead of being overwritten. options can be nil
+func (media *Media) DownloadToFile(ctx context.Context, filePath string, options *DownloadOptions) (int64, error) {
+	downloadHref, err := media.enableDownload()
+	if err != nil {
+		return 0, err
 	}
-	body, err := io.ReadAll(resp.Body)
-
-	defer func() {
-		err = resp.Body.Close()
-		if err != nil {
-			panic(fmt.Sprintf("error closing body: %s", err))
-		}
-	}()
+	size, err := downloadTransferUrlToFile(ctx, media.client, downloadHref, filePath, options)
+	if err != nil {
+		return size, fmt.Errorf("error downloading media '%s': %w", media.Media.Name, err)
+	}
+	return size, nil
+}
 
+// OpenIso opens the ISO image of a media item for inspection, without downloading the whole image:
+// the volume descriptors, directories and files read through the returned image are requested from
+// the transfer service with HTTP range requests. The image implements the io/fs interfaces, such as
+// fs.ReadDir and fs.ReadFile. The context applies to every read of the image
+func (media *Media) OpenIso(ctx context.Context) (*iso.Image, error) {
+	downloadHref, err := media.enableDownload()
 	if err != nil {
 		return nil, err
 	}
-	return body, nil
+	image, err := iso.Open(newTransferRangeReader(ctx, media.client, downloadHref, media.Media.Size))
+	if err != nil {
+		return nil, fmt.Errorf("error opening media '%s' as ISO image: %s", media.Media.Name, err)
+	}
+	return image, nil
 }
@@ -7,6 +7,10 @@
 package govcd
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	. "gopkg.in/check.v1"
 	"os"
@@ -116,6 +120,27 @@ func (vcd *TestVCD) Test_UploadAnyMediaFile(check *C) {
 		check.Assert(fromFile, DeepEquals, contents)
 	}
 
+	// Stream the media item, then resume a partial download to a file with checksum verification
+	fromFile, err := os.ReadFile(path.Clean(sourceFile))
+	check.Assert(err, IsNil)
+	var streamed bytes.Buffer
+	size, err := media.DownloadTo(context.Background(), &streamed, nil)
+	check.Assert(err, IsNil)
+	check.Assert(size, Equals, int64(len(fromFile)))
+	check.Assert(streamed.Bytes(), DeepEquals, fromFile)
+
+	checksum := sha256.Sum256(fromFile)
+	downloadPath := path.Join(check.MkDir(), "media")
+	err = os.WriteFile(downloadPath, fromFile[:len(fromFile)/2], 0600)
+	check.Assert(err, IsNil)
+	size, err = media.DownloadToFile(context.Background(), downloadPath, &DownloadOptions{
+		Resume:            true,
+		ChecksumAlgorithm: "sha256",
+		Checksum:          hex.EncodeToString(checksum[:]),
+	})
+	check.Assert(err, IsNil)
+	check.Assert(size, Equals, int64(len(fromFile)))
+
 	task, err := media.Delete()
 	check.Assert(err, IsNil)
 	err = task.WaitTaskCompletion()
@@ -0,0 +1,625 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// Kinds of objects handled by the NSX-T cascade delete planner. The order of the list is used to
+// sort steps that have no dependency between each other
+const (
+	CascadeDeleteKindDfwRule              = "dfwRule"
+	CascadeDeleteKindEdgeFirewallRule     = "edgeFirewallRule"
+	CascadeDeleteKindNatRule              = "natRule"
+	CascadeDeleteKindIpSecVpnTunnel       = "ipSecVpnTunnel"
+	CascadeDeleteKindAlbVirtualService    = "albVirtualService"
+	CascadeDeleteKindAlbPool              = "albPool"
+	CascadeDeleteKindAlbServiceEngineLink = "albServiceEngineGroupAssignment"
+	CascadeDeleteKindAlbSettings          = "albSettings"
+	CascadeDeleteKindDhcpBinding          = "dhcpBinding"
+	CascadeDeleteKindDhcp                 = "dhcp"
+	CascadeDeleteKindFirewallGroup        = "firewallGroup"
+	CascadeDeleteKindNetwork              = "network"
+	CascadeDeleteKindEdgeGateway          = "edgeGateway"
+	CascadeDeleteKindVdcGroup             = "vdcGroup"
+)
+
+var cascadeDeleteKindOrder = []string{
+	CascadeDeleteKindDfwRule,
+	CascadeDeleteKindEdgeFirewallRule,
+	CascadeDeleteKindNatRule,
+	CascadeDeleteKindIpSecVpnTunnel,
+	CascadeDeleteKindAlbVirtualService,
+	CascadeDeleteKindAlbPool,
+	CascadeDeleteKindAlbServiceEngineLink,
+	CascadeDeleteKindAlbSettings,
+	CascadeDeleteKindDhcpBinding,
+	CascadeDeleteKindDhcp,
+	CascadeDeleteKindFirewallGroup,
+	CascadeDeleteKindNetwork,
+	CascadeDeleteKindEdgeGateway,
+	CascadeDeleteKindVdcGroup,
+}
+
+// NsxtCascadeDeleteOptions defines the scope of an NSX-T cascade delete plan
+type NsxtCascadeDeleteOptions struct {
+	// OrgName is the Org containing the objects to delete. It is mandatory
+	OrgName string
+	// VdcGroupIds and EdgeGatewayIds restrict the plan to the given VDC Groups and Edge Gateways,
+	// together with all the objects that reference them (directly or indirectly). When both are
+	// empty, all the NSX-T network objects of the Org are included
+	VdcGroupIds    []string
+	EdgeGatewayIds []string
+}
+
+// CascadeDeleteStep is a single deletion in an NSX-T cascade delete plan
+type CascadeDeleteStep struct {
+	Kind string
+	Id   string
+	Name string
+	// Parent is the name of the Edge Gateway, VDC Group or network that contains the object
+	Parent string
+
+	// key identifies the step in the plan (IDs of rules are not unique across kinds)
+	key string
+	// references contains the keys of the steps for objects that this object depends on, and
+	// which can only be deleted after this one
+	references []string
+	delete     func() error
+}
+
+// NsxtCascadeDeletePlan contains the steps required to remove a set of NSX-T objects, in a
+// safe deletion order: each object is deleted before the objects it references
+type NsxtCascadeDeletePlan struct {
+	OrgName string
+	Steps   []*CascadeDeleteStep
+}
+
+// PlanNsxtCascadeDelete discovers the NSX-T network objects of an Org (VDC Groups, Edge Gateways,
+// Org VDC networks, Firewall Groups and IP Sets, NAT rules, Edge and Distributed firewall rules,
+// IPSec VPN tunnels, ALB objects and DHCP) and the references between them, and returns the
+// order in which they can be deleted without dependency errors.
+//
+// The returned plan can be printed with NsxtCascadeDeletePlan.String (plan-only mode) or run
+// with NsxtCascadeDeletePlan.Execute.
+//
+// Note. vApps and VMs connected to the networks are not part of the plan and must be removed
+// beforehand.
+func (vcdClient *VCDClient) PlanNsxtCascadeDelete(options NsxtCascadeDeleteOptions) (*NsxtCascadeDeletePlan, error) {
+	if options.OrgName == "" {
+		return nil, fmt.Errorf("Org name must be specified for NSX-T cascade delete")
+	}
+	adminOrg, err := vcdClient.GetAdminOrgByName(options.OrgName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Org '%s': %s", options.OrgName, err)
+	}
+
+	planner := &cascadeDeletePlanner{
+		vcdClient: vcdClient,
+		steps:     make(map[string]*CascadeDeleteStep),
+	}
+	err = planner.discover(adminOrg)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering NSX-T objects in Org '%s': %s", options.OrgName, err)
+	}
+
+	steps := planner.stepList()
+	if len(options.VdcGroupIds) > 0 || len(options.EdgeGatewayIds) > 0 {
+		var roots []string
+		for _, id := range options.VdcGroupIds {
+			roots = append(roots, cascadeDeleteKey(CascadeDeleteKindVdcGroup, id))
+		}
+		for _, id := range options.EdgeGatewayIds {
+			roots = append(roots, cascadeDeleteKey(CascadeDeleteKindEdgeGateway, id))
+		}
+		steps, err = cascadeDeleteClosure(steps, roots)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	orderedSteps, err := orderCascadeDeleteSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	return &NsxtCascadeDeletePlan{OrgName: adminOrg.AdminOrg.Name, Steps: orderedSteps}, nil
+}
+
+// String returns a human readable list of the deletions in the plan
+func (plan *NsxtCascadeDeletePlan) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "NSX-T cascade delete plan for Org '%s': %d step(s)\n", plan.OrgName, len(plan.Steps))
+	for index, step := range plan.Steps {
+		fmt.Fprintf(&builder, "%4d. %s '%s'", index+1, step.Kind, step.Name)
+		if step.Parent != "" {
+			fmt.Fprintf(&builder, " in '%s'", step.Parent)
+		}
+		fmt.Fprintf(&builder, " (%s)\n", step.Id)
+	}
+	return builder.String()
+}
+
+// Execute deletes the objects in the plan, in order. It stops at the first failure, so that no
+// object is deleted while something still references it
+func (plan *NsxtCascadeDeletePlan) Execute() error {
+	for index, step := range plan.Steps {
+		util.Logger.Printf("[TRACE] NSX-T cascade delete step %d/%d: %s '%s' (%s)", index+1, len(plan.Steps), step.Kind, step.Name, step.Id)
+		err := step.delete()
+		if err != nil {
+			return fmt.Errorf("error deleting %s '%s' (step %d of %d): %s", step.Kind, step.Name, index+1, len(plan.Steps), err)
+		}
+	}
+	return nil
+}
+
+// cascadeDeletePlanner collects the steps of a plan during discovery
+type cascadeDeletePlanner struct {
+	vcdClient *VCDClient
+	steps     map[string]*CascadeDeleteStep
+}
+
+func cascadeDeleteKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// add registers a step, unless an object with the same kind and ID was already found from
+// another parent. It returns false in the latter case
+func (planner *cascadeDeletePlanner) add(kind, id, name, parent string, deleteFunc func() error, references ...string) bool {
+	key := cascadeDeleteKey(kind, id)
+	if _, found := planner.steps[key]; found {
+		return false
+	}
+	planner.steps[key] = &CascadeDeleteStep{
+		Kind:       kind,
+		Id:         id,
+		Name:       name,
+		Parent:     parent,
+		key:        key,
+		references: references,
+		delete:     deleteFunc,
+	}
+	return true
+}
+
+func (planner *cascadeDeletePlanner) stepList() []*CascadeDeleteStep {
+	steps := make([]*CascadeDeleteStep, 0, len(planner.steps))
+	for _, step := range planner.steps {
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// ownerKey returns the key of the VDC Group or Edge Gateway owning an object. Objects owned by
+// a VDC have no owner step, as VDCs are not deleted by the plan
+func ownerKey(ownerRef *types.OpenApiReference) []string {
+	if ownerRef == nil || ownerRef.ID == "" {
+		return nil
+	}
+	switch {
+	case strings.Contains(ownerRef.ID, ":vdcGroup:"):
+		return []string{cascadeDeleteKey(CascadeDeleteKindVdcGroup, ownerRef.ID)}
+	case strings.Contains(ownerRef.ID, ":gateway:"):
+		return []string{cascadeDeleteKey(CascadeDeleteKindEdgeGateway, ownerRef.ID)}
+	}
+	return nil
+}
+
+func firewallGroupKeys(references ...[]types.OpenApiReference) []string {
+	var keys []string
+	for _, referenceList := range references {
+		for _, reference := range referenceList {
+			keys = append(keys, cascadeDeleteKey(CascadeDeleteKindFirewallGroup, reference.ID))
+		}
+	}
+	return keys
+}
+
+func (planner *cascadeDeletePlanner) discover(adminOrg *AdminOrg) error {
+	vdcGroups, err := adminOrg.GetAllVdcGroups(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving VDC Groups: %s", err)
+	}
+	for _, vdcGroup := range vdcGroups {
+		if !vdcGroup.IsNsxt() {
+			continue
+		}
+		err = planner.discoverVdcGroup(vdcGroup)
+		if err != nil {
+			return fmt.Errorf("error processing VDC Group '%s': %s", vdcGroup.VdcGroup.Name, err)
+		}
+	}
+
+	vdcs, err := adminOrg.GetAllVDCs(true)
+	if err != nil {
+		return fmt.Errorf("error retrieving VDCs: %s", err)
+	}
+	for _, vdc := range vdcs {
+		if !vdc.IsNsxt() {
+			continue
+		}
+		edgeGateways, err := vdc.GetAllNsxtEdgeGateways(nil)
+		if err != nil {
+			return fmt.Errorf("error retrieving Edge Gateways in VDC '%s': %s", vdc.Vdc.Name, err)
+		}
+		err = planner.discoverEdgeGateways(edgeGateways)
+		if err != nil {
+			return err
+		}
+		networks, err := vdc.GetAllOpenApiOrgVdcNetworks(nil)
+		if err != nil {
+			return fmt.Errorf("error retrieving networks in VDC '%s': %s", vdc.Vdc.Name, err)
+		}
+		err = planner.discoverNetworks(networks)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (planner *cascadeDeletePlanner) discoverVdcGroup(vdcGroup *VdcGroup) error {
+	vdcGroupId := vdcGroup.VdcGroup.Id
+	vdcGroupName := vdcGroup.VdcGroup.Name
+	vdcGroupKey := cascadeDeleteKey(CascadeDeleteKindVdcGroup, vdcGroupId)
+	planner.add(CascadeDeleteKindVdcGroup, vdcGroupId, vdcGroupName, "", vdcGroup.Delete)
+
+	if vdcGroup.VdcGroup.DfwEnabled {
+		dfw, err := vdcGroup.GetDistributedFirewall()
+		if err != nil {
+			return fmt.Errorf("error retrieving Distributed Firewall: %s", err)
+		}
+		for _, rule := range dfw.DistributedFirewallRuleContainer.Values {
+			dfwRule := &DistributedFirewallRule{Rule: rule, client: vdcGroup.client, VdcGroup: vdcGroup}
+			references := append(firewallGroupKeys(rule.SourceFirewallGroups, rule.DestinationFirewallGroups), vdcGroupKey)
+			planner.add(CascadeDeleteKindDfwRule, rule.ID, rule.Name, vdcGroupName, dfwRule.Delete, references...)
+		}
+	}
+
+	firewallGroups, err := getAllNsxtFirewallGroups(vdcGroup.client, queryParameterFilterAnd("_context=="+vdcGroupId, nil))
+	if err != nil {
+		return fmt.Errorf("error retrieving Firewall Groups: %s", err)
+	}
+	err = planner.discoverFirewallGroups(firewallGroups, vdcGroupName)
+	if err != nil {
+		return err
+	}
+
+	edgeGateways, err := vdcGroup.GetAllNsxtEdgeGateways(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving Edge Gateways: %s", err)
+	}
+	err = planner.discoverEdgeGateways(edgeGateways)
+	if err != nil {
+		return err
+	}
+
+	networks, err := vdcGroup.GetAllOpenApiOrgVdcNetworks(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving networks: %s", err)
+	}
+	return planner.discoverNetworks(networks)
+}
+
+func (planner *cascadeDeletePlanner) discoverFirewallGroups(firewallGroups []*NsxtFirewallGroup, parent string) error {
+	for _, firewallGroup := range firewallGroups {
+		fwGroup := firewallGroup.NsxtFirewallGroup
+		owner := fwGroup.OwnerRef
+		if owner == nil {
+			owner = fwGroup.EdgeGatewayRef
+		}
+		references := ownerKey(owner)
+		groupParent := parent
+		if owner != nil && owner.Name != "" {
+			groupParent = owner.Name
+		}
+		// Summaries don't contain the member networks of Security Groups
+		if fwGroup.TypeValue == types.FirewallGroupTypeSecurityGroup || fwGroup.Type == types.FirewallGroupTypeSecurityGroup {
+			if _, found := planner.steps[cascadeDeleteKey(CascadeDeleteKindFirewallGroup, fwGroup.ID)]; found {
+				continue
+			}
+			fullGroup, err := getNsxtFirewallGroupById(firewallGroup.client, fwGroup.ID)
+			if err != nil {
+				return fmt.Errorf("error retrieving Security Group '%s': %s", fwGroup.Name, err)
+			}
+			firewallGroup = fullGroup
+			for _, member := range fullGroup.NsxtFirewallGroup.Members {
+				references = append(references, cascadeDeleteKey(CascadeDeleteKindNetwork, member.ID))
+			}
+		}
+		planner.add(CascadeDeleteKindFirewallGroup, fwGroup.ID, fwGroup.Name, groupParent, firewallGroup.Delete, references...)
+	}
+	return nil
+}
+
+func (planner *cascadeDeletePlanner) discoverEdgeGateways(edgeGateways []*NsxtEdgeGateway) error {
+	for _, egw := range edgeGateways {
+		edgeId := egw.EdgeGateway.ID
+		edgeName := egw.EdgeGateway.Name
+		parent := ""
+		if egw.EdgeGateway.OwnerRef != nil {
+			parent = egw.EdgeGateway.OwnerRef.Name
+		}
+		if !planner.add(CascadeDeleteKindEdgeGateway, edgeId, edgeName, parent, egw.Delete, ownerKey(egw.EdgeGateway.OwnerRef)...) {
+			continue
+		}
+		err := planner.discoverEdgeGatewayContent(egw)
+		if err != nil {
+			return fmt.Errorf("error processing Edge Gateway '%s': %s", edgeName, err)
+		}
+	}
+	return nil
+}
+
+func (planner *cascadeDeletePlanner) discoverEdgeGatewayContent(egw *NsxtEdgeGateway) error {
+	edgeId := egw.EdgeGateway.ID
+	edgeName := egw.EdgeGateway.Name
+	edgeKey := cascadeDeleteKey(CascadeDeleteKindEdgeGateway, edgeId)
+
+	firewallGroups, err := egw.GetAllNsxtFirewallGroups(nil, "")
+	if err != nil {
+		return fmt.Errorf("error retrieving Firewall Groups: %s", err)
+	}
+	err = planner.discoverFirewallGroups(firewallGroups, edgeName)
+	if err != nil {
+		return err
+	}
+
+	natRules, err := egw.GetAllNatRules(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving NAT rules: %s", err)
+	}
+	for _, natRule := range natRules {
+		planner.add(CascadeDeleteKindNatRule, natRule.NsxtNatRule.ID, natRule.NsxtNatRule.Name, edgeName, natRule.Delete, edgeKey)
+	}
+
+	ipSecTunnels, err := egw.GetAllIpSecVpnTunnels(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving IPSec VPN tunnels: %s", err)
+	}
+	for _, tunnel := range ipSecTunnels {
+		planner.add(CascadeDeleteKindIpSecVpnTunnel, tunnel.NsxtIpSecVpn.ID, tunnel.NsxtIpSecVpn.Name, edgeName, tunnel.Delete, edgeKey)
+	}
+
+	firewall, err := egw.GetNsxtFirewall()
+	if err != nil {
+		return fmt.Errorf("error retrieving firewall rules: %s", err)
+	}
+	for _, rule := range firewall.NsxtFirewallRuleContainer.UserDefinedRules {
+		ruleId := rule.ID
+		references := append(firewallGroupKeys(rule.SourceFirewallGroups, rule.DestinationFirewallGroups), edgeKey)
+		planner.add(CascadeDeleteKindEdgeFirewallRule, ruleId, rule.Name, edgeName,
+			func() error { return firewall.DeleteRuleById(ruleId) }, references...)
+	}
+
+	return planner.discoverAlb(egw)
+}
+
+func (planner *cascadeDeletePlanner) discoverAlb(egw *NsxtEdgeGateway) error {
+	edgeId := egw.EdgeGateway.ID
+	edgeName := egw.EdgeGateway.Name
+	edgeKey := cascadeDeleteKey(CascadeDeleteKindEdgeGateway, edgeId)
+
+	albSettings, err := egw.GetAlbSettings()
+	if err != nil {
+		return fmt.Errorf("error retrieving ALB settings: %s", err)
+	}
+	if !albSettings.Enabled {
+		return nil
+	}
+	albSettingsKey := cascadeDeleteKey(CascadeDeleteKindAlbSettings, edgeId)
+	planner.add(CascadeDeleteKindAlbSettings, edgeId, edgeName, edgeName, egw.DisableAlb, edgeKey)
+
+	queryParameters := url.Values{}
+	queryParameters.Add("filter", "gatewayRef.id=="+edgeId)
+	assignments, err := planner.vcdClient.GetAllAlbServiceEngineGroupAssignments(queryParameters)
+	if err != nil {
+		return fmt.Errorf("error retrieving ALB Service Engine Group assignments: %s", err)
+	}
+	// Virtual Services reference the Service Engine Group, which is bound to the Edge Gateway by
+	// the assignment
+	assignmentKeys := make(map[string]string)
+	for _, assignment := range assignments {
+		assignmentId := assignment.NsxtAlbServiceEngineGroupAssignment.ID
+		serviceEngineGroup := assignment.NsxtAlbServiceEngineGroupAssignment.ServiceEngineGroupRef
+		assignmentKeys[serviceEngineGroup.ID] = cascadeDeleteKey(CascadeDeleteKindAlbServiceEngineLink, assignmentId)
+		planner.add(CascadeDeleteKindAlbServiceEngineLink, assignmentId, serviceEngineGroup.Name, edgeName,
+			assignment.Delete, albSettingsKey, edgeKey)
+	}
+
+	pools, err := planner.vcdClient.GetAllAlbPools(edgeId, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving ALB Pools: %s", err)
+	}
+	for _, pool := range pools {
+		references := []string{albSettingsKey, edgeKey}
+		if pool.NsxtAlbPool.MemberGroupRef != nil {
+			references = append(references, cascadeDeleteKey(CascadeDeleteKindFirewallGroup, pool.NsxtAlbPool.MemberGroupRef.ID))
+		}
+		planner.add(CascadeDeleteKindAlbPool, pool.NsxtAlbPool.ID, pool.NsxtAlbPool.Name, edgeName, pool.Delete, references...)
+	}
+
+	virtualServices, err := planner.vcdClient.GetAllAlbVirtualServiceSummaries(edgeId, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving ALB Virtual Services: %s", err)
+	}
+	for _, virtualService := range virtualServices {
+		vs := virtualService.NsxtAlbVirtualService
+		references := []string{
+			cascadeDeleteKey(CascadeDeleteKindAlbPool, vs.LoadBalancerPoolRef.ID),
+			albSettingsKey,
+			edgeKey,
+		}
+		if assignmentKey, found := assignmentKeys[vs.ServiceEngineGroupRef.ID]; found {
+			references = append(references, assignmentKey)
+		}
+		planner.add(CascadeDeleteKindAlbVirtualService, vs.ID, vs.Name, edgeName, virtualService.Delete, references...)
+	}
+	return nil
+}
+
+func (planner *cascadeDeletePlanner) discoverNetworks(networks []*OpenApiOrgVdcNetwork) error {
+	for _, network := range networks {
+		if !network.IsNsxt() {
+			continue
+		}
+		networkId := network.OpenApiOrgVdcNetwork.ID
+		networkName := network.OpenApiOrgVdcNetwork.Name
+		networkKey := cascadeDeleteKey(CascadeDeleteKindNetwork, networkId)
+		references := ownerKey(network.OpenApiOrgVdcNetwork.OwnerRef)
+		if network.OpenApiOrgVdcNetwork.Connection != nil && network.OpenApiOrgVdcNetwork.Connection.RouterRef.ID != "" {
+			references = append(references, cascadeDeleteKey(CascadeDeleteKindEdgeGateway, network.OpenApiOrgVdcNetwork.Connection.RouterRef.ID))
+		}
+		parent := ""
+		if network.OpenApiOrgVdcNetwork.OwnerRef != nil {
+			parent = network.OpenApiOrgVdcNetwork.OwnerRef.Name
+		}
+		if !planner.add(CascadeDeleteKindNetwork, networkId, networkName, parent, network.Delete, references...) {
+			continue
+		}
+
+		// Imported and direct networks don't support DHCP
+		if !network.IsRouted() && !network.IsIsolated() {
+			continue
+		}
+		if !network.IsDhcpEnabled() {
+			continue
+		}
+		dhcpKey := cascadeDeleteKey(CascadeDeleteKindDhcp, networkId)
+		planner.add(CascadeDeleteKindDhcp, networkId, networkName, networkName, network.DeletNetworkDhcp, networkKey)
+
+		bindings, err := network.GetAllOpenApiOrgVdcNetworkDhcpBindings(nil)
+		if err != nil {
+			return fmt.Errorf("error retrieving DHCP bindings of network '%s': %s", networkName, err)
+		}
+		for _, binding := range bindings {
+			planner.add(CascadeDeleteKindDhcpBinding, binding.OpenApiOrgVdcNetworkDhcpBinding.ID,
+				binding.OpenApiOrgVdcNetworkDhcpBinding.Name, networkName, binding.Delete, dhcpKey, networkKey)
+		}
+	}
+	return nil
+}
+
+// cascadeDeleteClosure returns the steps for the root objects and all the objects that
+// reference them, directly or indirectly
+func cascadeDeleteClosure(steps []*CascadeDeleteStep, roots []string) ([]*CascadeDeleteStep, error) {
+	byKey := make(map[string]*CascadeDeleteStep, len(steps))
+	for _, step := range steps {
+		byKey[step.key] = step
+	}
+	selected := make(map[string]bool)
+	for _, root := range roots {
+		if _, found := byKey[root]; !found {
+			return nil, fmt.Errorf("%s not found among the NSX-T objects of the Org", strings.Replace(root, ":", " ", 1))
+		}
+		selected[root] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, step := range steps {
+			if selected[step.key] {
+				continue
+			}
+			for _, reference := range step.references {
+				if selected[reference] {
+					selected[step.key] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var result []*CascadeDeleteStep
+	for _, step := range steps {
+		if selected[step.key] {
+			result = append(result, step)
+		}
+	}
+	return result, nil
+}
+
+// orderCascadeDeleteSteps sorts the steps so that each object comes before all the objects it
+// references. References to objects outside the list are ignored. Steps with no dependency
+// between them are sorted by kind and name, so that the same objects always produce the same plan
+func orderCascadeDeleteSteps(steps []*CascadeDeleteStep) ([]*CascadeDeleteStep, error) {
+	byKey := make(map[string]*CascadeDeleteStep, len(steps))
+	for _, step := range steps {
+		byKey[step.key] = step
+	}
+	// referrers counts, for each step, how many steps must be deleted before it
+	referrers := make(map[string]int, len(steps))
+	for _, step := range steps {
+		for _, reference := range uniqueReferences(step) {
+			if _, found := byKey[reference]; found {
+				referrers[reference]++
+			}
+		}
+	}
+
+	var ready []*CascadeDeleteStep
+	for _, step := range steps {
+		if referrers[step.key] == 0 {
+			ready = append(ready, step)
+		}
+	}
+
+	result := make([]*CascadeDeleteStep, 0, len(steps))
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool {
+			return lessCascadeDeleteStep(ready[i], ready[j])
+		})
+		step := ready[0]
+		ready = ready[1:]
+		result = append(result, step)
+		for _, reference := range uniqueReferences(step) {
+			if _, found := byKey[reference]; !found {
+				continue
+			}
+			referrers[reference]--
+			if referrers[reference] == 0 {
+				ready = append(ready, byKey[reference])
+			}
+		}
+	}
+
+	if len(result) != len(steps) {
+		var cyclic []string
+		for _, step := range steps {
+			if referrers[step.key] > 0 {
+				cyclic = append(cyclic, fmt.Sprintf("%s '%s'", step.Kind, step.Name))
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("circular references found between: %s", strings.Join(cyclic, ", "))
+	}
+	return result, nil
+}
+
+func uniqueReferences(step *CascadeDeleteStep) []string {
+	references := slices.Clone(step.references)
+	slices.Sort(references)
+	return slices.Compact(references)
+}
+
+func lessCascadeDeleteStep(a, b *CascadeDeleteStep) bool {
+	kindA := slices.Index(cascadeDeleteKindOrder, a.Kind)
+	kindB := slices.Index(cascadeDeleteKindOrder, b.Kind)
+	if kindA != kindB {
+		return kindA < kindB
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Id < b.Id
+}
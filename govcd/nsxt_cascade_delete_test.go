@@ -0,0 +1,51 @@
+//go:build network || nsxt || functional || openapi || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test_PlanNsxtCascadeDelete builds a plan for the configured Edge Gateway without executing it,
+// and checks that the objects depending on the Edge Gateway come before it
+func (vcd *TestVCD) Test_PlanNsxtCascadeDelete(check *C) {
+	skipNoNsxtConfiguration(vcd, check)
+	vcd.skipIfNotSysAdmin(check)
+
+	edge, err := vcd.nsxtVdc.GetNsxtEdgeGatewayByName(vcd.config.VCD.Nsxt.EdgeGateway)
+	check.Assert(err, IsNil)
+
+	plan, err := vcd.client.PlanNsxtCascadeDelete(NsxtCascadeDeleteOptions{
+		OrgName:        vcd.config.VCD.Org,
+		EdgeGatewayIds: []string{edge.EdgeGateway.ID},
+	})
+	check.Assert(err, IsNil)
+	check.Assert(len(plan.Steps) > 0, Equals, true)
+	if testVerbose {
+		fmt.Print(plan.String())
+	}
+
+	edgePosition := -1
+	for index, step := range plan.Steps {
+		if step.Kind == CascadeDeleteKindEdgeGateway && step.Id == edge.EdgeGateway.ID {
+			edgePosition = index
+		}
+	}
+	check.Assert(edgePosition, Not(Equals), -1)
+	for _, step := range plan.Steps[edgePosition+1:] {
+		check.Assert(step.Kind, Not(Equals), CascadeDeleteKindNatRule)
+		check.Assert(step.Kind, Not(Equals), CascadeDeleteKindEdgeFirewallRule)
+		check.Assert(step.Kind, Not(Equals), CascadeDeleteKindNetwork)
+	}
+
+	// The whole Org can be planned as well
+	plan, err = vcd.client.PlanNsxtCascadeDelete(NsxtCascadeDeleteOptions{OrgName: vcd.config.VCD.Org})
+	check.Assert(err, IsNil)
+	check.Assert(len(plan.Steps) > 0, Equals, true)
+}
@@ -0,0 +1,148 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// cascadeDeleteTestSteps builds a small NSX-T setup:
+// VDC Group <- Edge Gateway <- routed network <- security group <- DFW rule
+// Edge Gateway <- NAT rule, Edge Gateway <- ALB settings <- pool <- virtual service
+// Standalone edge gateway (not in the VDC group) <- IP set
+func cascadeDeleteTestSteps() []*CascadeDeleteStep {
+	step := func(kind, id, name string, references ...string) *CascadeDeleteStep {
+		return &CascadeDeleteStep{Kind: kind, Id: id, Name: name, key: cascadeDeleteKey(kind, id), references: references}
+	}
+	vdcGroup := cascadeDeleteKey(CascadeDeleteKindVdcGroup, "vg1")
+	edge := cascadeDeleteKey(CascadeDeleteKindEdgeGateway, "egw1")
+	otherEdge := cascadeDeleteKey(CascadeDeleteKindEdgeGateway, "egw2")
+	network := cascadeDeleteKey(CascadeDeleteKindNetwork, "net1")
+	securityGroup := cascadeDeleteKey(CascadeDeleteKindFirewallGroup, "sg1")
+	albSettings := cascadeDeleteKey(CascadeDeleteKindAlbSettings, "egw1")
+	pool := cascadeDeleteKey(CascadeDeleteKindAlbPool, "pool1")
+
+	return []*CascadeDeleteStep{
+		step(CascadeDeleteKindVdcGroup, "vg1", "group"),
+		step(CascadeDeleteKindEdgeGateway, "egw1", "edge", vdcGroup),
+		step(CascadeDeleteKindEdgeGateway, "egw2", "other-edge"),
+		step(CascadeDeleteKindNetwork, "net1", "net", edge, vdcGroup),
+		step(CascadeDeleteKindFirewallGroup, "sg1", "sg", network, vdcGroup),
+		step(CascadeDeleteKindFirewallGroup, "ipset1", "ipset", otherEdge),
+		step(CascadeDeleteKindDfwRule, "rule1", "rule", securityGroup, securityGroup, vdcGroup),
+		step(CascadeDeleteKindNatRule, "nat1", "nat", edge),
+		step(CascadeDeleteKindAlbSettings, "egw1", "edge", edge),
+		step(CascadeDeleteKindAlbPool, "pool1", "pool", albSettings, edge),
+		step(CascadeDeleteKindAlbVirtualService, "vs1", "vs", pool, albSettings, edge,
+			cascadeDeleteKey(CascadeDeleteKindAlbServiceEngineLink, "not-discovered")),
+	}
+}
+
+func Test_orderCascadeDeleteSteps(t *testing.T) {
+	steps := cascadeDeleteTestSteps()
+	ordered, err := orderCascadeDeleteSteps(steps)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ordered) != len(steps) {
+		t.Fatalf("expected %d steps, got %d", len(steps), len(ordered))
+	}
+
+	position := make(map[string]int)
+	for index, step := range ordered {
+		position[step.key] = index
+	}
+	for _, step := range ordered {
+		for _, reference := range step.references {
+			referencePosition, found := position[reference]
+			if found && referencePosition < position[step.key] {
+				t.Errorf("%s '%s' is deleted after %s, which it references", step.Kind, step.Name, reference)
+			}
+		}
+	}
+	if ordered[len(ordered)-1].Kind != CascadeDeleteKindVdcGroup {
+		t.Errorf("expected VDC group to be deleted last, got %s", ordered[len(ordered)-1].Kind)
+	}
+
+	// The order must not depend on the order of discovery
+	reversed := cascadeDeleteTestSteps()
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	orderedReversed, err := orderCascadeDeleteSteps(reversed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for index := range ordered {
+		if ordered[index].key != orderedReversed[index].key {
+			t.Fatalf("order depends on discovery order: step %d is %s and %s", index, ordered[index].key, orderedReversed[index].key)
+		}
+	}
+}
+
+func Test_orderCascadeDeleteStepsCycle(t *testing.T) {
+	steps := []*CascadeDeleteStep{
+		{Kind: CascadeDeleteKindFirewallGroup, Name: "a", key: "a", references: []string{"b"}},
+		{Kind: CascadeDeleteKindFirewallGroup, Name: "b", key: "b", references: []string{"a"}},
+		{Kind: CascadeDeleteKindNatRule, Name: "c", key: "c"},
+	}
+	_, err := orderCascadeDeleteSteps(steps)
+	if err == nil {
+		t.Fatalf("expected error for circular references")
+	}
+	if !strings.Contains(err.Error(), "'a'") || !strings.Contains(err.Error(), "'b'") || strings.Contains(err.Error(), "'c'") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func Test_cascadeDeleteClosure(t *testing.T) {
+	steps := cascadeDeleteTestSteps()
+
+	closure, err := cascadeDeleteClosure(steps, []string{cascadeDeleteKey(CascadeDeleteKindEdgeGateway, "egw1")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	names := make(map[string]bool)
+	for _, step := range closure {
+		names[step.Name] = true
+	}
+	for _, expected := range []string{"edge", "net", "sg", "rule", "nat", "pool", "vs"} {
+		if !names[expected] {
+			t.Errorf("expected '%s' in the plan for the edge gateway", expected)
+		}
+	}
+	for _, unexpected := range []string{"group", "other-edge", "ipset"} {
+		if names[unexpected] {
+			t.Errorf("'%s' must not be in the plan for the edge gateway", unexpected)
+		}
+	}
+
+	_, err = cascadeDeleteClosure(steps, []string{cascadeDeleteKey(CascadeDeleteKindVdcGroup, "missing")})
+	if err == nil {
+		t.Errorf("expected error for a root that doesn't exist")
+	}
+}
+
+func Test_ownerKey(t *testing.T) {
+	if ownerKey(nil) != nil {
+		t.Errorf("expected no key for nil owner")
+	}
+	tests := map[string]string{
+		"urn:vcloud:vdcGroup:1111": cascadeDeleteKey(CascadeDeleteKindVdcGroup, "urn:vcloud:vdcGroup:1111"),
+		"urn:vcloud:gateway:2222":  cascadeDeleteKey(CascadeDeleteKindEdgeGateway, "urn:vcloud:gateway:2222"),
+		"urn:vcloud:vdc:3333":      "",
+	}
+	for id, want := range tests {
+		got := ownerKey(&types.OpenApiReference{ID: id})
+		if want == "" && len(got) != 0 || want != "" && (len(got) != 1 || got[0] != want) {
+			t.Errorf("ownerKey(%s) = %v, want %s", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// OvaVerifyOptions define how the integrity of an OVF package is checked before it is uploaded.
+// The files of a package with a manifest (.mf) are always checked against the digests of the
+// manifest. The zero value accepts packages without manifest
+type OvaVerifyOptions struct {
+	// RequireManifest rejects packages without manifest
+	RequireManifest bool
+	// TrustedCertificates, when set, requires the package to be signed: the signature of the
+	// manifest in the certificate file (.cert) is checked, and the signing certificate must chain
+	// to one of these certificates, using the intermediate certificates of the certificate file
+	TrustedCertificates *x509.CertPool
+}
+
+// isRequired returns true when the package must have a manifest
+func (options OvaVerifyOptions) isRequired() bool {
+	return options.RequireManifest || options.TrustedCertificates != nil
+}
+
+// ovfManifestLine matches the lines of a manifest and of a certificate file, such as
+// "SHA256(disk.vmdk)= 8a2b..."
+var ovfManifestLine = regexp.MustCompile(`^(SHA1|SHA256|SHA512)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+// ovfManifestEntry is the digest of a file of the package
+type ovfManifestEntry struct {
+	algorithm string
+	name      string
+	digest    string
+}
+
+// ovfPackageContent holds the metadata of an OVF package to verify
+type ovfPackageContent struct {
+	descriptorName string
+	descriptor     []byte
+	// manifest and certificate are nil when the package doesn't have them
+	manifest    []byte
+	certificate []byte
+	// digests returns the hex-encoded digests of the files listed in the manifest, by file name
+	digests func(entries []ovfManifestEntry) (map[string]string, error)
+}
+
+// VerifyOva checks the integrity of an OVA or OVF package: every file of the package must match
+// the digest listed in its manifest and, when options.TrustedCertificates is set, the manifest must
+// be signed by a trusted certificate. An OVA is read without being extracted.
+// Catalog.UploadOvf runs the same checks with the options set by WithOvaVerification
+func VerifyOva(ovaFileName string, options OvaVerifyOptions) error {
+	ovaFileName, err := validateAndFixFilePath(ovaFileName)
+	if err != nil {
+		return err
+	}
+	fileContentType, err := util.GetFileContentType(ovaFileName)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(fileContentType, "text/xml") || strings.EqualFold(filepath.Ext(ovaFileName), ".ovf") {
+		return verifyOvfDirectory(ovaFileName, options)
+	}
+
+	content, err := readOvaMetadata(ovaFileName)
+	if err != nil {
+		return err
+	}
+	content.digests = func(entries []ovfManifestEntry) (map[string]string, error) {
+		return digestOvaEntries(ovaFileName, entries)
+	}
+	return verifyOvfPackage(content, options)
+}
+
+// verifyOvfDirectory verifies the package of an OVF descriptor, whose files, manifest and certificate
+// are in the directory of the descriptor
+func verifyOvfDirectory(ovfFilePath string, options OvaVerifyOptions) error {
+	descriptor, err := os.ReadFile(filepath.Clean(ovfFilePath))
+	if err != nil {
+		return fmt.Errorf("error reading OVF descriptor: %s", err)
+	}
+	dir := filepath.Dir(ovfFilePath)
+	content := ovfPackageContent{
+		descriptorName: filepath.Base(ovfFilePath),
+		descriptor:     descriptor,
+		digests: func(entries []ovfManifestEntry) (map[string]string, error) {
+			digests := make(map[string]string)
+			for _, entry := range entries {
+				digest, err := digestFile(filepath.Join(dir, filepath.FromSlash(entry.name)), entry.algorithm)
+				if err != nil {
+					return nil, fmt.Errorf("error reading file '%s' of the manifest: %s", entry.name, err)
+				}
+				digests[entry.name] = digest
+			}
+			return digests, nil
+		},
+	}
+	content.manifest, err = readOvfCompanionFile(ovfFilePath, ".mf")
+	if err != nil {
+		return err
+	}
+	content.certificate, err = readOvfCompanionFile(ovfFilePath, ".cert")
+	if err != nil {
+		return err
+	}
+	return verifyOvfPackage(content, options)
+}
+
+// readOvfCompanionFile returns the content of the file with the given extension next to the OVF
+// descriptor: the one named after the descriptor, or else the only one in the directory. It returns
+// nil when there is none
+func readOvfCompanionFile(ovfFilePath, extension string) ([]byte, error) {
+	companionPath := strings.TrimSuffix(ovfFilePath, filepath.Ext(ovfFilePath)) + extension
+	if _, err := os.Stat(companionPath); err != nil {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(ovfFilePath), "*"+extension))
+		if err != nil || len(matches) == 0 {
+			return nil, nil
+		}
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("found %d %s files next to OVF descriptor '%s'", len(matches), extension, ovfFilePath)
+		}
+		companionPath = matches[0]
+	}
+	content, err := os.ReadFile(filepath.Clean(companionPath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%s': %s", companionPath, err)
+	}
+	return content, nil
+}
+
+// readOvaMetadata reads the descriptor, the manifest and the certificate of an OVA
+func readOvaMetadata(ovaFileName string) (ovfPackageContent, error) {
+	var content ovfPackageContent
+	file, err := os.Open(filepath.Clean(ovaFileName))
+	if err != nil {
+		return content, err
+	}
+	defer safeClose(file)
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return content, fmt.Errorf("error reading OVA '%s': %s", ovaFileName, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := ovaEntryName(header)
+		var target *[]byte
+		switch strings.ToLower(path.Ext(name)) {
+		case ".ovf":
+			content.descriptorName = name
+			target = &content.descriptor
+		case ".mf":
+			target = &content.manifest
+		case ".cert":
+			target = &content.certificate
+		default:
+			continue
+		}
+		if *target != nil {
+			return content, fmt.Errorf("OVA '%s' has more than one %s file", ovaFileName, path.Ext(name))
+		}
+		*target, err = io.ReadAll(reader)
+		if err != nil {
+			return content, fmt.Errorf("error reading '%s' in OVA '%s': %s", name, ovaFileName, err)
+		}
+	}
+	if content.descriptor == nil {
+		return content, fmt.Errorf("no OVF descriptor found in OVA '%s'", ovaFileName)
+	}
+	return content, nil
+}
+
+// digestOvaEntries computes the digests of the files listed in the manifest in a single pass over the OVA
+func digestOvaEntries(ovaFileName string, entries []ovfManifestEntry) (map[string]string, error) {
+	algorithms := make(map[string]string)
+	for _, entry := range entries {
+		algorithms[entry.name] = entry.algorithm
+	}
+	file, err := os.Open(filepath.Clean(ovaFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer safeClose(file)
+
+	digests := make(map[string]string)
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return digests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading OVA '%s': %s", ovaFileName, err)
+		}
+		name := ovaEntryName(header)
+		algorithm, found := algorithms[name]
+		if !found || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		digests[name], err = digestReader(reader, algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("error reading '%s' in OVA '%s': %s", name, ovaFileName, err)
+		}
+	}
+}
+
+// verifyOvfPackage checks the files of the package against its manifest, and the signature of the
+// manifest when trusted certificates are given
+func verifyOvfPackage(content ovfPackageContent, options OvaVerifyOptions) error {
+	if content.manifest == nil {
+		if options.isRequired() {
+			return fmt.Errorf("OVF package '%s' has no manifest", content.descriptorName)
+		}
+		util.Logger.Printf("[DEBUG] OVF package '%s' has no manifest: its files are not verified\n", content.descriptorName)
+		return nil
+	}
+	entries, err := parseOvfManifest(content.manifest)
+	if err != nil {
+		return err
+	}
+
+	// Every file of the package must be listed, so that none can be replaced
+	var envelope Envelope
+	err = xml.Unmarshal(content.descriptor, &envelope)
+	if err != nil {
+		return fmt.Errorf("error parsing OVF descriptor: %s", err)
+	}
+	required := []string{content.descriptorName}
+	for _, fileDesc := range envelope.File {
+		file := &ovaStreamFile{href: fileDesc.HREF, size: int64(fileDesc.Size), chunkSize: int64(fileDesc.ChunkSize)}
+		for chunk := range file.chunkCount() {
+			required = append(required, file.chunkName(chunk))
+		}
+	}
+	listed := make(map[string]bool)
+	for _, entry := range entries {
+		listed[entry.name] = true
+	}
+	for _, name := range required {
+		if !listed[name] {
+			return fmt.Errorf("file '%s' is not listed in the manifest of OVF package '%s'", name, content.descriptorName)
+		}
+	}
+
+	digests, err := content.digests(entries)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		digest, found := digests[entry.name]
+		if !found {
+			return fmt.Errorf("file '%s' listed in the manifest was not found in OVF package '%s'", entry.name, content.descriptorName)
+		}
+		if !strings.EqualFold(digest, entry.digest) {
+			return fmt.Errorf("%s digest mismatch for file '%s': the manifest lists %s, the file has %s",
+				entry.algorithm, entry.name, entry.digest, digest)
+		}
+	}
+
+	if options.TrustedCertificates != nil {
+		err = verifyOvfManifestSignature(content.manifest, content.certificate, options.TrustedCertificates)
+		if err != nil {
+			return fmt.Errorf("invalid signature of OVF package '%s': %s", content.descriptorName, err)
+		}
+	}
+	return nil
+}
+
+// parseOvfManifest returns the entries of a manifest, in order
+func parseOvfManifest(manifest []byte) ([]ovfManifestEntry, error) {
+	var entries []ovfManifestEntry
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		match := ovfManifestLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("invalid manifest line '%s'", line)
+		}
+		entry := ovfManifestEntry{algorithm: match[1], name: match[2], digest: match[3]}
+		err := validateOvfFileReference(entry.name)
+		if err != nil {
+			return nil, err
+		}
+		if names[entry.name] {
+			return nil, fmt.Errorf("file '%s' is listed twice in the manifest", entry.name)
+		}
+		names[entry.name] = true
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading manifest: %s", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the manifest is empty")
+	}
+	return entries, nil
+}
+
+// verifyOvfManifestSignature checks the signature of the manifest held by the certificate file, which
+// holds a line with the signature followed by the signing certificate and its intermediate certificates
+func verifyOvfManifestSignature(manifest, certificateFile []byte, trusted *x509.CertPool) error {
+	if certificateFile == nil {
+		return errors.New("the package is not signed: no certificate file found")
+	}
+
+	var algorithm, signature string
+	var certificates []*x509.Certificate
+	rest := certificateFile
+	for len(rest) > 0 {
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("error parsing certificate: %s", err)
+			}
+			certificates = append(certificates, certificate)
+		}
+		rest = remaining
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(certificateFile))
+	for scanner.Scan() {
+		match := ovfManifestLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match != nil {
+			algorithm, signature = match[1], match[3]
+			break
+		}
+	}
+	if signature == "" {
+		return errors.New("no signature found in the certificate file")
+	}
+	if len(certificates) == 0 {
+		return errors.New("no certificate found in the certificate file")
+	}
+
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %s", err)
+	}
+	err = checkOvfSignature(certificates[0], algorithm, manifest, signatureBytes)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err = certificates[0].Verify(x509.VerifyOptions{
+		Roots:         trusted,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("the signing certificate '%s' is not trusted: %s", certificates[0].Subject, err)
+	}
+	return nil
+}
+
+// checkOvfSignature checks the signature of the content with the public key of the certificate
+func checkOvfSignature(certificate *x509.Certificate, algorithm string, content, signature []byte) error {
+	var hashType crypto.Hash
+	switch algorithm {
+	case "SHA1":
+		hashType = crypto.SHA1
+	case "SHA256":
+		hashType = crypto.SHA256
+	case "SHA512":
+		hashType = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm '%s'", algorithm)
+	}
+	hasher := hashType.New()
+	_, _ = hasher.Write(content)
+	digest := hasher.Sum(nil)
+
+	switch publicKey := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err := rsa.VerifyPKCS1v15(publicKey, hashType, digest, signature)
+		if err != nil {
+			return fmt.Errorf("the signature of the manifest doesn't match: %s", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, digest, signature) {
+			return errors.New("the signature of the manifest doesn't match")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", certificate.PublicKey)
+	}
+	return nil
+}
+
+// digestFile returns the hex-encoded digest of a file
+func digestFile(filePath, algorithm string) (string, error) {
+	file, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return "", err
+	}
+	defer safeClose(file)
+	return digestReader(file, algorithm)
+}
+
+// digestReader returns the hex-encoded digest of the content of the reader
+func digestReader(reader io.Reader, algorithm string) (string, error) {
+	hasher, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(hasher, reader)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
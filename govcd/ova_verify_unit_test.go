@@ -0,0 +1,219 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVerifyDescriptor = `<Envelope><References>
+	<File href="disk1.vmdk" id="file1" size="4"/>
+	<File href="disk2.vmdk" id="file2" size="6" chunkSize="4"/>
+</References></Envelope>`
+
+// testOvaManifest returns a SHA256 manifest of the entries
+func testOvaManifest(entries []testOvaEntry) []byte {
+	var manifest strings.Builder
+	for _, entry := range entries {
+		digest := sha256.Sum256(entry.content)
+		_, _ = fmt.Fprintf(&manifest, "SHA256(%s)= %s\n", entry.name, hex.EncodeToString(digest[:]))
+	}
+	return []byte(manifest.String())
+}
+
+// writeTestOva writes an OVA holding the descriptor, the manifest and the certificate when they are
+// not nil, and the files
+func writeTestOva(t *testing.T, manifest, certificate []byte, files []testOvaEntry) string {
+	entries := []testOvaEntry{{"package.ovf", []byte(testVerifyDescriptor)}}
+	if manifest != nil {
+		entries = append(entries, testOvaEntry{"package.mf", manifest})
+	}
+	if certificate != nil {
+		entries = append(entries, testOvaEntry{"package.cert", certificate})
+	}
+	ovaPath := filepath.Join(t.TempDir(), "package.ova")
+	err := os.WriteFile(ovaPath, buildTestOva(t, append(entries, files...)).Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return ovaPath
+}
+
+func Test_VerifyOva(t *testing.T) {
+	files := []testOvaEntry{
+		{"disk1.vmdk", []byte("abcd")},
+		{"disk2.vmdk.000000000", []byte("efgh")},
+		{"disk2.vmdk.000000001", []byte("ij")},
+	}
+	allFiles := append([]testOvaEntry{{"package.ovf", []byte(testVerifyDescriptor)}}, files...)
+	manifest := testOvaManifest(allFiles)
+
+	err := VerifyOva(writeTestOva(t, manifest, nil, files), OvaVerifyOptions{})
+	if err != nil {
+		t.Errorf("unexpected error for valid package: %s", err)
+	}
+
+	tampered := append([]testOvaEntry{}, files...)
+	tampered[2] = testOvaEntry{"disk2.vmdk.000000001", []byte("xx")}
+	err = VerifyOva(writeTestOva(t, manifest, nil, tampered), OvaVerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "SHA256 digest mismatch for file 'disk2.vmdk.000000001'") {
+		t.Errorf("expected digest mismatch, got %v", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, testOvaManifest(allFiles[:3]), nil, files), OvaVerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "'disk2.vmdk.000000001' is not listed") {
+		t.Errorf("expected unlisted file error, got %v", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, manifest, nil, files[:2]), OvaVerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "was not found") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+
+	withoutManifest := writeTestOva(t, nil, nil, files)
+	err = VerifyOva(withoutManifest, OvaVerifyOptions{})
+	if err != nil {
+		t.Errorf("unexpected error for package without manifest: %s", err)
+	}
+	err = VerifyOva(withoutManifest, OvaVerifyOptions{RequireManifest: true})
+	if err == nil || !strings.Contains(err.Error(), "has no manifest") {
+		t.Errorf("expected missing manifest error, got %v", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, []byte("disk1.vmdk abcd\n"), nil, files), OvaVerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "invalid manifest line") {
+		t.Errorf("expected invalid manifest error, got %v", err)
+	}
+}
+
+func Test_VerifyOvaDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := []testOvaEntry{
+		{"package.ovf", []byte(testVerifyDescriptor)},
+		{"disk1.vmdk", []byte("abcd")},
+		{"disk2.vmdk.000000000", []byte("efgh")},
+		{"disk2.vmdk.000000001", []byte("ij")},
+		{"package.mf", testOvaManifest([]testOvaEntry{
+			{"package.ovf", []byte(testVerifyDescriptor)},
+			{"disk1.vmdk", []byte("abcd")},
+			{"disk2.vmdk.000000000", []byte("efgh")},
+			{"disk2.vmdk.000000001", []byte("ij")},
+		})},
+	}
+	for _, file := range files {
+		err := os.WriteFile(filepath.Join(dir, file.name), file.content, 0600)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	err := VerifyOva(filepath.Join(dir, "package.ovf"), OvaVerifyOptions{})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "disk1.vmdk"), []byte("abce"), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = VerifyOva(filepath.Join(dir, "package.ovf"), OvaVerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch for file 'disk1.vmdk'") {
+		t.Errorf("expected digest mismatch, got %v", err)
+	}
+}
+
+// newTestCertificate returns a certificate for the key, signed by the parent or self-signed
+func newTestCertificate(t *testing.T, name string, isCA bool, publicKey any, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	if parent == nil {
+		parent = template
+	}
+	content, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	certificate, err := x509.ParseCertificate(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return certificate
+}
+
+func Test_VerifyOvaSignature(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	caCertificate := newTestCertificate(t, "test CA", true, caKey.Public(), nil, caKey)
+	signerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	signerCertificate := newTestCertificate(t, "test signer", false, signerKey.Public(), caCertificate, caKey)
+
+	files := []testOvaEntry{
+		{"disk1.vmdk", []byte("abcd")},
+		{"disk2.vmdk.000000000", []byte("efgh")},
+		{"disk2.vmdk.000000001", []byte("ij")},
+	}
+	manifest := testOvaManifest(append([]testOvaEntry{{"package.ovf", []byte(testVerifyDescriptor)}}, files...))
+	signCertificateFile := func(content []byte) []byte {
+		digest := sha256.Sum256(content)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, signerKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		certificateFile := fmt.Sprintf("SHA256(package.mf)= %s\n", hex.EncodeToString(signature))
+		return append([]byte(certificateFile), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signerCertificate.Raw})...)
+	}
+	trusted := x509.NewCertPool()
+	trusted.AddCert(caCertificate)
+
+	err = VerifyOva(writeTestOva(t, manifest, signCertificateFile(manifest), files), OvaVerifyOptions{TrustedCertificates: trusted})
+	if err != nil {
+		t.Errorf("unexpected error for signed package: %s", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, manifest, signCertificateFile(manifest), files), OvaVerifyOptions{TrustedCertificates: x509.NewCertPool()})
+	if err == nil || !strings.Contains(err.Error(), "is not trusted") {
+		t.Errorf("expected untrusted certificate error, got %v", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, manifest, signCertificateFile([]byte("other manifest")), files), OvaVerifyOptions{TrustedCertificates: trusted})
+	if err == nil || !strings.Contains(err.Error(), "signature of the manifest doesn't match") {
+		t.Errorf("expected signature mismatch, got %v", err)
+	}
+
+	err = VerifyOva(writeTestOva(t, manifest, nil, files), OvaVerifyOptions{TrustedCertificates: trusted})
+	if err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("expected unsigned package error, got %v", err)
+	}
+}
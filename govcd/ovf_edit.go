@@ -0,0 +1,270 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// OvfDescriptorEditor changes an OVF descriptor before it is uploaded, such as RenameOvfNetwork,
+// RemoveOvfHardware or SetOvfPropertyDefaults. An editor can't add files to the package: the
+// descriptor can only reference the files the package holds
+type OvfDescriptorEditor func(envelope *types.OvfEnvelope) error
+
+// ParseOvfDescriptor returns the typed model of an OVF descriptor
+func ParseOvfDescriptor(descriptor []byte) (*types.OvfEnvelope, error) {
+	envelope := &types.OvfEnvelope{}
+	err := xml.Unmarshal(descriptor, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing OVF descriptor: %s", err)
+	}
+	return envelope, nil
+}
+
+// MarshalOvfDescriptor returns the content of an OVF descriptor, with its XML declaration
+func MarshalOvfDescriptor(envelope *types.OvfEnvelope) ([]byte, error) {
+	content, err := xml.MarshalIndent(envelope, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing OVF descriptor: %s", err)
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// editOvfDescriptor returns the descriptor changed by the editors
+func editOvfDescriptor(descriptor []byte, editors []OvfDescriptorEditor) ([]byte, error) {
+	envelope, err := ParseOvfDescriptor(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	for _, editor := range editors {
+		err = editor(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("error editing OVF descriptor: %s", err)
+		}
+	}
+	return MarshalOvfDescriptor(envelope)
+}
+
+// editOvfFile returns the descriptor of the file changed by the editors, and its file references
+func editOvfFile(ovfFilePath string, ovfFileDesc *Envelope, editors []OvfDescriptorEditor) ([]byte, Envelope, error) {
+	descriptor, err := os.ReadFile(filepath.Clean(ovfFilePath))
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	return editOvfPackageDescriptor(descriptor, ovfFileDesc, editors)
+}
+
+// editOvfPackageDescriptor returns the descriptor changed by the editors, and its file references,
+// which must be files of the original descriptor
+func editOvfPackageDescriptor(descriptor []byte, ovfFileDesc *Envelope, editors []OvfDescriptorEditor) ([]byte, Envelope, error) {
+	edited, err := editOvfDescriptor(descriptor, editors)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	var editedFileDesc Envelope
+	err = xml.Unmarshal(edited, &editedFileDesc)
+	if err != nil {
+		return nil, Envelope{}, fmt.Errorf("error parsing edited OVF descriptor: %s", err)
+	}
+	err = checkEditedOvfFiles(ovfFileDesc, &editedFileDesc)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	return edited, editedFileDesc, nil
+}
+
+// checkEditedOvfFiles checks that the edited descriptor only references files of the original one
+func checkEditedOvfFiles(original, edited *Envelope) error {
+	for _, editedFile := range edited.File {
+		found := false
+		for _, file := range original.File {
+			if file.HREF == editedFile.HREF && file.ChunkSize == editedFile.ChunkSize {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("the edited OVF descriptor references file '%s', which is not part of the package", editedFile.HREF)
+		}
+	}
+	return nil
+}
+
+// RenameOvfNetwork returns an editor which renames a network of the NetworkSection, and the
+// connections of the network adapters to it. When newName is already a network of the descriptor,
+// the adapters are moved to it. Sections which are not modeled, such as vcloud:NetworkConfigSection,
+// are not changed
+func RenameOvfNetwork(oldName, newName string) OvfDescriptorEditor {
+	return func(envelope *types.OvfEnvelope) error {
+		if newName == "" {
+			return fmt.Errorf("the new name of network '%s' can not be empty", oldName)
+		}
+		if envelope.NetworkSection == nil {
+			return fmt.Errorf("network '%s' not found: the descriptor has no network section", oldName)
+		}
+		networks := envelope.NetworkSection.Network
+		oldIndex := slices.IndexFunc(networks, func(network *types.OvfNetwork) bool { return network.Name == oldName })
+		if oldIndex < 0 {
+			return fmt.Errorf("network '%s' not found", oldName)
+		}
+		if slices.ContainsFunc(networks, func(network *types.OvfNetwork) bool { return network.Name == newName }) {
+			envelope.NetworkSection.Network = slices.Delete(networks, oldIndex, oldIndex+1)
+		} else {
+			networks[oldIndex].Name = newName
+		}
+
+		for _, virtualSystem := range envelope.VirtualSystems() {
+			for _, hardwareSection := range virtualSystem.VirtualHardwareSection {
+				for _, item := range hardwareSection.Item {
+					for _, connection := range item.Connection {
+						if connection.NetworkName == oldName {
+							connection.NetworkName = newName
+						}
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// RemoveOvfHardware returns an editor which removes the virtual hardware items of the given
+// resource types, such as 14 for floppy drives or 15 for CD drives, from every virtual system.
+// The items attached to a removed item, such as the disks of a controller, are removed as well.
+// The disks which are no longer used, and their files, are removed from the descriptor
+func RemoveOvfHardware(resourceTypes ...int) OvfDescriptorEditor {
+	return func(envelope *types.OvfEnvelope) error {
+		removedTypes := make(map[string]bool)
+		for _, resourceType := range resourceTypes {
+			removedTypes[strconv.Itoa(resourceType)] = true
+		}
+
+		removedHostResources := make(map[string]bool)
+		usedHostResources := make(map[string]bool)
+		for _, virtualSystem := range envelope.VirtualSystems() {
+			for _, hardwareSection := range virtualSystem.VirtualHardwareSection {
+				removedIds := make(map[string]bool)
+				isRemoved := func(item *types.OvfItem) bool {
+					return removedTypes[item.ResourceType] || (item.Parent != "" && removedIds[item.Parent])
+				}
+				// Items can be attached to items which are removed in a previous pass
+				for removed := true; removed; {
+					removed = false
+					for _, item := range hardwareSection.Item {
+						if !removedIds[item.InstanceID] && isRemoved(item) {
+							removedIds[item.InstanceID] = true
+							removed = true
+						}
+					}
+				}
+				var items []*types.OvfItem
+				for _, item := range hardwareSection.Item {
+					hostResources := usedHostResources
+					if removedIds[item.InstanceID] {
+						hostResources = removedHostResources
+					} else {
+						items = append(items, item)
+					}
+					for _, hostResource := range item.HostResource {
+						hostResources[hostResource] = true
+					}
+				}
+				hardwareSection.Item = items
+			}
+		}
+
+		removedFiles := make(map[string]bool)
+		if envelope.DiskSection != nil {
+			var disks []*types.OvfDisk
+			for _, disk := range envelope.DiskSection.Disk {
+				hostResource := "ovf:/disk/" + disk.DiskID
+				if removedHostResources[hostResource] && !usedHostResources[hostResource] {
+					if disk.FileRef != "" {
+						removedFiles[disk.FileRef] = true
+					}
+					continue
+				}
+				disks = append(disks, disk)
+			}
+			envelope.DiskSection.Disk = disks
+			for _, disk := range disks {
+				delete(removedFiles, disk.FileRef)
+			}
+		}
+		for hostResource := range removedHostResources {
+			if fileId, found := strings.CutPrefix(hostResource, "ovf:/file/"); found && !usedHostResources[hostResource] {
+				removedFiles[fileId] = true
+			}
+		}
+		var files []*types.OvfFile
+		for _, file := range envelope.References.File {
+			if !removedFiles[file.ID] {
+				files = append(files, file)
+			}
+		}
+		envelope.References.File = files
+		return nil
+	}
+}
+
+// SetOvfPropertyDefaults returns an editor which sets the default value of product properties of
+// every virtual system, by key. The properties which are not declared are added to the first
+// product section of the virtual system, as user configurable strings
+func SetOvfPropertyDefaults(defaults map[string]string) OvfDescriptorEditor {
+	return func(envelope *types.OvfEnvelope) error {
+		keys := make([]string, 0, len(defaults))
+		for key := range defaults {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		virtualSystems := envelope.VirtualSystems()
+		if len(virtualSystems) == 0 {
+			return fmt.Errorf("the descriptor has no virtual system")
+		}
+		for _, virtualSystem := range virtualSystems {
+			for _, key := range keys {
+				found := false
+				for _, productSection := range virtualSystem.ProductSection {
+					for _, property := range productSection.Property {
+						if property.Key == key {
+							property.DefaultValue = defaults[key]
+							found = true
+						}
+					}
+				}
+				if found {
+					continue
+				}
+				if len(virtualSystem.ProductSection) == 0 {
+					virtualSystem.ProductSection = []*types.OvfProductSection{{Info: "Information about the installed software"}}
+				}
+				productSection := virtualSystem.ProductSection[0]
+				// The property is written at the end of the section, in the category of the last property
+				category := ""
+				if len(productSection.Property) > 0 {
+					category = productSection.Property[len(productSection.Property)-1].Category
+				}
+				productSection.Property = append(productSection.Property, &types.OvfProductProperty{
+					Key:              key,
+					Type:             "string",
+					UserConfigurable: true,
+					DefaultValue:     defaults[key],
+					Category:         category,
+				})
+			}
+		}
+		return nil
+	}
+}
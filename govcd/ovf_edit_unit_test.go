@@ -0,0 +1,440 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// testOvftoolDescriptor is written like the descriptors exported by ovftool
+const testOvftoolDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<!--Generated by VMware ovftool 4.6.0 (build-21452615), UTC time: 2024-03-01T10:00:00.000Z-->
+<Envelope vmw:buildId="build-21452615" xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+    <File ovf:href="appliance-disk1.vmdk" ovf:id="file1" ovf:size="68096"/>
+    <File ovf:href="appliance-disk2.vmdk" ovf:id="file2" ovf:size="5000" ovf:chunkSize="3000"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="16" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized" ovf:populatedSize="2097152"/>
+    <Disk ovf:capacity="1" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="vmdisk2" ovf:fileRef="file2" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="VM Network">
+      <Description>The VM Network network</Description>
+    </Network>
+    <Network ovf:name="Management">
+      <Description>The Management network</Description>
+    </Network>
+  </NetworkSection>
+  <DeploymentOptionSection>
+    <Info>Deployment options</Info>
+    <Configuration ovf:default="true" ovf:id="small">
+      <Label>Small</Label>
+      <Description>2 CPUs</Description>
+    </Configuration>
+  </DeploymentOptionSection>
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+    <Name>appliance</Name>
+    <AnnotationSection>
+      <Info>A human-readable annotation</Info>
+      <Annotation>Test appliance &amp; friends</Annotation>
+    </AnnotationSection>
+    <OperatingSystemSection ovf:id="101" vmw:osType="otherLinux64Guest">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection ovf:transport="com.vmware.guestInfo">
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>appliance</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-19</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>2 virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>2</rasd:VirtualQuantity>
+        <vmw:CoresPerSocket ovf:required="false">2</vmw:CoresPerSocket>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI controller 0</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceSubType>VirtualSCSI</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>IDE Controller</rasd:Description>
+        <rasd:ElementName>IDE 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceType>5</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>2</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item ovf:required="false">
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>false</rasd:AutomaticAllocation>
+        <rasd:ElementName>CD/DVD drive 1</rasd:ElementName>
+        <rasd:InstanceID>5</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceSubType>vmware.cdrom.remotepassthrough</rasd:ResourceSubType>
+        <rasd:ResourceType>15</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>1</rasd:AddressOnParent>
+        <rasd:ElementName>Hard disk 2</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk2</rasd:HostResource>
+        <rasd:InstanceID>6</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>7</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>VM Network</rasd:Connection>
+        <rasd:Description>VmxNet3 ethernet adapter on &quot;VM Network&quot;</rasd:Description>
+        <rasd:ElementName>Network adapter 1</rasd:ElementName>
+        <rasd:InstanceID>7</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+        <vmw:Config ovf:required="false" vmw:key="wakeOnLanEnabled" vmw:value="false"/>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>8</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>Management</rasd:Connection>
+        <rasd:ElementName>Network adapter 2</rasd:ElementName>
+        <rasd:InstanceID>8</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="efi"/>
+      <vmw:ExtraConfig ovf:required="false" vmw:key="guestinfo.appliance" vmw:value="true"/>
+    </VirtualHardwareSection>
+    <ProductSection ovf:class="vami" ovf:instance="appliance">
+      <Info>Information about the installed software</Info>
+      <Product>Appliance</Product>
+      <Vendor>Example</Vendor>
+      <Version>1.0</Version>
+      <FullVersion>1.0.0-1</FullVersion>
+      <Property ovf:key="hostname" ovf:type="string" ovf:userConfigurable="true">
+        <Label>Host name</Label>
+      </Property>
+      <Category>Networking</Category>
+      <Property ovf:key="ip0" ovf:qualifiers="MaxLen(15)" ovf:type="string" ovf:userConfigurable="true" ovf:value="10.0.0.2">
+        <Label>IP address</Label>
+        <Description>The address of the first interface</Description>
+        <Value ovf:configuration="small" ovf:value="10.0.0.3"/>
+      </Property>
+      <Property ovf:key="dns" ovf:type="string" ovf:userConfigurable="true"/>
+      <Category>Security</Category>
+      <Property ovf:key="password" ovf:password="true" ovf:type="string" ovf:userConfigurable="true">
+        <Label>Root password</Label>
+      </Property>
+    </ProductSection>
+    <EulaSection>
+      <Info>End User License Agreement</Info>
+      <License>Use at your own risk.</License>
+    </EulaSection>
+  </VirtualSystem>
+</Envelope>`
+
+// canonicalOvf returns the elements of a descriptor, with their path, sorted attributes and text,
+// ignoring namespace declarations, element order and indentation
+func canonicalOvf(t *testing.T, content []byte) []string {
+	var lines []string
+	var stack []string
+	var text []string
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading descriptor: %s", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			var attributes []string
+			for _, attribute := range token.Attr {
+				if attribute.Name.Space != "xmlns" && attribute.Name.Local != "xmlns" {
+					attributes = append(attributes, attribute.Name.Space+" "+attribute.Name.Local+"="+attribute.Value)
+				}
+			}
+			sort.Strings(attributes)
+			path := token.Name.Space + " " + token.Name.Local
+			if len(stack) > 0 {
+				path = stack[len(stack)-1] + "/" + path
+			}
+			stack = append(stack, path)
+			text = append(text, "")
+			lines = append(lines, path+" "+strings.Join(attributes, ","))
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1] += string(token)
+			}
+		case xml.EndElement:
+			lines = append(lines, stack[len(stack)-1]+" text="+strings.TrimSpace(text[len(text)-1]))
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// readTestOvfDescriptor returns the descriptor of an OVA or OVF file of the test resources
+func readTestOvfDescriptor(t *testing.T, fileName string) []byte {
+	if filepath.Ext(fileName) == ".ovf" {
+		content, err := os.ReadFile(filepath.Clean(fileName))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return content
+	}
+	file, err := os.Open(filepath.Clean(fileName))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer safeClose(file)
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			t.Fatalf("no descriptor found in %s: %s", fileName, err)
+		}
+		if filepath.Ext(header.Name) == ".ovf" {
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return content
+		}
+	}
+}
+
+func Test_OvfDescriptorRoundTrip(t *testing.T) {
+	envelope, err := ParseOvfDescriptor([]byte(testOvftoolDescriptor))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	virtualSystems := envelope.VirtualSystems()
+	if len(virtualSystems) != 1 || len(virtualSystems[0].VirtualHardwareSection[0].Item) != 8 {
+		t.Fatalf("unexpected virtual systems: %v", virtualSystems)
+	}
+	properties := virtualSystems[0].ProductSection[0].Property
+	var categories []string
+	for _, property := range properties {
+		categories = append(categories, property.Key+"="+property.Category)
+	}
+	expectedCategories := []string{"hostname=", "ip0=Networking", "dns=Networking", "password=Security"}
+	if !slices.Equal(categories, expectedCategories) {
+		t.Errorf("unexpected categories: %v", categories)
+	}
+	if properties[1].DefaultValue != "10.0.0.2" || properties[1].Value[0].Configuration != "small" || !properties[3].Password {
+		t.Errorf("unexpected properties: %+v %+v", properties[1], properties[3])
+	}
+	if envelope.References.File[1].ChunkSize != 3000 || envelope.DiskSection.Disk[0].PopulatedSize != 2097152 {
+		t.Errorf("unexpected references or disks")
+	}
+
+	content, err := MarshalOvfDescriptor(envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, expected := range []string{`<ovf:Envelope xmlns:`, `<rasd:Connection>VM Network</rasd:Connection>`,
+		`<vmw:CoresPerSocket ovf:required="false">2</vmw:CoresPerSocket>`, `<ovf:Category>Networking</ovf:Category>`,
+		`xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common"`} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected '%s' in descriptor:\n%s", expected, content)
+		}
+	}
+	if !slices.Equal(canonicalOvf(t, []byte(testOvftoolDescriptor)), canonicalOvf(t, content)) {
+		t.Errorf("the descriptor changed after a round trip:\n%s", content)
+	}
+
+	// The existing descriptors are written the same way after a second round trip
+	testFiles := []string{"../test-resources/test_vapp_template_ovf/descriptor.ovf"}
+	ovaFiles, _ := filepath.Glob("../test-resources/*.ova")
+	for _, fileName := range append(testFiles, ovaFiles...) {
+		descriptor := readTestOvfDescriptor(t, fileName)
+		first, err := editOvfDescriptor(descriptor, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", fileName, err)
+		}
+		second, err := editOvfDescriptor(first, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", fileName, err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Errorf("the descriptor of %s changed after a second round trip", fileName)
+		}
+		var original, edited Envelope
+		if xml.Unmarshal(descriptor, &original) != nil || xml.Unmarshal(second, &edited) != nil || checkEditedOvfFiles(&original, &edited) != nil ||
+			len(original.File) != len(edited.File) {
+			t.Errorf("the references of %s changed after a round trip", fileName)
+		}
+	}
+}
+
+func Test_RenameOvfNetwork(t *testing.T) {
+	content, err := editOvfDescriptor([]byte(testOvftoolDescriptor), []OvfDescriptorEditor{RenameOvfNetwork("VM Network", "tenant-net")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	envelope, err := ParseOvfDescriptor(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if envelope.NetworkSection.Network[0].Name != "tenant-net" || len(envelope.NetworkSection.Network) != 2 {
+		t.Errorf("unexpected networks: %+v", envelope.NetworkSection.Network)
+	}
+	if envelope.VirtualSystem.VirtualHardwareSection[0].Item[6].Connection[0].NetworkName != "tenant-net" {
+		t.Errorf("the network adapter was not connected to the renamed network")
+	}
+
+	// Renaming to an existing network merges both
+	envelope, _ = ParseOvfDescriptor([]byte(testOvftoolDescriptor))
+	err = RenameOvfNetwork("VM Network", "Management")(envelope)
+	if err != nil || len(envelope.NetworkSection.Network) != 1 ||
+		envelope.VirtualSystem.VirtualHardwareSection[0].Item[6].Connection[0].NetworkName != "Management" {
+		t.Errorf("unexpected merge of networks: %v", err)
+	}
+
+	err = RenameOvfNetwork("missing", "other")(envelope)
+	if err == nil || !strings.Contains(err.Error(), "network 'missing' not found") {
+		t.Errorf("expected error for missing network, got %v", err)
+	}
+}
+
+func Test_RemoveOvfHardware(t *testing.T) {
+	envelope, err := ParseOvfDescriptor([]byte(testOvftoolDescriptor))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Removing the IDE controller removes the CD drive and the second disk with its file
+	err = RemoveOvfHardware(5)(envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var instanceIds []string
+	for _, item := range envelope.VirtualSystem.VirtualHardwareSection[0].Item {
+		instanceIds = append(instanceIds, item.InstanceID)
+	}
+	if !slices.Equal(instanceIds, []string{"1", "2", "4", "7", "8"}) {
+		t.Errorf("unexpected items: %v", instanceIds)
+	}
+	if len(envelope.DiskSection.Disk) != 1 || envelope.DiskSection.Disk[0].DiskID != "vmdisk1" {
+		t.Errorf("unexpected disks: %+v", envelope.DiskSection.Disk)
+	}
+	if len(envelope.References.File) != 1 || envelope.References.File[0].ID != "file1" {
+		t.Errorf("unexpected files: %+v", envelope.References.File)
+	}
+
+	envelope, _ = ParseOvfDescriptor([]byte(testOvftoolDescriptor))
+	err = RemoveOvfHardware(14, 15)(envelope)
+	if err != nil || len(envelope.VirtualSystem.VirtualHardwareSection[0].Item) != 7 || len(envelope.References.File) != 2 {
+		t.Errorf("unexpected removal of the CD drive: %v", err)
+	}
+}
+
+func Test_SetOvfPropertyDefaults(t *testing.T) {
+	content, err := editOvfDescriptor([]byte(testOvftoolDescriptor), []OvfDescriptorEditor{
+		SetOvfPropertyDefaults(map[string]string{"hostname": "app01", "ntp": "pool.ntp.org"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	envelope, err := ParseOvfDescriptor(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	properties := envelope.VirtualSystem.ProductSection[0].Property
+	if len(properties) != 5 || properties[0].DefaultValue != "app01" {
+		t.Fatalf("unexpected properties: %+v", properties)
+	}
+	added := properties[4]
+	if added.Key != "ntp" || added.DefaultValue != "pool.ntp.org" || !added.UserConfigurable || added.Category != "Security" {
+		t.Errorf("unexpected added property: %+v", added)
+	}
+
+	// A product section is created when the virtual system has none
+	envelope, _ = ParseOvfDescriptor(readTestOvfDescriptor(t, "../test-resources/test_vapp_template_ovf/descriptor.ovf"))
+	err = SetOvfPropertyDefaults(map[string]string{"key": "value"})(envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, virtualSystem := range envelope.VirtualSystems() {
+		found := false
+		for _, productSection := range virtualSystem.ProductSection {
+			found = found || slices.ContainsFunc(productSection.Property, func(property *types.OvfProductProperty) bool {
+				return property.Key == "key" && property.DefaultValue == "value"
+			})
+		}
+		if !found {
+			t.Errorf("property not added to virtual system %s", virtualSystem.ID)
+		}
+	}
+}
+
+func Test_editOvfPackageDescriptor(t *testing.T) {
+	var ovfFileDesc Envelope
+	err := xml.Unmarshal([]byte(testOvftoolDescriptor), &ovfFileDesc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, edited, err := editOvfPackageDescriptor([]byte(testOvftoolDescriptor), &ovfFileDesc, []OvfDescriptorEditor{RemoveOvfHardware(5)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(edited.File) != 1 || edited.File[0].HREF != "appliance-disk1.vmdk" {
+		t.Errorf("unexpected files of the edited descriptor: %+v", edited.File)
+	}
+
+	addFile := func(envelope *types.OvfEnvelope) error {
+		envelope.References.File = append(envelope.References.File, &types.OvfFile{ID: "file3", HREF: "extra.vmdk"})
+		return nil
+	}
+	_, _, err = editOvfPackageDescriptor([]byte(testOvftoolDescriptor), &ovfFileDesc, []OvfDescriptorEditor{addFile})
+	if err == nil || !strings.Contains(err.Error(), "'extra.vmdk', which is not part of the package") {
+		t.Errorf("expected error for a file added by an editor, got %v", err)
+	}
+
+	failing := func(envelope *types.OvfEnvelope) error { return errors.New("failure") }
+	_, _, err = editOvfPackageDescriptor([]byte(testOvftoolDescriptor), &ovfFileDesc, []OvfDescriptorEditor{failing})
+	if err == nil || !strings.Contains(err.Error(), "error editing OVF descriptor: failure") {
+		t.Errorf("expected editor error, got %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// OvfProperty is a typed view of a property declared in a product section
+type OvfProperty struct {
+	Key         string
+	Label       string
+	Description string
+	// Type is the OVF type of the property, such as string, boolean, uint16 or real64
+	Type         string
+	DefaultValue string
+	// Value is the current value, or the default value when no value is set
+	Value            string
+	UserConfigurable bool
+	// AllowedValues lists the values allowed by a ValueMap qualifier. Any value is allowed when empty
+	AllowedValues []string
+	// MinLength and MaxLength come from MinLen and MaxLen qualifiers. They are 0 when unset
+	MinLength int
+	MaxLength int
+}
+
+var (
+	ovfValueMapRegexp  = regexp.MustCompile(`ValueMap\{([^}]*)\}`)
+	ovfMinLenRegexp    = regexp.MustCompile(`MinLen\((\d+)\)`)
+	ovfMaxLenRegexp    = regexp.MustCompile(`MaxLen\((\d+)\)`)
+	ovfIntegerTypeBits = map[string]int{"uint8": 8, "sint8": 8, "uint16": 16, "sint16": 16,
+		"uint32": 32, "sint32": 32, "uint64": 64, "sint64": 64}
+)
+
+// OvfPropertiesFromSection returns the properties declared in a product section, by key
+func OvfPropertiesFromSection(productSection *types.ProductSectionList) map[string]OvfProperty {
+	properties := make(map[string]OvfProperty)
+	if productSection == nil || productSection.ProductSection == nil {
+		return properties
+	}
+	for _, property := range productSection.ProductSection.Property {
+		if property == nil {
+			continue
+		}
+		ovfProperty := OvfProperty{
+			Key:              property.Key,
+			Label:            property.Label,
+			Description:      property.Description,
+			Type:             property.Type,
+			DefaultValue:     property.DefaultValue,
+			Value:            property.DefaultValue,
+			UserConfigurable: property.UserConfigurable,
+		}
+		if property.Value != nil {
+			ovfProperty.Value = property.Value.Value
+		}
+		if match := ovfValueMapRegexp.FindStringSubmatch(property.Qualifiers); match != nil {
+			for _, allowed := range strings.Split(match[1], ",") {
+				allowed = strings.Trim(strings.TrimSpace(allowed), `"`)
+				if allowed != "" {
+					ovfProperty.AllowedValues = append(ovfProperty.AllowedValues, allowed)
+				}
+			}
+		}
+		if match := ovfMinLenRegexp.FindStringSubmatch(property.Qualifiers); match != nil {
+			ovfProperty.MinLength, _ = strconv.Atoi(match[1])
+		}
+		if match := ovfMaxLenRegexp.FindStringSubmatch(property.Qualifiers); match != nil {
+			ovfProperty.MaxLength, _ = strconv.Atoi(match[1])
+		}
+		properties[property.Key] = ovfProperty
+	}
+	return properties
+}
+
+// Validate checks that the property can be set to the given value
+func (property OvfProperty) Validate(value string) error {
+	if !property.UserConfigurable {
+		return fmt.Errorf("property '%s' is not user configurable", property.Key)
+	}
+	switch property.Type {
+	case "", "string", "password":
+	case "boolean":
+		if !strings.EqualFold(value, "true") && !strings.EqualFold(value, "false") {
+			return fmt.Errorf("property '%s' must be 'true' or 'false', got '%s'", property.Key, value)
+		}
+	case "real32", "real64":
+		bits := 64
+		if property.Type == "real32" {
+			bits = 32
+		}
+		number, err := strconv.ParseFloat(value, bits)
+		if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+			return fmt.Errorf("property '%s' must be a %s number, got '%s'", property.Key, property.Type, value)
+		}
+	default:
+		bits, found := ovfIntegerTypeBits[property.Type]
+		if !found {
+			return fmt.Errorf("property '%s' has unsupported type '%s'", property.Key, property.Type)
+		}
+		var err error
+		if strings.HasPrefix(property.Type, "u") {
+			_, err = strconv.ParseUint(value, 10, bits)
+		} else {
+			_, err = strconv.ParseInt(value, 10, bits)
+		}
+		if err != nil {
+			return fmt.Errorf("property '%s' must be a %s number, got '%s'", property.Key, property.Type, value)
+		}
+	}
+	if len(property.AllowedValues) > 0 {
+		allowed := false
+		for _, allowedValue := range property.AllowedValues {
+			if value == allowedValue {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("property '%s' must be one of %s, got '%s'", property.Key,
+				strings.Join(property.AllowedValues, ", "), value)
+		}
+	}
+	if property.MinLength > 0 && len(value) < property.MinLength {
+		return fmt.Errorf("property '%s' must have at least %d characters", property.Key, property.MinLength)
+	}
+	if property.MaxLength > 0 && len(value) > property.MaxLength {
+		return fmt.Errorf("property '%s' must have at most %d characters", property.Key, property.MaxLength)
+	}
+	return nil
+}
+
+// applyOvfProperties returns a copy of the product section with the given values, after
+// validating them against the declared properties. Values for undeclared properties are an error
+func applyOvfProperties(productSection *types.ProductSectionList, values map[string]string) (*types.ProductSectionList, error) {
+	declared := OvfPropertiesFromSection(productSection)
+	var errs []error
+	for _, key := range sortedKeys(values) {
+		property, found := declared[key]
+		if !found {
+			errs = append(errs, fmt.Errorf("property '%s' is not declared", key))
+			continue
+		}
+		err := property.Validate(values[key])
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &types.ProductSectionList{ProductSection: &types.ProductSection{}}
+	if productSection != nil && productSection.ProductSection != nil {
+		updated.ProductSection.Info = productSection.ProductSection.Info
+		for _, property := range productSection.ProductSection.Property {
+			if property == nil {
+				continue
+			}
+			updatedProperty := *property
+			if value, found := values[property.Key]; found {
+				updatedProperty.Value = &types.Value{Value: value}
+			}
+			updated.ProductSection.Property = append(updated.ProductSection.Property, &updatedProperty)
+		}
+	}
+	return updated, nil
+}
+
+// GetOvfProperties returns the OVF properties of the VM, by key
+func (vm *VM) GetOvfProperties() (map[string]OvfProperty, error) {
+	productSection, err := vm.GetProductSectionList()
+	if err != nil {
+		return nil, err
+	}
+	return OvfPropertiesFromSection(productSection), nil
+}
+
+// SetOvfProperties sets values of OVF properties of the VM. Every property must be declared in
+// the product section of the VM, be user configurable, and the value must match the type and
+// qualifiers of the property. Properties which are not in values are left unchanged
+func (vm *VM) SetOvfProperties(values map[string]string) (map[string]OvfProperty, error) {
+	productSection, err := vm.GetProductSectionList()
+	if err != nil {
+		return nil, err
+	}
+	updated, err := applyOvfProperties(productSection, values)
+	if err != nil {
+		return nil, fmt.Errorf("error setting OVF properties of VM '%s': %s", vm.VM.Name, err)
+	}
+	productSection, err = vm.SetProductSectionList(updated)
+	if err != nil {
+		return nil, err
+	}
+	return OvfPropertiesFromSection(productSection), nil
+}
+
+// GetOvfProperties returns the OVF properties of the vApp, by key
+func (vapp *VApp) GetOvfProperties() (map[string]OvfProperty, error) {
+	productSection, err := vapp.GetProductSectionList()
+	if err != nil {
+		return nil, err
+	}
+	return OvfPropertiesFromSection(productSection), nil
+}
+
+// SetOvfProperties sets values of OVF properties of the vApp, with the same checks as
+// VM.SetOvfProperties
+func (vapp *VApp) SetOvfProperties(values map[string]string) (map[string]OvfProperty, error) {
+	productSection, err := vapp.GetProductSectionList()
+	if err != nil {
+		return nil, err
+	}
+	updated, err := applyOvfProperties(productSection, values)
+	if err != nil {
+		return nil, fmt.Errorf("error setting OVF properties of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	productSection, err = vapp.SetProductSectionList(updated)
+	if err != nil {
+		return nil, err
+	}
+	return OvfPropertiesFromSection(productSection), nil
+}
+
+// CloudInitEncoding is the encoding of cloud-init data in guestinfo properties
+type CloudInitEncoding string
+
+const (
+	// CloudInitEncodingNone passes the data as plain text
+	CloudInitEncodingNone CloudInitEncoding = ""
+	// CloudInitEncodingBase64 passes the data encoded in base64
+	CloudInitEncodingBase64 CloudInitEncoding = "base64"
+	// CloudInitEncodingGzipBase64 passes the data compressed with gzip, then encoded in base64
+	CloudInitEncodingGzipBase64 CloudInitEncoding = "gzip+base64"
+)
+
+// OVF properties read by the VMware datasource of cloud-init. VCD passes the OVF properties with
+// the "guestinfo." prefix to the VM as guestinfo variables
+const (
+	CloudInitUserDataProperty         = "guestinfo.userdata"
+	CloudInitUserDataEncodingProperty = "guestinfo.userdata.encoding"
+	CloudInitMetaDataProperty         = "guestinfo.metadata"
+	CloudInitMetaDataEncodingProperty = "guestinfo.metadata.encoding"
+)
+
+// EncodeCloudInitData encodes cloud-init data with the given encoding
+func EncodeCloudInitData(data string, encoding CloudInitEncoding) (string, error) {
+	switch encoding {
+	case CloudInitEncodingNone:
+		return data, nil
+	case CloudInitEncodingBase64:
+		return base64.StdEncoding.EncodeToString([]byte(data)), nil
+	case CloudInitEncodingGzipBase64:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		_, err := writer.Write([]byte(data))
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return "", fmt.Errorf("error compressing cloud-init data: %s", err)
+		}
+		return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+	}
+	return "", fmt.Errorf("unsupported cloud-init encoding '%s'", encoding)
+}
+
+// SetCloudInitUserData sets the cloud-init user data and, when not empty, the meta data of the
+// VM in the guestinfo.userdata and guestinfo.metadata OVF properties, encoded with the given
+// encoding. The data properties must be declared by the template of the VM. The encoding
+// properties are added when the template doesn't declare them. Cloud-init reads the data at the
+// next boot of the VM
+func (vm *VM) SetCloudInitUserData(userData, metaData string, encoding CloudInitEncoding) error {
+	productSection, err := vm.GetProductSectionList()
+	if err != nil {
+		return err
+	}
+	updated, err := cloudInitProductSection(productSection, userData, metaData, encoding)
+	if err != nil {
+		return fmt.Errorf("error setting cloud-init data of VM '%s': %s", vm.VM.Name, err)
+	}
+	_, err = vm.SetProductSectionList(updated)
+	return err
+}
+
+// cloudInitProductSection returns a copy of the product section with the cloud-init properties
+func cloudInitProductSection(productSection *types.ProductSectionList, userData, metaData string, encoding CloudInitEncoding) (*types.ProductSectionList, error) {
+	if userData == "" {
+		return nil, fmt.Errorf("user data must not be empty")
+	}
+	values := make(map[string]string)
+	encodings := make(map[string]string)
+	encodedUserData, err := EncodeCloudInitData(userData, encoding)
+	if err != nil {
+		return nil, err
+	}
+	values[CloudInitUserDataProperty] = encodedUserData
+	encodings[CloudInitUserDataEncodingProperty] = string(encoding)
+	if metaData != "" {
+		encodedMetaData, err := EncodeCloudInitData(metaData, encoding)
+		if err != nil {
+			return nil, err
+		}
+		values[CloudInitMetaDataProperty] = encodedMetaData
+		encodings[CloudInitMetaDataEncodingProperty] = string(encoding)
+	}
+
+	declared := OvfPropertiesFromSection(productSection)
+	var undeclared []string
+	for key, value := range encodings {
+		if _, found := declared[key]; found {
+			values[key] = value
+		} else if value != "" {
+			undeclared = append(undeclared, key)
+		}
+	}
+	updated, err := applyOvfProperties(productSection, values)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(undeclared)
+	for _, key := range undeclared {
+		updated.ProductSection.Property = append(updated.ProductSection.Property, &types.Property{
+			Key:              key,
+			Type:             "string",
+			UserConfigurable: true,
+			Value:            &types.Value{Value: encodings[key]},
+		})
+	}
+	return updated, nil
+}
@@ -0,0 +1,173 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func testOvfProductSection() *types.ProductSectionList {
+	return &types.ProductSectionList{ProductSection: &types.ProductSection{
+		Info: "Custom properties",
+		Property: []*types.Property{
+			{Key: "hostname", Type: "string", UserConfigurable: true, Qualifiers: "MinLen(1) MaxLen(15)"},
+			{Key: "size", Type: "string", UserConfigurable: true, DefaultValue: "small", Qualifiers: `ValueMap{"small", "large"}`},
+			{Key: "port", Type: "uint16", UserConfigurable: true, DefaultValue: "80", Value: &types.Value{Value: "8080"}},
+			{Key: "offset", Type: "sint8", UserConfigurable: true},
+			{Key: "ratio", Type: "real32", UserConfigurable: true},
+			{Key: "debug", Type: "boolean", UserConfigurable: true},
+			{Key: "fixed", Type: "string", UserConfigurable: false, DefaultValue: "constant"},
+			{Key: CloudInitUserDataProperty, Type: "string", UserConfigurable: true},
+			{Key: CloudInitMetaDataProperty, Type: "string", UserConfigurable: true},
+			{Key: CloudInitMetaDataEncodingProperty, Type: "string", UserConfigurable: true},
+		},
+	}}
+}
+
+func Test_OvfPropertiesFromSection(t *testing.T) {
+	properties := OvfPropertiesFromSection(testOvfProductSection())
+	if len(properties) != 10 {
+		t.Fatalf("expected 10 properties, got %d", len(properties))
+	}
+	if properties["hostname"].MinLength != 1 || properties["hostname"].MaxLength != 15 {
+		t.Errorf("unexpected length limits: %+v", properties["hostname"])
+	}
+	if !reflect.DeepEqual(properties["size"].AllowedValues, []string{"small", "large"}) || properties["size"].Value != "small" {
+		t.Errorf("unexpected size property: %+v", properties["size"])
+	}
+	if properties["port"].Value != "8080" || properties["port"].DefaultValue != "80" {
+		t.Errorf("unexpected port property: %+v", properties["port"])
+	}
+	if len(OvfPropertiesFromSection(nil)) != 0 {
+		t.Errorf("expected no properties for nil section")
+	}
+}
+
+func Test_OvfPropertyValidate(t *testing.T) {
+	properties := OvfPropertiesFromSection(testOvfProductSection())
+	tests := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{"hostname", "web01", true},
+		{"hostname", "", false},
+		{"hostname", "a-very-long-host-name", false},
+		{"size", "large", true},
+		{"size", "medium", false},
+		{"port", "443", true},
+		{"port", "70000", false},
+		{"port", "-1", false},
+		{"offset", "-128", true},
+		{"offset", "200", false},
+		{"ratio", "0.5", true},
+		{"ratio", "half", false},
+		{"debug", "True", true},
+		{"debug", "yes", false},
+		{"fixed", "other", false},
+	}
+	for _, tt := range tests {
+		err := properties[tt.key].Validate(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s=%s: expected valid=%t, got %v", tt.key, tt.value, tt.valid, err)
+		}
+	}
+	err := OvfProperty{Key: "odd", Type: "uint128", UserConfigurable: true}.Validate("1")
+	if err == nil {
+		t.Errorf("expected error for unsupported type")
+	}
+}
+
+func Test_applyOvfProperties(t *testing.T) {
+	section := testOvfProductSection()
+	updated, err := applyOvfProperties(section, map[string]string{"size": "large", "port": "443"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	properties := OvfPropertiesFromSection(updated)
+	if properties["size"].Value != "large" || properties["port"].Value != "443" || properties["debug"].Value != "" {
+		t.Errorf("unexpected properties: %+v", properties)
+	}
+	if section.ProductSection.Property[2].Value.Value != "8080" || updated.ProductSection.Info != "Custom properties" {
+		t.Errorf("source section was modified or info was lost")
+	}
+
+	_, err = applyOvfProperties(section, map[string]string{"missing": "x", "size": "medium"})
+	if err == nil || !strings.Contains(err.Error(), "missing") || !strings.Contains(err.Error(), "size") {
+		t.Errorf("expected errors for both properties, got %v", err)
+	}
+}
+
+func Test_EncodeCloudInitData(t *testing.T) {
+	data := "#cloud-config\nhostname: web01\n"
+	encoded, err := EncodeCloudInitData(data, CloudInitEncodingNone)
+	if err != nil || encoded != data {
+		t.Errorf("unexpected plain encoding: %s, %v", encoded, err)
+	}
+	encoded, err = EncodeCloudInitData(data, CloudInitEncodingBase64)
+	if err != nil || encoded != base64.StdEncoding.EncodeToString([]byte(data)) {
+		t.Errorf("unexpected base64 encoding: %s, %v", encoded, err)
+	}
+
+	encoded, err = EncodeCloudInitData(data, CloudInitEncodingGzipBase64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid base64: %s", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("invalid gzip: %s", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil || string(decoded) != data {
+		t.Errorf("unexpected decoded data: %s, %v", decoded, err)
+	}
+
+	_, err = EncodeCloudInitData(data, "rot13")
+	if err == nil {
+		t.Errorf("expected error for unsupported encoding")
+	}
+}
+
+func Test_cloudInitProductSection(t *testing.T) {
+	updated, err := cloudInitProductSection(testOvfProductSection(), "#cloud-config", "instance-id: vm1", CloudInitEncodingBase64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	properties := OvfPropertiesFromSection(updated)
+	if properties[CloudInitUserDataProperty].Value != base64.StdEncoding.EncodeToString([]byte("#cloud-config")) ||
+		properties[CloudInitMetaDataProperty].Value != base64.StdEncoding.EncodeToString([]byte("instance-id: vm1")) {
+		t.Errorf("unexpected data properties: %+v", properties)
+	}
+	// The metadata encoding is declared, the user data encoding is added
+	if properties[CloudInitMetaDataEncodingProperty].Value != "base64" || properties[CloudInitUserDataEncodingProperty].Value != "base64" {
+		t.Errorf("unexpected encoding properties: %+v", properties)
+	}
+	if len(updated.ProductSection.Property) != len(testOvfProductSection().ProductSection.Property)+1 {
+		t.Errorf("expected one added property, got %d", len(updated.ProductSection.Property))
+	}
+
+	_, err = cloudInitProductSection(&types.ProductSectionList{}, "#cloud-config", "", CloudInitEncodingNone)
+	if err == nil || !strings.Contains(err.Error(), CloudInitUserDataProperty) {
+		t.Errorf("expected error for undeclared user data property, got %v", err)
+	}
+	_, err = cloudInitProductSection(testOvfProductSection(), "", "", CloudInitEncodingNone)
+	if err == nil {
+		t.Errorf("expected error for empty user data")
+	}
+}
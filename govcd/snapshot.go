@@ -0,0 +1,178 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// VCD keeps a single snapshot for each VM. Creating a snapshot replaces the previous one, and
+// a vApp snapshot is a snapshot of each of its VMs.
+
+// CreateSnapshotAsync starts the creation of a snapshot of the VM, replacing the existing one.
+// When memory is true, the memory of a powered on VM is included in the snapshot. When quiesce
+// is true, the guest file system is quiesced before taking the snapshot (requires VMware Tools)
+func (vm *VM) CreateSnapshotAsync(name string, memory, quiesce bool) (Task, error) {
+	if vm.VM.HREF == "" {
+		return Task{}, fmt.Errorf("cannot create snapshot, VM HREF is unset")
+	}
+	return createSnapshot(vm.client, vm.VM.HREF, vm.VM.Link, name, memory, quiesce)
+}
+
+// CreateSnapshot creates a snapshot of the VM and waits for the task to complete.
+// See CreateSnapshotAsync for the meaning of the parameters
+func (vm *VM) CreateSnapshot(name string, memory, quiesce bool) error {
+	task, err := vm.CreateSnapshotAsync(name, memory, quiesce)
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// RevertToCurrentSnapshotAsync starts reverting the VM to its current snapshot
+func (vm *VM) RevertToCurrentSnapshotAsync() (Task, error) {
+	if vm.VM.HREF == "" {
+		return Task{}, fmt.Errorf("cannot revert to snapshot, VM HREF is unset")
+	}
+	return snapshotAction(vm.client, vm.VM.HREF, vm.VM.Link, types.RelSnapshotRevertToCurrent,
+		"revertToCurrentSnapshot", "error reverting VM to current snapshot: %s")
+}
+
+// RevertToCurrentSnapshot reverts the VM to its current snapshot and waits for the task to complete
+func (vm *VM) RevertToCurrentSnapshot() error {
+	task, err := vm.RevertToCurrentSnapshotAsync()
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// RemoveAllSnapshotsAsync starts removing all the snapshots of the VM
+func (vm *VM) RemoveAllSnapshotsAsync() (Task, error) {
+	if vm.VM.HREF == "" {
+		return Task{}, fmt.Errorf("cannot remove snapshots, VM HREF is unset")
+	}
+	return snapshotAction(vm.client, vm.VM.HREF, vm.VM.Link, types.RelSnapshotRemoveAll,
+		"removeAllSnapshots", "error removing VM snapshots: %s")
+}
+
+// RemoveAllSnapshots removes all the snapshots of the VM and waits for the task to complete
+func (vm *VM) RemoveAllSnapshots() error {
+	task, err := vm.RemoveAllSnapshotsAsync()
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// GetSnapshotSection retrieves the snapshots of the VM. The returned section has no Snapshot
+// items when the VM has no snapshot
+func (vm *VM) GetSnapshotSection() (*types.SnapshotSection, error) {
+	if vm.VM.HREF == "" {
+		return nil, fmt.Errorf("cannot retrieve snapshots, VM HREF is unset")
+	}
+	return getSnapshotSection(vm.client, vm.VM.HREF)
+}
+
+// CreateSnapshotAsync starts the creation of a snapshot of all the VMs of the vApp, replacing
+// the existing ones. See VM.CreateSnapshotAsync for the meaning of the parameters
+func (vapp *VApp) CreateSnapshotAsync(name string, memory, quiesce bool) (Task, error) {
+	if vapp.VApp.HREF == "" {
+		return Task{}, fmt.Errorf("cannot create snapshot, vApp HREF is unset")
+	}
+	return createSnapshot(vapp.client, vapp.VApp.HREF, vapp.VApp.Link, name, memory, quiesce)
+}
+
+// CreateSnapshot creates a snapshot of all the VMs of the vApp and waits for the task to complete
+func (vapp *VApp) CreateSnapshot(name string, memory, quiesce bool) error {
+	task, err := vapp.CreateSnapshotAsync(name, memory, quiesce)
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// RevertToCurrentSnapshotAsync starts reverting all the VMs of the vApp to their current snapshot
+func (vapp *VApp) RevertToCurrentSnapshotAsync() (Task, error) {
+	if vapp.VApp.HREF == "" {
+		return Task{}, fmt.Errorf("cannot revert to snapshot, vApp HREF is unset")
+	}
+	return snapshotAction(vapp.client, vapp.VApp.HREF, vapp.VApp.Link, types.RelSnapshotRevertToCurrent,
+		"revertToCurrentSnapshot", "error reverting vApp to current snapshot: %s")
+}
+
+// RevertToCurrentSnapshot reverts all the VMs of the vApp to their current snapshot and waits for
+// the task to complete
+func (vapp *VApp) RevertToCurrentSnapshot() error {
+	task, err := vapp.RevertToCurrentSnapshotAsync()
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// RemoveAllSnapshotsAsync starts removing the snapshots of all the VMs of the vApp
+func (vapp *VApp) RemoveAllSnapshotsAsync() (Task, error) {
+	if vapp.VApp.HREF == "" {
+		return Task{}, fmt.Errorf("cannot remove snapshots, vApp HREF is unset")
+	}
+	return snapshotAction(vapp.client, vapp.VApp.HREF, vapp.VApp.Link, types.RelSnapshotRemoveAll,
+		"removeAllSnapshots", "error removing vApp snapshots: %s")
+}
+
+// RemoveAllSnapshots removes the snapshots of all the VMs of the vApp and waits for the task to
+// complete
+func (vapp *VApp) RemoveAllSnapshots() error {
+	task, err := vapp.RemoveAllSnapshotsAsync()
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
+
+// GetSnapshotSection retrieves the snapshots of the vApp
+func (vapp *VApp) GetSnapshotSection() (*types.SnapshotSection, error) {
+	if vapp.VApp.HREF == "" {
+		return nil, fmt.Errorf("cannot retrieve snapshots, vApp HREF is unset")
+	}
+	return getSnapshotSection(vapp.client, vapp.VApp.HREF)
+}
+
+// snapshotActionHref returns the HREF of the link with the given relation, if the entity has
+// it, or the default action path otherwise. The links of an entity retrieved before a snapshot
+// operation may not reflect the current snapshot state, so a missing link is not an error.
+func snapshotActionHref(entityHref string, links types.LinkList, rel, action string) string {
+	return hrefForRel(links, rel, entityHref+"/action/"+action)
+}
+
+func createSnapshot(client *Client, entityHref string, links types.LinkList, name string, memory, quiesce bool) (Task, error) {
+	params := &types.CreateSnapshotParams{
+		Xmlns:   types.XMLNamespaceVCloud,
+		Name:    name,
+		Memory:  &memory,
+		Quiesce: &quiesce,
+	}
+	href := snapshotActionHref(entityHref, links, types.RelSnapshotCreate, "createSnapshot")
+	return client.ExecuteTaskRequest(href, http.MethodPost, types.MimeCreateSnapshotParams,
+		"error creating snapshot: %s", params)
+}
+
+func snapshotAction(client *Client, entityHref string, links types.LinkList, rel, action, errorMessage string) (Task, error) {
+	href := snapshotActionHref(entityHref, links, rel, action)
+	return client.ExecuteTaskRequest(href, http.MethodPost, "", errorMessage, nil)
+}
+
+func getSnapshotSection(client *Client, entityHref string) (*types.SnapshotSection, error) {
+	snapshotSection := &types.SnapshotSection{}
+	_, err := client.ExecuteRequest(entityHref+"/snapshotSection", http.MethodGet,
+		types.MimeSnapshotSection, "error retrieving snapshot section: %s", nil, snapshotSection)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotSection, nil
+}
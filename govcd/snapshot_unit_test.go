@@ -0,0 +1,64 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_snapshotActionHref(t *testing.T) {
+	vmHref := "https://vcd.example.com/api/vApp/vm-1"
+	links := types.LinkList{
+		{Rel: types.RelSnapshotCreate, HREF: vmHref + "/action/createSnapshot"},
+		{Rel: types.RelSnapshotRemoveAll, HREF: "https://other.example.com/api/vApp/vm-1/action/removeAllSnapshots"},
+	}
+
+	href := snapshotActionHref(vmHref, links, types.RelSnapshotRemoveAll, "removeAllSnapshots")
+	if href != links[1].HREF {
+		t.Errorf("expected link HREF %s, got %s", links[1].HREF, href)
+	}
+	href = snapshotActionHref(vmHref, links, types.RelSnapshotRevertToCurrent, "revertToCurrentSnapshot")
+	if href != vmHref+"/action/revertToCurrentSnapshot" {
+		t.Errorf("expected default action HREF, got %s", href)
+	}
+}
+
+func Test_CreateSnapshotParamsMarshal(t *testing.T) {
+	memory, quiesce := false, true
+	params := &types.CreateSnapshotParams{
+		Xmlns:       types.XMLNamespaceVCloud,
+		Name:        "before-patch",
+		Memory:      &memory,
+		Quiesce:     &quiesce,
+		Description: "snapshot",
+	}
+	output, err := xml.Marshal(params)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, expected := range []string{`name="before-patch"`, `memory="false"`, `quiesce="true"`, `<Description>snapshot</Description>`} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("expected %s in %s", expected, output)
+		}
+	}
+
+	var section types.SnapshotSection
+	err = xml.Unmarshal([]byte(`<SnapshotSection xmlns="http://schemas.dmtf.org/ovf/envelope/1">
+  <Info>Snapshot information section</Info>
+  <Snapshot xmlns="http://www.vmware.com/vcloud/v1.5" created="2024-01-01T10:00:00.000Z" poweredOn="true" size="4096"/>
+</SnapshotSection>`), &section)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(section.Snapshot) != 1 || !section.Snapshot[0].PoweredOn || section.Snapshot[0].Size != 4096 {
+		t.Errorf("unexpected snapshot section: %+v", section)
+	}
+}
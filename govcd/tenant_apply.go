@@ -0,0 +1,883 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// TenantChangeAction is the kind of operation of a TenantChange
+type TenantChangeAction string
+
+const (
+	TenantChangeCreate TenantChangeAction = "create"
+	TenantChangeUpdate TenantChangeAction = "update"
+	TenantChangeDelete TenantChangeAction = "delete"
+)
+
+// Kinds of objects handled by the tenant apply engine
+const (
+	TenantKindVdc           = "vdc"
+	TenantKindNetwork       = "network"
+	TenantKindNatRule       = "natRule"
+	TenantKindFirewallRules = "firewallRules"
+	TenantKindCatalog       = "catalog"
+	TenantKindVApp          = "vApp"
+	TenantKindVm            = "vm"
+)
+
+// Phases define the order in which the changes are applied: objects are created before the
+// objects that use them, and deleted after them
+const (
+	tenantPhaseVdc = iota
+	tenantPhaseCatalog
+	tenantPhaseNetwork
+	tenantPhaseEdgeRules
+	tenantPhaseVApp
+	tenantPhaseVm
+	tenantPhaseDeleteVm
+	tenantPhaseDeleteVApp
+	tenantPhaseDeleteNatRule
+	tenantPhaseDeleteNetwork
+	tenantPhaseDeleteCatalog
+)
+
+// TenantApplyOptions defines how a TenantSpec is reconciled
+type TenantApplyOptions struct {
+	// Prune deletes the objects which are not in the spec: networks and vApps of the VDC, NAT and
+	// firewall rules of the Edge Gateways listed in the spec, VMs of the vApps listed in the spec,
+	// and metadata entries of the objects whose metadata is in the spec
+	Prune bool
+	// PruneCatalogs deletes the catalogs which are not in the spec, with their items. Catalogs
+	// belong to the whole Org, not to the VDC of the spec, so they are only deleted when the spec
+	// describes every catalog of the Org
+	PruneCatalogs bool
+}
+
+// TenantChange is a single operation of a TenantPlan
+type TenantChange struct {
+	Action TenantChangeAction
+	Kind   string
+	Name   string
+	// Parent is the name of the Edge Gateway or vApp containing the object, if any
+	Parent string
+	// Details describes the differences found for updates
+	Details []string
+
+	phase int
+	apply func() error
+}
+
+// TenantPlan is the list of changes needed to bring a tenant to the state of a TenantSpec
+type TenantPlan struct {
+	Org     string
+	Vdc     string
+	Changes []*TenantChange
+}
+
+// PlanTenantSpec reads the current state of the objects in the spec through the existing getters
+// and computes the creates, updates and deletes needed to reach the desired state. Nothing is
+// changed in VCD. The plan is empty when the tenant already matches the spec.
+func (vcdClient *VCDClient) PlanTenantSpec(spec *TenantSpec, options TenantApplyOptions) (*TenantPlan, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("tenant spec must not be nil")
+	}
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	adminOrg, err := vcdClient.GetAdminOrgByName(spec.Org)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Org '%s': %s", spec.Org, err)
+	}
+	vdc, err := adminOrg.GetVDCByName(spec.Vdc, false)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving VDC '%s': %s", spec.Vdc, err)
+	}
+
+	planner := &tenantPlanner{
+		vcdClient:     vcdClient,
+		adminOrg:      adminOrg,
+		vdc:           vdc,
+		spec:          spec,
+		prune:         options.Prune,
+		pruneCatalogs: options.PruneCatalogs,
+		plan:          &TenantPlan{Org: spec.Org, Vdc: spec.Vdc},
+	}
+	for _, step := range []func() error{
+		planner.planVdcMetadata,
+		planner.planCatalogs,
+		planner.planNetworks,
+		planner.planEdgeGateways,
+		planner.planVApps,
+	} {
+		err = step()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(planner.plan.Changes, func(i, j int) bool {
+		return planner.plan.Changes[i].phase < planner.plan.Changes[j].phase
+	})
+	return planner.plan, nil
+}
+
+// ApplyTenantSpec computes the plan for the spec and applies it. It returns the plan that was
+// applied, which is empty when the tenant already matched the spec
+func (vcdClient *VCDClient) ApplyTenantSpec(spec *TenantSpec, options TenantApplyOptions) (*TenantPlan, error) {
+	plan, err := vcdClient.PlanTenantSpec(spec, options)
+	if err != nil {
+		return nil, err
+	}
+	return plan, plan.Apply()
+}
+
+// IsEmpty returns true when there is nothing to change
+func (plan *TenantPlan) IsEmpty() bool {
+	return len(plan.Changes) == 0
+}
+
+// String returns a human readable description of the plan
+func (plan *TenantPlan) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Plan for Org '%s', VDC '%s': %d change(s)\n", plan.Org, plan.Vdc, len(plan.Changes))
+	for _, change := range plan.Changes {
+		fmt.Fprintf(&builder, "  %s %s '%s'", change.Action, change.Kind, change.Name)
+		if change.Parent != "" {
+			fmt.Fprintf(&builder, " in '%s'", change.Parent)
+		}
+		builder.WriteString("\n")
+		for _, detail := range change.Details {
+			fmt.Fprintf(&builder, "      %s\n", detail)
+		}
+	}
+	return builder.String()
+}
+
+// Apply runs the changes of the plan in order, waiting for each task to complete. It stops at
+// the first failure; running the plan again from a fresh PlanTenantSpec continues from there
+func (plan *TenantPlan) Apply() error {
+	for _, change := range plan.Changes {
+		util.Logger.Printf("[TRACE] tenant apply: %s %s '%s' %s", change.Action, change.Kind, change.Name, change.Parent)
+		err := change.apply()
+		if err != nil {
+			description := fmt.Sprintf("%s '%s'", change.Kind, change.Name)
+			if change.Parent != "" {
+				description += fmt.Sprintf(" in '%s'", change.Parent)
+			}
+			return fmt.Errorf("error applying %s of %s: %s", change.Action, description, err)
+		}
+	}
+	return nil
+}
+
+// tenantPlanner holds the state used to compute a TenantPlan
+type tenantPlanner struct {
+	vcdClient     *VCDClient
+	adminOrg      *AdminOrg
+	vdc           *Vdc
+	spec          *TenantSpec
+	prune         bool
+	pruneCatalogs bool
+	plan          *TenantPlan
+}
+
+func (planner *tenantPlanner) add(phase int, action TenantChangeAction, kind, name, parent string, details []string, apply func() error) {
+	planner.plan.Changes = append(planner.plan.Changes, &TenantChange{
+		Action:  action,
+		Kind:    kind,
+		Name:    name,
+		Parent:  parent,
+		Details: details,
+		phase:   phase,
+		apply:   apply,
+	})
+}
+
+// metadataUpdater applies metadata changes through the functions of an entity
+type metadataUpdater struct {
+	merge  func(map[string]types.MetadataValue) error
+	delete func(key string, isSystem bool) error
+}
+
+func (updater metadataUpdater) apply(toSet map[string]string, toRemove []string) error {
+	if len(toSet) > 0 {
+		err := updater.merge(metadataValues(toSet))
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range toRemove {
+		err := updater.delete(key, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planVdcMetadata() error {
+	if planner.spec.Metadata == nil {
+		return nil
+	}
+	adminVdc, err := planner.adminOrg.GetAdminVDCByName(planner.spec.Vdc, false)
+	if err != nil {
+		return fmt.Errorf("error retrieving VDC '%s': %s", planner.spec.Vdc, err)
+	}
+	metadata, err := adminVdc.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("error retrieving metadata of VDC '%s': %s", planner.spec.Vdc, err)
+	}
+	toSet, toRemove := metadataChanges(planner.spec.Metadata, metadata.MetadataEntry, planner.prune)
+	if len(toSet) == 0 && len(toRemove) == 0 {
+		return nil
+	}
+	updater := metadataUpdater{merge: adminVdc.MergeMetadataWithMetadataValues, delete: adminVdc.DeleteMetadataEntryWithDomain}
+	planner.add(tenantPhaseVdc, TenantChangeUpdate, TenantKindVdc, planner.spec.Vdc, "", metadataDetails(toSet, toRemove),
+		func() error { return updater.apply(toSet, toRemove) })
+	return nil
+}
+
+func (planner *tenantPlanner) planCatalogs() error {
+	wanted := make(map[string]bool)
+	for _, catalogSpec := range planner.spec.Catalogs {
+		catalogSpec := catalogSpec
+		wanted[catalogSpec.Name] = true
+		adminCatalog, err := planner.adminOrg.GetAdminCatalogByName(catalogSpec.Name, false)
+		if err != nil {
+			if !ContainsNotFound(err) {
+				return fmt.Errorf("error retrieving catalog '%s': %s", catalogSpec.Name, err)
+			}
+			planner.add(tenantPhaseCatalog, TenantChangeCreate, TenantKindCatalog, catalogSpec.Name, "", metadataDetails(catalogSpec.Metadata, nil),
+				func() error {
+					adminCatalog, err := planner.adminOrg.CreateCatalog(catalogSpec.Name, catalogSpec.Description)
+					if err != nil {
+						return err
+					}
+					if len(catalogSpec.Metadata) == 0 {
+						return nil
+					}
+					return adminCatalog.MergeMetadataWithMetadataValues(metadataValues(catalogSpec.Metadata))
+				})
+			continue
+		}
+
+		metadata, err := adminCatalog.GetMetadata()
+		if err != nil {
+			return fmt.Errorf("error retrieving metadata of catalog '%s': %s", catalogSpec.Name, err)
+		}
+		toSet, toRemove := metadataChanges(catalogSpec.Metadata, metadata.MetadataEntry, planner.prune)
+		var details []string
+		if adminCatalog.AdminCatalog.Description != catalogSpec.Description {
+			details = append(details, fmt.Sprintf("description: '%s' => '%s'", adminCatalog.AdminCatalog.Description, catalogSpec.Description))
+		}
+		details = append(details, metadataDetails(toSet, toRemove)...)
+		if len(details) == 0 {
+			continue
+		}
+		descriptionChanged := adminCatalog.AdminCatalog.Description != catalogSpec.Description
+		updater := metadataUpdater{merge: adminCatalog.MergeMetadataWithMetadataValues, delete: adminCatalog.DeleteMetadataEntryWithDomain}
+		planner.add(tenantPhaseCatalog, TenantChangeUpdate, TenantKindCatalog, catalogSpec.Name, "", details,
+			func() error {
+				if descriptionChanged {
+					adminCatalog.AdminCatalog.Description = catalogSpec.Description
+					err := adminCatalog.Update()
+					if err != nil {
+						return err
+					}
+				}
+				return updater.apply(toSet, toRemove)
+			})
+	}
+
+	if !planner.pruneCatalogs || planner.adminOrg.AdminOrg.Catalogs == nil {
+		return nil
+	}
+	for _, catalogRef := range planner.adminOrg.AdminOrg.Catalogs.Catalog {
+		if wanted[catalogRef.Name] {
+			continue
+		}
+		catalogName := catalogRef.Name
+		planner.add(tenantPhaseDeleteCatalog, TenantChangeDelete, TenantKindCatalog, catalogName, "", nil,
+			func() error {
+				adminCatalog, err := planner.adminOrg.GetAdminCatalogByName(catalogName, true)
+				if err != nil {
+					return err
+				}
+				return adminCatalog.Delete(true, true)
+			})
+	}
+	return nil
+}
+
+// edgeGatewayId returns the ID of an Edge Gateway of the Org, or an empty string for no name
+func (planner *tenantPlanner) edgeGatewayId(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	egw, err := planner.adminOrg.GetNsxtEdgeGatewayByName(name)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving Edge Gateway '%s': %s", name, err)
+	}
+	return egw.EdgeGateway.ID, nil
+}
+
+func (planner *tenantPlanner) planNetworks() error {
+	networks, err := planner.vdc.GetAllOpenApiOrgVdcNetworks(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving networks of VDC '%s': %s", planner.spec.Vdc, err)
+	}
+	currentNetworks := make(map[string]*OpenApiOrgVdcNetwork)
+	for _, network := range networks {
+		currentNetworks[network.OpenApiOrgVdcNetwork.Name] = network
+	}
+
+	wanted := make(map[string]bool)
+	for _, networkSpec := range planner.spec.Networks {
+		networkSpec := networkSpec
+		wanted[networkSpec.Name] = true
+		edgeGatewayId, err := planner.edgeGatewayId(networkSpec.EdgeGateway)
+		if err != nil {
+			return fmt.Errorf("network '%s': %s", networkSpec.Name, err)
+		}
+
+		network, found := currentNetworks[networkSpec.Name]
+		if !found {
+			planner.add(tenantPhaseNetwork, TenantChangeCreate, TenantKindNetwork, networkSpec.Name, "", metadataDetails(networkSpec.Metadata, nil),
+				func() error {
+					networkConfig := &types.OpenApiOrgVdcNetwork{
+						OwnerRef:    &types.OpenApiReference{ID: planner.vdc.Vdc.ID},
+						NetworkType: types.OrgVdcNetworkTypeIsolated,
+					}
+					if edgeGatewayId != "" {
+						networkConfig.NetworkType = types.OrgVdcNetworkTypeRouted
+						networkConfig.Connection = &types.Connection{
+							RouterRef:      types.OpenApiReference{ID: edgeGatewayId},
+							ConnectionType: "INTERNAL",
+						}
+					}
+					applyNetworkSpec(networkSpec, networkConfig)
+					network, err := planner.vdc.CreateOpenApiOrgVdcNetwork(networkConfig)
+					if err != nil {
+						return err
+					}
+					if len(networkSpec.Metadata) == 0 {
+						return nil
+					}
+					return network.MergeMetadataWithMetadataValues(metadataValues(networkSpec.Metadata))
+				})
+			continue
+		}
+
+		details, err := networkDifferences(networkSpec, network.OpenApiOrgVdcNetwork, edgeGatewayId)
+		if err != nil {
+			return err
+		}
+		metadata, err := network.GetMetadata()
+		if err != nil {
+			return fmt.Errorf("error retrieving metadata of network '%s': %s", networkSpec.Name, err)
+		}
+		toSet, toRemove := metadataChanges(networkSpec.Metadata, metadata.MetadataEntry, planner.prune)
+		fieldsChanged := len(details) > 0
+		details = append(details, metadataDetails(toSet, toRemove)...)
+		if len(details) == 0 {
+			continue
+		}
+		updater := metadataUpdater{merge: network.MergeMetadataWithMetadataValues, delete: network.DeleteMetadataEntryWithDomain}
+		planner.add(tenantPhaseNetwork, TenantChangeUpdate, TenantKindNetwork, networkSpec.Name, "", details,
+			func() error {
+				if fieldsChanged {
+					networkConfig := network.OpenApiOrgVdcNetwork
+					applyNetworkSpec(networkSpec, networkConfig)
+					_, err := network.Update(networkConfig)
+					if err != nil {
+						return err
+					}
+				}
+				return updater.apply(toSet, toRemove)
+			})
+	}
+
+	if !planner.prune {
+		return nil
+	}
+	for _, name := range sortedKeys(currentNetworks) {
+		if wanted[name] {
+			continue
+		}
+		network := currentNetworks[name]
+		planner.add(tenantPhaseDeleteNetwork, TenantChangeDelete, TenantKindNetwork, name, "", nil, network.Delete)
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planEdgeGateways() error {
+	for _, edgeSpec := range planner.spec.EdgeGateways {
+		egw, err := planner.adminOrg.GetNsxtEdgeGatewayByName(edgeSpec.Name)
+		if err != nil {
+			return fmt.Errorf("error retrieving Edge Gateway '%s': %s", edgeSpec.Name, err)
+		}
+		err = planner.planNatRules(egw, edgeSpec)
+		if err != nil {
+			return err
+		}
+		err = planner.planFirewallRules(egw, edgeSpec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planNatRules(egw *NsxtEdgeGateway, edgeSpec TenantEdgeGatewaySpec) error {
+	natRules, err := egw.GetAllNatRules(nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving NAT rules of Edge Gateway '%s': %s", edgeSpec.Name, err)
+	}
+	currentRules := make(map[string]*NsxtNatRule)
+	for _, natRule := range natRules {
+		currentRules[natRule.NsxtNatRule.Name] = natRule
+	}
+
+	wanted := make(map[string]bool)
+	for _, ruleSpec := range edgeSpec.NatRules {
+		ruleSpec := ruleSpec
+		wanted[ruleSpec.Name] = true
+		natRule, found := currentRules[ruleSpec.Name]
+		if !found {
+			planner.add(tenantPhaseEdgeRules, TenantChangeCreate, TenantKindNatRule, ruleSpec.Name, edgeSpec.Name, nil,
+				func() error {
+					_, err := egw.CreateNatRule(natRuleFromSpec(ruleSpec))
+					return err
+				})
+			continue
+		}
+		details := natRuleDifferences(ruleSpec, natRule.NsxtNatRule)
+		if len(details) == 0 {
+			continue
+		}
+		planner.add(tenantPhaseEdgeRules, TenantChangeUpdate, TenantKindNatRule, ruleSpec.Name, edgeSpec.Name, details,
+			func() error {
+				ruleConfig := natRuleFromSpec(ruleSpec)
+				ruleConfig.ID = natRule.NsxtNatRule.ID
+				_, err := natRule.Update(ruleConfig)
+				return err
+			})
+	}
+
+	if !planner.prune {
+		return nil
+	}
+	for _, name := range sortedKeys(currentRules) {
+		if wanted[name] {
+			continue
+		}
+		planner.add(tenantPhaseDeleteNatRule, TenantChangeDelete, TenantKindNatRule, name, edgeSpec.Name, nil, currentRules[name].Delete)
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planFirewallRules(egw *NsxtEdgeGateway, edgeSpec TenantEdgeGatewaySpec) error {
+	if len(edgeSpec.FirewallRules) == 0 && !planner.prune {
+		return nil
+	}
+	firewall, err := egw.GetNsxtFirewall()
+	if err != nil {
+		return fmt.Errorf("error retrieving firewall rules of Edge Gateway '%s': %s", edgeSpec.Name, err)
+	}
+	firewallGroups, err := egw.GetAllNsxtFirewallGroups(nil, "")
+	if err != nil {
+		return fmt.Errorf("error retrieving Firewall Groups of Edge Gateway '%s': %s", edgeSpec.Name, err)
+	}
+	firewallGroupIds := make(map[string]string)
+	for _, firewallGroup := range firewallGroups {
+		firewallGroupIds[firewallGroup.NsxtFirewallGroup.Name] = firewallGroup.NsxtFirewallGroup.ID
+	}
+
+	rules, details, err := desiredFirewallRules(edgeSpec.FirewallRules, firewall.NsxtFirewallRuleContainer.UserDefinedRules, firewallGroupIds, planner.prune)
+	if err != nil {
+		return fmt.Errorf("Edge Gateway '%s': %s", edgeSpec.Name, err)
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	planner.add(tenantPhaseEdgeRules, TenantChangeUpdate, TenantKindFirewallRules, edgeSpec.Name, edgeSpec.Name, details,
+		func() error {
+			_, err := egw.UpdateNsxtFirewall(&types.NsxtFirewallRuleContainer{UserDefinedRules: rules})
+			return err
+		})
+	return nil
+}
+
+func (planner *tenantPlanner) planVApps() error {
+	currentVApps := make(map[string]bool)
+	for _, resourceEntities := range planner.vdc.Vdc.ResourceEntities {
+		for _, resourceEntity := range resourceEntities.ResourceEntity {
+			if resourceEntity.Type == types.MimeVApp {
+				currentVApps[resourceEntity.Name] = true
+			}
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, vAppSpec := range planner.spec.VApps {
+		vAppSpec := vAppSpec
+		wanted[vAppSpec.Name] = true
+		if !currentVApps[vAppSpec.Name] {
+			planner.add(tenantPhaseVApp, TenantChangeCreate, TenantKindVApp, vAppSpec.Name, "", metadataDetails(vAppSpec.Metadata, nil),
+				func() error {
+					vApp, err := planner.vdc.CreateRawVApp(vAppSpec.Name, vAppSpec.Description)
+					if err != nil {
+						return err
+					}
+					err = planner.attachVAppNetworks(vApp, vAppSpec.vAppNetworkNames())
+					if err != nil {
+						return err
+					}
+					if len(vAppSpec.Metadata) == 0 {
+						return nil
+					}
+					return vApp.MergeMetadataWithMetadataValues(metadataValues(vAppSpec.Metadata))
+				})
+			for _, vmSpec := range vAppSpec.VMs {
+				planner.planVmCreation(vAppSpec.Name, vmSpec)
+			}
+			continue
+		}
+
+		vApp, err := planner.vdc.GetVAppByName(vAppSpec.Name, false)
+		if err != nil {
+			return fmt.Errorf("error retrieving vApp '%s': %s", vAppSpec.Name, err)
+		}
+		err = planner.planVAppUpdate(vApp, vAppSpec)
+		if err != nil {
+			return err
+		}
+		err = planner.planVms(vApp, vAppSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !planner.prune {
+		return nil
+	}
+	for _, name := range sortedKeys(currentVApps) {
+		if wanted[name] {
+			continue
+		}
+		vAppName := name
+		planner.add(tenantPhaseDeleteVApp, TenantChangeDelete, TenantKindVApp, vAppName, "", nil,
+			func() error {
+				vApp, err := planner.vdc.GetVAppByName(vAppName, true)
+				if err != nil {
+					return err
+				}
+				return undeployAndDeleteVApp(vApp)
+			})
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planVAppUpdate(vApp *VApp, vAppSpec TenantVAppSpec) error {
+	var details []string
+	descriptionChanged := vApp.VApp.Description != vAppSpec.Description
+	if descriptionChanged {
+		details = append(details, fmt.Sprintf("description: '%s' => '%s'", vApp.VApp.Description, vAppSpec.Description))
+	}
+	missingNetworks, err := missingVAppNetworks(vApp, vAppSpec.vAppNetworkNames())
+	if err != nil {
+		return err
+	}
+	for _, network := range missingNetworks {
+		details = append(details, fmt.Sprintf("attach network '%s'", network))
+	}
+	metadata, err := vApp.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("error retrieving metadata of vApp '%s': %s", vAppSpec.Name, err)
+	}
+	toSet, toRemove := metadataChanges(vAppSpec.Metadata, metadata.MetadataEntry, planner.prune)
+	details = append(details, metadataDetails(toSet, toRemove)...)
+	if len(details) == 0 {
+		return nil
+	}
+
+	updater := metadataUpdater{merge: vApp.MergeMetadataWithMetadataValues, delete: vApp.DeleteMetadataEntryWithDomain}
+	planner.add(tenantPhaseVApp, TenantChangeUpdate, TenantKindVApp, vAppSpec.Name, "", details,
+		func() error {
+			if descriptionChanged {
+				err := vApp.UpdateDescription(vAppSpec.Description)
+				if err != nil {
+					return err
+				}
+			}
+			err := planner.attachVAppNetworks(vApp, missingNetworks)
+			if err != nil {
+				return err
+			}
+			return updater.apply(toSet, toRemove)
+		})
+	return nil
+}
+
+// missingVAppNetworks returns the networks which are not yet attached to the vApp
+func missingVAppNetworks(vApp *VApp, networkNames []string) ([]string, error) {
+	if len(networkNames) == 0 {
+		return nil, nil
+	}
+	networkConfig, err := vApp.GetNetworkConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving networks of vApp '%s': %s", vApp.VApp.Name, err)
+	}
+	attached := make(map[string]bool)
+	for _, network := range networkConfig.NetworkConfig {
+		attached[network.NetworkName] = true
+	}
+	var missing []string
+	for _, name := range networkNames {
+		if !attached[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+func (planner *tenantPlanner) attachVAppNetworks(vApp *VApp, networkNames []string) error {
+	for _, networkName := range networkNames {
+		orgNetwork, err := planner.vdc.GetOrgVdcNetworkByName(networkName, true)
+		if err != nil {
+			return fmt.Errorf("error retrieving network '%s': %s", networkName, err)
+		}
+		_, err = vApp.AddOrgNetwork(&VappNetworkSettings{}, orgNetwork.OrgVDCNetwork, false)
+		if err != nil {
+			return fmt.Errorf("error attaching network '%s': %s", networkName, err)
+		}
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planVms(vApp *VApp, vAppSpec TenantVAppSpec) error {
+	currentVms := make(map[string]bool)
+	if vApp.VApp.Children != nil {
+		for _, vm := range vApp.VApp.Children.VM {
+			currentVms[vm.Name] = true
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, vmSpec := range vAppSpec.VMs {
+		wanted[vmSpec.Name] = true
+		if !currentVms[vmSpec.Name] {
+			planner.planVmCreation(vAppSpec.Name, vmSpec)
+			continue
+		}
+		vm, err := vApp.GetVMByName(vmSpec.Name, false)
+		if err != nil {
+			return fmt.Errorf("error retrieving VM '%s' in vApp '%s': %s", vmSpec.Name, vAppSpec.Name, err)
+		}
+		err = planner.planVmUpdate(vm, vAppSpec.Name, vmSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !planner.prune {
+		return nil
+	}
+	for _, name := range sortedKeys(currentVms) {
+		if wanted[name] {
+			continue
+		}
+		vmName := name
+		planner.add(tenantPhaseDeleteVm, TenantChangeDelete, TenantKindVm, vmName, vAppSpec.Name, nil,
+			func() error {
+				vm, err := vApp.GetVMByName(vmName, true)
+				if err != nil {
+					return err
+				}
+				if vm.VM.Deployed {
+					task, err := vm.Undeploy()
+					if err == nil {
+						err = task.WaitTaskCompletion()
+					}
+					if err != nil {
+						return fmt.Errorf("error undeploying VM: %s", err)
+					}
+				}
+				return vApp.RemoveVM(*vm)
+			})
+	}
+	return nil
+}
+
+func (planner *tenantPlanner) planVmCreation(vAppName string, vmSpec TenantVmSpec) {
+	details := []string{fmt.Sprintf("from template '%s' of catalog '%s'", vmSpec.Template, vmSpec.Catalog)}
+	details = append(details, metadataDetails(vmSpec.Metadata, nil)...)
+	planner.add(tenantPhaseVm, TenantChangeCreate, TenantKindVm, vmSpec.Name, vAppName, details,
+		func() error {
+			vApp, err := planner.vdc.GetVAppByName(vAppName, true)
+			if err != nil {
+				return err
+			}
+			catalog, err := planner.adminOrg.GetCatalogByName(vmSpec.Catalog, true)
+			if err != nil {
+				return fmt.Errorf("error retrieving catalog '%s': %s", vmSpec.Catalog, err)
+			}
+			vAppTemplate, err := catalog.GetVAppTemplateByName(vmSpec.Template)
+			if err != nil {
+				return fmt.Errorf("error retrieving template '%s': %s", vmSpec.Template, err)
+			}
+
+			var networkConnectionSection *types.NetworkConnectionSection
+			if vmSpec.Network != "" {
+				networkConnectionSection = &types.NetworkConnectionSection{
+					PrimaryNetworkConnectionIndex: 0,
+					NetworkConnection: []*types.NetworkConnection{{
+						Network:                 vmSpec.Network,
+						NetworkConnectionIndex:  0,
+						IsConnected:             true,
+						IPAddress:               vmSpec.IpAddress,
+						IPAddressAllocationMode: valueOrDefault(vmSpec.IpAllocationMode, types.IPAllocationModePool),
+					}},
+				}
+			}
+			task, err := vApp.AddNewVM(vmSpec.Name, *vAppTemplate, networkConnectionSection, true)
+			if err != nil {
+				return err
+			}
+			err = task.WaitTaskCompletion()
+			if err != nil {
+				return err
+			}
+
+			vm, err := vApp.GetVMByName(vmSpec.Name, true)
+			if err != nil {
+				return err
+			}
+			err = applyVmCompute(vm, vmSpec)
+			if err != nil {
+				return err
+			}
+			if len(vmSpec.Metadata) == 0 {
+				return nil
+			}
+			return vm.MergeMetadataWithMetadataValues(metadataValues(vmSpec.Metadata))
+		})
+}
+
+func (planner *tenantPlanner) planVmUpdate(vm *VM, vAppName string, vmSpec TenantVmSpec) error {
+	details, err := vmComputeDifferences(vm, vmSpec)
+	if err != nil {
+		return err
+	}
+	computeChanged := len(details) > 0
+	metadata, err := vm.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("error retrieving metadata of VM '%s': %s", vmSpec.Name, err)
+	}
+	toSet, toRemove := metadataChanges(vmSpec.Metadata, metadata.MetadataEntry, planner.prune)
+	details = append(details, metadataDetails(toSet, toRemove)...)
+	if len(details) == 0 {
+		return nil
+	}
+	updater := metadataUpdater{merge: vm.MergeMetadataWithMetadataValues, delete: vm.DeleteMetadataEntryWithDomain}
+	planner.add(tenantPhaseVm, TenantChangeUpdate, TenantKindVm, vmSpec.Name, vAppName, details,
+		func() error {
+			if computeChanged {
+				err := applyVmCompute(vm, vmSpec)
+				if err != nil {
+					return err
+				}
+			}
+			return updater.apply(toSet, toRemove)
+		})
+	return nil
+}
+
+// vmComputeDifferences compares CPU and memory of a VM with the spec. Values not set in the spec
+// are not compared
+func vmComputeDifferences(vm *VM, vmSpec TenantVmSpec) ([]string, error) {
+	vmSpecSection := vm.VM.VmSpecSection
+	if vmSpecSection == nil {
+		return nil, fmt.Errorf("VM '%s' has no VmSpecSection", vmSpec.Name)
+	}
+	var differences []string
+	if vmSpec.Cpus != 0 && (vmSpecSection.NumCpus == nil || *vmSpecSection.NumCpus != vmSpec.Cpus) {
+		differences = append(differences, fmt.Sprintf("CPUs: %s => %d", intPointerString(vmSpecSection.NumCpus), vmSpec.Cpus))
+	}
+	if vmSpec.CoresPerSocket != 0 && (vmSpecSection.NumCoresPerSocket == nil || *vmSpecSection.NumCoresPerSocket != vmSpec.CoresPerSocket) {
+		differences = append(differences, fmt.Sprintf("cores per socket: %s => %d", intPointerString(vmSpecSection.NumCoresPerSocket), vmSpec.CoresPerSocket))
+	}
+	if vmSpec.MemoryMb != 0 && (vmSpecSection.MemoryResourceMb == nil || vmSpecSection.MemoryResourceMb.Configured != vmSpec.MemoryMb) {
+		currentMemory := int64(0)
+		if vmSpecSection.MemoryResourceMb != nil {
+			currentMemory = vmSpecSection.MemoryResourceMb.Configured
+		}
+		differences = append(differences, fmt.Sprintf("memory: %d MB => %d MB", currentMemory, vmSpec.MemoryMb))
+	}
+	return differences, nil
+}
+
+func intPointerString(value *int) string {
+	if value == nil {
+		return "unset"
+	}
+	return fmt.Sprint(*value)
+}
+
+// applyVmCompute sets CPU and memory of a VM as defined in the spec, when they differ
+func applyVmCompute(vm *VM, vmSpec TenantVmSpec) error {
+	vmSpecSection := vm.VM.VmSpecSection
+	if vmSpecSection == nil {
+		return fmt.Errorf("VM '%s' has no VmSpecSection", vmSpec.Name)
+	}
+	cpusChanged := vmSpec.Cpus != 0 && (vmSpecSection.NumCpus == nil || *vmSpecSection.NumCpus != vmSpec.Cpus)
+	coresChanged := vmSpec.CoresPerSocket != 0 && (vmSpecSection.NumCoresPerSocket == nil || *vmSpecSection.NumCoresPerSocket != vmSpec.CoresPerSocket)
+	if cpusChanged || coresChanged {
+		var cpus, cores *int
+		if vmSpec.Cpus != 0 {
+			cpus = addrOf(vmSpec.Cpus)
+		}
+		if vmSpec.CoresPerSocket != 0 {
+			cores = addrOf(vmSpec.CoresPerSocket)
+		}
+		err := vm.ChangeCPUAndCoreCount(cpus, cores)
+		if err != nil {
+			return err
+		}
+		err = vm.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+	if vmSpec.MemoryMb != 0 && (vm.VM.VmSpecSection.MemoryResourceMb == nil || vm.VM.VmSpecSection.MemoryResourceMb.Configured != vmSpec.MemoryMb) {
+		return vm.ChangeMemory(vmSpec.MemoryMb)
+	}
+	return nil
+}
+
+// undeployAndDeleteVApp powers off a vApp, if needed, and deletes it
+func undeployAndDeleteVApp(vApp *VApp) error {
+	if vApp.VApp.Deployed {
+		task, err := vApp.Undeploy()
+		if err == nil {
+			err = task.WaitTaskCompletion()
+		}
+		if err != nil {
+			return fmt.Errorf("error undeploying vApp: %s", err)
+		}
+	}
+	task, err := vApp.Delete()
+	if err != nil {
+		return err
+	}
+	return task.WaitTaskCompletion()
+}
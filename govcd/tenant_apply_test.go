@@ -0,0 +1,77 @@
+//go:build network || nsxt || functional || openapi || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+
+	. "gopkg.in/check.v1"
+)
+
+// Test_ApplyTenantSpec applies a spec with an isolated network and a catalog, checks that a second
+// plan is empty, and then updates the network through the spec
+func (vcd *TestVCD) Test_ApplyTenantSpec(check *C) {
+	skipNoNsxtConfiguration(vcd, check)
+
+	networkName := check.TestName() + "-net"
+	catalogName := check.TestName() + "-cat"
+	spec := &TenantSpec{
+		Org: vcd.config.VCD.Org,
+		Vdc: vcd.config.VCD.Nsxt.Vdc,
+		Networks: []TenantNetworkSpec{{
+			Name:          networkName,
+			Gateway:       "172.31.250.1",
+			PrefixLength:  24,
+			StaticIpPools: []TenantIpRangeSpec{{Start: "172.31.250.10", End: "172.31.250.20"}},
+			Metadata:      map[string]string{"managed-by": check.TestName()},
+		}},
+		Catalogs: []TenantCatalogSpec{{Name: catalogName, Description: "tenant spec catalog"}},
+	}
+
+	plan, err := vcd.client.PlanTenantSpec(spec, TenantApplyOptions{})
+	check.Assert(err, IsNil)
+	check.Assert(len(plan.Changes), Equals, 2)
+	check.Assert(plan.Changes[0].Kind, Equals, TenantKindCatalog)
+	check.Assert(plan.Changes[1].Kind, Equals, TenantKindNetwork)
+	if testVerbose {
+		fmt.Print(plan.String())
+	}
+
+	PrependToCleanupList(catalogName, "catalog", vcd.config.VCD.Org, check.TestName())
+	err = plan.Apply()
+	check.Assert(err, IsNil)
+
+	adminOrg, err := vcd.client.GetAdminOrgByName(vcd.config.VCD.Org)
+	check.Assert(err, IsNil)
+	network, err := vcd.nsxtVdc.GetOpenApiOrgVdcNetworkByName(networkName)
+	check.Assert(err, IsNil)
+	PrependToCleanupListOpenApi(network.OpenApiOrgVdcNetwork.ID, check.TestName(), types.OpenApiPathVersion1_0_0+types.OpenApiEndpointOrgVdcNetworks+network.OpenApiOrgVdcNetwork.ID)
+
+	// Applying the same spec again changes nothing
+	plan, err = vcd.client.ApplyTenantSpec(spec, TenantApplyOptions{})
+	check.Assert(err, IsNil)
+	check.Assert(plan.IsEmpty(), Equals, true)
+
+	spec.Networks[0].DnsServer1 = "172.31.250.2"
+	plan, err = vcd.client.ApplyTenantSpec(spec, TenantApplyOptions{})
+	check.Assert(err, IsNil)
+	check.Assert(len(plan.Changes), Equals, 1)
+	check.Assert(plan.Changes[0].Action, Equals, TenantChangeUpdate)
+
+	network, err = vcd.nsxtVdc.GetOpenApiOrgVdcNetworkByName(networkName)
+	check.Assert(err, IsNil)
+	check.Assert(network.OpenApiOrgVdcNetwork.Subnets.Values[0].DNSServer1, Equals, "172.31.250.2")
+
+	err = network.Delete()
+	check.Assert(err, IsNil)
+	catalog, err := adminOrg.GetAdminCatalogByName(catalogName, true)
+	check.Assert(err, IsNil)
+	err = catalog.Delete(true, true)
+	check.Assert(err, IsNil)
+}
@@ -0,0 +1,522 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// TenantSpec is the desired state of the resources of a tenant in a VDC. It is consumed by
+// VCDClient.PlanTenantSpec and VCDClient.ApplyTenantSpec, and can be written in YAML or JSON
+// (see ParseTenantSpec).
+//
+// Objects are identified by name. Objects which exist in VCD but are not in the spec are left
+// untouched, unless TenantApplyOptions.Prune is set. Catalogs, which belong to the whole Org, are
+// only deleted with TenantApplyOptions.PruneCatalogs.
+type TenantSpec struct {
+	Org string `json:"org"`
+	Vdc string `json:"vdc"`
+	// Metadata contains the metadata of the VDC. Without 'metadata' key, the metadata of an object
+	// is not managed, and it is never pruned
+	Metadata     map[string]string       `json:"metadata,omitempty"`
+	Networks     []TenantNetworkSpec     `json:"networks,omitempty"`
+	EdgeGateways []TenantEdgeGatewaySpec `json:"edgeGateways,omitempty"`
+	Catalogs     []TenantCatalogSpec     `json:"catalogs,omitempty"`
+	VApps        []TenantVAppSpec        `json:"vApps,omitempty"`
+}
+
+// TenantNetworkSpec defines an NSX-T Org VDC network. The network is routed when EdgeGateway is
+// set, and isolated otherwise
+type TenantNetworkSpec struct {
+	Name          string              `json:"name"`
+	Description   string              `json:"description,omitempty"`
+	EdgeGateway   string              `json:"edgeGateway,omitempty"`
+	Gateway       string              `json:"gateway"`
+	PrefixLength  int                 `json:"prefixLength"`
+	DnsServer1    string              `json:"dnsServer1,omitempty"`
+	DnsServer2    string              `json:"dnsServer2,omitempty"`
+	DnsSuffix     string              `json:"dnsSuffix,omitempty"`
+	StaticIpPools []TenantIpRangeSpec `json:"staticIpPools,omitempty"`
+	Metadata      map[string]string   `json:"metadata,omitempty"`
+}
+
+// TenantIpRangeSpec is a range of IP addresses
+type TenantIpRangeSpec struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// TenantEdgeGatewaySpec defines the NAT and firewall rules of an existing NSX-T Edge Gateway
+type TenantEdgeGatewaySpec struct {
+	Name          string                   `json:"name"`
+	NatRules      []TenantNatRuleSpec      `json:"natRules,omitempty"`
+	FirewallRules []TenantFirewallRuleSpec `json:"firewallRules,omitempty"`
+}
+
+// TenantNatRuleSpec defines an NSX-T NAT rule. RuleType is one of the types.NsxtNatRuleType*
+// constants
+type TenantNatRuleSpec struct {
+	Name                     string `json:"name"`
+	Description              string `json:"description,omitempty"`
+	RuleType                 string `json:"ruleType"`
+	ExternalAddresses        string `json:"externalAddresses,omitempty"`
+	InternalAddresses        string `json:"internalAddresses,omitempty"`
+	DnatExternalPort         string `json:"dnatExternalPort,omitempty"`
+	SnatDestinationAddresses string `json:"snatDestinationAddresses,omitempty"`
+	Disabled                 bool   `json:"disabled,omitempty"`
+	Logging                  bool   `json:"logging,omitempty"`
+}
+
+// TenantFirewallRuleSpec defines an NSX-T Edge Gateway firewall rule. Sources and Destinations
+// contain names of Firewall Groups (IP Sets or Security Groups) available to the Edge Gateway.
+// An empty list means 'Any'. Managed rules are placed on top of the user defined rules, in the
+// order of the spec
+type TenantFirewallRuleSpec struct {
+	Name string `json:"name"`
+	// Action is one of ALLOW (default), DROP, REJECT
+	Action string `json:"action,omitempty"`
+	// Direction is one of IN_OUT (default), IN, OUT
+	Direction string `json:"direction,omitempty"`
+	// IpProtocol is one of IPV4_IPV6 (default), IPV4, IPV6
+	IpProtocol   string   `json:"ipProtocol,omitempty"`
+	Sources      []string `json:"sources,omitempty"`
+	Destinations []string `json:"destinations,omitempty"`
+	Disabled     bool     `json:"disabled,omitempty"`
+	Logging      bool     `json:"logging,omitempty"`
+}
+
+// TenantCatalogSpec defines a catalog of the Org
+type TenantCatalogSpec struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// TenantVAppSpec defines a vApp. Networks contains the names of the Org VDC networks attached
+// to the vApp. Networks used by VMs are attached automatically
+type TenantVAppSpec struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Networks    []string          `json:"networks,omitempty"`
+	VMs         []TenantVmSpec    `json:"vms,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// TenantVmSpec defines a VM created from a vApp template. Catalog, Template and Network are
+// only used on creation. Cpus, CoresPerSocket and MemoryMb are reconciled when set
+type TenantVmSpec struct {
+	Name           string `json:"name"`
+	Catalog        string `json:"catalog"`
+	Template       string `json:"template"`
+	Cpus           int    `json:"cpus,omitempty"`
+	CoresPerSocket int    `json:"coresPerSocket,omitempty"`
+	MemoryMb       int64  `json:"memoryMb,omitempty"`
+	Network        string `json:"network,omitempty"`
+	// IpAllocationMode is one of POOL (default), DHCP, MANUAL, NONE
+	IpAllocationMode string            `json:"ipAllocationMode,omitempty"`
+	IpAddress        string            `json:"ipAddress,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// ParseTenantSpec decodes a YAML or JSON tenant spec and validates it
+func ParseTenantSpec(data []byte) (*TenantSpec, error) {
+	spec := &TenantSpec{}
+	err := yaml.UnmarshalStrict(data, spec)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding tenant spec: %s", err)
+	}
+	err = spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Validate checks that the spec has the mandatory fields, and that names are unique for each
+// kind of object
+func (spec *TenantSpec) Validate() error {
+	var problems []string
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	checkNames := func(kind string, names []string) {
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if name == "" {
+				problem("%s without name", kind)
+				continue
+			}
+			if seen[name] {
+				problem("duplicate %s '%s'", kind, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	if spec.Org == "" {
+		problem("missing Org name")
+	}
+	if spec.Vdc == "" {
+		problem("missing VDC name")
+	}
+
+	var names []string
+	for _, network := range spec.Networks {
+		names = append(names, network.Name)
+		if network.Gateway == "" || network.PrefixLength == 0 {
+			problem("network '%s' requires gateway and prefix length", network.Name)
+		}
+	}
+	checkNames("network", names)
+
+	names = nil
+	for _, edge := range spec.EdgeGateways {
+		names = append(names, edge.Name)
+		var ruleNames []string
+		for _, natRule := range edge.NatRules {
+			ruleNames = append(ruleNames, natRule.Name)
+			if natRule.RuleType == "" {
+				problem("NAT rule '%s' of Edge Gateway '%s' requires a rule type", natRule.Name, edge.Name)
+			}
+		}
+		checkNames(fmt.Sprintf("NAT rule in Edge Gateway '%s'", edge.Name), ruleNames)
+		ruleNames = nil
+		for _, firewallRule := range edge.FirewallRules {
+			ruleNames = append(ruleNames, firewallRule.Name)
+		}
+		checkNames(fmt.Sprintf("firewall rule in Edge Gateway '%s'", edge.Name), ruleNames)
+	}
+	checkNames("Edge Gateway", names)
+
+	names = nil
+	for _, catalog := range spec.Catalogs {
+		names = append(names, catalog.Name)
+	}
+	checkNames("catalog", names)
+
+	names = nil
+	for _, vApp := range spec.VApps {
+		names = append(names, vApp.Name)
+		var vmNames []string
+		for _, vm := range vApp.VMs {
+			vmNames = append(vmNames, vm.Name)
+			if vm.Catalog == "" || vm.Template == "" {
+				problem("VM '%s' in vApp '%s' requires catalog and template", vm.Name, vApp.Name)
+			}
+		}
+		checkNames(fmt.Sprintf("VM in vApp '%s'", vApp.Name), vmNames)
+	}
+	checkNames("vApp", names)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid tenant spec: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// vAppNetworkNames returns the Org VDC networks that must be attached to the vApp
+func (vAppSpec *TenantVAppSpec) vAppNetworkNames() []string {
+	networks := slices.Clone(vAppSpec.Networks)
+	for _, vm := range vAppSpec.VMs {
+		if vm.Network != "" && !slices.Contains(networks, vm.Network) {
+			networks = append(networks, vm.Network)
+		}
+	}
+	return networks
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// metadataChanges compares the desired metadata with the current entries of the GENERAL domain.
+// It returns the entries to set and, when prune is set, the keys to remove. Nil desired metadata
+// means that the metadata is not managed by the spec, so nothing is removed, while an empty map
+// removes all the entries when prune is set
+func metadataChanges(desired map[string]string, current []*types.MetadataEntry, prune bool) (map[string]string, []string) {
+	currentValues := make(map[string]string)
+	for _, entry := range current {
+		if entry.Domain != nil && entry.Domain.Domain != "" && entry.Domain.Domain != "GENERAL" {
+			continue
+		}
+		value := ""
+		if entry.TypedValue != nil {
+			value = entry.TypedValue.Value
+		}
+		currentValues[entry.Key] = value
+	}
+
+	toSet := make(map[string]string)
+	for key, value := range desired {
+		currentValue, found := currentValues[key]
+		if !found || currentValue != value {
+			toSet[key] = value
+		}
+	}
+	var toRemove []string
+	if prune && desired != nil {
+		for key := range currentValues {
+			if _, found := desired[key]; !found {
+				toRemove = append(toRemove, key)
+			}
+		}
+		sort.Strings(toRemove)
+	}
+	return toSet, toRemove
+}
+
+// metadataDetails describes metadata changes for a plan
+func metadataDetails(toSet map[string]string, toRemove []string) []string {
+	var details []string
+	for _, key := range sortedKeys(toSet) {
+		details = append(details, fmt.Sprintf("set metadata '%s'='%s'", key, toSet[key]))
+	}
+	for _, key := range toRemove {
+		details = append(details, fmt.Sprintf("remove metadata '%s'", key))
+	}
+	return details
+}
+
+// metadataValues converts string metadata to the values accepted by MergeMetadataWithMetadataValues
+func metadataValues(metadata map[string]string) map[string]types.MetadataValue {
+	values := make(map[string]types.MetadataValue, len(metadata))
+	for key, value := range metadata {
+		values[key] = types.MetadataValue{
+			Domain:     &types.MetadataDomainTag{Visibility: types.MetadataReadWriteVisibility, Domain: "GENERAL"},
+			TypedValue: &types.MetadataTypedValue{XsiType: types.MetadataStringValue, Value: value},
+		}
+	}
+	return values
+}
+
+// applyNetworkSpec sets the fields of an Org VDC network definition from the spec
+func applyNetworkSpec(spec TenantNetworkSpec, network *types.OpenApiOrgVdcNetwork) {
+	network.Name = spec.Name
+	network.Description = spec.Description
+	var ipRanges []types.OrgVdcNetworkSubnetIPRangeValues
+	for _, pool := range spec.StaticIpPools {
+		ipRanges = append(ipRanges, types.OrgVdcNetworkSubnetIPRangeValues{StartAddress: pool.Start, EndAddress: pool.End})
+	}
+	network.Subnets = types.OrgVdcNetworkSubnets{
+		Values: []types.OrgVdcNetworkSubnetValues{{
+			Gateway:      spec.Gateway,
+			PrefixLength: spec.PrefixLength,
+			DNSServer1:   spec.DnsServer1,
+			DNSServer2:   spec.DnsServer2,
+			DNSSuffix:    spec.DnsSuffix,
+			IPRanges:     types.OrgVdcNetworkSubnetIPRanges{Values: ipRanges},
+		}},
+	}
+}
+
+// networkDifferences lists the differences between the spec and an existing network. It returns
+// an error when the differences can't be applied without recreating the network
+func networkDifferences(spec TenantNetworkSpec, current *types.OpenApiOrgVdcNetwork, edgeGatewayId string) ([]string, error) {
+	currentEdgeGatewayId := ""
+	if current.Connection != nil {
+		currentEdgeGatewayId = current.Connection.RouterRef.ID
+	}
+	if currentEdgeGatewayId != edgeGatewayId {
+		return nil, fmt.Errorf("network '%s' can't be connected to a different Edge Gateway without recreating it", spec.Name)
+	}
+	if len(current.Subnets.Values) != 1 {
+		return nil, fmt.Errorf("network '%s' has %d subnets: only networks with one subnet are supported", spec.Name, len(current.Subnets.Values))
+	}
+	subnet := current.Subnets.Values[0]
+	if subnet.Gateway != spec.Gateway || subnet.PrefixLength != spec.PrefixLength {
+		return nil, fmt.Errorf("network '%s' can't change gateway from %s/%d to %s/%d without recreating it",
+			spec.Name, subnet.Gateway, subnet.PrefixLength, spec.Gateway, spec.PrefixLength)
+	}
+
+	var differences []string
+	compare := func(field, currentValue, desiredValue string) {
+		if currentValue != desiredValue {
+			differences = append(differences, fmt.Sprintf("%s: '%s' => '%s'", field, currentValue, desiredValue))
+		}
+	}
+	compare("description", current.Description, spec.Description)
+	compare("DNS server 1", subnet.DNSServer1, spec.DnsServer1)
+	compare("DNS server 2", subnet.DNSServer2, spec.DnsServer2)
+	compare("DNS suffix", subnet.DNSSuffix, spec.DnsSuffix)
+	var currentPools, desiredPools []string
+	for _, ipRange := range subnet.IPRanges.Values {
+		currentPools = append(currentPools, ipRange.StartAddress+"-"+ipRange.EndAddress)
+	}
+	for _, pool := range spec.StaticIpPools {
+		desiredPools = append(desiredPools, pool.Start+"-"+pool.End)
+	}
+	compare("static IP pools", strings.Join(currentPools, ","), strings.Join(desiredPools, ","))
+	return differences, nil
+}
+
+// natRuleFromSpec builds an NSX-T NAT rule definition
+func natRuleFromSpec(spec TenantNatRuleSpec) *types.NsxtNatRule {
+	return &types.NsxtNatRule{
+		Name:                     spec.Name,
+		Description:              spec.Description,
+		Enabled:                  !spec.Disabled,
+		Type:                     spec.RuleType,
+		ExternalAddresses:        spec.ExternalAddresses,
+		InternalAddresses:        spec.InternalAddresses,
+		DnatExternalPort:         spec.DnatExternalPort,
+		SnatDestinationAddresses: spec.SnatDestinationAddresses,
+		Logging:                  spec.Logging,
+	}
+}
+
+// natRuleDifferences lists the differences between the spec and an existing NAT rule
+func natRuleDifferences(spec TenantNatRuleSpec, current *types.NsxtNatRule) []string {
+	var differences []string
+	compare := func(field, currentValue, desiredValue string) {
+		if currentValue != desiredValue {
+			differences = append(differences, fmt.Sprintf("%s: '%s' => '%s'", field, currentValue, desiredValue))
+		}
+	}
+	currentType := current.RuleType
+	if currentType == "" {
+		currentType = current.Type
+	}
+	compare("type", currentType, spec.RuleType)
+	compare("description", current.Description, spec.Description)
+	compare("external addresses", current.ExternalAddresses, spec.ExternalAddresses)
+	compare("internal addresses", current.InternalAddresses, spec.InternalAddresses)
+	compare("DNAT external port", current.DnatExternalPort, spec.DnatExternalPort)
+	compare("SNAT destination addresses", current.SnatDestinationAddresses, spec.SnatDestinationAddresses)
+	compare("enabled", fmt.Sprint(current.Enabled), fmt.Sprint(!spec.Disabled))
+	compare("logging", fmt.Sprint(current.Logging), fmt.Sprint(spec.Logging))
+	return differences
+}
+
+// firewallRuleFromSpec builds an NSX-T firewall rule, resolving Firewall Group names with the
+// given name to ID map. When the rule exists, the fields of the spec are set on a copy of it, so
+// that the fields which the spec doesn't model (such as Application Port Profiles) are kept
+func firewallRuleFromSpec(spec TenantFirewallRuleSpec, existing *types.NsxtFirewallRule, firewallGroupIds map[string]string) (*types.NsxtFirewallRule, error) {
+	references := func(names []string) ([]types.OpenApiReference, error) {
+		var result []types.OpenApiReference
+		for _, name := range names {
+			id, found := firewallGroupIds[name]
+			if !found {
+				return nil, fmt.Errorf("firewall rule '%s' references unknown Firewall Group '%s'", spec.Name, name)
+			}
+			result = append(result, types.OpenApiReference{ID: id, Name: name})
+		}
+		return result, nil
+	}
+	sources, err := references(spec.Sources)
+	if err != nil {
+		return nil, err
+	}
+	destinations, err := references(spec.Destinations)
+	if err != nil {
+		return nil, err
+	}
+	rule := &types.NsxtFirewallRule{}
+	if existing != nil {
+		*rule = *existing
+	}
+	rule.Name = spec.Name
+	// ActionValue replaces the deprecated Action
+	rule.Action = ""
+	rule.ActionValue = valueOrDefault(spec.Action, "ALLOW")
+	rule.Enabled = !spec.Disabled
+	rule.SourceFirewallGroups = sources
+	rule.DestinationFirewallGroups = destinations
+	rule.IpProtocol = valueOrDefault(spec.IpProtocol, "IPV4_IPV6")
+	rule.Logging = spec.Logging
+	rule.Direction = valueOrDefault(spec.Direction, "IN_OUT")
+	return rule, nil
+}
+
+// desiredFirewallRules computes the list of user defined rules of an Edge Gateway. Managed rules
+// come first, in the order of the spec, followed by the unmanaged rules unless prune is set. A
+// rule of the spec manages the first current rule with its name: the following rules with the
+// same name are unmanaged.
+// It returns nil when the current rules already match
+func desiredFirewallRules(specs []TenantFirewallRuleSpec, current []*types.NsxtFirewallRule, firewallGroupIds map[string]string, prune bool) ([]*types.NsxtFirewallRule, []string, error) {
+	currentByName := make(map[string]*types.NsxtFirewallRule)
+	for _, rule := range current {
+		if _, found := currentByName[rule.Name]; !found {
+			currentByName[rule.Name] = rule
+		}
+	}
+
+	var rules []*types.NsxtFirewallRule
+	var details []string
+	managed := make(map[*types.NsxtFirewallRule]bool)
+	for _, spec := range specs {
+		existing, found := currentByName[spec.Name]
+		// The existing rule keeps its ID, so that it is updated instead of replaced
+		rule, err := firewallRuleFromSpec(spec, existing, firewallGroupIds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			details = append(details, fmt.Sprintf("create rule '%s'", spec.Name))
+		} else {
+			managed[existing] = true
+			if !firewallRulesEqual(rule, existing) {
+				details = append(details, fmt.Sprintf("update rule '%s'", spec.Name))
+			}
+		}
+		rules = append(rules, rule)
+	}
+	for _, rule := range current {
+		if managed[rule] {
+			continue
+		}
+		if prune {
+			details = append(details, fmt.Sprintf("delete rule '%s'", rule.Name))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(details) == 0 {
+		var currentNames, desiredNames []string
+		for _, rule := range current {
+			currentNames = append(currentNames, rule.Name)
+		}
+		for _, rule := range rules {
+			desiredNames = append(desiredNames, rule.Name)
+		}
+		if slices.Equal(currentNames, desiredNames) {
+			return nil, nil, nil
+		}
+		details = append(details, "reorder rules")
+	}
+	return rules, details, nil
+}
+
+func firewallRulesEqual(desired, current *types.NsxtFirewallRule) bool {
+	currentAction := current.ActionValue
+	if currentAction == "" {
+		currentAction = current.Action
+	}
+	groupIds := func(references []types.OpenApiReference) []string {
+		var ids []string
+		for _, reference := range references {
+			ids = append(ids, reference.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	return desired.ActionValue == currentAction &&
+		desired.Enabled == current.Enabled &&
+		desired.IpProtocol == current.IpProtocol &&
+		desired.Direction == current.Direction &&
+		desired.Logging == current.Logging &&
+		slices.Equal(groupIds(desired.SourceFirewallGroups), groupIds(current.SourceFirewallGroups)) &&
+		slices.Equal(groupIds(desired.DestinationFirewallGroups), groupIds(current.DestinationFirewallGroups))
+}
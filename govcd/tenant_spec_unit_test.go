@@ -0,0 +1,289 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_ParseTenantSpec(t *testing.T) {
+	spec, err := ParseTenantSpec([]byte(`
+org: my-org
+vdc: my-vdc
+metadata:
+  owner: team-a
+networks:
+  - name: web
+    edgeGateway: edge
+    gateway: 10.10.10.1
+    prefixLength: 24
+    staticIpPools:
+      - start: 10.10.10.10
+        end: 10.10.10.20
+edgeGateways:
+  - name: edge
+    natRules:
+      - name: web-dnat
+        ruleType: DNAT
+        externalAddresses: 1.1.1.1
+        internalAddresses: 10.10.10.10
+catalogs:
+  - name: templates
+vApps:
+  - name: app
+    vms:
+      - name: vm1
+        catalog: templates
+        template: photon
+        network: web
+        cpus: 2
+        memoryMb: 2048
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spec.Org != "my-org" || spec.Vdc != "my-vdc" || spec.Metadata["owner"] != "team-a" {
+		t.Errorf("unexpected top level fields: %+v", spec)
+	}
+	if len(spec.Networks) != 1 || spec.Networks[0].PrefixLength != 24 || len(spec.Networks[0].StaticIpPools) != 1 {
+		t.Errorf("unexpected networks: %+v", spec.Networks)
+	}
+	if len(spec.VApps) != 1 || len(spec.VApps[0].VMs) != 1 || spec.VApps[0].VMs[0].MemoryMb != 2048 {
+		t.Errorf("unexpected vApps: %+v", spec.VApps)
+	}
+	if networks := spec.VApps[0].vAppNetworkNames(); !reflect.DeepEqual(networks, []string{"web"}) {
+		t.Errorf("expected vApp networks [web], got %v", networks)
+	}
+
+	_, err = ParseTenantSpec([]byte("org: my-org\nvdc: my-vdc\nunknown: field\n"))
+	if err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func Test_TenantSpecValidate(t *testing.T) {
+	spec := &TenantSpec{
+		Vdc: "my-vdc",
+		Networks: []TenantNetworkSpec{
+			{Name: "net", Gateway: "10.0.0.1", PrefixLength: 24},
+			{Name: "net", Gateway: "10.0.1.1", PrefixLength: 24},
+			{Name: "no-gateway"},
+		},
+		EdgeGateways: []TenantEdgeGatewaySpec{
+			{Name: "edge", NatRules: []TenantNatRuleSpec{{Name: "rule"}}},
+		},
+		VApps: []TenantVAppSpec{
+			{Name: "app", VMs: []TenantVmSpec{{Name: "vm"}, {Catalog: "cat", Template: "tmpl"}}},
+		},
+	}
+	err := spec.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, expected := range []string{
+		"missing Org name",
+		"duplicate network 'net'",
+		"network 'no-gateway' requires gateway and prefix length",
+		"NAT rule 'rule' of Edge Gateway 'edge' requires a rule type",
+		"VM 'vm' in vApp 'app' requires catalog and template",
+		"VM in vApp 'app' without name",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got: %s", expected, err)
+		}
+	}
+}
+
+func Test_metadataChanges(t *testing.T) {
+	current := []*types.MetadataEntry{
+		{Key: "same", TypedValue: &types.MetadataTypedValue{Value: "1"}},
+		{Key: "changed", TypedValue: &types.MetadataTypedValue{Value: "old"}},
+		{Key: "extra", TypedValue: &types.MetadataTypedValue{Value: "x"}},
+		{Key: "system", Domain: &types.MetadataDomainTag{Domain: "SYSTEM"}, TypedValue: &types.MetadataTypedValue{Value: "s"}},
+	}
+	desired := map[string]string{"same": "1", "changed": "new", "added": "a"}
+
+	toSet, toRemove := metadataChanges(desired, current, false)
+	if !reflect.DeepEqual(toSet, map[string]string{"changed": "new", "added": "a"}) {
+		t.Errorf("unexpected entries to set: %v", toSet)
+	}
+	if len(toRemove) != 0 {
+		t.Errorf("expected no entries to remove without prune, got %v", toRemove)
+	}
+
+	_, toRemove = metadataChanges(desired, current, true)
+	if !reflect.DeepEqual(toRemove, []string{"extra"}) {
+		t.Errorf("expected to remove [extra], got %v", toRemove)
+	}
+
+	// Metadata missing from the spec is not managed, while an empty map clears it
+	toSet, toRemove = metadataChanges(nil, current, true)
+	if len(toSet) != 0 || len(toRemove) != 0 {
+		t.Errorf("expected no changes for unmanaged metadata, got %v, %v", toSet, toRemove)
+	}
+	_, toRemove = metadataChanges(map[string]string{}, current, true)
+	sort.Strings(toRemove)
+	if !reflect.DeepEqual(toRemove, []string{"changed", "extra", "same"}) {
+		t.Errorf("expected to remove all GENERAL entries, got %v", toRemove)
+	}
+	spec, err := ParseTenantSpec([]byte("org: org\nvdc: vdc\nmetadata: {}\ncatalogs:\n- name: cat\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spec.Metadata == nil || spec.Catalogs[0].Metadata != nil {
+		t.Errorf("expected empty VDC metadata and nil catalog metadata, got %v, %v", spec.Metadata, spec.Catalogs[0].Metadata)
+	}
+}
+
+func Test_networkDifferences(t *testing.T) {
+	spec := TenantNetworkSpec{
+		Name:          "net",
+		Gateway:       "10.0.0.1",
+		PrefixLength:  24,
+		DnsServer1:    "8.8.8.8",
+		StaticIpPools: []TenantIpRangeSpec{{Start: "10.0.0.10", End: "10.0.0.20"}},
+	}
+	current := &types.OpenApiOrgVdcNetwork{Name: "net"}
+	applyNetworkSpec(spec, current)
+
+	differences, err := networkDifferences(spec, current, "")
+	if err != nil || len(differences) != 0 {
+		t.Errorf("expected no differences, got %v, %v", differences, err)
+	}
+
+	spec.DnsServer1 = "1.1.1.1"
+	spec.Description = "changed"
+	differences, err = networkDifferences(spec, current, "")
+	if err != nil || len(differences) != 2 {
+		t.Errorf("expected 2 differences, got %v, %v", differences, err)
+	}
+
+	_, err = networkDifferences(spec, current, "urn:vcloud:gateway:1")
+	if err == nil {
+		t.Errorf("expected error when changing the Edge Gateway")
+	}
+	spec.PrefixLength = 16
+	_, err = networkDifferences(spec, current, "")
+	if err == nil {
+		t.Errorf("expected error when changing the subnet")
+	}
+}
+
+func Test_natRuleDifferences(t *testing.T) {
+	spec := TenantNatRuleSpec{Name: "rule", RuleType: types.NsxtNatRuleTypeDnat, ExternalAddresses: "1.1.1.1", InternalAddresses: "10.0.0.1"}
+	current := natRuleFromSpec(spec)
+	current.RuleType = current.Type
+	if differences := natRuleDifferences(spec, current); len(differences) != 0 {
+		t.Errorf("expected no differences, got %v", differences)
+	}
+	spec.Disabled = true
+	spec.InternalAddresses = "10.0.0.2"
+	if differences := natRuleDifferences(spec, current); len(differences) != 2 {
+		t.Errorf("expected 2 differences, got %v", differences)
+	}
+}
+
+func Test_desiredFirewallRules(t *testing.T) {
+	groupIds := map[string]string{"web": "group-web", "any-internal": "group-internal"}
+	specs := []TenantFirewallRuleSpec{
+		{Name: "allow-web", Destinations: []string{"web"}},
+		{Name: "drop-internal", Action: "DROP", Sources: []string{"any-internal"}},
+	}
+	managedRules := func() []*types.NsxtFirewallRule {
+		var rules []*types.NsxtFirewallRule
+		for i, spec := range specs {
+			rule, err := firewallRuleFromSpec(spec, nil, groupIds)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			rule.ID = []string{"id-1", "id-2"}[i]
+			rules = append(rules, rule)
+		}
+		return rules
+	}
+	unmanaged := &types.NsxtFirewallRule{ID: "id-3", Name: "manual", ActionValue: "ALLOW", IpProtocol: "IPV4", Direction: "IN"}
+
+	// Matching state produces no changes
+	current := append(managedRules(), unmanaged)
+	rules, details, err := desiredFirewallRules(specs, current, groupIds, false)
+	if err != nil || rules != nil || details != nil {
+		t.Errorf("expected no changes, got %v, %v, %v", rules, details, err)
+	}
+
+	// Prune removes the unmanaged rule
+	rules, details, err = desiredFirewallRules(specs, current, groupIds, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 || !reflect.DeepEqual(details, []string{"delete rule 'manual'"}) {
+		t.Errorf("unexpected prune result: %v, %v", rules, details)
+	}
+
+	// Managed rules are moved on top, keeping their IDs
+	current = append([]*types.NsxtFirewallRule{unmanaged}, managedRules()...)
+	rules, details, err = desiredFirewallRules(specs, current, groupIds, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(details, []string{"reorder rules"}) || rules[0].ID != "id-1" || rules[2].ID != "id-3" {
+		t.Errorf("unexpected reorder result: %v, %v", rules, details)
+	}
+
+	// Changed and missing rules
+	current = managedRules()[:1]
+	current[0].ActionValue = "REJECT"
+	_, details, err = desiredFirewallRules(specs, current, groupIds, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(details, []string{"update rule 'allow-web'", "create rule 'drop-internal'"}) {
+		t.Errorf("unexpected details: %v", details)
+	}
+
+	// Fields which are not in the spec are kept, also when other rules change
+	current = managedRules()
+	current[0].ApplicationPortProfiles = []types.OpenApiReference{{ID: "profile-https", Name: "HTTPS"}}
+	current[0].Comments = "web traffic"
+	current[0].DestinationGroupsExcluded = addrOf(true)
+	current[1].Enabled = false
+	rules, details, err = desiredFirewallRules(specs, current, groupIds, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(details, []string{"update rule 'drop-internal'"}) {
+		t.Errorf("unexpected details: %v", details)
+	}
+	if !reflect.DeepEqual(rules[0], current[0]) {
+		t.Errorf("expected unchanged rule %+v, got %+v", current[0], rules[0])
+	}
+
+	// Rules sharing the name of a managed rule are unmanaged
+	duplicate := &types.NsxtFirewallRule{ID: "id-4", Name: "allow-web", ActionValue: "DROP", IpProtocol: "IPV4", Direction: "IN"}
+	current = append(managedRules(), duplicate)
+	rules, details, err = desiredFirewallRules(specs, current, groupIds, false)
+	if err != nil || rules != nil || details != nil {
+		t.Errorf("expected no changes with duplicate name, got %v, %v, %v", rules, details, err)
+	}
+	rules, details, err = desiredFirewallRules(specs, current, groupIds, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 || rules[0].ID != "id-1" || !reflect.DeepEqual(details, []string{"delete rule 'allow-web'"}) {
+		t.Errorf("unexpected prune result with duplicate name: %v, %v", rules, details)
+	}
+
+	// Unknown Firewall Groups are reported
+	_, _, err = desiredFirewallRules([]TenantFirewallRuleSpec{{Name: "bad", Sources: []string{"missing"}}}, nil, groupIds, false)
+	if err == nil {
+		t.Errorf("expected error for unknown Firewall Group")
+	}
+}
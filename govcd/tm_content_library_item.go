@@ -5,10 +5,12 @@
 package govcd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/vmware/go-vcloud-director/v3/types/v56"
 	"github.com/vmware/go-vcloud-director/v3/util"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -33,6 +35,10 @@ type ContentLibraryItemUploadArguments struct {
 	FilePath        string   // Path to the main file to upload
 	OvfFilesPaths   []string // OVF only: Path to the files referenced by the OVF
 	UploadPieceSize int64    // When uploading big files, the payloads are divided into chunks of this size in bytes. Defaults to 'defaultPieceSize'
+	// StateFile, when set, makes the upload resumable: the progress is recorded in this file and the Content Library Item is
+	// kept when the upload fails. Creating the item again with the same arguments continues the upload from the bytes
+	// already received by TM. The file is removed once the upload is complete
+	StateFile string
 }
 
 // wrap is a hidden helper that facilitates the usage of a generic CRUD function
@@ -59,6 +65,28 @@ func (cl *ContentLibrary) CreateContentLibraryItem(config *types.ContentLibraryI
 		}
 	}
 
+	var state *UploadState
+	sourcePath := ""
+	if args.StateFile != "" {
+		var err error
+		state, err = LoadUploadState(args.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		sourcePath, err = filepath.Abs(cleanFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resuming := state != nil && state.IsStarted()
+	// A resumable upload keeps the Content Library Item on failure, so that it can be resumed
+	onError := func(identifier string, err error) error {
+		if state != nil {
+			return err
+		}
+		return cleanupContentLibraryItemOnUploadError(cl, identifier, err)
+	}
+
 	// Only OVA files have all the required files packed inside, so we need to extract and process them
 	if filepath.Ext(cleanFilePath) == ".ova" {
 		ovaInnerFilesPaths, tmpDir, err := util.Unpack(args.FilePath)
@@ -87,29 +115,51 @@ func (cl *ContentLibrary) CreateContentLibraryItem(config *types.ContentLibraryI
 		return nil, fmt.Errorf("%s is not a valid ISO/OVF file", args.FilePath)
 	}
 
-	// Create the "skeleton" of the Content Library Item. This is empty, we need to send the files afterward
-	cli, err := createContentLibraryItem(cl, config, args.FilePath)
-	if err != nil {
-		if cli == nil || cli.ContentLibraryItem == nil {
+	var cli *ContentLibraryItem
+	var err error
+	if resuming {
+		err = state.checkResumable(UploadKindContentLibraryItem, config.Name, sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		cli, err = cl.GetContentLibraryItemById(state.ItemHref)
+		if err != nil {
 			return nil, err
 		}
-		// We use Name for cleanup because ID may or may not be available
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.Name, err)
+	} else {
+		// Create the "skeleton" of the Content Library Item. This is empty, we need to send the files afterward
+		cli, err = createContentLibraryItem(cl, config, args.FilePath)
+		if err != nil {
+			if cli == nil || cli.ContentLibraryItem == nil {
+				return nil, err
+			}
+			// We use Name for cleanup because ID may or may not be available
+			return nil, onError(cli.ContentLibraryItem.Name, err)
+		}
+		if state != nil {
+			err = state.start(UploadKindContentLibraryItem, config.Name, cli.ContentLibraryItem.ID, sourcePath)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// Get the files that need to be uploaded after creation, this should always return 1: Either the ISO file or the "descriptor.ovf"
+	// Get the files that need to be uploaded after creation, this should always return 1: Either the ISO file or the "descriptor.ovf".
+	// A resumed upload may return more, when the "descriptor.ovf" was already uploaded
 	filesToUpload, err := getContentLibraryItemPendingFilesToUpload(cli, 1, retriesForPollingContentLibraryItemFilesToUpload)
 	if err != nil {
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+		return nil, onError(cli.ContentLibraryItem.ID, err)
 	}
-	if len(filesToUpload) != 1 {
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, fmt.Errorf("expected 1 %s File to upload, got %d", labelContentLibraryItem, len(filesToUpload)))
+	if len(filesToUpload) != 1 && !resuming {
+		return nil, onError(cli.ContentLibraryItem.ID, fmt.Errorf("expected 1 %s File to upload, got %d", labelContentLibraryItem, len(filesToUpload)))
 	}
 
 	// Upload either the requested ISO file or the "descriptor.ovf"
-	err = uploadContentLibraryItemFile(&cl.vcdClient.Client, filesToUpload[0], []string{args.FilePath}, args.UploadPieceSize)
-	if err != nil {
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+	if len(filesToUpload) == 1 && !isContentLibraryItemFileUploaded(filesToUpload[0]) {
+		err = uploadContentLibraryItemFile(&cl.vcdClient.Client, filesToUpload[0], []string{args.FilePath}, args.UploadPieceSize, state)
+		if err != nil {
+			return nil, onError(cli.ContentLibraryItem.ID, err)
+		}
 	}
 
 	if cli.ContentLibraryItem.ItemType == "TEMPLATE" {
@@ -117,19 +167,19 @@ func (cl *ContentLibrary) CreateContentLibraryItem(config *types.ContentLibraryI
 		// Refresh the file list and upload each one of them.
 		filesToUpload, err = getContentLibraryItemPendingFilesToUpload(cli, 2, retriesForPollingContentLibraryItemFilesToUpload)
 		if err != nil {
-			return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+			return nil, onError(cli.ContentLibraryItem.ID, err)
 		}
 		if len(filesToUpload) < 1 {
-			return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, fmt.Errorf("expected at least 1 file to upload during OVA processing, got %d", len(filesToUpload)))
+			return nil, onError(cli.ContentLibraryItem.ID, fmt.Errorf("expected at least 1 file to upload during OVA processing, got %d", len(filesToUpload)))
 		}
 
 		for _, fileToUpload := range filesToUpload {
-			if fileToUpload.BytesTransferred != 0 && fileToUpload.ExpectedSizeBytes == fileToUpload.BytesTransferred {
+			if isContentLibraryItemFileUploaded(fileToUpload) {
 				continue
 			}
-			err = uploadContentLibraryItemFile(&cl.vcdClient.Client, fileToUpload, args.OvfFilesPaths, args.UploadPieceSize)
+			err = uploadContentLibraryItemFile(&cl.vcdClient.Client, fileToUpload, args.OvfFilesPaths, args.UploadPieceSize, state)
 			if err != nil {
-				return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+				return nil, onError(cli.ContentLibraryItem.ID, err)
 			}
 		}
 	}
@@ -147,24 +197,34 @@ func (cl *ContentLibrary) CreateContentLibraryItem(config *types.ContentLibraryI
 		return nil
 	})
 	if err != nil {
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+		return nil, onError(cli.ContentLibraryItem.ID, err)
+	}
+	if state != nil {
+		state.complete()
 	}
 
 	// Return the created Content Library Item
-	cli, err = cl.GetContentLibraryItemById(cli.ContentLibraryItem.ID)
+	id := cli.ContentLibraryItem.ID
+	cli, err = cl.GetContentLibraryItemById(id)
 	if err != nil {
-		return nil, cleanupContentLibraryItemOnUploadError(cl, cli.ContentLibraryItem.ID, err)
+		return nil, onError(id, err)
 	}
 	return cli, nil
 }
 
+// isContentLibraryItemFileUploaded returns true when TM received the whole file
+func isContentLibraryItemFileUploaded(file *types.ContentLibraryItemFile) bool {
+	return file.BytesTransferred != 0 && file.ExpectedSizeBytes == file.BytesTransferred
+}
+
 // uploadContentLibraryItemFile uploads a single Content Library Item File that must be present in one of the given paths and is
 // requested by VCFA.
-func uploadContentLibraryItemFile(client *Client, fileToUpload *types.ContentLibraryItemFile, filePaths []string, uploadPieceSize int64) error {
+// When state is not nil, the upload continues from the bytes already received by TM and its progress is recorded.
+func uploadContentLibraryItemFile(client *Client, fileToUpload *types.ContentLibraryItemFile, filePaths []string, uploadPieceSize int64, state *UploadState) error {
 	if fileToUpload == nil || len(filePaths) == 0 {
 		return fmt.Errorf("the Content Library Item or its files cannot be nil / empty")
 	}
-	if fileToUpload.BytesTransferred != 0 && fileToUpload.ExpectedSizeBytes == fileToUpload.BytesTransferred {
+	if isContentLibraryItemFileUploaded(fileToUpload) {
 		return fmt.Errorf("the file %s is already uploaded", fileToUpload.Name)
 	}
 
@@ -180,7 +240,7 @@ func uploadContentLibraryItemFile(client *Client, fileToUpload *types.ContentLib
 		if isOvf && filepath.Ext(filePath) != ".ovf" {
 			continue
 		}
-		_, err := uploadFile(client, filePath, uploadDetails{
+		details := uploadDetails{
 			uploadLink:               fileToUpload.TransferUrl,
 			uploadedBytes:            0,
 			fileSizeToUpload:         fileToUpload.ExpectedSizeBytes,
@@ -191,7 +251,14 @@ func uploadContentLibraryItemFile(client *Client, fileToUpload *types.ContentLib
 				util.Logger.Printf("[DEBUG] Uploaded Content Library Item file '%s': %d/%d", fileToUpload.Name, bytesUpload, totalSize)
 			},
 			uploadError: addrOf(fmt.Errorf("error uploading Content Library Item file '%s'", fileToUpload.Name)),
-		})
+		}
+		applyUploadSettings(client, &details)
+		if state != nil {
+			details.fileOffset = state.resumeOffset(fileToUpload.Name, fileToUpload.BytesTransferred)
+			details.onProgress = state.fileProgress(fileToUpload.Name, fileToUpload.TransferUrl, fileToUpload.ExpectedSizeBytes)
+			details.pieceRetries = uploadPieceRetries
+		}
+		_, err := uploadFile(client, filePath, details)
 		if err != nil {
 			return err
 		}
@@ -419,3 +486,43 @@ func (cli *ContentLibraryItem) Delete() error {
 	}
 	return deleteEntityById(&cli.vcdClient.Client, c)
 }
+
+// DownloadFileTo streams the file with the given name of the Content Library Item to the writer,
+// using the transfer URL that TM reports for the file. It returns the number of bytes held by the writer
+// at the end. See DownloadOptions to resume the download, follow its progress and verify its checksum
+func (cli *ContentLibraryItem) DownloadFileTo(ctx context.Context, fileName string, writer io.Writer, options *DownloadOptions) (int64, error) {
+	file, err := cli.getDownloadableFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return downloadTransferUrl(ctx, &cli.vcdClient.Client, file.TransferUrl, writer, options)
+}
+
+// DownloadFileToFile downloads the file with the given name of the Content Library Item to a local file
+// and returns its size. With options.Resume, an existing partial file is completed instead of being overwritten
+func (cli *ContentLibraryItem) DownloadFileToFile(ctx context.Context, fileName, filePath string, options *DownloadOptions) (int64, error) {
+	file, err := cli.getDownloadableFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return downloadTransferUrlToFile(ctx, &cli.vcdClient.Client, file.TransferUrl, filePath, options)
+}
+
+// getDownloadableFile retrieves the file with the given name of the Content Library Item, which must be
+// completely uploaded
+func (cli *ContentLibraryItem) getDownloadableFile(fileName string) (*types.ContentLibraryItemFile, error) {
+	files, err := getContentLibraryItemFiles(cli)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name != fileName {
+			continue
+		}
+		if file.TransferUrl == "" || file.BytesTransferred != file.ExpectedSizeBytes {
+			return nil, fmt.Errorf("file '%s' of %s '%s' is not available for download", fileName, labelContentLibraryItem, cli.ContentLibraryItem.Name)
+		}
+		return file, nil
+	}
+	return nil, fmt.Errorf("file '%s' not found in %s '%s': %s", fileName, labelContentLibraryItem, cli.ContentLibraryItem.Name, ErrorEntityNotFound)
+}
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/vmware/go-vcloud-director/v3/types/v56"
 	"github.com/vmware/go-vcloud-director/v3/util"
@@ -47,11 +48,23 @@ func (p *mutexedProgress) LockedGet() float64 {
 // uploadedBytesForCallback all uploaded bytes if multi disk in ova
 // allFilesSize overall sum of size if multi disk in ova
 // callBack a function with signature //function(bytesUpload, totalSize) to let the caller monitor progress of the upload operation.
+// fileOffset - how much of the local file was already received by the transfer service, when resuming an upload
+// onProgress - when set, receives the bytes of the file received by the transfer service after each piece
+// pieceRetries - how many times a piece is sent again after a failure
+// parallelRanges - how many pieces of the file are sent at the same time
+// limiter - when set, limits the bandwidth of the upload
+// sharedProgress - when set, aggregates the progress of parallel uploads instead of uploadedBytesForCallback
 type uploadDetails struct {
 	uploadLink                                                                               string
 	uploadedBytes, fileSizeToUpload, uploadPieceSize, uploadedBytesForCallback, allFilesSize int64
 	callBack                                                                                 func(bytesUpload, totalSize int64)
 	uploadError                                                                              *error
+	fileOffset                                                                               int64
+	onProgress                                                                               func(uploadedBytes int64)
+	pieceRetries                                                                             int
+	parallelRanges                                                                           int
+	limiter                                                                                  *bandwidthLimiter
+	sharedProgress                                                                           *uploadProgress
 }
 
 // Upload file by parts which size is defined by user provided variable uploadPieceSize and
@@ -63,10 +76,6 @@ type uploadDetails struct {
 func uploadFile(client *Client, filePath string, uDetails uploadDetails) (int64, error) {
 	util.Logger.Printf("[TRACE] Starting uploading: %s, offset: %v, fileze: %v, toLink: %s \n", filePath, uDetails.uploadedBytes, uDetails.fileSizeToUpload, uDetails.uploadLink)
 
-	var part []byte
-	var count int
-	var pieceSize int64
-
 	file, err := os.Open(filepath.Clean(filePath))
 	if err != nil {
 		util.Logger.Printf("[ERROR] during upload process - file open issue : %s, error %s ", filePath, err)
@@ -95,40 +104,38 @@ func uploadFile(client *Client, filePath string, uDetails uploadDetails) (int64,
 			uDetails.fileSizeToUpload, fileSize)
 	}
 
-	// do not allow smaller than 1kb
-	if uDetails.uploadPieceSize > 1024 && uDetails.uploadPieceSize < uDetails.fileSizeToUpload {
-		pieceSize = uDetails.uploadPieceSize
-	} else {
-		pieceSize = defaultPieceSize
-	}
+	pieceSize := uploadPieceSizeFor(uDetails.uploadPieceSize, uDetails.fileSizeToUpload)
 
-	util.Logger.Printf("[TRACE] Uploading will use piece size: %#v \n", pieceSize)
-	part = make([]byte, pieceSize)
-
-	for {
-		if count, err = io.ReadFull(file, part); err != nil {
-			break
+	// when resuming, the part of the file already received is skipped
+	if uDetails.fileOffset > 0 {
+		if uDetails.fileOffset >= fileSize {
+			util.Logger.Printf("[TRACE] File %s was already uploaded\n", filePath)
+			if uDetails.sharedProgress != nil {
+				uDetails.sharedProgress.add(fileSize, uDetails)
+			}
+			return fileSize, nil
 		}
-		err = uploadPartFile(client, part, int64(count), uDetails)
-		uDetails.uploadedBytes += int64(count)
-		uDetails.uploadedBytesForCallback += int64(count)
+		_, err = file.Seek(uDetails.fileOffset, io.SeekStart)
 		if err != nil {
-			util.Logger.Printf("[ERROR] during upload process: %s, error %s ", filePath, err)
 			*uDetails.uploadError = err
 			return 0, err
 		}
+		uDetails.uploadedBytes += uDetails.fileOffset
+		uDetails.uploadedBytesForCallback += uDetails.fileOffset
+		if uDetails.sharedProgress != nil {
+			uDetails.sharedProgress.add(uDetails.fileOffset, uDetails)
+		}
+		util.Logger.Printf("[TRACE] Resuming upload of %s from byte %d\n", filePath, uDetails.fileOffset)
 	}
 
-	// upload last part as ReadFull returns io.ErrUnexpectedEOF when reaches end of file.
-	if err == io.ErrUnexpectedEOF {
-		err = uploadPartFile(client, part[:count], int64(count), uDetails)
-		if err != nil {
-			util.Logger.Printf("[ERROR] during upload process: %s, error %s ", filePath, err)
-			*uDetails.uploadError = err
-			return 0, err
-		}
+	util.Logger.Printf("[TRACE] Uploading will use piece size: %#v \n", pieceSize)
+	if uDetails.parallelRanges > 1 {
+		err = uploadFileRanges(client, file, fileSize, pieceSize, uDetails)
 	} else {
-		util.Logger.Printf("Error Uploading: %s, error %s ", filePath, err)
+		_, err = uploadStream(client, file, pieceSize, uDetails)
+	}
+	if err != nil {
+		util.Logger.Printf("[ERROR] during upload process: %s, error %s ", filePath, err)
 		*uDetails.uploadError = err
 		return 0, err
 	}
@@ -136,6 +143,47 @@ func uploadFile(client *Client, filePath string, uDetails uploadDetails) (int64,
 	return fileSize, nil
 }
 
+// uploadStream uploads the content of the reader piece by piece, starting at uDetails.uploadedBytes
+// in the uploaded file. It returns the number of bytes read from the reader and uploaded
+func uploadStream(client *Client, reader io.Reader, pieceSize int64, uDetails uploadDetails) (int64, error) {
+	var uploaded int64
+	part := make([]byte, pieceSize)
+	for {
+		// ReadFull returns io.ErrUnexpectedEOF for the last part, and io.EOF when the content
+		// ended with the previous part
+		count, err := io.ReadFull(reader, part)
+		if err == io.EOF {
+			return uploaded, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return uploaded, err
+		}
+		uploadErr := uploadPartFile(client, part[:count], int64(count), uDetails)
+		if uploadErr != nil {
+			return uploaded, uploadErr
+		}
+		uploaded += int64(count)
+		uDetails.uploadedBytes += int64(count)
+		uDetails.uploadedBytesForCallback += int64(count)
+		if uDetails.onProgress != nil {
+			uDetails.onProgress(uDetails.uploadedBytes)
+		}
+		if err == io.ErrUnexpectedEOF {
+			return uploaded, nil
+		}
+	}
+}
+
+// uploadPieceSizeFor returns the requested piece size, or the default one when the requested size
+// is too small or larger than the file
+func uploadPieceSizeFor(requested, fileSize int64) int64 {
+	// do not allow smaller than 1kb
+	if requested > 1024 && requested < fileSize {
+		return requested
+	}
+	return defaultPieceSize
+}
+
 // Create Request with right headers and range settings. Support multi part file upload.
 // client - client for requests
 // requestUrl - upload url
@@ -174,12 +222,39 @@ func newFileUploadRequest(client *Client, requestUrl string, filePart []byte, of
 // partDataSize - how much bytes will be uploaded
 // uploadDetails - file upload settings and data
 func uploadPartFile(client *Client, part []byte, partDataSize int64, uDetails uploadDetails) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = sendFilePart(client, part, partDataSize, uDetails)
+		if err == nil || attempt >= uDetails.pieceRetries {
+			break
+		}
+		util.Logger.Printf("[DEBUG] upload of bytes %d-%d failed, retrying: %s", uDetails.uploadedBytes, uDetails.uploadedBytes+partDataSize-1, err)
+		time.Sleep(uploadPieceRetryInterval)
+	}
+	if err != nil {
+		return err
+	}
+
+	if uDetails.sharedProgress != nil {
+		uDetails.sharedProgress.add(partDataSize, uDetails)
+	} else {
+		uDetails.callBack(uDetails.uploadedBytesForCallback+partDataSize, uDetails.allFilesSize)
+	}
+
+	return nil
+}
+
+// sendFilePart sends a file part to the transfer service
+func sendFilePart(client *Client, part []byte, partDataSize int64, uDetails uploadDetails) error {
 	// Avoids session time out, as the multi part upload is treated as one request
 	makeEmptyRequest(client)
 	request, err := newFileUploadRequest(client, uDetails.uploadLink, part, uDetails.uploadedBytes, partDataSize, uDetails.fileSizeToUpload)
 	if err != nil {
 		return err
 	}
+	if uDetails.limiter != nil {
+		request.Body = io.NopCloser(uDetails.limiter.reader(bytes.NewReader(part)))
+	}
 
 	response, err := checkResp(client.Http.Do(request))
 	if err != nil {
@@ -189,9 +264,6 @@ func uploadPartFile(client *Client, part []byte, partDataSize int64, uDetails up
 	if err != nil {
 		return fmt.Errorf("file closing failed. Err: %s", err)
 	}
-
-	uDetails.callBack(uDetails.uploadedBytesForCallback+partDataSize, uDetails.allFilesSize)
-
 	return nil
 }
 
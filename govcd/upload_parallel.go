@@ -0,0 +1,196 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// UploadSettings configure how the files of OVF packages, media and Content Library Items are sent
+// to the transfer service. The zero value uploads one piece at a time without bandwidth limit
+type UploadSettings struct {
+	// ParallelFiles is the number of files of an OVF package uploaded at the same time
+	ParallelFiles int
+	// ParallelRanges is the number of pieces of a single file uploaded at the same time. Pieces are
+	// then received out of order, which the transfer service must accept
+	ParallelRanges int
+	// MaxBytesPerSecond limits the bandwidth used by each upload operation, over all its parallel
+	// transfers. 0 means unlimited
+	MaxBytesPerSecond int64
+}
+
+// validate checks that the settings are not negative
+func (settings UploadSettings) validate() error {
+	if settings.ParallelFiles < 0 || settings.ParallelRanges < 0 || settings.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("upload settings can't be negative: %+v", settings)
+	}
+	return nil
+}
+
+// applyUploadSettings sets the parallelism and the bandwidth limit of the client in the details of
+// a file upload. A limiter already set in the details, shared between files, is kept
+func applyUploadSettings(client *Client, details *uploadDetails) {
+	details.parallelRanges = client.UploadSettings.ParallelRanges
+	if details.limiter == nil {
+		details.limiter = newBandwidthLimiter(client.UploadSettings.MaxBytesPerSecond)
+	}
+}
+
+// uploadProgress aggregates the bytes uploaded by parallel transfers and reports them to the
+// progress callback in order
+type uploadProgress struct {
+	mutex    sync.Mutex
+	uploaded int64
+}
+
+func (progress *uploadProgress) add(bytes int64, details uploadDetails) {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.uploaded += bytes
+	details.callBack(progress.uploaded, details.allFilesSize)
+}
+
+// throttleChunkSize is the largest amount of bytes read at once by a throttled reader
+const throttleChunkSize = 32 * 1024
+
+// bandwidthLimiter spreads the bytes sent by all the transfers sharing it over time
+type bandwidthLimiter struct {
+	mutex          sync.Mutex
+	bytesPerSecond int64
+	next           time.Time
+}
+
+// newBandwidthLimiter returns a limiter for the given bandwidth, or nil when it is unlimited
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until the given amount of bytes may be sent
+func (limiter *bandwidthLimiter) wait(bytes int) {
+	if limiter == nil || bytes <= 0 {
+		return
+	}
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(int64(bytes) * int64(time.Second) / limiter.bytesPerSecond))
+	limiter.mutex.Unlock()
+	time.Sleep(delay)
+}
+
+// reader returns a reader which reads at the bandwidth of the limiter
+func (limiter *bandwidthLimiter) reader(reader io.Reader) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	return &throttledReader{reader: reader, limiter: limiter}
+}
+
+type throttledReader struct {
+	reader  io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (throttled *throttledReader) Read(content []byte) (int, error) {
+	if len(content) > throttleChunkSize {
+		content = content[:throttleChunkSize]
+	}
+	read, err := throttled.reader.Read(content)
+	throttled.limiter.wait(read)
+	return read, err
+}
+
+// runParallel runs the jobs with at most 'concurrency' of them at the same time. Once a job fails,
+// the jobs which did not start yet are skipped. It returns the errors of all failed jobs
+func runParallel(concurrency int, jobs []func() error) error {
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		errs      []error
+		failed    atomic.Bool
+		semaphore = make(chan struct{}, max(concurrency, 1))
+	)
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if failed.Load() {
+				return
+			}
+			err := job()
+			if err != nil {
+				failed.Store(true)
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// uploadFileRanges uploads the pieces of a file in parallel, starting from the current offset of
+// the upload details. The progress recorded by details.onProgress is the contiguous part of the
+// file received by the transfer service
+func uploadFileRanges(client *Client, file *os.File, fileSize, pieceSize int64, uDetails uploadDetails) error {
+	// uploadedBytes is the offset of the file in the uploaded content, which differs from the
+	// offset in the local file for chunked files
+	rangeBase := uDetails.uploadedBytes - uDetails.fileOffset
+	if uDetails.sharedProgress == nil {
+		uDetails.sharedProgress = &uploadProgress{uploaded: uDetails.uploadedBytesForCallback}
+	}
+
+	var mutex sync.Mutex
+	contiguous := uDetails.fileOffset
+	completed := make(map[int64]int64)
+
+	var jobs []func() error
+	for start := uDetails.fileOffset; start < fileSize; start += pieceSize {
+		length := min(pieceSize, fileSize-start)
+		jobs = append(jobs, func() error {
+			part := make([]byte, length)
+			_, err := file.ReadAt(part, start)
+			if err != nil {
+				return err
+			}
+			details := uDetails
+			details.uploadedBytes = rangeBase + start
+			err = uploadPartFile(client, part, length, details)
+			if err != nil {
+				return err
+			}
+			if details.onProgress != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				completed[start] = start + length
+				for end, found := completed[contiguous]; found; end, found = completed[contiguous] {
+					delete(completed, contiguous)
+					contiguous = end
+				}
+				details.onProgress(rangeBase + contiguous)
+			}
+			return nil
+		})
+	}
+	util.Logger.Printf("[TRACE] Uploading %d pieces of %s with %d parallel ranges\n", len(jobs), file.Name(), uDetails.parallelRanges)
+	return runParallel(uDetails.parallelRanges, jobs)
+}
@@ -0,0 +1,229 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_runParallel(t *testing.T) {
+	var running, maxRunning, done atomic.Int32
+	var jobs []func() error
+	for range 10 {
+		jobs = append(jobs, func() error {
+			current := running.Add(1)
+			defer running.Add(-1)
+			for {
+				previous := maxRunning.Load()
+				if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			done.Add(1)
+			return nil
+		})
+	}
+	err := runParallel(3, jobs)
+	if err != nil || done.Load() != 10 || maxRunning.Load() > 3 {
+		t.Errorf("unexpected run: %v, %d jobs done, %d at the same time", err, done.Load(), maxRunning.Load())
+	}
+
+	// Once a job fails, the jobs which did not start are skipped
+	done.Store(0)
+	failing := []func() error{func() error { return fmt.Errorf("failure") }}
+	for range 5 {
+		failing = append(failing, func() error { done.Add(1); return nil })
+	}
+	err = runParallel(1, failing)
+	if err == nil || done.Load() == 5 {
+		t.Errorf("expected failure and skipped jobs, got %v and %d jobs done", err, done.Load())
+	}
+}
+
+func Test_bandwidthLimiter(t *testing.T) {
+	if newBandwidthLimiter(0) != nil {
+		t.Errorf("expected no limiter without limit")
+	}
+	limiter := newBandwidthLimiter(100 * 1024)
+	content := bytes.Repeat([]byte("x"), 50*1024)
+	start := time.Now()
+	read, err := io.ReadAll(limiter.reader(bytes.NewReader(content)))
+	if err != nil || !bytes.Equal(read, content) {
+		t.Fatalf("unexpected read: %d bytes, %v", len(read), err)
+	}
+	// The first 32 KiB are sent at once, the rest after the time needed for them at 100 KiB/s
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("read was not throttled: %s", elapsed)
+	}
+}
+
+func Test_uploadFileRanges(t *testing.T) {
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	var mutex sync.Mutex
+	received := make([]byte, len(content))
+	var running, maxRunning int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			return
+		}
+		mutex.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mutex.Unlock()
+		var start, end, total int
+		_, _ = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		body, _ := io.ReadAll(r.Body)
+		// Later pieces complete first
+		time.Sleep(time.Duration(total-start) * time.Microsecond)
+		mutex.Lock()
+		copy(received[start:], body)
+		running--
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl,
+		UploadSettings: UploadSettings{ParallelRanges: 4}}
+
+	filePath := filepath.Join(t.TempDir(), "disk.vmdk")
+	err := os.WriteFile(filePath, content, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var progressMutex sync.Mutex
+	var reported, recorded []int64
+	var uploadError error
+	details := uploadDetails{
+		uploadLink:       server.URL + "/transfer/1/disk.vmdk",
+		fileSizeToUpload: int64(len(content)),
+		uploadPieceSize:  1500,
+		allFilesSize:     int64(len(content)),
+		callBack: func(bytesUpload, totalSize int64) {
+			progressMutex.Lock()
+			defer progressMutex.Unlock()
+			reported = append(reported, bytesUpload)
+		},
+		uploadError: &uploadError,
+		fileOffset:  1500,
+		onProgress:  func(uploadedBytes int64) { recorded = append(recorded, uploadedBytes) },
+	}
+	applyUploadSettings(client, &details)
+	copy(received, content[:1500])
+	size, err := uploadFile(client, filePath, details)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != int64(len(content)) || !bytes.Equal(received, content) {
+		t.Errorf("unexpected upload of %d bytes", size)
+	}
+	if maxRunning < 2 || maxRunning > 4 {
+		t.Errorf("expected up to 4 pieces at the same time, got %d", maxRunning)
+	}
+	if !slices.IsSorted(reported) || reported[len(reported)-1] != int64(len(content)) {
+		t.Errorf("unexpected aggregated progress: %v", reported)
+	}
+	// The recorded progress only covers the contiguous part of the file
+	if !slices.IsSorted(recorded) || recorded[len(recorded)-1] != int64(len(content)) {
+		t.Errorf("unexpected recorded progress: %v", recorded)
+	}
+}
+
+func Test_WithUploadSettings(t *testing.T) {
+	vcdClient := &VCDClient{}
+	err := WithUploadSettings(UploadSettings{ParallelFiles: 2, ParallelRanges: 3, MaxBytesPerSecond: 1024})(vcdClient)
+	if err != nil || vcdClient.Client.UploadSettings.ParallelRanges != 3 {
+		t.Errorf("unexpected settings: %+v, %v", vcdClient.Client.UploadSettings, err)
+	}
+	err = WithUploadSettings(UploadSettings{ParallelFiles: -1})(vcdClient)
+	if err == nil {
+		t.Errorf("expected error for negative settings")
+	}
+}
+
+func Test_uploadFilesParallel(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"disk1.vmdk": bytes.Repeat([]byte("a"), 7000),
+		"disk2.vmdk": bytes.Repeat([]byte("b"), 5000),
+	}
+	var filePaths []string
+	for name, content := range files {
+		filePath := filepath.Join(dir, name)
+		err := os.WriteFile(filePath, content, 0600)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+
+	var mutex sync.Mutex
+	received := map[string][]byte{"disk1.vmdk": make([]byte, 7000), "disk2.vmdk": make([]byte, 5000)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			return
+		}
+		var start, end, total int
+		_, _ = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		copy(received[filepath.Base(r.URL.Path)][start:], body)
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl,
+		UploadSettings: UploadSettings{ParallelFiles: 2, ParallelRanges: 2}}
+
+	var envelope Envelope
+	err := xml.Unmarshal([]byte(`<Envelope><References>
+		<File href="disk1.vmdk" id="file1" size="7000"/>
+		<File href="disk2.vmdk" id="file2" size="5000"/>
+	</References></Envelope>`), &envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	vappTemplate := &types.VAppTemplate{Files: &types.FilesList{File: []*types.File{
+		{Name: "descriptor.ovf", Size: 100, BytesTransferred: 100},
+		{Name: "disk1.vmdk", Size: 7000, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk1.vmdk"}}},
+		{Name: "disk2.vmdk", Size: 5000, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk2.vmdk"}}},
+	}}}
+
+	callBack, progress := getProgressCallBackFunction()
+	var uploadError error
+	err = uploadFiles(client, vappTemplate, &envelope, dir, filePaths, 2000, callBack, &uploadError, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, content := range files {
+		if !bytes.Equal(received[name], content) {
+			t.Errorf("unexpected content received for %s", name)
+		}
+	}
+	if progress.LockedGet() != 100 {
+		t.Errorf("unexpected progress: %f", progress.LockedGet())
+	}
+}
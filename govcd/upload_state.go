@@ -0,0 +1,195 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// Kinds of items recorded in an UploadState
+const (
+	UploadKindVAppTemplate       = "vAppTemplate"
+	UploadKindMedia              = "media"
+	UploadKindContentLibraryItem = "contentLibraryItem"
+)
+
+// uploadPieceRetries is the number of times a piece of a resumable upload is sent again after a
+// failure, waiting uploadPieceRetryInterval between attempts
+var (
+	uploadPieceRetries       = 3
+	uploadPieceRetryInterval = 5 * time.Second
+)
+
+// UploadState records the progress of a resumable upload in a file, so that an interrupted upload
+// can continue where it stopped, even after a restart of the process. The file is removed once the
+// upload is complete.
+// When resuming, a file continues from the contiguous part recorded here, bounded by the bytes
+// received by the transfer service. With parallel ranges, the service also counts the pieces received
+// after a piece that failed, which must not be skipped
+type UploadState struct {
+	// Kind is one of UploadKindVAppTemplate, UploadKindMedia or UploadKindContentLibraryItem
+	Kind string `json:"kind"`
+	// ItemName is the name of the uploaded item
+	ItemName string `json:"itemName"`
+	// ItemHref is the HREF of the vApp template or media, or the ID of the Content Library Item
+	ItemHref string `json:"itemHref"`
+	// SourcePath is the absolute path of the uploaded OVA, OVF or ISO file
+	SourcePath string `json:"sourcePath"`
+	// Files are the files sent to the transfer service
+	Files []*UploadStateFile `json:"files,omitempty"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+// UploadStateFile is a file of a resumable upload
+type UploadStateFile struct {
+	Name          string `json:"name"`
+	TransferUrl   string `json:"transferUrl"`
+	Size          int64  `json:"size"`
+	UploadedBytes int64  `json:"uploadedBytes"`
+}
+
+// LoadUploadState reads the state of a resumable upload. When the file doesn't exist, it returns
+// an empty state which will be written to that path once the upload starts
+func LoadUploadState(path string) (*UploadState, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the path of the upload state file is empty")
+	}
+	state := &UploadState{path: path}
+	content, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload state '%s': %s", path, err)
+	}
+	err = json.Unmarshal(content, state)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing upload state '%s': %s", path, err)
+	}
+	return state, nil
+}
+
+// IsStarted returns true when the state records an item that was already created
+func (state *UploadState) IsStarted() bool {
+	return state.ItemHref != ""
+}
+
+// checkResumable verifies that the recorded upload is the one requested
+func (state *UploadState) checkResumable(kind, itemName, sourcePath string) error {
+	if !state.IsStarted() {
+		return nil
+	}
+	absolutePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path of '%s': %s", sourcePath, err)
+	}
+	if state.Kind != kind || state.ItemName != itemName || state.SourcePath != absolutePath {
+		return fmt.Errorf("upload state '%s' records the upload of %s '%s' from '%s', not of %s '%s' from '%s'",
+			state.path, state.Kind, state.ItemName, state.SourcePath, kind, itemName, absolutePath)
+	}
+	return nil
+}
+
+// start records a newly created item
+func (state *UploadState) start(kind, itemName, itemHref, sourcePath string) error {
+	absolutePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path of '%s': %s", sourcePath, err)
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.Kind = kind
+	state.ItemName = itemName
+	state.ItemHref = itemHref
+	state.SourcePath = absolutePath
+	state.Files = nil
+	return state.save()
+}
+
+// setUploaded records the bytes received by the transfer service for a file
+func (state *UploadState) setUploaded(name, transferUrl string, size, uploadedBytes int64) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	var file *UploadStateFile
+	for _, existing := range state.Files {
+		if existing.Name == name {
+			file = existing
+			break
+		}
+	}
+	if file == nil {
+		file = &UploadStateFile{Name: name}
+		state.Files = append(state.Files, file)
+	}
+	file.TransferUrl = transferUrl
+	file.Size = size
+	file.UploadedBytes = uploadedBytes
+	err := state.save()
+	if err != nil {
+		util.Logger.Printf("[WARN] %s", err)
+	}
+}
+
+// resumeOffset returns the offset from which a file partially received by the transfer service is
+// uploaded again: the contiguous part recorded for the file, when it is not larger than the bytes
+// received by the service. Nothing is skipped when the file was not recorded
+func (state *UploadState) resumeOffset(name string, bytesTransferred int64) int64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	for _, file := range state.Files {
+		if file.Name == name {
+			return max(min(file.UploadedBytes, bytesTransferred), 0)
+		}
+	}
+	return 0
+}
+
+// complete removes the state file of a finished upload
+func (state *UploadState) complete() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	err := os.Remove(state.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		util.Logger.Printf("[WARN] error removing upload state '%s': %s", state.path, err)
+	}
+}
+
+// save writes the state, replacing the previous file only once the new one is complete
+func (state *UploadState) save() error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding upload state: %s", err)
+	}
+	tempPath := state.path + ".tmp"
+	err = os.WriteFile(tempPath, content, 0600)
+	if err == nil {
+		err = os.Rename(tempPath, state.path)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing upload state '%s': %s", state.path, err)
+	}
+	return nil
+}
+
+// fileProgress returns the function that records the progress of a file in the state, or nil
+// when there is no state
+func (state *UploadState) fileProgress(name, transferUrl string, size int64) func(uploadedBytes int64) {
+	if state == nil {
+		return nil
+	}
+	return func(uploadedBytes int64) {
+		state.setUploaded(name, transferUrl, size, uploadedBytes)
+	}
+}
@@ -0,0 +1,254 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_UploadState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "upload.json")
+	state, err := LoadUploadState(statePath)
+	if err != nil || state.IsStarted() {
+		t.Fatalf("expected empty state, got %+v, %v", state, err)
+	}
+	err = state.checkResumable(UploadKindMedia, "image", "/tmp/image.iso")
+	if err != nil {
+		t.Errorf("unexpected error for empty state: %s", err)
+	}
+
+	err = state.start(UploadKindMedia, "image", "https://example.com/api/media/1", "/tmp/image.iso")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	state.fileProgress("file", "https://example.com/transfer/1/file", 100)(40)
+	state.setUploaded("file", "https://example.com/transfer/1/file", 100, 60)
+
+	loaded, err := LoadUploadState(statePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !loaded.IsStarted() || loaded.ItemHref != "https://example.com/api/media/1" || len(loaded.Files) != 1 || loaded.Files[0].UploadedBytes != 60 {
+		t.Errorf("unexpected loaded state: %+v", loaded)
+	}
+	if err = loaded.checkResumable(UploadKindMedia, "image", "/tmp/image.iso"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err = loaded.checkResumable(UploadKindMedia, "other", "/tmp/image.iso"); err == nil {
+		t.Errorf("expected error for another item")
+	}
+	if err = loaded.checkResumable(UploadKindVAppTemplate, "image", "/tmp/image.iso"); err == nil {
+		t.Errorf("expected error for another kind")
+	}
+
+	// A relative source path is recorded as absolute, so that the upload can be resumed from
+	// another working directory
+	t.Chdir(filepath.Dir(statePath))
+	err = state.start(UploadKindMedia, "image", "https://example.com/api/media/1", "image.iso")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sourcePath := filepath.Join(filepath.Dir(statePath), "image.iso")
+	if state.SourcePath != sourcePath {
+		t.Errorf("expected source path %s, got %s", sourcePath, state.SourcePath)
+	}
+	t.Chdir(t.TempDir())
+	if err = state.checkResumable(UploadKindMedia, "image", sourcePath); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err = state.checkResumable(UploadKindMedia, "image", "image.iso"); err == nil {
+		t.Errorf("expected error for a relative path in another directory")
+	}
+
+	loaded.complete()
+	if _, err = os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("expected state file to be removed, got %v", err)
+	}
+	var noState *UploadState
+	if noState.fileProgress("file", "", 1) != nil {
+		t.Errorf("expected no progress function without state")
+	}
+
+	err = os.WriteFile(statePath, []byte("{"), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = LoadUploadState(statePath); err == nil {
+		t.Errorf("expected error for invalid state")
+	}
+}
+
+func Test_uploadFileResume(t *testing.T) {
+	defaultInterval := uploadPieceRetryInterval
+	uploadPieceRetryInterval = 0
+	defer func() { uploadPieceRetryInterval = defaultInterval }()
+
+	content := bytes.Repeat([]byte("0123456789"), 500)
+	var mutex sync.Mutex
+	var ranges []string
+	received := make([]byte, len(content))
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		contentRange := r.Header.Get("Content-Range")
+		ranges = append(ranges, contentRange)
+		var start, end, total int
+		_, _ = fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+		body, _ := io.ReadAll(r.Body)
+		copy(received[start:], body)
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl}
+
+	filePath := filepath.Join(t.TempDir(), "image.iso")
+	err := os.WriteFile(filePath, content, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	copy(received, content[:3000])
+
+	var recorded []int64
+	var uploadError error
+	size, err := uploadFile(client, filePath, uploadDetails{
+		uploadLink:       server.URL + "/transfer/1/file",
+		fileSizeToUpload: int64(len(content)),
+		uploadPieceSize:  1500,
+		allFilesSize:     int64(len(content)),
+		callBack:         func(bytesUpload, totalSize int64) {},
+		uploadError:      &uploadError,
+		fileOffset:       3000,
+		onProgress:       func(uploadedBytes int64) { recorded = append(recorded, uploadedBytes) },
+		pieceRetries:     1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != int64(len(content)) || !bytes.Equal(received, content) {
+		t.Errorf("unexpected upload of %d bytes", size)
+	}
+	if strings.Join(ranges, ",") != "bytes 3000-4499/5000,bytes 4500-4999/5000" {
+		t.Errorf("unexpected ranges: %v", ranges)
+	}
+	if len(recorded) != 2 || recorded[0] != 4500 || recorded[1] != 5000 {
+		t.Errorf("unexpected recorded progress: %v", recorded)
+	}
+}
+
+// Test_uploadFileRangesResume checks that an upload with parallel ranges whose middle piece failed
+// resumes from the contiguous part recorded in the state, and not from the bytes received by the
+// transfer service, which include the pieces after the failed one
+func Test_uploadFileRangesResume(t *testing.T) {
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	var mutex sync.Mutex
+	received := make([]byte, len(content))
+	var bytesTransferred int64
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			return
+		}
+		var start, end, total int
+		_, _ = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		fail := failing && start == 3000
+		mutex.Unlock()
+		if fail {
+			// The other pieces are received before the failure
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		copy(received[start:], body)
+		bytesTransferred += int64(len(body))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl,
+		UploadSettings: UploadSettings{ParallelRanges: 4}}
+
+	filePath := filepath.Join(t.TempDir(), "image.iso")
+	err := os.WriteFile(filePath, content, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	state, err := LoadUploadState(filepath.Join(t.TempDir(), "upload.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	transferUrl := server.URL + "/transfer/1/image.iso"
+	upload := func(fileOffset int64) error {
+		var uploadError error
+		details := uploadDetails{
+			uploadLink:       transferUrl,
+			fileSizeToUpload: int64(len(content)),
+			uploadPieceSize:  1500,
+			allFilesSize:     int64(len(content)),
+			callBack:         func(bytesUpload, totalSize int64) {},
+			uploadError:      &uploadError,
+			fileOffset:       fileOffset,
+			onProgress:       state.fileProgress("image.iso", transferUrl, int64(len(content))),
+		}
+		applyUploadSettings(client, &details)
+		_, err := uploadFile(client, filePath, details)
+		return err
+	}
+
+	err = upload(0)
+	if err == nil {
+		t.Fatalf("expected error for the failed piece")
+	}
+	mutex.Lock()
+	failing = false
+	transferred := bytesTransferred
+	mutex.Unlock()
+	if transferred != int64(len(content)-1500) {
+		t.Fatalf("expected the pieces after the failed one to be received, got %d bytes", transferred)
+	}
+
+	offset := state.resumeOffset("image.iso", transferred)
+	if offset != 3000 {
+		t.Errorf("expected resume from the failed piece at 3000, got %d", offset)
+	}
+	err = upload(offset)
+	if err != nil {
+		t.Fatalf("unexpected error resuming: %s", err)
+	}
+	if !bytes.Equal(received, content) {
+		t.Errorf("the resumed upload left holes in the file")
+	}
+
+	if offset := state.resumeOffset("other.iso", 5000); offset != 0 {
+		t.Errorf("expected no offset for a file not recorded, got %d", offset)
+	}
+}
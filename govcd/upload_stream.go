@@ -0,0 +1,508 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// UploadOvfFromReader uploads an OVA archive read from a stream, such as a download from object
+// storage, without extracting it to disk. The OVF descriptor is read first, then every disk is sent
+// to the transfer service while it is read from the stream. Only the entries which can't be sent when
+// they are read, such as the entries placed before the descriptor or the chunks of a file out of
+// order, are spooled to a temporary directory.
+// The files are read and uploaded in the background, one at a time: the reader must stay open
+// until the returned task completes. On upload fail client may need to remove the catalog item
+// which waits for files to be uploaded.
+// The content of a stream can't be checked against its manifest before it is uploaded: when the
+// client requires verified packages (see WithOvaVerification), use VerifyOva and UploadOvf instead.
+// The editors change the OVF descriptor before it is uploaded, as in UploadOvfWithEditors
+func (cat *Catalog) UploadOvfFromReader(reader io.Reader, itemName, description string, uploadPieceSize int64, editors ...OvfDescriptorEditor) (UploadTask, error) {
+	if *cat == (Catalog{}) {
+		return UploadTask{}, errors.New("catalog can not be empty or nil")
+	}
+	if reader == nil {
+		return UploadTask{}, errors.New("the OVA reader can not be nil")
+	}
+	if cat.client.OvaVerifyOptions.isRequired() {
+		return UploadTask{}, errors.New("the client requires verified OVF packages, which is not possible for a stream")
+	}
+
+	for _, catalogItemName := range getExistingCatalogItems(cat) {
+		if catalogItemName == itemName {
+			return UploadTask{}, fmt.Errorf("catalog item '%s' already exists. Upload with different name", itemName)
+		}
+	}
+
+	stream := &ovaStream{reader: tar.NewReader(reader)}
+	uploading := false
+	defer func() {
+		if !uploading {
+			stream.removeSpool()
+		}
+	}()
+
+	descriptor, err := stream.readDescriptor()
+	if err != nil {
+		return UploadTask{}, err
+	}
+	var ovfFileDesc Envelope
+	err = xml.Unmarshal(descriptor, &ovfFileDesc)
+	if err != nil {
+		return UploadTask{}, fmt.Errorf("error parsing OVF descriptor: %s", err)
+	}
+	for _, file := range ovfFileDesc.File {
+		err = validateOvfFileReference(file.HREF)
+		if err != nil {
+			return UploadTask{}, err
+		}
+	}
+	if len(editors) > 0 {
+		descriptor, ovfFileDesc, err = editOvfPackageDescriptor(descriptor, &ovfFileDesc, editors)
+		if err != nil {
+			return UploadTask{}, err
+		}
+	}
+
+	catalogItemUploadURL, err := findCatalogItemUploadLink(cat, "application/vnd.vmware.vcloud.uploadVAppTemplateParams+xml")
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	vappTemplateUrl, err := createItemForUpload(cat.client, catalogItemUploadURL, itemName, description)
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	vappTemplate, err := queryVappTemplateAndVerifyTask(cat.client, vappTemplateUrl, itemName)
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	ovfUploadHref, err := getUploadLink(vappTemplate.Files)
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	err = uploadOvfDescriptionContent(cat.client, bytes.NewReader(descriptor), ovfUploadHref)
+	if err != nil {
+		removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+		return UploadTask{}, err
+	}
+
+	vappTemplate, err = waitForTempUploadLinks(cat.client, vappTemplateUrl, itemName)
+	if err != nil {
+		removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+		return UploadTask{}, err
+	}
+
+	progressCallBack, uploadProgress := getProgressCallBackFunction()
+
+	uploadError := *new(error)
+
+	// sending upload process to background, this allows not to lock and return task to client
+	uploading = true
+	go func() {
+		defer stream.removeSpool()
+		err := stream.uploadFiles(cat.client, vappTemplate, &ovfFileDesc, uploadPieceSize, progressCallBack)
+		if err != nil {
+			util.Logger.Println(strings.Repeat("*", 80))
+			util.Logger.Printf("*** [DEBUG - UploadOvfFromReader] error uploading files: %s\n", err)
+			util.Logger.Println(strings.Repeat("*", 80))
+			uploadError = err
+		}
+	}()
+
+	var task Task
+	for _, item := range vappTemplate.Tasks.Task {
+		task, err = createTaskForVcdImport(cat.client, item.HREF)
+		if err != nil {
+			removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+			return UploadTask{}, err
+		}
+		if task.Task.Status == "error" {
+			removeCatalogItemOnError(cat.client, vappTemplateUrl, itemName)
+			return UploadTask{}, fmt.Errorf("task did not complete succesfully: %s", task.Task.Description)
+		}
+	}
+
+	uploadTask := NewUploadTask(&task, uploadProgress, &uploadError)
+
+	util.Logger.Printf("[TRACE] Upload from stream started and task for vcd import created. \n")
+
+	return *uploadTask, nil
+}
+
+// UploadMediaFromReader uploads a media file of the given size read from a stream, such as a
+// download from object storage, without storing it on disk first. If checkFileIsIso is true, only ISO
+// and UDF images are allowed.
+// The content is read and uploaded in the background: the reader must stay open until the returned
+// task completes
+func (cat *Catalog) UploadMediaFromReader(mediaName, mediaDescription string, reader io.Reader, size, uploadPieceSize int64, checkFileIsIso bool) (UploadTask, error) {
+	if *cat == (Catalog{}) {
+		return UploadTask{}, errors.New("catalog can not be empty or nil")
+	}
+	if reader == nil {
+		return UploadTask{}, errors.New("the media reader can not be nil")
+	}
+	if size <= 0 {
+		return UploadTask{}, fmt.Errorf("invalid size %d for media '%s'", size, mediaName)
+	}
+
+	if checkFileIsIso {
+		// The header is read ahead and kept in the buffer, so that it is uploaded too
+		bufferedReader := bufio.NewReaderSize(reader, isoHeaderSize)
+		header, err := bufferedReader.Peek(isoHeaderSize)
+		if err != nil && err != io.EOF {
+			return UploadTask{}, fmt.Errorf("error reading media '%s': %s", mediaName, err)
+		}
+		isISOGood, err := readHeader(bytes.NewReader(header))
+		if err != nil || !isISOGood {
+			return UploadTask{}, fmt.Errorf("[ERROR] Media %s isn't correct iso file: %#v", mediaName, err)
+		}
+		reader = bufferedReader
+	}
+
+	for _, catalogItemName := range getExistingCatalogItems(cat) {
+		if catalogItemName == mediaName {
+			return UploadTask{}, fmt.Errorf("media item '%s' already exists. Upload with different name", mediaName)
+		}
+	}
+
+	catalogItemUploadURL, err := findCatalogItemUploadLink(cat, "application/vnd.vmware.vcloud.media+xml")
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	media, err := createMedia(cat.client, catalogItemUploadURL.String(), mediaName, mediaDescription, size)
+	if err != nil {
+		return UploadTask{}, fmt.Errorf("[ERROR] Issue creating media: %#v", err)
+	}
+
+	createdMedia, err := queryMedia(cat.client, media.Entity.HREF, mediaName)
+	if err != nil {
+		return UploadTask{}, err
+	}
+
+	return executeMediaUpload(cat.client, createdMedia, mediaName, size, uploadPieceSize, nil, func(details uploadDetails) error {
+		err := uploadSizedStream(cat.client, reader, size, details)
+		if err != nil {
+			*details.uploadError = err
+			return fmt.Errorf("error uploading media stream: %s", err)
+		}
+		return nil
+	})
+}
+
+// uploadSizedStream uploads exactly size bytes of the reader, from uDetails.uploadedBytes in the
+// uploaded file
+func uploadSizedStream(client *Client, reader io.Reader, size int64, uDetails uploadDetails) error {
+	pieceSize := uploadPieceSizeFor(uDetails.uploadPieceSize, size)
+	uploaded, err := uploadStream(client, io.LimitReader(reader, size), pieceSize, uDetails)
+	if err != nil {
+		return err
+	}
+	if uploaded != size {
+		return fmt.Errorf("the stream ended after %d of %d bytes", uploaded, size)
+	}
+	return nil
+}
+
+// ovaStream reads the entries of an OVA archive in the order of the stream. The entries which can't
+// be uploaded when they are read are spooled to a temporary directory
+type ovaStream struct {
+	reader   *tar.Reader
+	spoolDir string
+	// spooled are the spooled entries, by name
+	spooled map[string]spooledOvaEntry
+}
+
+type spooledOvaEntry struct {
+	path string
+	size int64
+}
+
+// ovaStreamFile is a file of the OVF package uploaded from the stream. A file which is not chunked
+// has a single chunk, named after the file
+type ovaStreamFile struct {
+	href      string
+	link      string
+	size      int64
+	chunkSize int64
+	// nextChunk is the index of the next chunk to upload
+	nextChunk int
+}
+
+// chunkCount returns the number of chunks of the file
+func (file *ovaStreamFile) chunkCount() int {
+	if file.chunkSize <= 0 {
+		return 1
+	}
+	return int((file.size + file.chunkSize - 1) / file.chunkSize)
+}
+
+// chunkName returns the name of the OVA entry holding a chunk of the file
+func (file *ovaStreamFile) chunkName(chunk int) string {
+	if file.chunkSize <= 0 {
+		return file.href
+	}
+	return fmt.Sprintf("%s.%09d", file.href, chunk)
+}
+
+// chunkSizeOf returns the size of a chunk of the file, or -1 when the file size is unknown
+func (file *ovaStreamFile) chunkSizeOf(chunk int) int64 {
+	if file.size <= 0 {
+		return -1
+	}
+	if file.chunkSize <= 0 {
+		return file.size
+	}
+	return min(file.chunkSize, file.size-int64(chunk)*file.chunkSize)
+}
+
+// ovaEntryName returns the name of a tar entry relative to the root of the archive
+func ovaEntryName(header *tar.Header) string {
+	return strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+}
+
+// readDescriptor returns the content of the OVF descriptor, spooling the entries placed before it
+func (stream *ovaStream) readDescriptor() ([]byte, error) {
+	for {
+		header, err := stream.reader.Next()
+		if err == io.EOF {
+			return nil, errors.New("no OVF descriptor found in the OVA stream")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading OVA stream: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := ovaEntryName(header)
+		if strings.EqualFold(path.Ext(name), ".ovf") {
+			descriptor, err := io.ReadAll(stream.reader)
+			if err != nil {
+				return nil, fmt.Errorf("error reading OVF descriptor '%s': %s", name, err)
+			}
+			return descriptor, nil
+		}
+		// The descriptor should be the first entry of an OVA: the files before it can only be
+		// uploaded once the descriptor is known
+		err = stream.spool(name, header.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// uploadFiles uploads the files of the package which vCD waits for, reading the rest of the stream
+func (stream *ovaStream) uploadFiles(client *Client, vappTemplate *types.VAppTemplate, ovfFileDesc *Envelope,
+	uploadPieceSize int64, progressCallBack func(bytesUpload, totalSize int64)) error {
+	details := uploadDetails{
+		uploadPieceSize: uploadPieceSize,
+		allFilesSize:    getAllFileSizeSum(ovfFileDesc),
+		callBack:        progressCallBack,
+		limiter:         newBandwidthLimiter(client.UploadSettings.MaxBytesPerSecond),
+		sharedProgress:  &uploadProgress{},
+	}
+
+	var files []*ovaStreamFile
+	for _, item := range vappTemplate.Files.File {
+		number, err := getFileFromDescription(item.Name, ovfFileDesc)
+		if err != nil {
+			// The descriptor itself is listed with the files of the template
+			continue
+		}
+		if item.BytesTransferred > 0 && item.BytesTransferred == item.Size {
+			continue
+		}
+		if len(item.Link) == 0 {
+			return fmt.Errorf("no upload link found for file '%s'", item.Name)
+		}
+		fileDesc := ovfFileDesc.File[number]
+		files = append(files, &ovaStreamFile{
+			href:      fileDesc.HREF,
+			link:      item.Link[0].HREF,
+			size:      int64(fileDesc.Size),
+			chunkSize: int64(fileDesc.ChunkSize),
+		})
+	}
+
+	// Entries read before the descriptor are uploaded first
+	for _, file := range files {
+		err := stream.uploadSpooledChunks(client, file, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		header, err := stream.reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading OVA stream: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := ovaEntryName(header)
+		file, chunk := findOvaStreamFile(files, name)
+		if file == nil || chunk < file.nextChunk {
+			util.Logger.Printf("[TRACE] Skipping OVA entry '%s'\n", name)
+			continue
+		}
+		if chunk > file.nextChunk {
+			// Chunks are uploaded in order: this one waits for the previous ones
+			err = stream.spool(name, header.Size)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = uploadOvaStreamChunk(client, file, chunk, stream.reader, header.Size, details)
+		if err != nil {
+			return err
+		}
+		err = stream.uploadSpooledChunks(client, file, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if file.nextChunk < file.chunkCount() {
+			return fmt.Errorf("file '%s' not found in the OVA stream", file.chunkName(file.nextChunk))
+		}
+	}
+	return nil
+}
+
+// findOvaStreamFile returns the file and the index of the chunk held by an OVA entry, or nil when
+// the entry is not a file of the package
+func findOvaStreamFile(files []*ovaStreamFile, name string) (*ovaStreamFile, int) {
+	for _, file := range files {
+		if file.chunkSize <= 0 {
+			if name == file.href {
+				return file, 0
+			}
+			continue
+		}
+		suffix, found := strings.CutPrefix(name, file.href+".")
+		if !found || len(suffix) != 9 {
+			continue
+		}
+		chunk, err := strconv.Atoi(suffix)
+		if err == nil && chunk < file.chunkCount() {
+			return file, chunk
+		}
+	}
+	return nil, -1
+}
+
+// uploadOvaStreamChunk uploads a chunk of a file, read from the stream or from the spool
+func uploadOvaStreamChunk(client *Client, file *ovaStreamFile, chunk int, reader io.Reader, size int64, details uploadDetails) error {
+	name := file.chunkName(chunk)
+	expectedSize := file.chunkSizeOf(chunk)
+	if expectedSize >= 0 && size != expectedSize {
+		return fmt.Errorf("file '%s' has %d bytes, but the descriptor declares %d", name, size, expectedSize)
+	}
+	util.Logger.Printf("[TRACE] Uploading OVA entry '%s' to %s\n", name, file.link)
+
+	details.uploadLink = file.link
+	details.uploadError = new(error)
+	details.fileSizeToUpload = file.size
+	// when file size in OVF does not exist, use real file size instead
+	if file.size <= 0 {
+		details.fileSizeToUpload = size
+	}
+	details.uploadedBytes = int64(chunk) * file.chunkSize
+	err := uploadSizedStream(client, reader, size, details)
+	if err != nil {
+		return fmt.Errorf("error uploading file '%s': %s", name, err)
+	}
+	file.nextChunk++
+	return nil
+}
+
+// uploadSpooledChunks uploads the spooled chunks of a file which follow the uploaded ones
+func (stream *ovaStream) uploadSpooledChunks(client *Client, file *ovaStreamFile, details uploadDetails) error {
+	for file.nextChunk < file.chunkCount() {
+		name := file.chunkName(file.nextChunk)
+		entry, found := stream.spooled[name]
+		if !found {
+			return nil
+		}
+		spooledFile, err := os.Open(filepath.Clean(entry.path))
+		if err != nil {
+			return fmt.Errorf("error opening spooled file '%s': %s", name, err)
+		}
+		err = uploadOvaStreamChunk(client, file, file.nextChunk, spooledFile, entry.size, details)
+		safeClose(spooledFile)
+		if err != nil {
+			return err
+		}
+		delete(stream.spooled, name)
+		err = os.Remove(entry.path)
+		if err != nil {
+			util.Logger.Printf("[WARN] error removing spooled file '%s': %s", entry.path, err)
+		}
+	}
+	return nil
+}
+
+// spool copies the current entry of the stream to the temporary directory
+func (stream *ovaStream) spool(name string, size int64) error {
+	if stream.spoolDir == "" {
+		dir, err := os.MkdirTemp("", "govcd-ova-spool")
+		if err != nil {
+			return fmt.Errorf("error creating spool directory: %s", err)
+		}
+		stream.spoolDir = dir
+		stream.spooled = make(map[string]spooledOvaEntry)
+	}
+	util.Logger.Printf("[TRACE] Spooling OVA entry '%s' of %d bytes\n", name, size)
+
+	file, err := os.CreateTemp(stream.spoolDir, "entry-*")
+	if err != nil {
+		return fmt.Errorf("error spooling OVA entry '%s': %s", name, err)
+	}
+	written, err := io.Copy(file, stream.reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error spooling OVA entry '%s': %s", name, err)
+	}
+	stream.spooled[name] = spooledOvaEntry{path: file.Name(), size: written}
+	return nil
+}
+
+// removeSpool removes the temporary directory of the spooled entries
+func (stream *ovaStream) removeSpool() {
+	if stream.spoolDir == "" {
+		return
+	}
+	err := os.RemoveAll(stream.spoolDir)
+	if err != nil {
+		util.Logger.Printf("[WARN] error removing spool directory '%s': %s", stream.spoolDir, err)
+	}
+}
@@ -0,0 +1,237 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+type testOvaEntry struct {
+	name    string
+	content []byte
+}
+
+// buildTestOva returns an OVA archive holding the entries in the given order
+func buildTestOva(t *testing.T, entries []testOvaEntry) *bytes.Buffer {
+	var ova bytes.Buffer
+	writer := tar.NewWriter(&ova)
+	for _, entry := range entries {
+		err := writer.WriteHeader(&tar.Header{Name: entry.name, Size: int64(len(entry.content)), Mode: 0644, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = writer.Write(entry.content)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return &ova
+}
+
+// newTestTransferServer returns a server storing the uploaded files by name and recording the
+// Content-Range of every piece
+func newTestTransferServer(sizes map[string]int) (*httptest.Server, map[string][]byte, *[]string) {
+	var mutex sync.Mutex
+	received := make(map[string][]byte)
+	for name, size := range sizes {
+		received[name] = make([]byte, size)
+	}
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			return
+		}
+		var start, end, total int
+		_, _ = fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		name := path.Base(r.URL.Path)
+		ranges = append(ranges, name+" "+r.Header.Get("Content-Range"))
+		copy(received[name][start:], body)
+	}))
+	return server, received, &ranges
+}
+
+func Test_ovaStreamUploadFiles(t *testing.T) {
+	descriptor := []byte(`<Envelope><References>
+		<File href="disk1.vmdk" id="file1" size="3000"/>
+		<File href="disk2.vmdk" id="file2" size="5000" chunkSize="3000"/>
+		<File href="disk3.vmdk" id="file3" size="2500"/>
+	</References></Envelope>`)
+	disk1 := bytes.Repeat([]byte("a"), 3000)
+	disk2 := append(bytes.Repeat([]byte("b"), 3000), bytes.Repeat([]byte("c"), 2000)...)
+	disk3 := bytes.Repeat([]byte("d"), 2500)
+	// disk1 comes before the descriptor and the chunks of disk2 are out of order: both are spooled
+	ova := buildTestOva(t, []testOvaEntry{
+		{"./disk1.vmdk", disk1},
+		{"template.ovf", descriptor},
+		{"disk2.vmdk.000000001", disk2[3000:]},
+		{"template.mf", []byte("SHA256(disk1.vmdk)= 00")},
+		{"disk2.vmdk.000000000", disk2[:3000]},
+		{"disk3.vmdk", disk3},
+	})
+
+	server, received, ranges := newTestTransferServer(map[string]int{"disk1.vmdk": 3000, "disk2.vmdk": 5000, "disk3.vmdk": 2500})
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl}
+
+	stream := &ovaStream{reader: tar.NewReader(ova)}
+	readDescriptor, err := stream.readDescriptor()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(readDescriptor, descriptor) {
+		t.Fatalf("unexpected descriptor: %s", readDescriptor)
+	}
+	if _, found := stream.spooled["disk1.vmdk"]; !found {
+		t.Fatalf("expected the entry before the descriptor to be spooled, got %v", stream.spooled)
+	}
+	var envelope Envelope
+	err = xml.Unmarshal(readDescriptor, &envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	vappTemplate := &types.VAppTemplate{Files: &types.FilesList{File: []*types.File{
+		{Name: "descriptor.ovf", Size: int64(len(descriptor)), BytesTransferred: int64(len(descriptor))},
+		{Name: "disk1.vmdk", Size: 3000, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk1.vmdk"}}},
+		{Name: "disk2.vmdk", Size: 5000, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk2.vmdk"}}},
+		{Name: "disk3.vmdk", Size: 2500, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk3.vmdk"}}},
+	}}}
+
+	callBack, progress := getProgressCallBackFunction()
+	err = stream.uploadFiles(client, vappTemplate, &envelope, 2000, callBack)
+	stream.removeSpool()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, content := range map[string][]byte{"disk1.vmdk": disk1, "disk2.vmdk": disk2, "disk3.vmdk": disk3} {
+		if !bytes.Equal(received[name], content) {
+			t.Errorf("unexpected content received for %s", name)
+		}
+	}
+	expectedRanges := []string{
+		"disk1.vmdk bytes 0-1999/3000", "disk1.vmdk bytes 2000-2999/3000",
+		"disk2.vmdk bytes 0-1999/5000", "disk2.vmdk bytes 2000-2999/5000",
+		"disk2.vmdk bytes 3000-4999/5000",
+		"disk3.vmdk bytes 0-1999/2500", "disk3.vmdk bytes 2000-2499/2500",
+	}
+	if strings.Join(*ranges, ",") != strings.Join(expectedRanges, ",") {
+		t.Errorf("unexpected pieces: %v", *ranges)
+	}
+	if progress.LockedGet() != 100 {
+		t.Errorf("unexpected progress: %f", progress.LockedGet())
+	}
+	if _, err := os.Stat(stream.spoolDir); !os.IsNotExist(err) {
+		t.Errorf("expected spool directory %s to be removed", stream.spoolDir)
+	}
+}
+
+func Test_ovaStreamUploadFilesErrors(t *testing.T) {
+	descriptor := []byte(`<Envelope><References>
+		<File href="disk.vmdk" id="file1" size="5000" chunkSize="3000"/>
+	</References></Envelope>`)
+	server, _, _ := newTestTransferServer(map[string]int{"disk.vmdk": 5000})
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl}
+	var envelope Envelope
+	err := xml.Unmarshal(descriptor, &envelope)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	vappTemplate := &types.VAppTemplate{Files: &types.FilesList{File: []*types.File{
+		{Name: "disk.vmdk", Size: 5000, Link: types.LinkList{{HREF: server.URL + "/transfer/1/disk.vmdk"}}},
+	}}}
+
+	tests := []struct {
+		name          string
+		entries       []testOvaEntry
+		expectedError string
+	}{
+		{
+			name:          "NoDescriptor",
+			entries:       []testOvaEntry{{"disk.vmdk.000000000", make([]byte, 3000)}},
+			expectedError: "no OVF descriptor",
+		},
+		{
+			name: "MissingChunk",
+			entries: []testOvaEntry{
+				{"template.ovf", descriptor},
+				{"disk.vmdk.000000000", make([]byte, 3000)},
+			},
+			expectedError: "file 'disk.vmdk.000000001' not found",
+		},
+		{
+			name: "WrongChunkSize",
+			entries: []testOvaEntry{
+				{"template.ovf", descriptor},
+				{"disk.vmdk.000000000", make([]byte, 2000)},
+			},
+			expectedError: "declares 3000",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := &ovaStream{reader: tar.NewReader(buildTestOva(t, test.entries))}
+			defer stream.removeSpool()
+			_, err := stream.readDescriptor()
+			if err == nil {
+				callBack, _ := getProgressCallBackFunction()
+				err = stream.uploadFiles(client, vappTemplate, &envelope, 0, callBack)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing '%s', got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func Test_uploadSizedStream(t *testing.T) {
+	server, received, _ := newTestTransferServer(map[string]int{"media.iso": 4000})
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL + "/api")
+	client := &Client{Http: *server.Client(), APIVersion: "37.0", VCDHREF: *serverUrl}
+	callBack, _ := getProgressCallBackFunction()
+	details := uploadDetails{
+		uploadLink:       server.URL + "/transfer/1/media.iso",
+		fileSizeToUpload: 4000,
+		uploadPieceSize:  1500,
+		allFilesSize:     4000,
+		callBack:         callBack,
+	}
+
+	// Bytes after the declared size are not sent
+	content := bytes.Repeat([]byte("i"), 4000)
+	err := uploadSizedStream(client, io.MultiReader(bytes.NewReader(content), strings.NewReader("extra")), 4000, details)
+	if err != nil || !bytes.Equal(received["media.iso"], content) {
+		t.Errorf("unexpected upload: %v", err)
+	}
+
+	err = uploadSizedStream(client, bytes.NewReader(content[:3000]), 4000, details)
+	if err == nil || !strings.Contains(err.Error(), "ended after 3000 of 4000 bytes") {
+		t.Errorf("expected error for a short stream, got %v", err)
+	}
+}
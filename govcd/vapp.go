@@ -661,16 +661,17 @@ func (vapp *VApp) ChangeVMName(name string) (Task, error) {
 		types.MimeVM, "error changing VM name: %s", newName)
 }
 
-// SetOvf sets guest properties for the first child VM in vApp
+// SetOvf sets guest properties for the first child VM in vApp. Values are not checked against
+// the declared properties: use VM.SetOvfProperties for validated values
 //
-// Deprecated: Use vm.SetProductSectionList()
+// Deprecated: Use vm.SetOvfProperties()
 func (vapp *VApp) SetOvf(parameters map[string]string) (Task, error) {
 	err := vapp.Refresh()
 	if err != nil {
 		return Task{}, fmt.Errorf("error refreshing vApp before running customization: %s", err)
 	}
 
-	if vapp.VApp.Children == nil {
+	if vapp.VApp.Children == nil || len(vapp.VApp.Children.VM) == 0 {
 		return Task{}, fmt.Errorf("vApp doesn't contain any children, interrupting customization")
 	}
 
@@ -701,6 +702,9 @@ func (vapp *VApp) SetOvf(parameters map[string]string) (Task, error) {
 		types.MimeProductSection, "error setting ovf: %s", ovf)
 }
 
+// ChangeNetworkConfig updates the NIC configuration of the first VM of the vApp.
+//
+// Deprecated: use the typed NIC functions of the VM, such as VM.AddNic and VM.UpdateNic
 func (vapp *VApp) ChangeNetworkConfig(networks []map[string]interface{}, ip string) (Task, error) {
 	err := vapp.Refresh()
 	if err != nil {
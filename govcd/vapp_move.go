@@ -0,0 +1,343 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// VmCopyOptions define how a VM is copied or moved into another vApp by VApp.CopyVM and
+// VApp.MoveVM
+type VmCopyOptions struct {
+	// Name of the VM in the target vApp. The source name is used when empty
+	Name string
+	// NetworkMapping maps the networks of the source VM NICs to networks of the target vApp.
+	// Networks which are not in the map must exist with the same name in the target vApp
+	NetworkMapping map[string]string
+	// StorageProfile of the VM in the target VDC. When nil, the storage profile with the same
+	// name as the current one is used if the target VDC has it, or the VDC default otherwise
+	StorageProfile *types.Reference
+}
+
+// VAppCopyOptions define how a vApp is copied or moved to another VDC by Vdc.CopyVAppFrom and
+// VApp.MoveToVdc
+type VAppCopyOptions struct {
+	// Name and Description of the copied vApp. The source name is used when empty. They are
+	// ignored when moving a vApp
+	Name        string
+	Description string
+	// NetworkMapping maps the Org VDC networks to which the vApp networks are connected to
+	// networks of the target VDC. Networks which are not in the map must exist with the same name
+	// in the target VDC. vApp networks keep their names, so VM NICs don't change
+	NetworkMapping map[string]string
+	// StorageProfile of all the VMs in the target VDC. When nil, MoveToVdc uses for each VM the
+	// storage profile with the same name as its current one if the target VDC has it, or the VDC
+	// default otherwise, while CopyVAppFrom leaves the choice to VCD
+	StorageProfile *types.Reference
+}
+
+// CopyVM starts copying a VM, possibly from another vApp or VDC, into this vApp. The copy gets new
+// MAC addresses, and its IP addresses are allocated again unless they are MANUAL
+func (vapp *VApp) CopyVM(vm *VM, options VmCopyOptions) (Task, error) {
+	return vapp.recomposeWithVm(vm, options, false)
+}
+
+// MoveVM starts moving a powered off VM from another vApp, possibly in another VDC, into this
+// vApp. The VM is removed from its source vApp when the task completes
+func (vapp *VApp) MoveVM(vm *VM, options VmCopyOptions) (Task, error) {
+	poweredOn, err := vm.isPoweredOn()
+	if err != nil {
+		return Task{}, err
+	}
+	if poweredOn {
+		return Task{}, fmt.Errorf("VM '%s' must be powered off to be moved", vm.VM.Name)
+	}
+	return vapp.recomposeWithVm(vm, options, true)
+}
+
+// recomposeWithVm adds a VM to the vApp through a recomposeVApp request with a sourced item,
+// deleting the source VM when sourceDelete is set
+func (vapp *VApp) recomposeWithVm(vm *VM, options VmCopyOptions, sourceDelete bool) (Task, error) {
+	if vapp.VApp.HREF == "" || vm == nil || vm.VM == nil || vm.VM.HREF == "" {
+		return Task{}, fmt.Errorf("vApp and VM must have an HREF")
+	}
+	targetVdc, err := vapp.GetParentVDC()
+	if err != nil {
+		return Task{}, fmt.Errorf("error retrieving VDC of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	storageProfile, err := selectStorageProfile(targetVdc.Vdc, options.StorageProfile, vm.VM.StorageProfile)
+	if err != nil {
+		return Task{}, err
+	}
+
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return Task{}, err
+	}
+	networkConfig, err := vapp.GetNetworkConfig()
+	if err != nil {
+		return Task{}, fmt.Errorf("error retrieving networks of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	section, err = remapNetworkConnections(section, options.NetworkMapping, networkConfig.NetworkNames(), sourceDelete)
+	if err != nil {
+		return Task{}, fmt.Errorf("error mapping networks of VM '%s' to vApp '%s': %s", vm.VM.Name, vapp.VApp.Name, err)
+	}
+
+	name := options.Name
+	if name == "" {
+		name = vm.VM.Name
+	}
+	vAppComposition := &types.ReComposeVAppParams{
+		Ovf:         types.XMLNamespaceOVF,
+		Xsi:         types.XMLNamespaceXSI,
+		Xmlns:       types.XMLNamespaceVCloud,
+		Name:        vapp.VApp.Name,
+		Description: vapp.VApp.Description,
+		SourcedItem: &types.SourcedCompositionItemParam{
+			SourceDelete: sourceDelete,
+			Source:       &types.Reference{HREF: vm.VM.HREF},
+			VMGeneralParams: &types.VMGeneralParams{
+				Name:        name,
+				Description: vm.VM.Description,
+			},
+			InstantiationParams: &types.InstantiationParams{NetworkConnectionSection: section},
+			StorageProfile:      storageProfile,
+		},
+		AllEULAsAccepted: true,
+	}
+
+	apiEndpoint := urlParseRequestURI(vapp.VApp.HREF)
+	apiEndpoint.Path += "/action/recomposeVApp"
+	return vapp.client.ExecuteTaskRequest(apiEndpoint.String(), http.MethodPost,
+		types.MimeRecomposeVappParams, "error adding VM to vApp: %s", vAppComposition)
+}
+
+// CopyVAppFrom starts copying a vApp, possibly from another VDC of the same organization, into
+// this VDC. The copy is not deployed
+func (vdc *Vdc) CopyVAppFrom(sourceVapp *VApp, options VAppCopyOptions) (Task, error) {
+	if sourceVapp == nil || sourceVapp.VApp == nil || sourceVapp.VApp.HREF == "" {
+		return Task{}, fmt.Errorf("source vApp must have an HREF")
+	}
+	networkConfig, err := vdc.vAppNetworksForVdc(sourceVapp, options.NetworkMapping)
+	if err != nil {
+		return Task{}, err
+	}
+	var defaultStorageProfile *types.DefaultStorageProfileSection
+	if options.StorageProfile != nil {
+		storageProfile, err := selectStorageProfile(vdc.Vdc, options.StorageProfile, nil)
+		if err != nil {
+			return Task{}, err
+		}
+		defaultStorageProfile = &types.DefaultStorageProfileSection{StorageProfile: storageProfile.Name}
+	}
+
+	name := options.Name
+	if name == "" {
+		name = sourceVapp.VApp.Name
+	}
+	description := options.Description
+	if description == "" {
+		description = sourceVapp.VApp.Description
+	}
+	isSourceDelete := false
+	params := &types.CloneVAppParams{
+		Ovf:         types.XMLNamespaceOVF,
+		Xmlns:       types.XMLNamespaceVCloud,
+		Name:        name,
+		Description: description,
+		InstantiationParams: &types.InstantiationParams{
+			NetworkConfigSection:         networkConfig,
+			DefaultStorageProfileSection: defaultStorageProfile,
+		},
+		Source:         &types.Reference{HREF: sourceVapp.VApp.HREF},
+		IsSourceDelete: &isSourceDelete,
+	}
+
+	apiEndpoint := urlParseRequestURI(vdc.Vdc.HREF)
+	apiEndpoint.Path += "/action/cloneVApp"
+	vapp := NewVApp(vdc.client)
+	_, err = vdc.client.ExecuteRequest(apiEndpoint.String(), http.MethodPost,
+		types.MimeCloneVapp, "error copying vApp: %s", params, vapp.VApp)
+	if err != nil {
+		return Task{}, err
+	}
+	return vappCreationTask(vapp)
+}
+
+// MoveToVdc starts moving the vApp to another VDC of the same organization. The VMs of the vApp
+// must be powered off
+func (vapp *VApp) MoveToVdc(vdc *Vdc, options VAppCopyOptions) (Task, error) {
+	if vapp.VApp.HREF == "" || vdc == nil || vdc.Vdc == nil || vdc.Vdc.HREF == "" {
+		return Task{}, fmt.Errorf("vApp and VDC must have an HREF")
+	}
+	err := vapp.Refresh()
+	if err != nil {
+		return Task{}, fmt.Errorf("error refreshing vApp: %s", err)
+	}
+	networkConfig, err := vdc.vAppNetworksForVdc(vapp, options.NetworkMapping)
+	if err != nil {
+		return Task{}, err
+	}
+
+	params := &types.MoveVAppParams{
+		Ovf:                  types.XMLNamespaceOVF,
+		Xmlns:                types.XMLNamespaceVCloud,
+		Source:               &types.Reference{HREF: vapp.VApp.HREF},
+		NetworkConfigSection: networkConfig,
+	}
+	if vapp.VApp.Children != nil {
+		for _, child := range vapp.VApp.Children.VM {
+			storageProfile, err := selectStorageProfile(vdc.Vdc, options.StorageProfile, child.StorageProfile)
+			if err != nil {
+				return Task{}, err
+			}
+			item := &types.SourcedCompositionItemParam{
+				Source:         &types.Reference{HREF: child.HREF},
+				StorageProfile: storageProfile,
+			}
+			if child.NetworkConnectionSection != nil {
+				// vApp networks keep their names, so the NICs are sent unchanged
+				section, err := remapNetworkConnections(child.NetworkConnectionSection, nil, nil, true)
+				if err != nil {
+					return Task{}, err
+				}
+				item.InstantiationParams = &types.InstantiationParams{NetworkConnectionSection: section}
+			}
+			params.SourcedItem = append(params.SourcedItem, item)
+		}
+	}
+
+	apiEndpoint := urlParseRequestURI(vdc.Vdc.HREF)
+	apiEndpoint.Path += "/action/moveVApp"
+	movedVapp := NewVApp(vdc.client)
+	_, err = vdc.client.ExecuteRequest(apiEndpoint.String(), http.MethodPost,
+		types.MimeMoveVappParams, "error moving vApp: %s", params, movedVapp.VApp)
+	if err != nil {
+		return Task{}, err
+	}
+	return vappCreationTask(movedVapp)
+}
+
+// vappCreationTask returns the task running on a vApp returned by a clone or move request
+func vappCreationTask(vapp *VApp) (Task, error) {
+	if vapp.VApp.Tasks == nil || len(vapp.VApp.Tasks.Task) == 0 {
+		return Task{}, fmt.Errorf("no task found for vApp '%s'", vapp.VApp.Name)
+	}
+	task := NewTask(vapp.client)
+	task.Task = vapp.VApp.Tasks.Task[0]
+	return *task, nil
+}
+
+// vAppNetworksForVdc returns the network configuration of the vApp with the parent networks
+// replaced by the corresponding networks of this VDC
+func (vdc *Vdc) vAppNetworksForVdc(vapp *VApp, mapping map[string]string) (*types.NetworkConfigSection, error) {
+	networkConfig, err := vapp.GetNetworkConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving networks of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	lookup := func(name string) (*types.Reference, error) {
+		network, err := vdc.GetOrgVdcNetworkByName(name, false)
+		if err != nil {
+			return nil, fmt.Errorf("network '%s' not found in VDC '%s': %s", name, vdc.Vdc.Name, err)
+		}
+		return &types.Reference{HREF: network.OrgVDCNetwork.HREF, Name: network.OrgVDCNetwork.Name, ID: network.OrgVDCNetwork.ID}, nil
+	}
+	return remapVAppNetworks(networkConfig, mapping, lookup)
+}
+
+// selectStorageProfile returns the storage profile of the VDC to use for a VM. The requested
+// profile must exist in the VDC. Otherwise, the profile with the same HREF or name as the current
+// one is used when the VDC has it, or nil to use the VDC default
+func selectStorageProfile(vdc *types.Vdc, requested, current *types.Reference) (*types.Reference, error) {
+	find := func(reference *types.Reference) *types.Reference {
+		if vdc.VdcStorageProfiles == nil {
+			return nil
+		}
+		for _, storageProfile := range vdc.VdcStorageProfiles.VdcStorageProfile {
+			if (reference.HREF != "" && storageProfile.HREF == reference.HREF) ||
+				(reference.Name != "" && storageProfile.Name == reference.Name) {
+				return &types.Reference{HREF: storageProfile.HREF, Name: storageProfile.Name, ID: storageProfile.ID}
+			}
+		}
+		return nil
+	}
+	if requested != nil {
+		storageProfile := find(requested)
+		if storageProfile == nil {
+			return nil, fmt.Errorf("storage profile '%s' not found in VDC '%s'", requested.Name+requested.HREF, vdc.Name)
+		}
+		return storageProfile, nil
+	}
+	if current != nil {
+		return find(current), nil
+	}
+	return nil, nil
+}
+
+// remapNetworkConnections returns a copy of the section, suitable for a recompose request, with
+// the NIC networks renamed according to the mapping. When available is not nil, every network
+// must be one of the available networks. MAC addresses and allocated IP addresses are kept only
+// when keepAddresses is set, as a copy of a VM which is not deleted can't use them
+func remapNetworkConnections(section *types.NetworkConnectionSection, mapping map[string]string, available []string, keepAddresses bool) (*types.NetworkConnectionSection, error) {
+	availableNetworks := make(map[string]bool)
+	for _, name := range available {
+		availableNetworks[name] = true
+	}
+	remapped := &types.NetworkConnectionSection{
+		Info:                          "Network connection section",
+		PrimaryNetworkConnectionIndex: section.PrimaryNetworkConnectionIndex,
+	}
+	for _, connection := range section.NetworkConnection {
+		updated := *connection
+		if target, found := mapping[connection.Network]; found {
+			updated.Network = target
+		}
+		if available != nil && updated.Network != types.NoneNetwork && !availableNetworks[updated.Network] {
+			return nil, fmt.Errorf("network '%s' of NIC %d is not available", updated.Network, connection.NetworkConnectionIndex)
+		}
+		if !keepAddresses {
+			updated.MACAddress = ""
+			if updated.IPAddressAllocationMode != types.IPAllocationModeManual {
+				updated.IPAddress = ""
+			}
+		}
+		remapped.NetworkConnection = append(remapped.NetworkConnection, &updated)
+	}
+	return remapped, nil
+}
+
+// remapVAppNetworks returns a copy of the network configuration, suitable for a clone or move
+// request, where the parent network of each vApp network is replaced by the network found by
+// lookup, using the mapped name when the parent network is in the mapping
+func remapVAppNetworks(networkConfig *types.NetworkConfigSection, mapping map[string]string,
+	lookup func(name string) (*types.Reference, error)) (*types.NetworkConfigSection, error) {
+	remapped := &types.NetworkConfigSection{Info: "Configuration parameters for logical networks"}
+	for _, network := range networkConfig.NetworkConfig {
+		updated := types.VAppNetworkConfiguration{
+			NetworkName:   network.NetworkName,
+			Description:   network.Description,
+			Configuration: network.Configuration,
+			IsDeployed:    false,
+		}
+		if network.Configuration != nil && network.Configuration.ParentNetwork != nil {
+			parentName := network.Configuration.ParentNetwork.Name
+			if target, found := mapping[parentName]; found {
+				parentName = target
+			}
+			parent, err := lookup(parentName)
+			if err != nil {
+				return nil, fmt.Errorf("error mapping vApp network '%s': %s", network.NetworkName, err)
+			}
+			configuration := *network.Configuration
+			configuration.ParentNetwork = parent
+			updated.Configuration = &configuration
+		}
+		remapped.NetworkConfig = append(remapped.NetworkConfig, updated)
+	}
+	return remapped, nil
+}
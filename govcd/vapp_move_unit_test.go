@@ -0,0 +1,175 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_selectStorageProfile(t *testing.T) {
+	vdc := &types.Vdc{
+		Name: "target",
+		VdcStorageProfiles: &types.VdcStorageProfiles{VdcStorageProfile: []*types.Reference{
+			{HREF: "https://vcd/sp/gold", Name: "gold"},
+			{HREF: "https://vcd/sp/silver", Name: "silver"},
+		}},
+	}
+	tests := []struct {
+		name      string
+		requested *types.Reference
+		current   *types.Reference
+		wantHref  string
+		wantErr   bool
+	}{
+		{name: "requested by name", requested: &types.Reference{Name: "silver"}, wantHref: "https://vcd/sp/silver"},
+		{name: "requested by HREF", requested: &types.Reference{HREF: "https://vcd/sp/gold"}, wantHref: "https://vcd/sp/gold"},
+		{name: "requested missing", requested: &types.Reference{Name: "bronze"}, wantErr: true},
+		{name: "current name in other VDC", current: &types.Reference{HREF: "https://other/sp/gold", Name: "gold"}, wantHref: "https://vcd/sp/gold"},
+		{name: "current missing", current: &types.Reference{HREF: "https://other/sp/bronze", Name: "bronze"}},
+		{name: "nothing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageProfile, err := selectStorageProfile(vdc, tt.requested, tt.current)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			gotHref := ""
+			if storageProfile != nil {
+				gotHref = storageProfile.HREF
+			}
+			if gotHref != tt.wantHref {
+				t.Errorf("expected storage profile '%s', got '%s'", tt.wantHref, gotHref)
+			}
+		})
+	}
+}
+
+func Test_remapNetworkConnections(t *testing.T) {
+	section := &types.NetworkConnectionSection{
+		HREF:                          "https://vcd/vm/networkConnectionSection/",
+		PrimaryNetworkConnectionIndex: 1,
+		NetworkConnection: []*types.NetworkConnection{
+			{Network: "net-a", NetworkConnectionIndex: 0, MACAddress: "00:50:56:01:02:03",
+				IPAddressAllocationMode: types.IPAllocationModePool, IPAddress: "10.0.0.10"},
+			{Network: "net-b", NetworkConnectionIndex: 1, MACAddress: "00:50:56:01:02:04",
+				IPAddressAllocationMode: types.IPAllocationModeManual, IPAddress: "10.0.1.10"},
+			{Network: types.NoneNetwork, NetworkConnectionIndex: 2},
+		},
+	}
+
+	remapped, err := remapNetworkConnections(section, map[string]string{"net-a": "net-c"}, []string{"net-b", "net-c"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if remapped.HREF != "" || remapped.PrimaryNetworkConnectionIndex != 1 || len(remapped.NetworkConnection) != 3 {
+		t.Fatalf("unexpected section: %+v", remapped)
+	}
+	if remapped.NetworkConnection[0].Network != "net-c" || remapped.NetworkConnection[1].Network != "net-b" {
+		t.Errorf("unexpected networks: %s, %s", remapped.NetworkConnection[0].Network, remapped.NetworkConnection[1].Network)
+	}
+	if section.NetworkConnection[0].Network != "net-a" || section.NetworkConnection[0].MACAddress == "" {
+		t.Errorf("source section was modified")
+	}
+	// A copy gets new MAC addresses and allocated IP addresses, but keeps manual ones
+	for _, connection := range remapped.NetworkConnection {
+		if connection.MACAddress != "" {
+			t.Errorf("expected no MAC address for the copy of NIC %d, got %s", connection.NetworkConnectionIndex, connection.MACAddress)
+		}
+	}
+	if remapped.NetworkConnection[0].IPAddress != "" || remapped.NetworkConnection[1].IPAddress != "10.0.1.10" {
+		t.Errorf("unexpected IP addresses: %s, %s", remapped.NetworkConnection[0].IPAddress, remapped.NetworkConnection[1].IPAddress)
+	}
+	moved, err := remapNetworkConnections(section, nil, nil, true)
+	if err != nil || moved.NetworkConnection[0].MACAddress != "00:50:56:01:02:03" || moved.NetworkConnection[0].IPAddress != "10.0.0.10" {
+		t.Errorf("expected a move to keep the addresses, got %+v, %v", moved.NetworkConnection[0], err)
+	}
+
+	_, err = remapNetworkConnections(section, nil, []string{"net-b"}, true)
+	if err == nil {
+		t.Errorf("expected error for unavailable network")
+	}
+	_, err = remapNetworkConnections(section, nil, nil, false)
+	if err != nil {
+		t.Errorf("unexpected error without available networks: %s", err)
+	}
+}
+
+func Test_remapVAppNetworks(t *testing.T) {
+	networkConfig := &types.NetworkConfigSection{
+		HREF: "https://vcd/vapp/networkConfigSection/",
+		NetworkConfig: []types.VAppNetworkConfiguration{
+			{NetworkName: "routed", IsDeployed: true, Configuration: &types.NetworkConfiguration{
+				FenceMode: types.FenceModeNAT, ParentNetwork: &types.Reference{Name: "source-net", HREF: "https://vcd/source-net"}}},
+			{NetworkName: "direct", Configuration: &types.NetworkConfiguration{
+				FenceMode: types.FenceModeBridged, ParentNetwork: &types.Reference{Name: "shared-net", HREF: "https://vcd/shared-net"}}},
+			{NetworkName: "isolated", Configuration: &types.NetworkConfiguration{FenceMode: types.FenceModeIsolated}},
+		},
+	}
+	targetNetworks := map[string]string{"target-net": "https://target/target-net", "shared-net": "https://target/shared-net"}
+	lookup := func(name string) (*types.Reference, error) {
+		href, found := targetNetworks[name]
+		if !found {
+			return nil, fmt.Errorf("network '%s' not found", name)
+		}
+		return &types.Reference{Name: name, HREF: href}, nil
+	}
+
+	remapped, err := remapVAppNetworks(networkConfig, map[string]string{"source-net": "target-net"}, lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(remapped.NetworkConfig) != 3 {
+		t.Fatalf("expected 3 networks, got %d", len(remapped.NetworkConfig))
+	}
+	if remapped.NetworkConfig[0].NetworkName != "routed" || remapped.NetworkConfig[0].IsDeployed ||
+		remapped.NetworkConfig[0].Configuration.ParentNetwork.HREF != "https://target/target-net" {
+		t.Errorf("unexpected routed network: %+v", remapped.NetworkConfig[0].Configuration.ParentNetwork)
+	}
+	if remapped.NetworkConfig[1].Configuration.ParentNetwork.HREF != "https://target/shared-net" {
+		t.Errorf("unexpected direct network: %+v", remapped.NetworkConfig[1].Configuration.ParentNetwork)
+	}
+	if remapped.NetworkConfig[2].Configuration.ParentNetwork != nil {
+		t.Errorf("isolated network should have no parent")
+	}
+	if networkConfig.NetworkConfig[0].Configuration.ParentNetwork.Name != "source-net" {
+		t.Errorf("source configuration was modified")
+	}
+
+	_, err = remapVAppNetworks(networkConfig, nil, lookup)
+	if err == nil {
+		t.Errorf("expected error for unmapped network missing in target VDC")
+	}
+}
+
+func Test_MoveVAppParamsMarshal(t *testing.T) {
+	params := &types.MoveVAppParams{
+		Ovf:    types.XMLNamespaceOVF,
+		Xmlns:  types.XMLNamespaceVCloud,
+		Source: &types.Reference{HREF: "https://vcd/vapp"},
+		SourcedItem: []*types.SourcedCompositionItemParam{
+			{Source: &types.Reference{HREF: "https://vcd/vm1"}},
+			{Source: &types.Reference{HREF: "https://vcd/vm2"}, StorageProfile: &types.Reference{HREF: "https://vcd/sp"}},
+		},
+	}
+	output, err := xml.Marshal(params)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	text := string(output)
+	if !strings.HasPrefix(text, "<MoveVAppParams") || strings.Count(text, "<SourcedItem>") != 2 {
+		t.Errorf("unexpected XML: %s", text)
+	}
+	if strings.Contains(text, "NetworkConfigSection") {
+		t.Errorf("empty network config section should be omitted: %s", text)
+	}
+}
@@ -0,0 +1,108 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// GetStartupSection retrieves the start and stop order of the VMs of the vApp
+func (vapp *VApp) GetStartupSection() (*types.StartupSection, error) {
+	if vapp.VApp.HREF == "" {
+		return nil, fmt.Errorf("cannot retrieve startup section, vApp HREF is unset")
+	}
+	startupSection := &types.StartupSection{}
+	_, err := vapp.client.ExecuteRequest(vapp.VApp.HREF+"/startupSection/", http.MethodGet,
+		types.MimeStartupSection, "error retrieving vApp startup section: %s", nil, startupSection)
+	if err != nil {
+		return nil, err
+	}
+	return startupSection, nil
+}
+
+// UpdateStartupSectionAsync starts the update of the start and stop order of the VMs of the vApp
+func (vapp *VApp) UpdateStartupSectionAsync(startupSection *types.StartupSection) (Task, error) {
+	if vapp.VApp.HREF == "" {
+		return Task{}, fmt.Errorf("cannot update startup section, vApp HREF is unset")
+	}
+	if startupSection == nil {
+		return Task{}, fmt.Errorf("startup section must not be nil")
+	}
+	payload := &types.StartupSection{
+		Info: startupSection.Info,
+		Item: startupSection.Item,
+	}
+	if payload.Info == "" {
+		payload.Info = "VApp startup section"
+	}
+	return vapp.client.ExecuteTaskRequest(vapp.VApp.HREF+"/startupSection/", http.MethodPut,
+		types.MimeStartupSection, "error updating vApp startup section: %s", payload)
+}
+
+// UpdateStartupSection updates the start and stop order of the VMs of the vApp and returns the
+// resulting startup section
+func (vapp *VApp) UpdateStartupSection(startupSection *types.StartupSection) (*types.StartupSection, error) {
+	task, err := vapp.UpdateStartupSectionAsync(startupSection)
+	if err != nil {
+		return nil, err
+	}
+	err = task.WaitTaskCompletion()
+	if err != nil {
+		return nil, err
+	}
+	return vapp.GetStartupSection()
+}
+
+// SetStartupOrder starts the VMs of the vApp in the order of vmNames, waiting startDelay seconds
+// after starting each VM, and stops them in reverse order, waiting stopDelay seconds after
+// stopping each VM. VMs which are not in vmNames start together after the listed ones.
+// Start and stop actions of the VMs are left unchanged
+func (vapp *VApp) SetStartupOrder(vmNames []string, startDelay, stopDelay int) error {
+	startupSection, err := vapp.GetStartupSection()
+	if err != nil {
+		return err
+	}
+	err = applyStartupOrder(startupSection, vmNames, startDelay, stopDelay)
+	if err != nil {
+		return fmt.Errorf("error setting startup order of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	_, err = vapp.UpdateStartupSection(startupSection)
+	return err
+}
+
+// applyStartupOrder sets order and delays of the items of a startup section
+func applyStartupOrder(startupSection *types.StartupSection, vmNames []string, startDelay, stopDelay int) error {
+	if startDelay < 0 || stopDelay < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+	items := make(map[string]*types.StartupSectionItem)
+	for _, item := range startupSection.Item {
+		items[item.ID] = item
+	}
+
+	ordered := make(map[string]bool)
+	for position, name := range vmNames {
+		item, found := items[name]
+		if !found {
+			return fmt.Errorf("VM '%s' not found in startup section", name)
+		}
+		if ordered[name] {
+			return fmt.Errorf("VM '%s' is listed more than once", name)
+		}
+		ordered[name] = true
+		item.Order = position + 1
+		item.StartDelay = startDelay
+		item.StopDelay = stopDelay
+	}
+	for _, item := range startupSection.Item {
+		if !ordered[item.ID] {
+			item.Order = len(vmNames) + 1
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_applyStartupOrder(t *testing.T) {
+	startupSection := &types.StartupSection{}
+	err := xml.Unmarshal([]byte(`<ovf:StartupSection xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1"
+    xmlns:vcloud="http://www.vmware.com/vcloud/v1.5" vcloud:type="application/vnd.vmware.vcloud.startupSection+xml">
+  <ovf:Info>VApp startup section</ovf:Info>
+  <ovf:Item ovf:id="web" ovf:order="0" ovf:startAction="powerOn" ovf:startDelay="0" ovf:waitingForGuest="false" ovf:stopAction="powerOff" ovf:stopDelay="0"/>
+  <ovf:Item ovf:id="db" ovf:order="0" ovf:startAction="powerOn" ovf:startDelay="0" ovf:waitingForGuest="false" ovf:stopAction="guestShutdown" ovf:stopDelay="0"/>
+  <ovf:Item ovf:id="app" ovf:order="0" ovf:startAction="powerOn" ovf:startDelay="0" ovf:waitingForGuest="true" ovf:stopAction="powerOff" ovf:stopDelay="0"/>
+  <ovf:Item ovf:id="tools" ovf:order="0" ovf:startAction="none" ovf:startDelay="0" ovf:waitingForGuest="false" ovf:stopAction="powerOff" ovf:stopDelay="0"/>
+</ovf:StartupSection>`), startupSection)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(startupSection.Item) != 4 || startupSection.Type != types.MimeStartupSection {
+		t.Fatalf("unexpected startup section: %+v", startupSection)
+	}
+
+	err = applyStartupOrder(startupSection, []string{"db", "app", "web"}, 30, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedOrder := map[string]int{"db": 1, "app": 2, "web": 3, "tools": 4}
+	for _, item := range startupSection.Item {
+		if item.Order != expectedOrder[item.ID] {
+			t.Errorf("expected order %d for %s, got %d", expectedOrder[item.ID], item.ID, item.Order)
+		}
+		if item.ID != "tools" && (item.StartDelay != 30 || item.StopDelay != 10) {
+			t.Errorf("unexpected delays for %s: %d, %d", item.ID, item.StartDelay, item.StopDelay)
+		}
+	}
+	if startupSection.Item[1].StopAction != "guestShutdown" || !startupSection.Item[2].WaitingForGuest {
+		t.Errorf("actions must be preserved")
+	}
+
+	if applyStartupOrder(startupSection, []string{"missing"}, 0, 0) == nil {
+		t.Errorf("expected error for unknown VM")
+	}
+	if applyStartupOrder(startupSection, []string{"db", "db"}, 0, 0) == nil {
+		t.Errorf("expected error for duplicate VM")
+	}
+	if applyStartupOrder(startupSection, []string{"db"}, -1, 0) == nil {
+		t.Errorf("expected error for negative delay")
+	}
+}
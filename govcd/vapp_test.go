@@ -1908,3 +1908,104 @@ func (vcd *TestVCD) Test_Vapp_LeaseUpdate(check *C) {
 	err = task.WaitTaskCompletion()
 	check.Assert(err, IsNil)
 }
+
+// Test_VAppStartupSection sets the startup order of a vApp and verifies the delays
+func (vcd *TestVCD) Test_VAppStartupSection(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	startupSection, err := vapp.GetStartupSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(startupSection.Item), Equals, 1)
+	check.Assert(startupSection.Item[0].ID, Equals, vm.VM.Name)
+
+	err = vapp.SetStartupOrder([]string{vm.VM.Name}, 45, 15)
+	check.Assert(err, IsNil)
+	startupSection, err = vapp.GetStartupSection()
+	check.Assert(err, IsNil)
+	check.Assert(startupSection.Item[0].Order, Equals, 1)
+	check.Assert(startupSection.Item[0].StartDelay, Equals, 45)
+	check.Assert(startupSection.Item[0].StopDelay, Equals, 15)
+
+	startupSection.Item[0].StopAction = "guestShutdown"
+	startupSection, err = vapp.UpdateStartupSection(startupSection)
+	check.Assert(err, IsNil)
+	check.Assert(startupSection.Item[0].StopAction, Equals, "guestShutdown")
+
+	err = vapp.SetStartupOrder([]string{"missing-" + check.TestName()}, 0, 0)
+	check.Assert(err, NotNil)
+
+	// Cleanup
+	task, err := vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VAppCopyAndMoveVm copies and moves a VM into another vApp, then copies the vApp
+func (vcd *TestVCD) Test_VAppCopyAndMoveVm(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	targetName := check.TestName() + "-target"
+	targetVapp, err := vcd.nsxtVdc.CreateRawVApp(targetName, "")
+	check.Assert(err, IsNil)
+	AddToCleanupList(targetName, "vapp", vcd.nsxtVdc.Vdc.Name, check.TestName())
+
+	task, err := targetVapp.CopyVM(vm, VmCopyOptions{Name: vm.VM.Name + "-copy"})
+	check.Assert(err, IsNil)
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+	_, err = targetVapp.GetVMByName(vm.VM.Name+"-copy", true)
+	check.Assert(err, IsNil)
+
+	_, err = targetVapp.CopyVM(vm, VmCopyOptions{NetworkMapping: map[string]string{"missing": "missing"}, StorageProfile: &types.Reference{Name: "missing-" + check.TestName()}})
+	check.Assert(err, NotNil)
+
+	// A powered on VM can't be moved
+	_, err = targetVapp.MoveVM(vm, VmCopyOptions{})
+	check.Assert(err, NotNil)
+	task, err = vm.PowerOff()
+	check.Assert(err, IsNil)
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+
+	task, err = targetVapp.MoveVM(vm, VmCopyOptions{})
+	check.Assert(err, IsNil)
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+	_, err = targetVapp.GetVMByName(vm.VM.Name, true)
+	check.Assert(err, IsNil)
+	_, err = vapp.GetVMByName(vm.VM.Name, true)
+	check.Assert(ContainsNotFound(err), Equals, true)
+
+	copyName := check.TestName() + "-copy"
+	task, err = vcd.nsxtVdc.CopyVAppFrom(targetVapp, VAppCopyOptions{Name: copyName})
+	check.Assert(err, IsNil)
+	AddToCleanupList(copyName, "vapp", vcd.nsxtVdc.Vdc.Name, check.TestName())
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+	vappCopy, err := vcd.nsxtVdc.GetVAppByName(copyName, true)
+	check.Assert(err, IsNil)
+	check.Assert(vappCopy.VApp.Children, NotNil)
+	check.Assert(len(vappCopy.VApp.Children.VM), Equals, 2)
+
+	// Cleanup
+	for _, toDelete := range []*VApp{vappCopy, targetVapp, vapp} {
+		task, err = toDelete.Undeploy()
+		if err == nil {
+			check.Assert(task.WaitTaskCompletion(), IsNil)
+		}
+		task, err = toDelete.Delete()
+		check.Assert(err, IsNil)
+		check.Assert(task.WaitTaskCompletion(), IsNil)
+	}
+}
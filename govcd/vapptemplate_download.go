@@ -0,0 +1,289 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// EnableDownload prepares the vApp template for download and returns the URL of its OVF
+// descriptor. Depending on the size of the template, it may take a long time
+func (vAppTemplate *VAppTemplate) EnableDownload() (string, error) {
+	if vAppTemplate.VAppTemplate == nil || vAppTemplate.VAppTemplate.HREF == "" {
+		return "", fmt.Errorf("cannot enable download, vApp template HREF is unset")
+	}
+	enableHref := hrefForRel(vAppTemplate.VAppTemplate.Link, types.RelEnable, vAppTemplate.VAppTemplate.HREF+"/action/enableDownload")
+	task, err := vAppTemplate.client.ExecuteTaskRequest(enableHref, http.MethodPost, "",
+		"error enabling download of vApp template: %s", nil)
+	if err != nil {
+		return "", err
+	}
+	err = task.WaitTaskCompletion()
+	if err != nil {
+		return "", err
+	}
+	err = vAppTemplate.Refresh()
+	if err != nil {
+		return "", err
+	}
+	descriptorHref := hrefForRel(vAppTemplate.VAppTemplate.Link, types.RelDownloadDefault, "")
+	if descriptorHref == "" {
+		return "", fmt.Errorf("no download URL found for vApp template '%s'", vAppTemplate.VAppTemplate.Name)
+	}
+	return descriptorHref, nil
+}
+
+// DownloadOvf downloads the vApp template as an OVF package in the given directory, which is
+// created when needed. It returns the path of the OVF descriptor, named after the template.
+// Every file referenced by the descriptor is stored next to it, and its size is checked against
+// the size declared in the descriptor
+func (vAppTemplate *VAppTemplate) DownloadOvf(dir string) (string, error) {
+	descriptorHref, err := vAppTemplate.EnableDownload()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return "", fmt.Errorf("error creating directory '%s': %s", dir, err)
+	}
+	sink := &ovfDirectorySink{dir: dir}
+	err = downloadOvfPackage(context.Background(), vAppTemplate.client, descriptorHref, ovfDescriptorName(vAppTemplate.VAppTemplate.Name), sink)
+	if err != nil {
+		return "", err
+	}
+	return sink.descriptorPath, nil
+}
+
+// DownloadOva streams the vApp template as an OVA archive to the writer. The OVF descriptor is
+// the first entry of the archive, followed by the files it references in order. The size of every
+// file is checked against the size declared in the descriptor
+func (vAppTemplate *VAppTemplate) DownloadOva(writer io.Writer) error {
+	return vAppTemplate.DownloadOvaContext(context.Background(), writer)
+}
+
+// DownloadOvaContext is like DownloadOva, but stops the transfer when the context is done
+func (vAppTemplate *VAppTemplate) DownloadOvaContext(ctx context.Context, writer io.Writer) error {
+	descriptorHref, err := vAppTemplate.EnableDownload()
+	if err != nil {
+		return err
+	}
+	sink := &ovaSink{writer: tar.NewWriter(writer)}
+	err = downloadOvfPackage(ctx, vAppTemplate.client, descriptorHref, ovfDescriptorName(vAppTemplate.VAppTemplate.Name), sink)
+	if err != nil {
+		return err
+	}
+	err = sink.writer.Close()
+	if err != nil {
+		return fmt.Errorf("error closing OVA archive: %s", err)
+	}
+	return nil
+}
+
+// ovfPackageSink receives the files of an OVF package
+type ovfPackageSink interface {
+	writeDescriptor(name string, content []byte) error
+	// createFile returns the writer of a file of the package, whose size is -1 when unknown, and
+	// the function to call once its content is written
+	createFile(name string, size int64) (io.Writer, func() error, error)
+}
+
+// downloadOvfPackage downloads the descriptor and the files it references, passing them to the sink
+func downloadOvfPackage(ctx context.Context, client *Client, descriptorHref, descriptorName string, sink ovfPackageSink) error {
+	descriptorUrl, err := url.ParseRequestURI(descriptorHref)
+	if err != nil {
+		return fmt.Errorf("error parsing descriptor URL '%s': %s", descriptorHref, err)
+	}
+	var descriptor bytes.Buffer
+	_, err = downloadTransferUrl(ctx, client, descriptorHref, &descriptor, nil)
+	if err != nil {
+		return fmt.Errorf("error downloading OVF descriptor: %s", err)
+	}
+	var envelope Envelope
+	err = xml.Unmarshal(descriptor.Bytes(), &envelope)
+	if err != nil {
+		return fmt.Errorf("error parsing OVF descriptor: %s", err)
+	}
+	for _, file := range envelope.File {
+		err = validateOvfFileReference(file.HREF)
+		if err != nil {
+			return err
+		}
+		if file.ChunkSize > 0 {
+			return fmt.Errorf("file '%s' is chunked, which is not supported", file.HREF)
+		}
+	}
+
+	err = sink.writeDescriptor(descriptorName, descriptor.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, file := range envelope.File {
+		fileUrl := *descriptorUrl
+		fileUrl.Path = path.Join(path.Dir(descriptorUrl.Path), file.HREF)
+		fileUrl.RawPath = ""
+		util.Logger.Printf("[TRACE] downloading OVF file '%s' from %s", file.HREF, fileUrl.String())
+
+		err = downloadOvfFile(ctx, client, fileUrl.String(), file.HREF, int64(file.Size), sink)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadOvfFile streams a file of the package to the sink and checks its size
+func downloadOvfFile(ctx context.Context, client *Client, fileHref, name string, declaredSize int64, sink ovfPackageSink) error {
+	size := int64(-1)
+	if declaredSize > 0 {
+		size = declaredSize
+	}
+	writer, finish, err := sink.createFile(name, size)
+	if err != nil {
+		return fmt.Errorf("error creating file '%s': %s", name, err)
+	}
+	download := &rangeDownload{client: client, href: fileHref, writer: writer, expectedSize: declaredSize}
+	written, err := download.run(ctx)
+	finishErr := finish()
+	if err != nil {
+		return fmt.Errorf("error downloading file '%s': %s", name, err)
+	}
+	if declaredSize > 0 && written != declaredSize {
+		return fmt.Errorf("file '%s' has %d bytes, but the descriptor declares %d", name, written, declaredSize)
+	}
+	if finishErr != nil {
+		return fmt.Errorf("error writing file '%s': %s", name, finishErr)
+	}
+	return nil
+}
+
+// validateOvfFileReference rejects file references which would be written outside of the package
+func validateOvfFileReference(href string) error {
+	if href == "" || strings.Contains(href, "://") || path.IsAbs(href) || filepath.IsAbs(href) ||
+		path.Clean(href) != href || strings.HasPrefix(href, "..") || strings.Contains(href, "\\") {
+		return fmt.Errorf("invalid file reference '%s' in OVF descriptor", href)
+	}
+	return nil
+}
+
+// ovfDescriptorName returns the name of the descriptor of a template
+func ovfDescriptorName(templateName string) string {
+	name := strings.Trim(unsafeFileNameCharacters.ReplaceAllString(templateName, "_"), "._")
+	if name == "" {
+		name = "descriptor"
+	}
+	return name + ".ovf"
+}
+
+// ovfDirectorySink writes the package files to a directory
+type ovfDirectorySink struct {
+	dir            string
+	descriptorPath string
+}
+
+func (sink *ovfDirectorySink) writeDescriptor(name string, content []byte) error {
+	sink.descriptorPath = filepath.Join(sink.dir, name)
+	err := os.WriteFile(sink.descriptorPath, content, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing OVF descriptor: %s", err)
+	}
+	return nil
+}
+
+func (sink *ovfDirectorySink) createFile(name string, _ int64) (io.Writer, func() error, error) {
+	filePath := filepath.Join(sink.dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(filePath), 0750)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Create(filepath.Clean(filePath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
+
+// ovaSink writes the package files to a tar archive
+type ovaSink struct {
+	writer *tar.Writer
+}
+
+func (sink *ovaSink) writeDescriptor(name string, content []byte) error {
+	err := sink.writeHeader(name, int64(len(content)))
+	if err == nil {
+		_, err = sink.writer.Write(content)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing OVF descriptor: %s", err)
+	}
+	return nil
+}
+
+func (sink *ovaSink) createFile(name string, size int64) (io.Writer, func() error, error) {
+	if size >= 0 {
+		err := sink.writeHeader(name, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Flush fails when the entry is shorter than its header declares
+		return sink.writer, sink.writer.Flush, nil
+	}
+	// The size of a tar entry must be known before its content: files of unknown size are
+	// buffered in a temporary file
+	tempFile, err := os.CreateTemp("", "ova-entry-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	finish := func() error {
+		defer func() {
+			_ = tempFile.Close()
+			err := os.Remove(tempFile.Name())
+			if err != nil {
+				util.Logger.Printf("[WARN] error removing temporary file '%s': %s", tempFile.Name(), err)
+			}
+		}()
+		size, err := tempFile.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		_, err = tempFile.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = sink.writeHeader(name, size)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(sink.writer, tempFile)
+		return err
+	}
+	return tempFile, finish, nil
+}
+
+func (sink *ovaSink) writeHeader(name string, size int64) error {
+	return sink.writer.WriteHeader(&tar.Header{
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatUSTAR,
+	})
+}
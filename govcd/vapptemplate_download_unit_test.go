@@ -0,0 +1,142 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOvfDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1">
+  <References>
+    <File href="disk1.vmdk" id="file1" size="%d"/>
+    <File href="nvram/vm.nvram" id="file2"/>
+  </References>
+</Envelope>`
+
+func testOvfServer(t *testing.T, descriptor string, files map[string]string) (*Client, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transfer/abc/descriptor.ovf" {
+			_, _ = w.Write([]byte(descriptor))
+			return
+		}
+		content, ok := files[strings.TrimPrefix(r.URL.Path, "/transfer/abc/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Flushing first sends the content without length
+		if strings.HasSuffix(r.URL.Path, ".nvram") {
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return &Client{Http: *server.Client(), APIVersion: "37.0"}, server.URL + "/transfer/abc/descriptor.ovf"
+}
+
+func Test_downloadOvfPackage(t *testing.T) {
+	files := map[string]string{"disk1.vmdk": "disk content", "nvram/vm.nvram": "nvram content"}
+	descriptor := strings.Replace(testOvfDescriptor, "%d", "12", 1)
+	client, descriptorHref := testOvfServer(t, descriptor, files)
+
+	dir := t.TempDir()
+	sink := &ovfDirectorySink{dir: dir}
+	err := downloadOvfPackage(context.Background(), client, descriptorHref, ovfDescriptorName("my template"), sink)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sink.descriptorPath != filepath.Join(dir, "my_template.ovf") {
+		t.Errorf("unexpected descriptor path: %s", sink.descriptorPath)
+	}
+	for name, content := range files {
+		written, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(written) != content {
+			t.Errorf("unexpected content for %s: %s, %v", name, written, err)
+		}
+	}
+
+	var ova bytes.Buffer
+	ovaWriter := &ovaSink{writer: tar.NewWriter(&ova)}
+	err = downloadOvfPackage(context.Background(), client, descriptorHref, "template.ovf", ovaWriter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = ovaWriter.writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reader := tar.NewReader(&ova)
+	var names []string
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid archive: %s", err)
+		}
+		content, _ := io.ReadAll(reader)
+		if expected, ok := files[header.Name]; ok && string(content) != expected {
+			t.Errorf("unexpected content for %s: %s", header.Name, content)
+		}
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, ",") != "template.ovf,disk1.vmdk,nvram/vm.nvram" {
+		t.Errorf("unexpected archive entries: %v", names)
+	}
+}
+
+func Test_downloadOvfPackageSizeMismatch(t *testing.T) {
+	files := map[string]string{"disk1.vmdk": "disk content", "nvram/vm.nvram": "nvram content"}
+	descriptor := strings.Replace(testOvfDescriptor, "%d", "100", 1)
+	client, descriptorHref := testOvfServer(t, descriptor, files)
+
+	err := downloadOvfPackage(context.Background(), client, descriptorHref, "template.ovf", &ovfDirectorySink{dir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "100") {
+		t.Errorf("expected size mismatch, got %v", err)
+	}
+	err = downloadOvfPackage(context.Background(), client, descriptorHref, "template.ovf", &ovaSink{writer: tar.NewWriter(io.Discard)})
+	if err == nil || !strings.Contains(err.Error(), "100") {
+		t.Errorf("expected size mismatch, got %v", err)
+	}
+}
+
+func Test_downloadOvfPackageCanceled(t *testing.T) {
+	files := map[string]string{"disk1.vmdk": "disk content", "nvram/vm.nvram": "nvram content"}
+	descriptor := strings.Replace(testOvfDescriptor, "%d", "12", 1)
+	client, descriptorHref := testOvfServer(t, descriptor, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := downloadOvfPackage(ctx, client, descriptorHref, "template.ovf", &ovaSink{writer: tar.NewWriter(io.Discard)})
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
+
+func Test_validateOvfFileReference(t *testing.T) {
+	for _, href := range []string{"disk.vmdk", "sub/disk.vmdk"} {
+		if err := validateOvfFileReference(href); err != nil {
+			t.Errorf("%s: unexpected error: %s", href, err)
+		}
+	}
+	for _, href := range []string{"", "../disk.vmdk", "/etc/passwd", "sub/../../disk.vmdk", "http://host/disk.vmdk", `..\disk.vmdk`} {
+		if err := validateOvfFileReference(href); err == nil {
+			t.Errorf("%s: expected error", href)
+		}
+	}
+}
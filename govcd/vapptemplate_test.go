@@ -7,7 +7,13 @@
 package govcd
 
 import (
+	"archive/tar"
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
 	. "gopkg.in/check.v1"
 )
@@ -227,3 +233,51 @@ func (vcd *TestVCD) Test_VappTemplateLeaseUpdate(check *C) {
 	err = vAppTemplate.Delete()
 	check.Assert(err, IsNil)
 }
+
+func (vcd *TestVCD) Test_VAppTemplateDownload(check *C) {
+	fmt.Printf("Running: %s\n", check.TestName())
+	cat, err := vcd.org.GetCatalogByName(vcd.config.VCD.Catalog.Name, false)
+	if err != nil {
+		check.Skip(fmt.Sprintf("%s: Catalog not found. Test can't proceed", check.TestName()))
+	}
+	if vcd.config.VCD.Catalog.CatalogItem == "" {
+		check.Skip(fmt.Sprintf("%s: Catalog Item not given. Test can't proceed", check.TestName()))
+	}
+	catItem, err := cat.GetCatalogItemByName(vcd.config.VCD.Catalog.CatalogItem, false)
+	check.Assert(err, IsNil)
+	vAppTemplate, err := catItem.GetVAppTemplate()
+	check.Assert(err, IsNil)
+
+	dir, err := os.MkdirTemp("", "ovf-download")
+	check.Assert(err, IsNil)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	descriptorPath, err := vAppTemplate.DownloadOvf(dir)
+	check.Assert(err, IsNil)
+	check.Assert(filepath.Dir(descriptorPath), Equals, dir)
+	descriptor, err := os.ReadFile(descriptorPath)
+	check.Assert(err, IsNil)
+	check.Assert(strings.Contains(string(descriptor), "Envelope"), Equals, true)
+
+	var ova bytes.Buffer
+	err = vAppTemplate.DownloadOva(&ova)
+	check.Assert(err, IsNil)
+	reader := tar.NewReader(&ova)
+	header, err := reader.Next()
+	check.Assert(err, IsNil)
+	check.Assert(header.Name, Equals, filepath.Base(descriptorPath))
+	entries := 1
+	for {
+		_, err = reader.Next()
+		if err == io.EOF {
+			break
+		}
+		check.Assert(err, IsNil)
+		entries++
+	}
+	files, err := os.ReadDir(dir)
+	check.Assert(err, IsNil)
+	check.Assert(entries, Equals, len(files))
+}
@@ -332,7 +332,9 @@ func (vm *VM) updateNicParameters(networks []map[string]interface{}, networkSect
 	return nil
 }
 
-// ChangeNetworkConfig allows to update existing VM NIC configuration.f
+// ChangeNetworkConfig allows to update existing VM NIC configuration.
+//
+// Deprecated: use the typed NIC functions VM.ListNics, VM.AddNic, VM.UpdateNic, VM.RemoveNic and VM.SetPrimaryNic
 func (vm *VM) ChangeNetworkConfig(networks []map[string]interface{}) (Task, error) {
 	err := vm.Refresh()
 	if err != nil {
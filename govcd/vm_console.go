@@ -0,0 +1,162 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// AcquireScreenTicket retrieves a screen ticket for the console of a powered on VM.
+// The ticket is in the form mks://host/vm-path/ticket and can be used only once
+func (vm *VM) AcquireScreenTicket() (*types.ScreenTicket, error) {
+	if vm.VM.HREF == "" {
+		return nil, fmt.Errorf("cannot acquire screen ticket, VM HREF is unset")
+	}
+	href := hrefForRel(vm.VM.Link, types.RelScreenAcquireTicket, vm.VM.HREF+"/screen/action/acquireTicket")
+
+	screenTicket := &types.ScreenTicket{}
+	_, err := vm.client.ExecuteRequest(href, http.MethodPost, types.MimeScreenTicket,
+		"error acquiring screen ticket: %s", nil, screenTicket)
+	if err != nil {
+		return nil, err
+	}
+	return screenTicket, nil
+}
+
+// AcquireMksTicket retrieves an MKS ticket for the console of a powered on VM. The ticket can be
+// used only once, within a short time. Use WebMksUrl to build the WebMKS connection URL
+func (vm *VM) AcquireMksTicket() (*types.MksTicket, error) {
+	if vm.VM.HREF == "" {
+		return nil, fmt.Errorf("cannot acquire MKS ticket, VM HREF is unset")
+	}
+	href := hrefForRel(vm.VM.Link, types.RelScreenAcquireMksTicket, vm.VM.HREF+"/screen/action/acquireMksTicket")
+
+	mksTicket := &types.MksTicket{}
+	_, err := vm.client.ExecuteRequest(href, http.MethodPost, types.MimeMksTicket,
+		"error acquiring MKS ticket: %s", nil, mksTicket)
+	if err != nil {
+		return nil, err
+	}
+	return mksTicket, nil
+}
+
+// WebMksUrl builds the websocket URL used by WebMKS clients (such as the wmks.js library) to
+// connect to the console proxy, in the form wss://host/port;ticket
+func WebMksUrl(mksTicket *types.MksTicket) (string, error) {
+	if mksTicket == nil || mksTicket.Host == "" || mksTicket.Ticket == "" || mksTicket.Port == 0 {
+		return "", fmt.Errorf("MKS ticket must have host, port and ticket")
+	}
+	return fmt.Sprintf("wss://%s/%d;%s", mksTicket.Host, mksTicket.Port, mksTicket.Ticket), nil
+}
+
+// defaultScreenThumbnailConcurrency is the number of thumbnails retrieved at the same time by
+// VApp.GetScreenThumbnails when no concurrency is given
+const defaultScreenThumbnailConcurrency = 4
+
+// screenThumbnailMimeType is the type of the images returned by the screen thumbnail endpoint
+const screenThumbnailMimeType = "image/png"
+
+// GetScreenThumbnail retrieves a PNG image of the console of a powered on VM
+func (vm *VM) GetScreenThumbnail() ([]byte, error) {
+	var buffer bytes.Buffer
+	_, err := vm.WriteScreenThumbnail(&buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// WriteScreenThumbnail streams a PNG image of the console of a powered on VM to the given writer,
+// returning the number of bytes written
+func (vm *VM) WriteScreenThumbnail(writer io.Writer) (int64, error) {
+	if vm.VM.HREF == "" {
+		return 0, fmt.Errorf("cannot retrieve screen thumbnail, VM HREF is unset")
+	}
+	href := hrefForRel(vm.VM.Link, types.RelScreenThumbnail, vm.VM.HREF+"/screen")
+	thumbnailUrl, err := url.ParseRequestURI(href)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing screen thumbnail URL '%s': %s", href, err)
+	}
+
+	request := vm.client.NewRequest(map[string]string{}, http.MethodGet, *thumbnailUrl, nil)
+	request.Header.Set("Accept", screenThumbnailMimeType)
+	resp, err := checkResp(vm.client.Http.Do(request))
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving screen thumbnail of VM '%s': %s", vm.VM.Name, err)
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			util.Logger.Printf("[WARN] error closing screen thumbnail response: %s", closeErr)
+		}
+	}()
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || contentType != screenThumbnailMimeType {
+		return 0, fmt.Errorf("unexpected content type '%s' for screen thumbnail of VM '%s'", resp.Header.Get("Content-Type"), vm.VM.Name)
+	}
+	written, err := io.Copy(writer, resp.Body)
+	if err != nil {
+		return written, fmt.Errorf("error reading screen thumbnail of VM '%s': %s", vm.VM.Name, err)
+	}
+	return written, nil
+}
+
+// GetScreenThumbnails retrieves the console thumbnails of the powered on VMs of the vApp, running
+// up to 'concurrency' requests at the same time (4 when concurrency is not positive). VMs which
+// are not powered on in the vApp structure are skipped, so the vApp should be refreshed first.
+// The result maps VM names to PNG images. When some thumbnails can't be retrieved, the ones
+// that were retrieved are returned together with an error describing the failures
+func (vapp *VApp) GetScreenThumbnails(concurrency int) (map[string][]byte, error) {
+	if vapp.VApp.Children == nil {
+		return map[string][]byte{}, nil
+	}
+	if concurrency <= 0 {
+		concurrency = defaultScreenThumbnailConcurrency
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mutex      sync.Mutex
+		errs       []error
+		thumbnails = make(map[string][]byte)
+		semaphore  = make(chan struct{}, concurrency)
+	)
+	for _, child := range vapp.VApp.Children.VM {
+		if child == nil || types.VAppStatuses[child.Status] != "POWERED_ON" {
+			continue
+		}
+		vm := NewVM(vapp.client)
+		vm.VM = child
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			thumbnail, err := vm.GetScreenThumbnail()
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			thumbnails[vm.VM.Name] = thumbnail
+		}()
+	}
+	wg.Wait()
+
+	return thumbnails, errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_WebMksUrl(t *testing.T) {
+	mksTicket := &types.MksTicket{}
+	err := xml.Unmarshal([]byte(`<MksTicket xmlns="http://www.vmware.com/vcloud/v1.5" type="application/vnd.vmware.vcloud.mksTicket+xml">
+    <Host>console.example.com</Host>
+    <Vmx>[datastore1] vm-1/vm-1.vmx</Vmx>
+    <Ticket>cst-abc123</Ticket>
+    <Port>443</Port>
+</MksTicket>`), mksTicket)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if mksTicket.Vmx != "[datastore1] vm-1/vm-1.vmx" {
+		t.Errorf("unexpected VMX path: %s", mksTicket.Vmx)
+	}
+
+	url, err := WebMksUrl(mksTicket)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if url != "wss://console.example.com/443;cst-abc123" {
+		t.Errorf("unexpected WebMKS URL: %s", url)
+	}
+
+	_, err = WebMksUrl(&types.MksTicket{Host: "console.example.com"})
+	if err == nil {
+		t.Errorf("expected error for incomplete ticket")
+	}
+}
+
+func Test_GetScreenThumbnails(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nfake-image")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/vm-broken/screen") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// Without the image type in the Accept header, VCD answers with an XML error
+		if r.Header.Get("Accept") != "image/png" || strings.HasSuffix(r.URL.Path, "/vm-xml/screen") {
+			w.Header().Set("Content-Type", types.MimeError)
+			_, _ = w.Write([]byte("<Error/>"))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	defer server.Close()
+
+	client := &Client{Http: *server.Client(), APIVersion: "37.0"}
+	vmEntry := func(name string, status int) *types.Vm {
+		return &types.Vm{Name: name, HREF: server.URL + "/api/vApp/" + name, Status: status}
+	}
+	vapp := NewVApp(client)
+	vapp.VApp = &types.VApp{Children: &types.VAppChildren{VM: []*types.Vm{
+		vmEntry("vm-1", 4),
+		vmEntry("vm-2", 4),
+		vmEntry("vm-off", 8),
+		vmEntry("vm-broken", 4),
+	}}}
+
+	thumbnails, err := vapp.GetScreenThumbnails(2)
+	if err == nil || !strings.Contains(err.Error(), "vm-broken") {
+		t.Errorf("expected error for vm-broken, got %v", err)
+	}
+	if len(thumbnails) != 2 || !bytes.Equal(thumbnails["vm-1"], png) || !bytes.Equal(thumbnails["vm-2"], png) {
+		t.Errorf("unexpected thumbnails: %v", thumbnails)
+	}
+
+	var buffer bytes.Buffer
+	vm := NewVM(client)
+	vm.VM = vmEntry("vm-1", 4)
+	written, err := vm.WriteScreenThumbnail(&buffer)
+	if err != nil || written != int64(len(png)) || !bytes.Equal(buffer.Bytes(), png) {
+		t.Errorf("unexpected thumbnail: %d bytes, %v", written, err)
+	}
+
+	vm.VM = vmEntry("vm-xml", 4)
+	_, err = vm.WriteScreenThumbnail(&buffer)
+	if err == nil || !strings.Contains(err.Error(), "unexpected content type") {
+		t.Errorf("expected content type error, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// Limits of guest customization settings, checked by GuestCustomizationBuilder.Build
+const (
+	// GuestCustomizationScriptMaxLength is the maximum number of characters of a customization script
+	GuestCustomizationScriptMaxLength = 49000
+	// WindowsComputerNameMaxLength is the maximum length of a Windows (NetBIOS) computer name
+	WindowsComputerNameMaxLength = 15
+	// LinuxComputerNameMaxLength is the maximum length of a Linux host name
+	LinuxComputerNameMaxLength = 63
+	// AdminAutoLogonMaxCount is the maximum number of automatic administrator logons
+	AdminAutoLogonMaxCount = 100
+)
+
+// guestCustomizationPollInterval is the time between two checks of the guest customization status
+var guestCustomizationPollInterval = 3 * time.Second
+
+var computerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+var allDigitsRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+// GuestCustomizationBuilder builds a guest customization section and validates it before it is
+// sent to VCD, so that misconfigurations are reported right away instead of failing after the
+// VM is powered on. Settings are added with chained calls, and validated by Build:
+//
+//	section, err := NewGuestCustomizationBuilder(true).
+//		ComputerName("web01").
+//		ChangeSid(true).
+//		JoinDomain("example.com", "admin", "secret", "OU=Servers,DC=example,DC=com").
+//		AdminPassword("P@ssw0rd").
+//		Build()
+type GuestCustomizationBuilder struct {
+	windows bool
+	section types.GuestCustomizationSection
+	errs    []error
+}
+
+// NewGuestCustomizationBuilder creates a builder with guest customization enabled. Windows
+// specific settings (SID change, domain join, administrator auto logon) are rejected when
+// isWindows is false
+func NewGuestCustomizationBuilder(isWindows bool) *GuestCustomizationBuilder {
+	return &GuestCustomizationBuilder{
+		windows: isWindows,
+		section: types.GuestCustomizationSection{
+			Enabled:              addrOf(true),
+			ChangeSid:            addrOf(false),
+			JoinDomainEnabled:    addrOf(false),
+			AdminPasswordEnabled: addrOf(false),
+		},
+	}
+}
+
+// Disable disables guest customization, while keeping the other settings
+func (builder *GuestCustomizationBuilder) Disable() *GuestCustomizationBuilder {
+	builder.section.Enabled = addrOf(false)
+	return builder
+}
+
+// ComputerName sets the computer name, which is validated against the host name rules of the
+// guest OS
+func (builder *GuestCustomizationBuilder) ComputerName(name string) *GuestCustomizationBuilder {
+	builder.section.ComputerName = name
+	return builder
+}
+
+// ChangeSid sets whether the customization generates a new Windows SID
+func (builder *GuestCustomizationBuilder) ChangeSid(changeSid bool) *GuestCustomizationBuilder {
+	builder.windowsOnly("SID change")
+	builder.section.ChangeSid = addrOf(changeSid)
+	return builder
+}
+
+// JoinDomain joins the VM to a Windows domain with the given credentials. The organizational
+// unit is optional
+func (builder *GuestCustomizationBuilder) JoinDomain(domain, user, password, organizationalUnit string) *GuestCustomizationBuilder {
+	builder.windowsOnly("domain join")
+	if domain == "" || user == "" || password == "" {
+		builder.errs = append(builder.errs, fmt.Errorf("domain join requires domain name, user name and password"))
+	}
+	builder.section.JoinDomainEnabled = addrOf(true)
+	builder.section.UseOrgSettings = addrOf(false)
+	builder.section.DomainName = domain
+	builder.section.DomainUserName = user
+	builder.section.DomainUserPassword = password
+	builder.section.MachineObjectOU = organizationalUnit
+	return builder
+}
+
+// JoinDomainWithOrgSettings joins the VM to the Windows domain defined in the guest
+// personalization settings of the organization. The organizational unit is optional
+func (builder *GuestCustomizationBuilder) JoinDomainWithOrgSettings(organizationalUnit string) *GuestCustomizationBuilder {
+	builder.windowsOnly("domain join")
+	builder.section.JoinDomainEnabled = addrOf(true)
+	builder.section.UseOrgSettings = addrOf(true)
+	builder.section.DomainName = ""
+	builder.section.DomainUserName = ""
+	builder.section.DomainUserPassword = ""
+	builder.section.MachineObjectOU = organizationalUnit
+	return builder
+}
+
+// AdminPassword sets the administrator password to the given value
+func (builder *GuestCustomizationBuilder) AdminPassword(password string) *GuestCustomizationBuilder {
+	if password == "" {
+		builder.errs = append(builder.errs, fmt.Errorf("administrator password must not be empty"))
+	}
+	builder.section.AdminPasswordEnabled = addrOf(true)
+	builder.section.AdminPasswordAuto = addrOf(false)
+	builder.section.AdminPassword = password
+	return builder
+}
+
+// AutoAdminPassword lets VCD generate the administrator password
+func (builder *GuestCustomizationBuilder) AutoAdminPassword() *GuestCustomizationBuilder {
+	builder.section.AdminPasswordEnabled = addrOf(true)
+	builder.section.AdminPasswordAuto = addrOf(true)
+	builder.section.AdminPassword = ""
+	return builder
+}
+
+// ResetPasswordRequired requires the administrator password to be changed at first logon. It
+// needs an administrator password set with AdminPassword or AutoAdminPassword
+func (builder *GuestCustomizationBuilder) ResetPasswordRequired(required bool) *GuestCustomizationBuilder {
+	builder.section.ResetPasswordRequired = addrOf(required)
+	return builder
+}
+
+// AdminAutoLogon logs the administrator in automatically 'count' times, between 1 and
+// AdminAutoLogonMaxCount. It needs an administrator password set with AdminPassword or
+// AutoAdminPassword
+func (builder *GuestCustomizationBuilder) AdminAutoLogon(count int) *GuestCustomizationBuilder {
+	builder.windowsOnly("administrator auto logon")
+	builder.section.AdminAutoLogonEnabled = addrOf(true)
+	builder.section.AdminAutoLogonCount = count
+	return builder
+}
+
+// Script sets the customization script, run before and after customization with the
+// "precustomization" and "postcustomization" arguments
+func (builder *GuestCustomizationBuilder) Script(script string) *GuestCustomizationBuilder {
+	builder.section.CustomizationScript = script
+	return builder
+}
+
+func (builder *GuestCustomizationBuilder) windowsOnly(setting string) {
+	if !builder.windows {
+		builder.errs = append(builder.errs, fmt.Errorf("%s is only available for Windows guests", setting))
+	}
+}
+
+// Build validates the settings and returns the guest customization section. All the problems
+// found are reported together
+func (builder *GuestCustomizationBuilder) Build() (*types.GuestCustomizationSection, error) {
+	errs := append([]error{}, builder.errs...)
+	section := builder.section
+
+	if section.ComputerName != "" {
+		err := validateComputerName(section.ComputerName, builder.windows)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	passwordEnabled := section.AdminPasswordEnabled != nil && *section.AdminPasswordEnabled
+	if section.ResetPasswordRequired != nil && *section.ResetPasswordRequired && !passwordEnabled {
+		errs = append(errs, fmt.Errorf("password reset requires an administrator password"))
+	}
+	if section.AdminAutoLogonEnabled != nil && *section.AdminAutoLogonEnabled {
+		if !passwordEnabled {
+			errs = append(errs, fmt.Errorf("administrator auto logon requires an administrator password"))
+		}
+		if section.AdminAutoLogonCount < 1 || section.AdminAutoLogonCount > AdminAutoLogonMaxCount {
+			errs = append(errs, fmt.Errorf("administrator auto logon count must be between 1 and %d, got %d",
+				AdminAutoLogonMaxCount, section.AdminAutoLogonCount))
+		}
+	}
+
+	if len([]rune(section.CustomizationScript)) > GuestCustomizationScriptMaxLength {
+		errs = append(errs, fmt.Errorf("customization script has %d characters, the maximum is %d",
+			len([]rune(section.CustomizationScript)), GuestCustomizationScriptMaxLength))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid guest customization: %w", err)
+	}
+	section.Info = "Specifies Guest OS Customization Settings"
+	return &section, nil
+}
+
+// validateComputerName checks the computer name against the host name rules of the guest OS
+func validateComputerName(name string, windows bool) error {
+	maxLength := LinuxComputerNameMaxLength
+	if windows {
+		maxLength = WindowsComputerNameMaxLength
+	}
+	if len(name) > maxLength {
+		return fmt.Errorf("computer name '%s' is longer than %d characters", name, maxLength)
+	}
+	if !computerNameRegexp.MatchString(name) {
+		return fmt.Errorf("computer name '%s' must contain only letters, digits and hyphens, and must not start or end with a hyphen", name)
+	}
+	if allDigitsRegexp.MatchString(name) {
+		return fmt.Errorf("computer name '%s' must not contain only digits", name)
+	}
+	return nil
+}
+
+// ApplyGuestCustomization validates the settings of the builder and sets them as the guest
+// customization section of the VM. Customization runs when the VM is next powered on with
+// customization (for example with PowerOnAndForceCustomization)
+func (vm *VM) ApplyGuestCustomization(builder *GuestCustomizationBuilder) (*types.GuestCustomizationSection, error) {
+	if builder == nil {
+		return nil, fmt.Errorf("guest customization builder must not be nil")
+	}
+	section, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return vm.SetGuestCustomizationSection(section)
+}
+
+// WaitForGuestCustomization waits until the guest customization of the VM completes, checking
+// its status every 3 seconds. It returns an error when customization fails, or when it doesn't
+// complete within the timeout. The VM must be powered on for customization to progress
+func (vm *VM) WaitForGuestCustomization(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := vm.GetGuestCustomizationStatus()
+		if err != nil {
+			return fmt.Errorf("could not get VM customization status: %s", err)
+		}
+		util.Logger.Printf("[TRACE] VM '%s' guest customization status: %s", vm.VM.Name, status)
+		switch status {
+		case types.GuestCustStatusComplete:
+			return nil
+		case types.GuestCustStatusFailed:
+			return fmt.Errorf("guest customization of VM '%s' failed", vm.VM.Name)
+		}
+		if time.Now().Add(guestCustomizationPollInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for guest customization of VM '%s', last status %s",
+				timeout, vm.VM.Name, status)
+		}
+		time.Sleep(guestCustomizationPollInterval)
+	}
+}
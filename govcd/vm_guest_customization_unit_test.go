@@ -0,0 +1,174 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_GuestCustomizationBuilder(t *testing.T) {
+	section, err := NewGuestCustomizationBuilder(true).
+		ComputerName("web-01").
+		ChangeSid(true).
+		JoinDomain("example.com", "admin", "secret", "OU=Servers,DC=example,DC=com").
+		AdminPassword("P@ssw0rd").
+		ResetPasswordRequired(true).
+		AdminAutoLogon(3).
+		Script("echo done").
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !*section.Enabled || !*section.ChangeSid || !*section.JoinDomainEnabled || *section.UseOrgSettings ||
+		section.DomainName != "example.com" || *section.AdminPasswordAuto || section.AdminPassword != "P@ssw0rd" ||
+		section.AdminAutoLogonCount != 3 || section.ComputerName != "web-01" || section.Info == "" {
+		t.Errorf("unexpected section: %+v", section)
+	}
+
+	section, err = NewGuestCustomizationBuilder(false).ComputerName("db-server-01").AutoAdminPassword().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !*section.AdminPasswordAuto || section.AdminPassword != "" || *section.JoinDomainEnabled {
+		t.Errorf("unexpected section: %+v", section)
+	}
+
+	section, err = NewGuestCustomizationBuilder(true).JoinDomainWithOrgSettings("").Disable().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *section.Enabled || !*section.UseOrgSettings {
+		t.Errorf("unexpected section: %+v", section)
+	}
+}
+
+func Test_GuestCustomizationBuilderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *GuestCustomizationBuilder
+		wantErr []string
+	}{
+		{
+			name:    "Windows name too long",
+			builder: NewGuestCustomizationBuilder(true).ComputerName("a-very-long-name"),
+			wantErr: []string{"longer than 15"},
+		},
+		{
+			name:    "Linux name too long",
+			builder: NewGuestCustomizationBuilder(false).ComputerName(strings.Repeat("a", 64)),
+			wantErr: []string{"longer than 63"},
+		},
+		{
+			name:    "invalid characters",
+			builder: NewGuestCustomizationBuilder(false).ComputerName("web_01"),
+			wantErr: []string{"only letters, digits and hyphens"},
+		},
+		{
+			name:    "leading hyphen",
+			builder: NewGuestCustomizationBuilder(false).ComputerName("-web"),
+			wantErr: []string{"start or end with a hyphen"},
+		},
+		{
+			name:    "only digits",
+			builder: NewGuestCustomizationBuilder(true).ComputerName("12345"),
+			wantErr: []string{"only digits"},
+		},
+		{
+			name:    "Windows settings on Linux",
+			builder: NewGuestCustomizationBuilder(false).ChangeSid(true).JoinDomainWithOrgSettings("").AdminPassword("x").AdminAutoLogon(1),
+			wantErr: []string{"SID change", "domain join", "auto logon"},
+		},
+		{
+			name:    "incomplete domain credentials",
+			builder: NewGuestCustomizationBuilder(true).JoinDomain("example.com", "", "", ""),
+			wantErr: []string{"domain name, user name and password"},
+		},
+		{
+			name:    "auto logon without password",
+			builder: NewGuestCustomizationBuilder(true).AdminAutoLogon(101).ResetPasswordRequired(true),
+			wantErr: []string{"auto logon requires", "between 1 and 100", "password reset requires"},
+		},
+		{
+			name:    "empty password",
+			builder: NewGuestCustomizationBuilder(true).AdminPassword(""),
+			wantErr: []string{"must not be empty"},
+		},
+		{
+			name:    "script too long",
+			builder: NewGuestCustomizationBuilder(false).Script(strings.Repeat("x", GuestCustomizationScriptMaxLength+1)),
+			wantErr: []string{"customization script has"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing '%s', got: %s", want, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_WaitForGuestCustomization(t *testing.T) {
+	defaultInterval := guestCustomizationPollInterval
+	guestCustomizationPollInterval = 10 * time.Millisecond
+	defer func() { guestCustomizationPollInterval = defaultInterval }()
+
+	var calls atomic.Int32
+	statuses := map[string][]string{
+		"vm-ok":      {types.GuestCustStatusPending, types.GuestCustStatusPostPending, types.GuestCustStatusComplete},
+		"vm-failed":  {types.GuestCustStatusPending, types.GuestCustStatusFailed},
+		"vm-pending": {types.GuestCustStatusPending},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/vApp/"), "/guestcustomizationstatus")
+		sequence := statuses[name]
+		status := sequence[min(int(calls.Add(1))-1, len(sequence)-1)]
+		w.Header().Set("Content-Type", types.MimeGuestCustomizationStatus)
+		_, _ = fmt.Fprintf(w, `<GuestCustomizationStatusSection xmlns="%s"><GuestCustStatus>%s</GuestCustStatus></GuestCustomizationStatusSection>`,
+			types.XMLNamespaceVCloud, status)
+	}))
+	defer server.Close()
+
+	client := &Client{Http: *server.Client(), APIVersion: "37.0"}
+	newVm := func(name string) *VM {
+		calls.Store(0)
+		vm := NewVM(client)
+		vm.VM = &types.Vm{Name: name, HREF: server.URL + "/api/vApp/" + name}
+		return vm
+	}
+
+	err := newVm("vm-ok").WaitForGuestCustomization(time.Second)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	err = newVm("vm-failed").WaitForGuestCustomization(time.Second)
+	if err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("expected failure, got %v", err)
+	}
+	err = newVm("vm-pending").WaitForGuestCustomization(50 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), types.GuestCustStatusPending) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	err = newVm("vm-ok").WaitForGuestCustomization(0)
+	if err == nil {
+		t.Errorf("expected error for zero timeout")
+	}
+}
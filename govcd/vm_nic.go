@@ -0,0 +1,322 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+// VmNic describes a network adapter of a VM, as used by VM.ListNics, VM.AddNic and VM.UpdateNic
+type VmNic struct {
+	// Index is the virtual slot of the NIC (NetworkConnectionIndex). It is assigned by AddNic and
+	// identifies the NIC for UpdateNic
+	Index int
+	// Network is the name of a vApp network or of an Org VDC network attached to the parent vApp.
+	// It must be empty or types.NoneNetwork when IpAllocationMode is NONE
+	Network string
+	// AdapterType is one of VMXNET3, E1000, E1000E, VLANCE, VMXNET2, PCNet32, SRIOVETHERNETCARD.
+	// When empty, VCD picks the default adapter of the guest OS. It can't be changed while the VM
+	// is powered on
+	AdapterType string
+	// IpAllocationMode is one of types.IPAllocationModePool, types.IPAllocationModeDHCP,
+	// types.IPAllocationModeManual or types.IPAllocationModeNone
+	IpAllocationMode string
+	// IpAddress is mandatory for MANUAL allocation, and reported by ListNics for the other modes
+	IpAddress string
+	// MacAddress is generated by VCD when empty
+	MacAddress string
+	Connected  bool
+	// Primary is reported by ListNics. It is honored by AddNic, while UpdateNic ignores it: use
+	// SetPrimaryNic to change the primary NIC
+	Primary bool
+}
+
+// ListNics returns the NICs of the VM, ordered by index
+func (vm *VM) ListNics() ([]VmNic, error) {
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return nil, err
+	}
+	return nicsFromSection(section), nil
+}
+
+// AddNic adds a NIC to the VM in the first free slot and returns it with its assigned index.
+// NICs are hot-added when the VM is powered on and the guest OS supports it
+func (vm *VM) AddNic(nic VmNic) (*VmNic, error) {
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return nil, err
+	}
+	err = vm.validateNicNetwork(nic)
+	if err != nil {
+		return nil, err
+	}
+	index := addNicToSection(section, nic)
+	err = vm.UpdateNetworkConnectionSection(section)
+	if err != nil {
+		return nil, err
+	}
+	nics, err := vm.ListNics()
+	if err != nil {
+		return nil, err
+	}
+	for _, added := range nics {
+		if added.Index == index {
+			return &added, nil
+		}
+	}
+	return nil, fmt.Errorf("NIC %d was not found in VM '%s' after adding it", index, vm.VM.Name)
+}
+
+// UpdateNic changes the NIC of the VM with the same index. Only the NIC settings which differ
+// from the current ones are changed, and no request is sent when nothing differs
+func (vm *VM) UpdateNic(nic VmNic) error {
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return err
+	}
+	err = vm.validateNicNetwork(nic)
+	if err != nil {
+		return err
+	}
+	poweredOn, err := vm.isPoweredOn()
+	if err != nil {
+		return err
+	}
+	changed, err := updateNicInSection(section, nic, poweredOn)
+	if err != nil || !changed {
+		return err
+	}
+	return vm.UpdateNetworkConnectionSection(section)
+}
+
+// RemoveNic removes the NIC with the given index. When the primary NIC is removed, the NIC with
+// the lowest remaining index becomes primary
+func (vm *VM) RemoveNic(index int) error {
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return err
+	}
+	err = removeNicFromSection(section, index)
+	if err != nil {
+		return err
+	}
+	return vm.UpdateNetworkConnectionSection(section)
+}
+
+// SetPrimaryNic makes the NIC with the given index the primary NIC of the VM
+func (vm *VM) SetPrimaryNic(index int) error {
+	section, err := vm.GetNetworkConnectionSection()
+	if err != nil {
+		return err
+	}
+	if nicSlot(section, index) == -1 {
+		return fmt.Errorf("VM '%s' has no NIC with index %d", vm.VM.Name, index)
+	}
+	if section.PrimaryNetworkConnectionIndex == index {
+		return nil
+	}
+	section.PrimaryNetworkConnectionIndex = index
+	return vm.UpdateNetworkConnectionSection(section)
+}
+
+func (vm *VM) isPoweredOn() (bool, error) {
+	status, err := vm.GetStatus()
+	if err != nil {
+		return false, err
+	}
+	return status == "POWERED_ON", nil
+}
+
+// validateNicNetwork checks the NIC settings and that its network is available to the parent vApp
+func (vm *VM) validateNicNetwork(nic VmNic) error {
+	err := validateNic(nic)
+	if err != nil {
+		return err
+	}
+	if nic.Network == "" || nic.Network == types.NoneNetwork {
+		return nil
+	}
+
+	vapp, err := vm.GetParentVApp()
+	if err != nil {
+		return err
+	}
+	networkConfig, err := vapp.GetNetworkConfig()
+	if err != nil {
+		return fmt.Errorf("error retrieving networks of vApp '%s': %s", vapp.VApp.Name, err)
+	}
+	for _, network := range networkConfig.NetworkConfig {
+		if network.NetworkName == nic.Network {
+			return nil
+		}
+	}
+
+	vdc, err := vapp.GetParentVDC()
+	if err == nil {
+		_, err = vdc.GetOrgVdcNetworkByName(nic.Network, false)
+		if err == nil {
+			return fmt.Errorf("network '%s' exists in VDC '%s' but is not attached to vApp '%s'", nic.Network, vdc.Vdc.Name, vapp.VApp.Name)
+		}
+	}
+	return fmt.Errorf("network '%s' not found in vApp '%s'", nic.Network, vapp.VApp.Name)
+}
+
+// validateNic checks the consistency of the NIC settings
+func validateNic(nic VmNic) error {
+	switch nic.IpAllocationMode {
+	case types.IPAllocationModePool, types.IPAllocationModeDHCP:
+	case types.IPAllocationModeManual:
+		if net.ParseIP(nic.IpAddress) == nil {
+			return fmt.Errorf("MANUAL IP allocation requires a valid IP address, got '%s'", nic.IpAddress)
+		}
+	case types.IPAllocationModeNone:
+		if nic.Network != "" && nic.Network != types.NoneNetwork {
+			return fmt.Errorf("NONE IP allocation can't be used with network '%s'", nic.Network)
+		}
+	default:
+		return fmt.Errorf("invalid IP allocation mode '%s'", nic.IpAllocationMode)
+	}
+	if nic.IpAllocationMode != types.IPAllocationModeNone && nic.Network == "" {
+		return fmt.Errorf("%s IP allocation requires a network", nic.IpAllocationMode)
+	}
+	if nic.MacAddress != "" {
+		_, err := net.ParseMAC(nic.MacAddress)
+		if err != nil {
+			return fmt.Errorf("invalid MAC address '%s': %s", nic.MacAddress, err)
+		}
+	}
+	return nil
+}
+
+// nicsFromSection converts a network connection section to a list of NICs ordered by index
+func nicsFromSection(section *types.NetworkConnectionSection) []VmNic {
+	var nics []VmNic
+	for _, connection := range section.NetworkConnection {
+		nics = append(nics, VmNic{
+			Index:            connection.NetworkConnectionIndex,
+			Network:          connection.Network,
+			AdapterType:      connection.NetworkAdapterType,
+			IpAllocationMode: connection.IPAddressAllocationMode,
+			IpAddress:        connection.IPAddress,
+			MacAddress:       connection.MACAddress,
+			Connected:        connection.IsConnected,
+			Primary:          connection.NetworkConnectionIndex == section.PrimaryNetworkConnectionIndex,
+		})
+	}
+	sort.Slice(nics, func(i, j int) bool {
+		return nics[i].Index < nics[j].Index
+	})
+	return nics
+}
+
+// nicSlot returns the position of the NIC with the given index in the section, or -1
+func nicSlot(section *types.NetworkConnectionSection, index int) int {
+	return slices.IndexFunc(section.NetworkConnection, func(connection *types.NetworkConnection) bool {
+		return connection.NetworkConnectionIndex == index
+	})
+}
+
+// nicNetworkName returns the network name used by VCD for a NIC
+func nicNetworkName(nic VmNic) string {
+	if nic.IpAllocationMode == types.IPAllocationModeNone && nic.Network == "" {
+		return types.NoneNetwork
+	}
+	return nic.Network
+}
+
+// addNicToSection adds a NIC in the first free slot of the section and returns its index
+func addNicToSection(section *types.NetworkConnectionSection, nic VmNic) int {
+	index := 0
+	for nicSlot(section, index) != -1 {
+		index++
+	}
+	connection := &types.NetworkConnection{
+		Network:                 nicNetworkName(nic),
+		NeedsCustomization:      true,
+		NetworkConnectionIndex:  index,
+		IsConnected:             nic.Connected,
+		MACAddress:              nic.MacAddress,
+		IPAddressAllocationMode: nic.IpAllocationMode,
+		NetworkAdapterType:      nic.AdapterType,
+	}
+	if nic.IpAllocationMode == types.IPAllocationModeManual {
+		connection.IPAddress = nic.IpAddress
+	}
+	section.NetworkConnection = append(section.NetworkConnection, connection)
+	if nic.Primary || len(section.NetworkConnection) == 1 {
+		section.PrimaryNetworkConnectionIndex = index
+	}
+	return index
+}
+
+// updateNicInSection applies the NIC settings to the NIC with the same index, returning whether
+// anything changed
+func updateNicInSection(section *types.NetworkConnectionSection, nic VmNic, poweredOn bool) (bool, error) {
+	slot := nicSlot(section, nic.Index)
+	if slot == -1 {
+		return false, fmt.Errorf("no NIC with index %d", nic.Index)
+	}
+	connection := section.NetworkConnection[slot]
+
+	var changes []string
+	network := nicNetworkName(nic)
+	networkChanged := connection.Network != network
+	if networkChanged {
+		changes = append(changes, "network")
+		connection.Network = network
+	}
+	if nic.AdapterType != "" && !strings.EqualFold(connection.NetworkAdapterType, nic.AdapterType) {
+		if poweredOn {
+			return false, fmt.Errorf("the adapter type of NIC %d can't be changed while the VM is powered on", nic.Index)
+		}
+		changes = append(changes, "adapter type")
+		connection.NetworkAdapterType = nic.AdapterType
+	}
+	ipChanged := connection.IPAddressAllocationMode != nic.IpAllocationMode ||
+		(nic.IpAllocationMode == types.IPAllocationModeManual && connection.IPAddress != nic.IpAddress)
+	if ipChanged {
+		changes = append(changes, "IP address")
+	}
+	// The address of a NIC which moves to another network must be allocated again in that network
+	if ipChanged || networkChanged {
+		connection.IPAddressAllocationMode = nic.IpAllocationMode
+		connection.IPAddress = ""
+		if nic.IpAllocationMode == types.IPAllocationModeManual {
+			connection.IPAddress = nic.IpAddress
+		}
+		connection.NeedsCustomization = true
+	}
+	if nic.MacAddress != "" && !strings.EqualFold(connection.MACAddress, nic.MacAddress) {
+		changes = append(changes, "MAC address")
+		connection.MACAddress = nic.MacAddress
+	}
+	if connection.IsConnected != nic.Connected {
+		changes = append(changes, "connection state")
+		connection.IsConnected = nic.Connected
+	}
+	return len(changes) > 0, nil
+}
+
+// removeNicFromSection removes the NIC with the given index, moving the primary NIC to the
+// lowest remaining index when needed
+func removeNicFromSection(section *types.NetworkConnectionSection, index int) error {
+	slot := nicSlot(section, index)
+	if slot == -1 {
+		return fmt.Errorf("no NIC with index %d", index)
+	}
+	section.NetworkConnection = slices.Delete(section.NetworkConnection, slot, slot+1)
+	if section.PrimaryNetworkConnectionIndex == index && len(section.NetworkConnection) > 0 {
+		nics := nicsFromSection(section)
+		section.PrimaryNetworkConnectionIndex = nics[0].Index
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func testNetworkConnectionSection() *types.NetworkConnectionSection {
+	return &types.NetworkConnectionSection{
+		PrimaryNetworkConnectionIndex: 0,
+		NetworkConnection: []*types.NetworkConnection{
+			{Network: "net-a", NetworkConnectionIndex: 0, IsConnected: true, IPAddressAllocationMode: types.IPAllocationModePool,
+				IPAddress: "10.0.0.10", MACAddress: "00:50:56:01:02:03", NetworkAdapterType: "VMXNET3"},
+			{Network: "net-b", NetworkConnectionIndex: 2, IsConnected: true, IPAddressAllocationMode: types.IPAllocationModeDHCP,
+				MACAddress: "00:50:56:01:02:04", NetworkAdapterType: "E1000E"},
+		},
+	}
+}
+
+func Test_validateNic(t *testing.T) {
+	tests := []struct {
+		name    string
+		nic     VmNic
+		wantErr bool
+	}{
+		{"pool", VmNic{Network: "net", IpAllocationMode: types.IPAllocationModePool}, false},
+		{"manual", VmNic{Network: "net", IpAllocationMode: types.IPAllocationModeManual, IpAddress: "10.0.0.5"}, false},
+		{"manual without IP", VmNic{Network: "net", IpAllocationMode: types.IPAllocationModeManual}, true},
+		{"none", VmNic{IpAllocationMode: types.IPAllocationModeNone}, false},
+		{"none with network", VmNic{Network: "net", IpAllocationMode: types.IPAllocationModeNone}, true},
+		{"dhcp without network", VmNic{IpAllocationMode: types.IPAllocationModeDHCP}, true},
+		{"invalid mode", VmNic{Network: "net", IpAllocationMode: "STATIC"}, true},
+		{"invalid MAC", VmNic{Network: "net", IpAllocationMode: types.IPAllocationModeDHCP, MacAddress: "00:50"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNic(tt.nic)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_addNicToSection(t *testing.T) {
+	section := testNetworkConnectionSection()
+	index := addNicToSection(section, VmNic{IpAllocationMode: types.IPAllocationModeNone, Primary: true})
+	if index != 1 {
+		t.Errorf("expected first free index 1, got %d", index)
+	}
+	if section.PrimaryNetworkConnectionIndex != 1 {
+		t.Errorf("expected new NIC to be primary")
+	}
+	nics := nicsFromSection(section)
+	if len(nics) != 3 || nics[1].Index != 1 || nics[1].Network != types.NoneNetwork || !nics[1].Primary {
+		t.Errorf("unexpected NICs: %+v", nics)
+	}
+
+	empty := &types.NetworkConnectionSection{PrimaryNetworkConnectionIndex: 5}
+	index = addNicToSection(empty, VmNic{Network: "net", IpAllocationMode: types.IPAllocationModeManual, IpAddress: "10.0.0.5"})
+	if index != 0 || empty.PrimaryNetworkConnectionIndex != 0 || empty.NetworkConnection[0].IPAddress != "10.0.0.5" {
+		t.Errorf("unexpected section after adding the only NIC: %+v", empty.NetworkConnection[0])
+	}
+}
+
+func Test_updateNicInSection(t *testing.T) {
+	section := testNetworkConnectionSection()
+	current := nicsFromSection(section)[0]
+
+	changed, err := updateNicInSection(section, current, true)
+	if err != nil || changed {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+
+	// MAC address comparison is case insensitive and an empty MAC keeps the current one
+	current.MacAddress = "00:50:56:01:02:03"
+	current.AdapterType = "vmxnet3"
+	changed, err = updateNicInSection(section, current, true)
+	if err != nil || changed {
+		t.Errorf("expected no change for equivalent values, got %v, %v", changed, err)
+	}
+
+	// A pooled address of the previous network is allocated again in the new one
+	moved := current
+	moved.Network = "net-c"
+	movedSection := testNetworkConnectionSection()
+	changed, err = updateNicInSection(movedSection, moved, true)
+	if err != nil || !changed {
+		t.Fatalf("expected change, got %v, %v", changed, err)
+	}
+	movedConnection := movedSection.NetworkConnection[0]
+	if movedConnection.Network != "net-c" || movedConnection.IPAddress != "" || !movedConnection.NeedsCustomization ||
+		movedConnection.IPAddressAllocationMode != types.IPAllocationModePool {
+		t.Errorf("unexpected connection after network change: %+v", movedConnection)
+	}
+
+	manual := current
+	manual.IpAllocationMode = types.IPAllocationModeManual
+	manual.IpAddress = "10.0.0.99"
+	changed, err = updateNicInSection(section, manual, true)
+	if err != nil || !changed {
+		t.Fatalf("expected change, got %v, %v", changed, err)
+	}
+	connection := section.NetworkConnection[0]
+	if connection.IPAddress != "10.0.0.99" || !connection.NeedsCustomization {
+		t.Errorf("unexpected connection: %+v", connection)
+	}
+
+	adapter := manual
+	adapter.AdapterType = "E1000E"
+	_, err = updateNicInSection(section, adapter, true)
+	if err == nil {
+		t.Errorf("expected error changing adapter type of a powered on VM")
+	}
+	changed, err = updateNicInSection(section, adapter, false)
+	if err != nil || !changed || connection.NetworkAdapterType != "E1000E" {
+		t.Errorf("expected adapter type change, got %v, %v", changed, err)
+	}
+
+	_, err = updateNicInSection(section, VmNic{Index: 7}, false)
+	if err == nil {
+		t.Errorf("expected error for unknown NIC")
+	}
+}
+
+func Test_removeNicFromSection(t *testing.T) {
+	section := testNetworkConnectionSection()
+	err := removeNicFromSection(section, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(section.NetworkConnection) != 1 || section.PrimaryNetworkConnectionIndex != 2 {
+		t.Errorf("expected NIC 2 to be primary, got %d", section.PrimaryNetworkConnectionIndex)
+	}
+	err = removeNicFromSection(section, 0)
+	if err == nil {
+		t.Errorf("expected error removing a missing NIC")
+	}
+}
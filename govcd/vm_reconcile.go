@@ -0,0 +1,611 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// VmDesiredSpec is the desired configuration of a VM used by VM.Reconcile. Only the fields that
+// are set are reconciled: nil pointers, empty strings and empty maps leave the current value
+// unchanged
+type VmDesiredSpec struct {
+	Description    *string
+	Cpus           *int
+	CoresPerSocket *int
+	MemoryMb       *int64
+	// DiskSizesMb contains the size of internal disks by DiskId. Disks can only grow
+	DiskSizesMb map[string]int64
+	// StorageProfileHref is the HREF of the VM storage profile
+	StorageProfileHref string
+	// SizingPolicyId and PlacementPolicyId are compute policy IDs. An empty string removes the policy
+	SizingPolicyId    *string
+	PlacementPolicyId *string
+	// BootOptions fields that are set are compared with the current boot options
+	BootOptions *types.BootOptions
+	// CpuHotAdd and MemoryHotAdd change the VM capabilities. The new capabilities are not used
+	// to hot-apply other changes of the same Reconcile call
+	CpuHotAdd    *bool
+	MemoryHotAdd *bool
+	// ExtraConfig contains extra configuration items to add or change. Items not in the map are
+	// left untouched
+	ExtraConfig map[string]string
+
+	// PowerCycle allows Reconcile to stop a running VM to apply the changes that can't be
+	// applied while it runs, and to power it on again afterwards
+	PowerCycle bool
+	// ShutdownTimeout is the time given to the guest OS to shut down when the VM is power cycled.
+	// The VM is powered off when the guest doesn't shut down in time, or when VMware Tools don't
+	// run in it. Defaults to 5 minutes
+	ShutdownTimeout time.Duration
+}
+
+// defaultVmShutdownTimeout is the time given to the guest OS to shut down when
+// VmDesiredSpec.ShutdownTimeout is not set
+const defaultVmShutdownTimeout = 5 * time.Minute
+
+// VmReconcileChange is a single difference between the current VM and the desired spec
+type VmReconcileChange struct {
+	Field string
+	From  string
+	To    string
+	// Hot is true when the change can be applied while the VM is powered on
+	Hot bool
+}
+
+// VmReconcilePlan describes the changes computed and applied by VM.Reconcile
+type VmReconcilePlan struct {
+	Changes []VmReconcileChange
+	// PoweredOn reports the power state of the VM when the plan was computed
+	PoweredOn bool
+	// PowerCycled is true when the VM was powered off and on again to apply the changes
+	PowerCycled bool
+	// Pending lists the changes that were not applied because they require the VM to be
+	// powered off and PowerCycle was not set
+	Pending []VmReconcileChange
+	// Tasks is the number of VCD tasks used to apply the changes
+	Tasks int
+}
+
+// String returns a human readable description of the plan
+func (plan *VmReconcilePlan) String() string {
+	var builder strings.Builder
+	for _, change := range plan.Changes {
+		mode := "requires power off"
+		if change.Hot {
+			mode = "hot"
+		}
+		fmt.Fprintf(&builder, "%s: '%s' => '%s' (%s)\n", change.Field, change.From, change.To, mode)
+	}
+	return builder.String()
+}
+
+// Fields of VmReconcileChange, used to group the changes into VCD tasks
+const (
+	vmFieldDescription     = "description"
+	vmFieldCpus            = "cpus"
+	vmFieldCoresPerSocket  = "coresPerSocket"
+	vmFieldMemory          = "memoryMb"
+	vmFieldDiskPrefix      = "disk "
+	vmFieldStorageProfile  = "storageProfile"
+	vmFieldSizingPolicy    = "sizingPolicy"
+	vmFieldPlacementPolicy = "placementPolicy"
+	vmFieldBootOptions     = "bootOptions"
+	vmFieldCpuHotAdd       = "cpuHotAdd"
+	vmFieldMemoryHotAdd    = "memoryHotAdd"
+	vmFieldExtraConfig     = "extraConfig "
+)
+
+// PlanReconcile computes the changes needed to bring the VM to the desired spec, without
+// applying them
+func (vm *VM) PlanReconcile(desired VmDesiredSpec) (*VmReconcilePlan, error) {
+	if vm.VM.HREF == "" {
+		return nil, fmt.Errorf("cannot reconcile VM, VM HREF is unset")
+	}
+	err := vm.Refresh()
+	if err != nil {
+		return nil, fmt.Errorf("error refreshing VM: %s", err)
+	}
+	var extraConfig []*types.ExtraConfigMarshal
+	if len(desired.ExtraConfig) > 0 {
+		extraConfig, err = vm.GetExtraConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	changes, err := vmReconcileChanges(vm.VM, desired, extraConfig)
+	if err != nil {
+		return nil, err
+	}
+	status, err := vm.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+	return &VmReconcilePlan{Changes: changes, PoweredOn: status == "POWERED_ON"}, nil
+}
+
+// Reconcile brings the VM to the desired spec with as few VCD tasks as possible, and returns
+// the plan that was applied.
+//
+// When the VM is powered off, all the changes are applied. When it is powered on, the changes
+// that can be hot-applied (description, storage profile, disk growth, boot options, and CPU or
+// memory increases when CPU or memory hot-add are enabled) are applied right away. The other
+// changes are applied by shutting the VM down and powering it on again when desired.PowerCycle
+// is set. Otherwise they are listed in plan.Pending and an error is returned.
+func (vm *VM) Reconcile(desired VmDesiredSpec) (*VmReconcilePlan, error) {
+	plan, err := vm.PlanReconcile(desired)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Changes) == 0 {
+		return plan, nil
+	}
+
+	var hot, cold []VmReconcileChange
+	for _, change := range plan.Changes {
+		if change.Hot {
+			hot = append(hot, change)
+		} else {
+			cold = append(cold, change)
+		}
+	}
+
+	if !plan.PoweredOn || len(cold) == 0 {
+		return plan, vm.applyReconcileChanges(plan, desired, plan.Changes)
+	}
+
+	if !desired.PowerCycle {
+		err = vm.applyReconcileChanges(plan, desired, hot)
+		if err != nil {
+			return plan, err
+		}
+		plan.Pending = cold
+		fields := make([]string, len(cold))
+		for i, change := range cold {
+			fields[i] = change.Field
+		}
+		return plan, fmt.Errorf("changes to %s of VM '%s' require the VM to be powered off", strings.Join(fields, ", "), vm.VM.Name)
+	}
+
+	util.Logger.Printf("[TRACE] VM.Reconcile: power cycling VM '%s' to apply %d change(s)", vm.VM.Name, len(cold))
+	return plan, vm.applyWithPowerCycle(plan, desired)
+}
+
+// applyWithPowerCycle stops the VM, applies all the changes of the plan, and powers the VM on
+// again, also when the changes could not be applied
+func (vm *VM) applyWithPowerCycle(plan *VmReconcilePlan, desired VmDesiredSpec) (err error) {
+	timeout := desired.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultVmShutdownTimeout
+	}
+	tasks, err := vm.stopForReconcile(timeout)
+	plan.Tasks += tasks
+	if err != nil {
+		return fmt.Errorf("error stopping VM '%s': %s", vm.VM.Name, err)
+	}
+	plan.PowerCycled = true
+
+	defer func() {
+		task, powerOnErr := vm.PowerOn()
+		if powerOnErr == nil {
+			powerOnErr = task.WaitTaskCompletion()
+		}
+		if powerOnErr != nil {
+			powerOnErr = fmt.Errorf("error powering on VM '%s': %s", vm.VM.Name, powerOnErr)
+			if err != nil {
+				err = fmt.Errorf("%s; %s", err, powerOnErr)
+			} else {
+				err = powerOnErr
+			}
+			return
+		}
+		plan.Tasks++
+		if err == nil {
+			err = vm.Refresh()
+		}
+	}()
+	return vm.applyReconcileChanges(plan, desired, plan.Changes)
+}
+
+// stopForReconcile shuts the guest OS down, or powers the VM off when VMware Tools don't run in
+// the guest or when the shutdown doesn't complete within the timeout. It returns the number of
+// tasks used
+func (vm *VM) stopForReconcile(timeout time.Duration) (int, error) {
+	tasks := 0
+	toolsStatus, err := vm.getToolsStatus()
+	if err != nil {
+		util.Logger.Printf("[WARN] VM.Reconcile: error retrieving VMware Tools status of VM '%s': %s", vm.VM.Name, err)
+	}
+	if vmToolsRunningStatuses[toolsStatus] {
+		tasks++
+		err = vm.shutdownGuest(timeout)
+		if err == nil {
+			return tasks, nil
+		}
+		util.Logger.Printf("[WARN] VM.Reconcile: guest shutdown of VM '%s' failed, powering it off: %s", vm.VM.Name, err)
+		status, err := vm.GetStatus()
+		if err == nil && status == "POWERED_OFF" {
+			return tasks, nil
+		}
+	}
+
+	task, err := vm.PowerOff()
+	if err == nil {
+		err = task.WaitTaskCompletion()
+	}
+	if err != nil {
+		return tasks, fmt.Errorf("error powering off: %s", err)
+	}
+	return tasks + 1, nil
+}
+
+// shutdownGuest shuts the guest OS down, canceling the shutdown task when it doesn't complete
+// within the timeout
+func (vm *VM) shutdownGuest(timeout time.Duration) error {
+	task, err := vm.Shutdown()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err = task.Refresh()
+		if err != nil {
+			return err
+		}
+		switch task.Task.Status {
+		case "success":
+			return nil
+		case "error", "aborted", "canceled":
+			message := task.Task.Status
+			if task.Task.Error != nil {
+				message = task.Task.Error.Message
+			}
+			return fmt.Errorf("shutdown task failed: %s", message)
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(min(vmWaitInitialInterval, time.Until(deadline)))
+	}
+	cancelErr := task.CancelTask()
+	if cancelErr != nil {
+		util.Logger.Printf("[WARN] VM.Reconcile: error canceling shutdown task of VM '%s': %s", vm.VM.Name, cancelErr)
+	}
+	return fmt.Errorf("guest OS did not shut down within %s", timeout)
+}
+
+// applyReconcileChanges applies the given changes, grouping them in one reconfigureVm task, one
+// VM capabilities task and one extra configuration update
+func (vm *VM) applyReconcileChanges(plan *VmReconcilePlan, desired VmDesiredSpec, changes []VmReconcileChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	fields := make(map[string]bool)
+	for _, change := range changes {
+		fields[change.Field] = true
+	}
+
+	payload, err := vm.reconfigurePayload(desired, fields)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		task, err := vm.client.ExecuteTaskRequestWithApiVersion(vm.VM.HREF+"/action/reconfigureVm", http.MethodPost,
+			types.MimeVM, "error reconfiguring VM: %s", payload,
+			vm.client.GetSpecificApiVersionOnCondition(">=37.1", "37.1"))
+		if err == nil {
+			err = task.WaitTaskCompletion()
+		}
+		if err != nil {
+			return err
+		}
+		plan.Tasks++
+	}
+
+	if fields[vmFieldCpuHotAdd] || fields[vmFieldMemoryHotAdd] {
+		cpuHotAdd, memoryHotAdd := false, false
+		if vm.VM.VMCapabilities != nil {
+			cpuHotAdd = vm.VM.VMCapabilities.CPUHotAddEnabled
+			memoryHotAdd = vm.VM.VMCapabilities.MemoryHotAddEnabled
+		}
+		if desired.CpuHotAdd != nil {
+			cpuHotAdd = *desired.CpuHotAdd
+		}
+		if desired.MemoryHotAdd != nil {
+			memoryHotAdd = *desired.MemoryHotAdd
+		}
+		_, err = vm.UpdateVmCpuAndMemoryHotAdd(cpuHotAdd, memoryHotAdd)
+		if err != nil {
+			return err
+		}
+		plan.Tasks++
+	}
+
+	var extraConfig []*types.ExtraConfigMarshal
+	for _, key := range sortedKeys(desired.ExtraConfig) {
+		if fields[vmFieldExtraConfig+key] {
+			extraConfig = append(extraConfig, &types.ExtraConfigMarshal{Key: key, Value: desired.ExtraConfig[key]})
+		}
+	}
+	if len(extraConfig) > 0 {
+		_, err = vm.UpdateExtraConfig(extraConfig)
+		if err != nil {
+			return err
+		}
+		plan.Tasks++
+	}
+	return vm.Refresh()
+}
+
+// reconfigurePayload builds the reconfigureVm request for the given fields, or returns nil when
+// none of the fields is changed through reconfigureVm
+func (vm *VM) reconfigurePayload(desired VmDesiredSpec, fields map[string]bool) (*types.Vm, error) {
+	payload := &types.Vm{
+		Xmlns:       types.XMLNamespaceVCloud,
+		Ovf:         types.XMLNamespaceOVF,
+		Name:        vm.VM.Name,
+		Description: vm.VM.Description,
+		// The compute policy must be sent with every reconfiguration, or VCD resets it to the
+		// default sizing policy of the VDC when the VM isn't compliant with the current one
+		ComputePolicy: vm.VM.ComputePolicy,
+	}
+	needed := false
+
+	if fields[vmFieldDescription] {
+		payload.Description = *desired.Description
+		needed = true
+	}
+
+	specChanged := fields[vmFieldCpus] || fields[vmFieldCoresPerSocket] || fields[vmFieldMemory]
+	disksChanged := false
+	for field := range fields {
+		if strings.HasPrefix(field, vmFieldDiskPrefix) {
+			disksChanged = true
+		}
+	}
+	if specChanged || disksChanged {
+		if vm.VM.VmSpecSection == nil {
+			return nil, fmt.Errorf("VM '%s' has no VmSpecSection", vm.VM.Name)
+		}
+		vmSpecSection := *vm.VM.VmSpecSection
+		modified := true
+		vmSpecSection.Modified = &modified
+		// Sending the disk section unchanged is treated as a change that fails, and disks missing
+		// from a disk section are deleted: it is sent in full, and only when disks change
+		vmSpecSection.DiskSection = nil
+		if fields[vmFieldCpus] {
+			vmSpecSection.NumCpus = desired.Cpus
+		}
+		if fields[vmFieldCoresPerSocket] {
+			vmSpecSection.NumCoresPerSocket = desired.CoresPerSocket
+		}
+		if fields[vmFieldMemory] {
+			memory := *vmSpecSection.MemoryResourceMb
+			memory.Configured = *desired.MemoryMb
+			vmSpecSection.MemoryResourceMb = &memory
+		}
+		if disksChanged {
+			diskSection := *vm.VM.VmSpecSection.DiskSection
+			diskSection.DiskSettings = nil
+			for _, disk := range vm.VM.VmSpecSection.DiskSection.DiskSettings {
+				updated := *disk
+				if fields[vmFieldDiskPrefix+disk.DiskId] {
+					updated.SizeMb = desired.DiskSizesMb[disk.DiskId]
+				}
+				diskSection.DiskSettings = append(diskSection.DiskSettings, &updated)
+			}
+			vmSpecSection.DiskSection = &diskSection
+		}
+		payload.VmSpecSection = &vmSpecSection
+		needed = true
+	}
+
+	if fields[vmFieldStorageProfile] {
+		payload.StorageProfile = &types.Reference{HREF: desired.StorageProfileHref}
+		needed = true
+	}
+
+	if fields[vmFieldSizingPolicy] || fields[vmFieldPlacementPolicy] {
+		computePolicy := &types.ComputePolicy{}
+		if vm.VM.ComputePolicy != nil {
+			computePolicy.VmSizingPolicy = vm.VM.ComputePolicy.VmSizingPolicy
+			computePolicy.VmPlacementPolicy = vm.VM.ComputePolicy.VmPlacementPolicy
+		}
+		var err error
+		if fields[vmFieldSizingPolicy] {
+			computePolicy.VmSizingPolicy, err = vm.computePolicyReference(*desired.SizingPolicyId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if fields[vmFieldPlacementPolicy] {
+			computePolicy.VmPlacementPolicy, err = vm.computePolicyReference(*desired.PlacementPolicyId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if computePolicy.VmSizingPolicy == nil && computePolicy.VmPlacementPolicy == nil {
+			return nil, fmt.Errorf("either sizing policy or placement policy is needed")
+		}
+		payload.ComputePolicy = computePolicy
+		needed = true
+	}
+
+	if fields[vmFieldBootOptions] {
+		payload.BootOptions = desired.BootOptions
+		needed = true
+	}
+
+	if !needed {
+		return nil, nil
+	}
+	return payload, nil
+}
+
+// computePolicyReference returns the reference of a VDC compute policy, or nil for an empty ID
+func (vm *VM) computePolicyReference(policyId string) (*types.Reference, error) {
+	if policyId == "" {
+		return nil, nil
+	}
+	href, err := vm.client.OpenApiBuildEndpoint(types.OpenApiPathVersion2_0_0, types.OpenApiEndpointVdcComputePolicies, policyId)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing HREF for compute policy %s: %s", policyId, err)
+	}
+	return &types.Reference{HREF: href.String()}, nil
+}
+
+// vmReconcileChanges compares the VM with the desired spec. The Hot flag of each change is
+// computed from the current CPU and memory hot-add capabilities of the VM
+func vmReconcileChanges(vm *types.Vm, desired VmDesiredSpec, extraConfig []*types.ExtraConfigMarshal) ([]VmReconcileChange, error) {
+	var changes []VmReconcileChange
+	add := func(field, from, to string, hot bool) {
+		changes = append(changes, VmReconcileChange{Field: field, From: from, To: to, Hot: hot})
+	}
+	cpuHotAdd, memoryHotAdd := false, false
+	if vm.VMCapabilities != nil {
+		cpuHotAdd = vm.VMCapabilities.CPUHotAddEnabled
+		memoryHotAdd = vm.VMCapabilities.MemoryHotAddEnabled
+	}
+
+	if desired.Description != nil && *desired.Description != vm.Description {
+		add(vmFieldDescription, vm.Description, *desired.Description, true)
+	}
+
+	spec := vm.VmSpecSection
+	needsSpec := desired.Cpus != nil || desired.CoresPerSocket != nil || desired.MemoryMb != nil || len(desired.DiskSizesMb) > 0
+	if needsSpec && spec == nil {
+		return nil, fmt.Errorf("VM '%s' has no VmSpecSection", vm.Name)
+	}
+	if desired.CoresPerSocket != nil && (spec.NumCoresPerSocket == nil || *spec.NumCoresPerSocket != *desired.CoresPerSocket) {
+		add(vmFieldCoresPerSocket, intPointerString(spec.NumCoresPerSocket), fmt.Sprint(*desired.CoresPerSocket), false)
+	}
+	if desired.Cpus != nil && (spec.NumCpus == nil || *spec.NumCpus != *desired.Cpus) {
+		// CPUs can be hot-added, but not removed, and only with an unchanged topology
+		hot := cpuHotAdd && spec.NumCpus != nil && *desired.Cpus > *spec.NumCpus &&
+			(desired.CoresPerSocket == nil || (spec.NumCoresPerSocket != nil && *spec.NumCoresPerSocket == *desired.CoresPerSocket))
+		add(vmFieldCpus, intPointerString(spec.NumCpus), fmt.Sprint(*desired.Cpus), hot)
+	}
+	if desired.MemoryMb != nil {
+		if spec.MemoryResourceMb == nil {
+			return nil, fmt.Errorf("VM '%s' has no memory settings", vm.Name)
+		}
+		current := spec.MemoryResourceMb.Configured
+		if current != *desired.MemoryMb {
+			add(vmFieldMemory, fmt.Sprint(current), fmt.Sprint(*desired.MemoryMb), memoryHotAdd && *desired.MemoryMb > current)
+		}
+	}
+
+	if len(desired.DiskSizesMb) > 0 {
+		disks := make(map[string]*types.DiskSettings)
+		if spec.DiskSection != nil {
+			for _, disk := range spec.DiskSection.DiskSettings {
+				disks[disk.DiskId] = disk
+			}
+		}
+		for _, diskId := range sortedKeys(desired.DiskSizesMb) {
+			size := desired.DiskSizesMb[diskId]
+			disk, found := disks[diskId]
+			if !found {
+				return nil, fmt.Errorf("VM '%s' has no internal disk with ID '%s'", vm.Name, diskId)
+			}
+			if size < disk.SizeMb {
+				return nil, fmt.Errorf("disk '%s' of VM '%s' can't shrink from %d MB to %d MB", diskId, vm.Name, disk.SizeMb, size)
+			}
+			if size > disk.SizeMb {
+				// Disks on IDE controllers can't be extended while the VM runs
+				add(vmFieldDiskPrefix+diskId, fmt.Sprintf("%d MB", disk.SizeMb), fmt.Sprintf("%d MB", size), disk.AdapterType != "1")
+			}
+		}
+	}
+
+	if desired.StorageProfileHref != "" && (vm.StorageProfile == nil || vm.StorageProfile.HREF != desired.StorageProfileHref) {
+		current := ""
+		if vm.StorageProfile != nil {
+			current = vm.StorageProfile.HREF
+		}
+		add(vmFieldStorageProfile, current, desired.StorageProfileHref, true)
+	}
+
+	var currentSizing, currentPlacement *types.Reference
+	if vm.ComputePolicy != nil {
+		currentSizing = vm.ComputePolicy.VmSizingPolicy
+		currentPlacement = vm.ComputePolicy.VmPlacementPolicy
+	}
+	if desired.SizingPolicyId != nil && referenceId(currentSizing) != *desired.SizingPolicyId {
+		add(vmFieldSizingPolicy, referenceId(currentSizing), *desired.SizingPolicyId, false)
+	}
+	if desired.PlacementPolicyId != nil && referenceId(currentPlacement) != *desired.PlacementPolicyId {
+		add(vmFieldPlacementPolicy, referenceId(currentPlacement), *desired.PlacementPolicyId, false)
+	}
+
+	if desired.BootOptions != nil {
+		differences, secureBootChanged := bootOptionsDifferences(vm.BootOptions, desired.BootOptions)
+		if len(differences) > 0 {
+			add(vmFieldBootOptions, "", strings.Join(differences, ", "), !secureBootChanged)
+		}
+	}
+
+	if desired.CpuHotAdd != nil && *desired.CpuHotAdd != cpuHotAdd {
+		add(vmFieldCpuHotAdd, fmt.Sprint(cpuHotAdd), fmt.Sprint(*desired.CpuHotAdd), false)
+	}
+	if desired.MemoryHotAdd != nil && *desired.MemoryHotAdd != memoryHotAdd {
+		add(vmFieldMemoryHotAdd, fmt.Sprint(memoryHotAdd), fmt.Sprint(*desired.MemoryHotAdd), false)
+	}
+
+	currentExtraConfig := make(map[string]string)
+	for _, item := range extraConfig {
+		currentExtraConfig[item.Key] = item.Value
+	}
+	for _, key := range sortedKeys(desired.ExtraConfig) {
+		current, found := currentExtraConfig[key]
+		if !found || current != desired.ExtraConfig[key] {
+			add(vmFieldExtraConfig+key, current, desired.ExtraConfig[key], false)
+		}
+	}
+	return changes, nil
+}
+
+func referenceId(reference *types.Reference) string {
+	if reference == nil {
+		return ""
+	}
+	return reference.ID
+}
+
+// bootOptionsDifferences lists the boot options set in desired which differ from the current
+// ones, and reports whether EFI secure boot, which can't change while the VM runs, is among them
+func bootOptionsDifferences(current, desired *types.BootOptions) ([]string, bool) {
+	if current == nil {
+		current = &types.BootOptions{}
+	}
+	var differences []string
+	compareInt := func(name string, currentValue, desiredValue *int) {
+		if desiredValue != nil && (currentValue == nil || *currentValue != *desiredValue) {
+			differences = append(differences, fmt.Sprintf("%s=%d", name, *desiredValue))
+		}
+	}
+	compareBool := func(name string, currentValue, desiredValue *bool) bool {
+		if desiredValue != nil && (currentValue == nil || *currentValue != *desiredValue) {
+			differences = append(differences, fmt.Sprintf("%s=%t", name, *desiredValue))
+			return true
+		}
+		return false
+	}
+	compareInt("bootDelay", current.BootDelay, desired.BootDelay)
+	compareBool("enterBiosSetup", current.EnterBiosSetup, desired.EnterBiosSetup)
+	compareBool("bootRetryEnabled", current.BootRetryEnabled, desired.BootRetryEnabled)
+	compareInt("bootRetryDelay", current.BootRetryDelay, desired.BootRetryDelay)
+	secureBootChanged := compareBool("efiSecureBootEnabled", current.EfiSecureBootEnabled, desired.EfiSecureBootEnabled)
+	if desired.NetworkBootProtocol != "" && desired.NetworkBootProtocol != current.NetworkBootProtocol {
+		differences = append(differences, "networkBootProtocol="+desired.NetworkBootProtocol)
+	}
+	return differences, secureBootChanged
+}
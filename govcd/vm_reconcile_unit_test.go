@@ -0,0 +1,231 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func testReconcileVm(cpuHotAdd, memoryHotAdd bool) *types.Vm {
+	return &types.Vm{
+		Name:        "vm1",
+		Description: "old",
+		VmSpecSection: &types.VmSpecSection{
+			NumCpus:           addrOf(2),
+			NumCoresPerSocket: addrOf(1),
+			MemoryResourceMb:  &types.MemoryResourceMb{Configured: 1024},
+			DiskSection: &types.DiskSection{DiskSettings: []*types.DiskSettings{
+				{DiskId: "2000", SizeMb: 1024, AdapterType: "5"},
+				{DiskId: "3000", SizeMb: 512, AdapterType: "1"},
+			}},
+		},
+		VMCapabilities: &types.VmCapabilities{CPUHotAddEnabled: cpuHotAdd, MemoryHotAddEnabled: memoryHotAdd},
+		StorageProfile: &types.Reference{HREF: "https://vcd/sp1"},
+		ComputePolicy:  &types.ComputePolicy{VmSizingPolicy: &types.Reference{ID: "sizing1"}},
+		BootOptions:    &types.BootOptions{BootDelay: addrOf(0), EfiSecureBootEnabled: addrOf(false)},
+	}
+}
+
+func reconcileChangesByField(changes []VmReconcileChange) map[string]VmReconcileChange {
+	result := make(map[string]VmReconcileChange)
+	for _, change := range changes {
+		result[change.Field] = change
+	}
+	return result
+}
+
+func Test_vmReconcileChanges(t *testing.T) {
+	type expectedChange struct {
+		field string
+		hot   bool
+	}
+	tests := []struct {
+		name        string
+		vm          *types.Vm
+		desired     VmDesiredSpec
+		extraConfig []*types.ExtraConfigMarshal
+		want        []expectedChange
+		wantErr     bool
+	}{
+		{
+			name: "no changes",
+			vm:   testReconcileVm(false, false),
+			desired: VmDesiredSpec{Description: addrOf("old"), Cpus: addrOf(2), MemoryMb: addrOf(int64(1024)),
+				DiskSizesMb: map[string]int64{"2000": 1024}, StorageProfileHref: "https://vcd/sp1",
+				SizingPolicyId: addrOf("sizing1"), BootOptions: &types.BootOptions{BootDelay: addrOf(0)},
+				CpuHotAdd: addrOf(false)},
+		},
+		{
+			name:    "increases without hot-add",
+			vm:      testReconcileVm(false, false),
+			desired: VmDesiredSpec{Cpus: addrOf(4), MemoryMb: addrOf(int64(2048))},
+			want:    []expectedChange{{vmFieldCpus, false}, {vmFieldMemory, false}},
+		},
+		{
+			name:    "increases with hot-add",
+			vm:      testReconcileVm(true, true),
+			desired: VmDesiredSpec{Cpus: addrOf(4), MemoryMb: addrOf(int64(2048))},
+			want:    []expectedChange{{vmFieldCpus, true}, {vmFieldMemory, true}},
+		},
+		{
+			name:    "decreases with hot-add",
+			vm:      testReconcileVm(true, true),
+			desired: VmDesiredSpec{Cpus: addrOf(1), MemoryMb: addrOf(int64(512))},
+			want:    []expectedChange{{vmFieldCpus, false}, {vmFieldMemory, false}},
+		},
+		{
+			name:    "CPU topology change",
+			vm:      testReconcileVm(true, true),
+			desired: VmDesiredSpec{Cpus: addrOf(4), CoresPerSocket: addrOf(2)},
+			want:    []expectedChange{{vmFieldCoresPerSocket, false}, {vmFieldCpus, false}},
+		},
+		{
+			name:    "disk growth",
+			vm:      testReconcileVm(false, false),
+			desired: VmDesiredSpec{DiskSizesMb: map[string]int64{"2000": 2048, "3000": 1024}},
+			want:    []expectedChange{{vmFieldDiskPrefix + "2000", true}, {vmFieldDiskPrefix + "3000", false}},
+		},
+		{
+			name:    "disk shrink",
+			vm:      testReconcileVm(false, false),
+			desired: VmDesiredSpec{DiskSizesMb: map[string]int64{"2000": 512}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown disk",
+			vm:      testReconcileVm(false, false),
+			desired: VmDesiredSpec{DiskSizesMb: map[string]int64{"9999": 512}},
+			wantErr: true,
+		},
+		{
+			name: "hot settings",
+			vm:   testReconcileVm(false, false),
+			desired: VmDesiredSpec{Description: addrOf("new"), StorageProfileHref: "https://vcd/sp2",
+				BootOptions: &types.BootOptions{BootDelay: addrOf(5)}},
+			want: []expectedChange{{vmFieldDescription, true}, {vmFieldStorageProfile, true}, {vmFieldBootOptions, true}},
+		},
+		{
+			name: "cold settings",
+			vm:   testReconcileVm(false, false),
+			desired: VmDesiredSpec{SizingPolicyId: addrOf("sizing2"), PlacementPolicyId: addrOf("placement1"),
+				BootOptions: &types.BootOptions{EfiSecureBootEnabled: addrOf(true)},
+				CpuHotAdd:   addrOf(true), MemoryHotAdd: addrOf(true),
+				ExtraConfig: map[string]string{"key1": "value1", "key2": "value2"}},
+			extraConfig: []*types.ExtraConfigMarshal{{Key: "key1", Value: "value1"}, {Key: "key2", Value: "old"}},
+			want: []expectedChange{{vmFieldSizingPolicy, false}, {vmFieldPlacementPolicy, false},
+				{vmFieldBootOptions, false}, {vmFieldCpuHotAdd, false}, {vmFieldMemoryHotAdd, false},
+				{vmFieldExtraConfig + "key2", false}},
+		},
+		{
+			name:    "missing spec section",
+			vm:      &types.Vm{Name: "vm1"},
+			desired: VmDesiredSpec{Cpus: addrOf(2)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := vmReconcileChanges(tt.vm, tt.desired, tt.extraConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("expected %d changes, got %d: %+v", len(tt.want), len(changes), changes)
+			}
+			byField := reconcileChangesByField(changes)
+			for _, want := range tt.want {
+				change, found := byField[want.field]
+				if !found {
+					t.Errorf("expected change of %s, got %+v", want.field, changes)
+					continue
+				}
+				if change.Hot != want.hot {
+					t.Errorf("expected hot=%t for %s, got %t", want.hot, want.field, change.Hot)
+				}
+			}
+		})
+	}
+}
+
+func Test_bootOptionsDifferences(t *testing.T) {
+	current := &types.BootOptions{BootDelay: addrOf(0), NetworkBootProtocol: "IPv4"}
+	differences, secureBoot := bootOptionsDifferences(current, &types.BootOptions{
+		BootDelay:           addrOf(0),
+		EnterBiosSetup:      addrOf(true),
+		NetworkBootProtocol: "IPv6",
+	})
+	if secureBoot {
+		t.Errorf("unexpected secure boot change")
+	}
+	if len(differences) != 2 || differences[0] != "enterBiosSetup=true" || differences[1] != "networkBootProtocol=IPv6" {
+		t.Errorf("unexpected differences: %v", differences)
+	}
+
+	differences, secureBoot = bootOptionsDifferences(nil, &types.BootOptions{EfiSecureBootEnabled: addrOf(false)})
+	if !secureBoot || len(differences) != 1 {
+		t.Errorf("expected secure boot change, got %v", differences)
+	}
+}
+
+func Test_shutdownGuest(t *testing.T) {
+	defaultInterval := vmWaitInitialInterval
+	vmWaitInitialInterval = 10 * time.Millisecond
+	defer func() { vmWaitInitialInterval = defaultInterval }()
+
+	var mutex sync.Mutex
+	status := "running"
+	canceled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/action/cancel") {
+			canceled = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		body, _ := xml.Marshal(&types.Task{HREF: "http://" + r.Host + "/api/task/1", Status: status,
+			Error: &types.Error{Message: "VMware Tools are not running"}})
+		w.Header().Set("Content-Type", types.MimeTask)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	setStatus := func(value string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status = value
+	}
+	vm := NewVM(&Client{Http: *server.Client(), APIVersion: "37.0"})
+	vm.VM = &types.Vm{Name: "vm-1", HREF: server.URL + "/api/vApp/vm-1"}
+
+	// A shutdown which doesn't complete in time is canceled
+	err := vm.shutdownGuest(50 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not shut down") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if !canceled {
+		t.Errorf("expected the shutdown task to be canceled")
+	}
+
+	setStatus("error")
+	err = vm.shutdownGuest(time.Second)
+	if err == nil || !strings.Contains(err.Error(), "VMware Tools are not running") {
+		t.Errorf("expected task error, got %v", err)
+	}
+	setStatus("success")
+	err = vm.shutdownGuest(time.Second)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
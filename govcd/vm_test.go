@@ -7,6 +7,8 @@
 package govcd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"slices"
 	"strings"
@@ -2490,3 +2492,364 @@ func deployVappWithOrgVdcNetwork(vappName, orgNetworkName string, vdc *Vdc) (*VA
 
 	return vapp, nil
 }
+
+// Test_VmAndVAppSnapshots creates, reverts and removes snapshots of a VM and of its vApp
+func (vcd *TestVCD) Test_VmAndVAppSnapshots(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	section, err := vm.GetSnapshotSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(section.Snapshot), Equals, 0)
+
+	err = vm.CreateSnapshot(check.TestName(), false, false)
+	check.Assert(err, IsNil)
+	section, err = vm.GetSnapshotSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(section.Snapshot), Equals, 1)
+	check.Assert(section.Snapshot[0].PoweredOn, Equals, false)
+
+	err = vm.Refresh()
+	check.Assert(err, IsNil)
+	err = vm.RevertToCurrentSnapshot()
+	check.Assert(err, IsNil)
+
+	task, err := vm.RemoveAllSnapshotsAsync()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	section, err = vm.GetSnapshotSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(section.Snapshot), Equals, 0)
+
+	// vApp snapshots apply to all of its VMs
+	task, err = vapp.CreateSnapshotAsync(check.TestName(), false, false)
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	section, err = vm.GetSnapshotSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(section.Snapshot), Equals, 1)
+
+	err = vapp.RevertToCurrentSnapshot()
+	check.Assert(err, IsNil)
+	err = vapp.RemoveAllSnapshots()
+	check.Assert(err, IsNil)
+	section, err = vapp.GetSnapshotSection()
+	check.Assert(err, IsNil)
+	check.Assert(len(section.Snapshot), Equals, 0)
+
+	// Cleanup
+	err = vapp.Refresh()
+	check.Assert(err, IsNil)
+	task, err = vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VmConsoleTickets acquires screen and MKS tickets and console thumbnails for a powered on VM
+func (vcd *TestVCD) Test_VmConsoleTickets(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	task, err := vm.PowerOn()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	err = vm.Refresh()
+	check.Assert(err, IsNil)
+
+	screenTicket, err := vm.AcquireScreenTicket()
+	check.Assert(err, IsNil)
+	check.Assert(strings.HasPrefix(screenTicket.Value, "mks://"), Equals, true)
+
+	mksTicket, err := vm.AcquireMksTicket()
+	check.Assert(err, IsNil)
+	check.Assert(mksTicket.Host, Not(Equals), "")
+	check.Assert(mksTicket.Ticket, Not(Equals), "")
+	check.Assert(mksTicket.Vmx, Not(Equals), "")
+
+	url, err := WebMksUrl(mksTicket)
+	check.Assert(err, IsNil)
+	check.Assert(strings.HasPrefix(url, "wss://"+mksTicket.Host+"/"), Equals, true)
+
+	thumbnail, err := vm.GetScreenThumbnail()
+	check.Assert(err, IsNil)
+	check.Assert(bytes.HasPrefix(thumbnail, []byte("\x89PNG")), Equals, true)
+
+	err = vapp.Refresh()
+	check.Assert(err, IsNil)
+	thumbnails, err := vapp.GetScreenThumbnails(0)
+	check.Assert(err, IsNil)
+	check.Assert(len(thumbnails[vm.VM.Name]) > 0, Equals, true)
+
+	// Cleanup
+	task, err = vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VmTypedNics adds, updates, promotes and removes a NIC using the typed NIC functions
+func (vcd *TestVCD) Test_VmTypedNics(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	nicsBefore, err := vm.ListNics()
+	check.Assert(err, IsNil)
+
+	nic, err := vm.AddNic(VmNic{IpAllocationMode: types.IPAllocationModeNone, AdapterType: "VMXNET3"})
+	check.Assert(err, IsNil)
+	check.Assert(nic.Network, Equals, types.NoneNetwork)
+	check.Assert(nic.Connected, Equals, false)
+
+	nic.Connected = true
+	err = vm.UpdateNic(*nic)
+	check.Assert(err, IsNil)
+
+	err = vm.SetPrimaryNic(nic.Index)
+	check.Assert(err, IsNil)
+	nics, err := vm.ListNics()
+	check.Assert(err, IsNil)
+	check.Assert(len(nics), Equals, len(nicsBefore)+1)
+	for _, current := range nics {
+		check.Assert(current.Primary, Equals, current.Index == nic.Index)
+		if current.Index == nic.Index {
+			check.Assert(current.Connected, Equals, true)
+		}
+	}
+
+	_, err = vm.AddNic(VmNic{Network: "missing-" + check.TestName(), IpAllocationMode: types.IPAllocationModeDHCP})
+	check.Assert(err, NotNil)
+
+	err = vm.RemoveNic(nic.Index)
+	check.Assert(err, IsNil)
+	nics, err = vm.ListNics()
+	check.Assert(err, IsNil)
+	check.Assert(len(nics), Equals, len(nicsBefore))
+
+	// Cleanup
+	task, err := vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VmReconcile reconciles a powered off VM, then checks that cold changes are reported as
+// pending on a powered on VM unless power cycling is allowed
+func (vcd *TestVCD) Test_VmReconcile(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	status, err := vm.GetStatus()
+	check.Assert(err, IsNil)
+	if status == "POWERED_ON" {
+		task, err := vm.PowerOff()
+		check.Assert(err, IsNil)
+		check.Assert(task.WaitTaskCompletion(), IsNil)
+	}
+
+	desired := VmDesiredSpec{
+		Description: addrOf(check.TestName()),
+		Cpus:        addrOf(2),
+		MemoryMb:    addrOf(int64(1024)),
+		CpuHotAdd:   addrOf(true),
+	}
+	plan, err := vm.Reconcile(desired)
+	check.Assert(err, IsNil)
+	check.Assert(plan.PoweredOn, Equals, false)
+	check.Assert(len(plan.Pending), Equals, 0)
+	check.Assert(vm.VM.Description, Equals, check.TestName())
+	check.Assert(*vm.VM.VmSpecSection.NumCpus, Equals, 2)
+	check.Assert(vm.VM.VmSpecSection.MemoryResourceMb.Configured, Equals, int64(1024))
+
+	plan, err = vm.PlanReconcile(desired)
+	check.Assert(err, IsNil)
+	check.Assert(len(plan.Changes), Equals, 0)
+
+	task, err := vm.PowerOn()
+	check.Assert(err, IsNil)
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+
+	// Memory hot-add is disabled: the memory change is pending while the CPU is hot-added
+	desired = VmDesiredSpec{Cpus: addrOf(4), MemoryMb: addrOf(int64(2048))}
+	plan, err = vm.Reconcile(desired)
+	check.Assert(err, NotNil)
+	check.Assert(len(plan.Pending), Equals, 1)
+	check.Assert(plan.Pending[0].Field, Equals, vmFieldMemory)
+	check.Assert(*vm.VM.VmSpecSection.NumCpus, Equals, 4)
+
+	desired.PowerCycle = true
+	plan, err = vm.Reconcile(desired)
+	check.Assert(err, IsNil)
+	check.Assert(plan.PowerCycled, Equals, true)
+	check.Assert(vm.VM.VmSpecSection.MemoryResourceMb.Configured, Equals, int64(2048))
+	status, err = vm.GetStatus()
+	check.Assert(err, IsNil)
+	check.Assert(status, Equals, "POWERED_ON")
+
+	// Cleanup
+	task, err = vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VmGuestCustomizationBuilder applies a guest customization built with the builder, then
+// forces customization and waits for it to complete
+func (vcd *TestVCD) Test_VmGuestCustomizationBuilder(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	_, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vm, NotNil)
+
+	_, err := vm.ApplyGuestCustomization(NewGuestCustomizationBuilder(false).ChangeSid(true))
+	check.Assert(err, NotNil)
+
+	builder := NewGuestCustomizationBuilder(false).
+		ComputerName("reconfigured-vm").
+		AutoAdminPassword().
+		Script("#!/bin/sh\necho customized")
+	section, err := vm.ApplyGuestCustomization(builder)
+	check.Assert(err, IsNil)
+	check.Assert(section.ComputerName, Equals, "reconfigured-vm")
+	check.Assert(*section.AdminPasswordAuto, Equals, true)
+	check.Assert(section.CustomizationScript, Not(Equals), "")
+
+	task, err := vm.Undeploy()
+	check.Assert(err, IsNil)
+	check.Assert(task.WaitTaskCompletion(), IsNil)
+	err = vm.PowerOnAndForceCustomization()
+	check.Assert(err, IsNil)
+	err = vm.WaitForGuestCustomization(10 * time.Minute)
+	check.Assert(err, IsNil)
+
+	err = deleteNsxtVapp(vcd, check.TestName())
+	check.Assert(err, IsNil)
+}
+
+// Test_VmOvfPropertiesAndCloudInit declares OVF properties on a VM, sets them through the typed
+// property functions and sets cloud-init user data
+func (vcd *TestVCD) Test_VmOvfPropertiesAndCloudInit(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	declared := &types.ProductSectionList{ProductSection: &types.ProductSection{
+		Info: "Custom properties",
+		Property: []*types.Property{
+			{Key: "size", Type: "string", UserConfigurable: true, DefaultValue: "small", Qualifiers: `ValueMap{"small","large"}`},
+			{Key: "port", Type: "uint16", UserConfigurable: true, DefaultValue: "80"},
+			{Key: CloudInitUserDataProperty, Type: "string", UserConfigurable: true},
+			{Key: CloudInitMetaDataProperty, Type: "string", UserConfigurable: true},
+		},
+	}}
+	_, err := vm.SetProductSectionList(declared)
+	check.Assert(err, IsNil)
+
+	_, err = vm.SetOvfProperties(map[string]string{"size": "medium"})
+	check.Assert(err, NotNil)
+	_, err = vm.SetOvfProperties(map[string]string{"undeclared": "value"})
+	check.Assert(err, NotNil)
+
+	properties, err := vm.SetOvfProperties(map[string]string{"size": "large", "port": "8080"})
+	check.Assert(err, IsNil)
+	check.Assert(properties["size"].Value, Equals, "large")
+	check.Assert(properties["port"].Value, Equals, "8080")
+
+	err = vm.SetCloudInitUserData("#cloud-config\nhostname: "+check.TestName(), "instance-id: test", CloudInitEncodingGzipBase64)
+	check.Assert(err, IsNil)
+	properties, err = vm.GetOvfProperties()
+	check.Assert(err, IsNil)
+	check.Assert(properties[CloudInitUserDataProperty].Value, Not(Equals), "")
+	check.Assert(properties[CloudInitUserDataEncodingProperty].Value, Equals, string(CloudInitEncodingGzipBase64))
+	check.Assert(properties[CloudInitMetaDataEncodingProperty].Value, Equals, string(CloudInitEncodingGzipBase64))
+	check.Assert(properties["size"].Value, Equals, "large")
+
+	// Cleanup
+	task, err := vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
+
+// Test_VmWaitUntil waits for a VM to be powered on and to run VMware Tools, and checks that a
+// condition which is never met stops at the deadline
+func (vcd *TestVCD) Test_VmWaitUntil(check *C) {
+	if vcd.skipVappTests {
+		check.Skip("Skipping test because vApp wasn't properly created")
+	}
+	vapp, vm := createNsxtVAppAndVm(vcd, check)
+	check.Assert(vapp, NotNil)
+	check.Assert(vm, NotNil)
+
+	status, err := vm.GetStatus()
+	check.Assert(err, IsNil)
+	if status != "POWERED_ON" {
+		task, err := vm.PowerOn()
+		check.Assert(err, IsNil)
+		check.Assert(task.WaitTaskCompletion(), IsNil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	err = vm.WaitUntil(ctx, VmPoweredOn(), VmToolsRunning(), VmNicsHaveIps())
+	check.Assert(err, IsNil)
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shortCancel()
+	err = vm.WaitUntil(shortCtx, VmGuestPropertyEquals("missing-"+check.TestName(), "value"))
+	check.Assert(err, NotNil)
+	check.Assert(strings.Contains(err.Error(), "missing-"+check.TestName()), Equals, true)
+
+	// Cleanup
+	task, err := vapp.Undeploy()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+	task, err = vapp.Delete()
+	check.Assert(err, IsNil)
+	err = task.WaitTaskCompletion()
+	check.Assert(err, IsNil)
+}
@@ -0,0 +1,197 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+	"github.com/vmware/go-vcloud-director/v3/util"
+)
+
+// VmCondition is a condition on the state of a VM, checked by VM.WaitUntil.
+// Check returns whether the condition is met and a short description of the current state,
+// used when the wait times out. An error stops the wait: Check returns one when the condition
+// can't be met any more, such as a failed guest customization
+type VmCondition struct {
+	Name  string
+	Check func(vm *VM) (bool, string, error)
+}
+
+// Backoff between two checks of VM.WaitUntil
+var (
+	vmWaitInitialInterval = 2 * time.Second
+	vmWaitMaxInterval     = 30 * time.Second
+)
+
+// VM tools statuses of the VM query which mean that VMware Tools run in the guest
+var vmToolsRunningStatuses = map[string]bool{"toolsOk": true, "toolsOld": true}
+
+// WaitUntil waits until all the conditions are met, checking them in order with an increasing
+// interval between checks, starting at 2 seconds and up to 30 seconds. The context sets the
+// single overall deadline: when it has no deadline, the MaxRetryTimeout of the client is used.
+// On timeout, the returned error names the first condition which was not met and its state
+//
+//	err := vm.WaitUntil(ctx, VmPoweredOn(), VmToolsRunning(), VmNicsHaveIps())
+func (vm *VM) WaitUntil(ctx context.Context, conditions ...VmCondition) error {
+	if len(conditions) == 0 {
+		return fmt.Errorf("at least one condition is required")
+	}
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(vm.client.MaxRetryTimeout)*time.Second)
+		defer cancel()
+	}
+
+	interval := vmWaitInitialInterval
+	for {
+		pending, state, err := vm.firstUnmetCondition(conditions)
+		if err != nil {
+			return err
+		}
+		if pending == "" {
+			return nil
+		}
+		util.Logger.Printf("[TRACE] VM '%s' waiting for condition '%s': %s", vm.VM.Name, pending, state)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("VM '%s' stopped waiting for condition '%s' (%s): %w", vm.VM.Name, pending, state, ctx.Err())
+		case <-timer.C:
+		}
+		interval = min(interval*3/2, vmWaitMaxInterval)
+	}
+}
+
+// firstUnmetCondition returns the name and state of the first condition which is not met, or an
+// empty name when all conditions are met
+func (vm *VM) firstUnmetCondition(conditions []VmCondition) (string, string, error) {
+	for _, condition := range conditions {
+		met, state, err := condition.Check(vm)
+		if err != nil {
+			return "", "", fmt.Errorf("error checking condition '%s' of VM '%s': %s", condition.Name, vm.VM.Name, err)
+		}
+		if !met {
+			return condition.Name, state, nil
+		}
+	}
+	return "", "", nil
+}
+
+// VmPoweredOn is met when the VM is powered on
+func VmPoweredOn() VmCondition {
+	return VmCondition{
+		Name: "powered on",
+		Check: func(vm *VM) (bool, string, error) {
+			status, err := vm.GetStatus()
+			if err != nil {
+				return false, "", err
+			}
+			return status == "POWERED_ON", "status " + status, nil
+		},
+	}
+}
+
+// VmToolsRunning is met when VMware Tools run in the guest
+func VmToolsRunning() VmCondition {
+	return VmCondition{
+		Name: "VMware Tools running",
+		Check: func(vm *VM) (bool, string, error) {
+			status, err := vm.getToolsStatus()
+			if err != nil {
+				return false, "", err
+			}
+			return vmToolsRunningStatuses[status], "tools status " + status, nil
+		},
+	}
+}
+
+// VmNicsHaveIps is met when every connected NIC of the VM, except the ones without network,
+// reports an IP address. IP addresses assigned by DHCP are reported only when VMware Tools run
+func VmNicsHaveIps() VmCondition {
+	return VmCondition{
+		Name: "all NICs have IPs",
+		Check: func(vm *VM) (bool, string, error) {
+			section, err := vm.GetNetworkConnectionSection()
+			if err != nil {
+				return false, "", err
+			}
+			var missing []string
+			for _, nic := range nicsFromSection(section) {
+				if nic.Connected && nic.Network != types.NoneNetwork && nic.IpAddress == "" {
+					missing = append(missing, fmt.Sprint(nic.Index))
+				}
+			}
+			if len(missing) > 0 {
+				return false, "no IP for NICs " + strings.Join(missing, ", "), nil
+			}
+			return true, "", nil
+		},
+	}
+}
+
+// VmGuestCustomizationDone is met when guest customization is complete. It stops the wait when
+// customization fails
+func VmGuestCustomizationDone() VmCondition {
+	return VmCondition{
+		Name: "guest customization done",
+		Check: func(vm *VM) (bool, string, error) {
+			status, err := vm.GetGuestCustomizationStatus()
+			if err != nil {
+				return false, "", err
+			}
+			if status == types.GuestCustStatusFailed {
+				return false, "", fmt.Errorf("guest customization failed")
+			}
+			return status == types.GuestCustStatusComplete, "customization status " + status, nil
+		},
+	}
+}
+
+// VmGuestPropertyEquals is met when the property with the given key of the OVF environment of
+// the VM has the expected value. The OVF environment is available only when the VM is powered on
+func VmGuestPropertyEquals(key, value string) VmCondition {
+	return VmCondition{
+		Name: fmt.Sprintf("guest property %s=%s", key, value),
+		Check: func(vm *VM) (bool, string, error) {
+			err := vm.Refresh()
+			if err != nil {
+				return false, "", err
+			}
+			environment := vm.VM.Environment
+			if environment == nil || environment.PropertySection == nil {
+				return false, "no OVF environment", nil
+			}
+			for _, property := range environment.PropertySection.Properties {
+				if property.Key == key {
+					return property.Value == value, fmt.Sprintf("%s=%s", key, property.Value), nil
+				}
+			}
+			return false, fmt.Sprintf("%s is not set", key), nil
+		},
+	}
+}
+
+// getToolsStatus returns the VMware Tools status reported by the VM query, such as toolsOk,
+// toolsOld, toolsNotRunning or toolsNotInstalled
+func (vm *VM) getToolsStatus() (string, error) {
+	if vm.VM.ID == "" {
+		return "", fmt.Errorf("VM ID is unset")
+	}
+	records, err := QueryVmList(types.VmQueryFilterOnlyDeployed, vm.client, map[string]string{"id": url.QueryEscape(vm.VM.ID)})
+	if err != nil {
+		return "", err
+	}
+	if len(records) != 1 {
+		return "", fmt.Errorf("expected one VM with ID %s, found %d", vm.VM.ID, len(records))
+	}
+	return records[0].VmToolsStatus, nil
+}
@@ -0,0 +1,71 @@
+//go:build unit || ALL
+
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package govcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmware/go-vcloud-director/v3/types/v56"
+)
+
+func Test_VmWaitUntil(t *testing.T) {
+	defaultInitial, defaultMax := vmWaitInitialInterval, vmWaitMaxInterval
+	vmWaitInitialInterval, vmWaitMaxInterval = time.Millisecond, 5*time.Millisecond
+	defer func() { vmWaitInitialInterval, vmWaitMaxInterval = defaultInitial, defaultMax }()
+
+	vm := NewVM(&Client{MaxRetryTimeout: 1})
+	vm.VM = &types.Vm{Name: "vm1"}
+
+	metAfter := func(name string, checks int) (VmCondition, *int) {
+		count := 0
+		return VmCondition{Name: name, Check: func(vm *VM) (bool, string, error) {
+			count++
+			return count >= checks, fmt.Sprintf("check %d", count), nil
+		}}, &count
+	}
+
+	first, firstCount := metAfter("first", 3)
+	second, secondCount := metAfter("second", 2)
+	err := vm.WaitUntil(context.Background(), first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The second condition is checked only once the first one is met
+	if *firstCount != 4 || *secondCount != 2 {
+		t.Errorf("unexpected number of checks: %d, %d", *firstCount, *secondCount)
+	}
+
+	failing := VmCondition{Name: "failing", Check: func(vm *VM) (bool, string, error) {
+		return false, "", fmt.Errorf("customization failed")
+	}}
+	err = vm.WaitUntil(context.Background(), failing)
+	if err == nil || !strings.Contains(err.Error(), "failing") || !strings.Contains(err.Error(), "customization failed") {
+		t.Errorf("expected condition error, got %v", err)
+	}
+
+	never, _ := metAfter("never", 1000000)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = vm.WaitUntil(ctx, never)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "'never'") || !strings.Contains(err.Error(), "check ") {
+		t.Errorf("expected deadline error with condition state, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("wait did not honor the context deadline")
+	}
+
+	err = vm.WaitUntil(context.Background())
+	if err == nil {
+		t.Errorf("expected error without conditions")
+	}
+}
@@ -60,6 +60,14 @@ const (
 	MimeSession = "application/vnd.vmware.vcloud.session+xml"
 	// MimeTask mime for task
 	MimeTask = "application/vnd.vmware.vcloud.task+xml"
+	// MimeCreateSnapshotParams mime for snapshot creation parameters
+	MimeCreateSnapshotParams = "application/vnd.vmware.vcloud.createSnapshotParams+xml"
+	// MimeSnapshotSection mime for the snapshot section of a VM or vApp
+	MimeSnapshotSection = "application/vnd.vmware.vcloud.snapshotSection+xml"
+	// MimeScreenTicket mime for a VM screen ticket
+	MimeScreenTicket = "application/vnd.vmware.vcloud.screenTicket+xml"
+	// MimeMksTicket mime for a VM MKS ticket
+	MimeMksTicket = "application/vnd.vmware.vcloud.mksTicket+xml"
 	// MimeError mime for error
 	MimeError = "application/vnd.vmware.vcloud.error+xml"
 	// MimeNetwork mime for a network
@@ -106,6 +114,8 @@ const (
 	MimeCaptureVappTemplateParams = "application/vnd.vmware.vcloud.captureVAppParams+xml"
 	// Mime for clone vApp template params
 	MimeCloneVapp = "application/vnd.vmware.vcloud.cloneVAppParams+xml"
+	// Mime for move vApp params
+	MimeMoveVappParams = "application/vnd.vmware.vcloud.moveVAppParams+xml"
 	// Mime for product section
 	MimeProductSection = "application/vnd.vmware.vcloud.productSections+xml"
 	// Mime for metadata
@@ -122,6 +132,8 @@ const (
 	MimeAdminGroup = "application/vnd.vmware.admin.group+xml"
 	// MimeOrgLdapSettings
 	MimeOrgLdapSettings = "application/vnd.vmware.admin.organizationldapsettings+xml"
+	// MimeOrgEmailSettings
+	MimeOrgEmailSettings = "application/vnd.vmware.admin.organizationEmailSettings+xml"
 	// Mime of vApp network
 	MimeVappNetwork = "application/vnd.vmware.vcloud.vAppNetwork+xml"
 	// Mime of access control
@@ -140,6 +152,8 @@ const (
 	MimeUpdateVdcStorageProfiles = "application/vnd.vmware.admin.updateVdcStorageProfiles+xml"
 	// Mime to modify lease settings
 	MimeLeaseSettingSection = "application/vnd.vmware.vcloud.leaseSettingsSection+xml"
+	// MimeStartupSection mime for the startup section of a vApp
+	MimeStartupSection = "application/vnd.vmware.vcloud.startupSection+xml"
 	// Mime to publish external catalog
 	PublishExternalCatalog = "application/vnd.vmware.admin.publishExternalCatalogParams+xml"
 	// Mime to publish a catalog
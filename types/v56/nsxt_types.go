@@ -535,6 +535,12 @@ type NsxtFirewallRule struct {
 	Logging    bool   `json:"logging"`
 	// Direction 'IN_OUT', 'OUT', 'IN'
 	Direction string `json:"direction"`
+	// Comments contains user entered comments shown in UI (VCD 10.3.2+)
+	Comments string `json:"comments,omitempty"`
+	// SourceGroupsExcluded reverses the list of SourceFirewallGroups (VCD 10.3.2+)
+	SourceGroupsExcluded *bool `json:"sourceGroupsExcluded,omitempty"`
+	// DestinationGroupsExcluded reverses the list of DestinationFirewallGroups (VCD 10.3.2+)
+	DestinationGroupsExcluded *bool `json:"destinationGroupsExcluded,omitempty"`
 	// Version of firewall rule. Must not be set when creating.
 	Version *struct {
 		// Version is incremented after each update
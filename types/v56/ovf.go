@@ -0,0 +1,555 @@
+// © Broadcom. All Rights Reserved.
+// The term "Broadcom" refers to Broadcom Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// OvfEnvelope is an OVF descriptor, as defined by DMTF DSP0243.
+// The sections which are not modeled are kept in the Other fields of their parent, so that the
+// descriptor can be unmarshaled, changed and marshaled again without losing content. The descriptor
+// is marshaled with the namespace prefixes it declares, such as ovf, rasd and vmw
+type OvfEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.dmtf.org/ovf/envelope/1 Envelope"`
+	// Attributes are the other attributes of the envelope, including its namespace declarations
+	Attributes []xml.Attr `xml:",any,attr"`
+
+	References     OvfReferences      `xml:"http://schemas.dmtf.org/ovf/envelope/1 References"`
+	DiskSection    *OvfDiskSection    `xml:"http://schemas.dmtf.org/ovf/envelope/1 DiskSection,omitempty"`
+	NetworkSection *OvfNetworkSection `xml:"http://schemas.dmtf.org/ovf/envelope/1 NetworkSection,omitempty"`
+	Other          []*OvfRawElement   `xml:",any"`
+
+	// One of VirtualSystem or VirtualSystemCollection is set
+	VirtualSystem           *OvfVirtualSystem           `xml:"http://schemas.dmtf.org/ovf/envelope/1 VirtualSystem,omitempty"`
+	VirtualSystemCollection *OvfVirtualSystemCollection `xml:"http://schemas.dmtf.org/ovf/envelope/1 VirtualSystemCollection,omitempty"`
+}
+
+// OvfReferences lists the files of the OVF package
+type OvfReferences struct {
+	File []*OvfFile `xml:"http://schemas.dmtf.org/ovf/envelope/1 File,omitempty"`
+}
+
+// OvfFile is a file of the OVF package. A file with ChunkSize is split in several files named after
+// HREF with a 9 digit suffix, such as disk.vmdk.000000000
+type OvfFile struct {
+	ID          string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 id,attr"`
+	HREF        string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 href,attr"`
+	Size        int64      `xml:"http://schemas.dmtf.org/ovf/envelope/1 size,attr,omitempty"`
+	Compression string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 compression,attr,omitempty"`
+	ChunkSize   int64      `xml:"http://schemas.dmtf.org/ovf/envelope/1 chunkSize,attr,omitempty"`
+	Attributes  []xml.Attr `xml:",any,attr"`
+}
+
+// OvfDiskSection describes the virtual disks of the package
+type OvfDiskSection struct {
+	Attributes []xml.Attr       `xml:",any,attr"`
+	Info       string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Disk       []*OvfDisk       `xml:"http://schemas.dmtf.org/ovf/envelope/1 Disk,omitempty"`
+	Other      []*OvfRawElement `xml:",any"`
+}
+
+// OvfDisk is a virtual disk, whose content is the file referenced by FileRef. Capacity is expressed
+// in CapacityAllocationUnits, such as "byte * 2^30"
+type OvfDisk struct {
+	DiskID                  string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 diskId,attr"`
+	FileRef                 string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 fileRef,attr,omitempty"`
+	Capacity                string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 capacity,attr"`
+	CapacityAllocationUnits string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 capacityAllocationUnits,attr,omitempty"`
+	Format                  string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 format,attr,omitempty"`
+	PopulatedSize           int64      `xml:"http://schemas.dmtf.org/ovf/envelope/1 populatedSize,attr,omitempty"`
+	ParentRef               string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 parentRef,attr,omitempty"`
+	Attributes              []xml.Attr `xml:",any,attr"`
+}
+
+// OvfNetworkSection lists the logical networks the virtual machines connect to
+type OvfNetworkSection struct {
+	Attributes []xml.Attr       `xml:",any,attr"`
+	Info       string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Network    []*OvfNetwork    `xml:"http://schemas.dmtf.org/ovf/envelope/1 Network,omitempty"`
+	Other      []*OvfRawElement `xml:",any"`
+}
+
+// OvfNetwork is a logical network, referenced by name by the Connection of network adapters
+type OvfNetwork struct {
+	Name        string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 name,attr"`
+	Attributes  []xml.Attr       `xml:",any,attr"`
+	Description string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Description,omitempty"`
+	Other       []*OvfRawElement `xml:",any"`
+}
+
+// OvfVirtualSystem is a virtual machine of the package
+type OvfVirtualSystem struct {
+	ID         string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 id,attr"`
+	Attributes []xml.Attr `xml:",any,attr"`
+	Info       string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Name       string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Name,omitempty"`
+
+	ProductSection         []*OvfProductSection         `xml:"http://schemas.dmtf.org/ovf/envelope/1 ProductSection,omitempty"`
+	EulaSection            []*OvfEulaSection            `xml:"http://schemas.dmtf.org/ovf/envelope/1 EulaSection,omitempty"`
+	OperatingSystemSection *OvfOperatingSystemSection   `xml:"http://schemas.dmtf.org/ovf/envelope/1 OperatingSystemSection,omitempty"`
+	VirtualHardwareSection []*OvfVirtualHardwareSection `xml:"http://schemas.dmtf.org/ovf/envelope/1 VirtualHardwareSection,omitempty"`
+	Other                  []*OvfRawElement             `xml:",any"`
+}
+
+// OvfVirtualSystemCollection is a group of virtual systems, such as a vApp
+type OvfVirtualSystemCollection struct {
+	ID         string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 id,attr"`
+	Attributes []xml.Attr `xml:",any,attr"`
+	Info       string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Name       string     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Name,omitempty"`
+
+	ProductSection []*OvfProductSection `xml:"http://schemas.dmtf.org/ovf/envelope/1 ProductSection,omitempty"`
+	EulaSection    []*OvfEulaSection    `xml:"http://schemas.dmtf.org/ovf/envelope/1 EulaSection,omitempty"`
+	StartupSection *StartupSection      `xml:"http://schemas.dmtf.org/ovf/envelope/1 StartupSection,omitempty"`
+	Other          []*OvfRawElement     `xml:",any"`
+
+	VirtualSystem           []*OvfVirtualSystem           `xml:"http://schemas.dmtf.org/ovf/envelope/1 VirtualSystem,omitempty"`
+	VirtualSystemCollection []*OvfVirtualSystemCollection `xml:"http://schemas.dmtf.org/ovf/envelope/1 VirtualSystemCollection,omitempty"`
+}
+
+// OvfEulaSection is a license agreement which must be accepted to deploy the package
+type OvfEulaSection struct {
+	Attributes []xml.Attr       `xml:",any,attr"`
+	Info       string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	License    string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 License"`
+	Other      []*OvfRawElement `xml:",any"`
+}
+
+// OvfOperatingSystemSection identifies the guest operating system with its CIM_OperatingSystem ID.
+// VMware descriptors also set the vmw:osType attribute
+type OvfOperatingSystemSection struct {
+	ID          int              `xml:"http://schemas.dmtf.org/ovf/envelope/1 id,attr"`
+	Version     string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 version,attr,omitempty"`
+	Attributes  []xml.Attr       `xml:",any,attr"`
+	Info        string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Description string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Description,omitempty"`
+	Other       []*OvfRawElement `xml:",any"`
+}
+
+// OvfVirtualHardwareSection describes the virtual hardware of a virtual system. VMware extensions,
+// such as vmw:Config and vmw:ExtraConfig, are kept in Other
+type OvfVirtualHardwareSection struct {
+	Attributes []xml.Attr            `xml:",any,attr"`
+	Info       string                `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	System     *OvfVirtualSystemType `xml:"http://schemas.dmtf.org/ovf/envelope/1 System,omitempty"`
+	Item       []*OvfItem            `xml:"http://schemas.dmtf.org/ovf/envelope/1 Item,omitempty"`
+	Other      []*OvfRawElement      `xml:",any"`
+}
+
+// OvfVirtualSystemType holds the CIM_VirtualSystemSettingData of a virtual hardware section, such as
+// the virtual hardware version "vmx-19"
+type OvfVirtualSystemType struct {
+	ElementName             string `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData ElementName"`
+	InstanceID              string `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData InstanceID"`
+	VirtualSystemIdentifier string `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData VirtualSystemIdentifier,omitempty"`
+	VirtualSystemType       string `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData VirtualSystemType,omitempty"`
+}
+
+// OvfItem is a virtual hardware device, described by CIM_ResourceAllocationSettingData. The values are
+// kept as written in the descriptor, and the elements follow the alphabetical order required by the
+// CIM schema. Common resource types are 3 (CPU), 4 (memory), 5 (IDE controller), 6 (SCSI controller),
+// 10 (network adapter), 14 (floppy drive), 15 (CD drive) and 17 (hard disk)
+type OvfItem struct {
+	Attributes            []xml.Attr           `xml:",any,attr"`
+	Address               string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Address,omitempty"`
+	AddressOnParent       string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData AddressOnParent,omitempty"`
+	AllocationUnits       string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData AllocationUnits,omitempty"`
+	AutomaticAllocation   string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData AutomaticAllocation,omitempty"`
+	AutomaticDeallocation string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData AutomaticDeallocation,omitempty"`
+	Caption               string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Caption,omitempty"`
+	ChangeableType        string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ChangeableType,omitempty"`
+	ConfigurationName     string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ConfigurationName,omitempty"`
+	Connection            []*OvfItemConnection `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Connection,omitempty"`
+	ConsumerVisibility    string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ConsumerVisibility,omitempty"`
+	Description           string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Description,omitempty"`
+	ElementName           string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ElementName"`
+	Generation            string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Generation,omitempty"`
+	HostResource          []string             `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData HostResource,omitempty"`
+	InstanceID            string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData InstanceID"`
+	Limit                 string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Limit,omitempty"`
+	MappingBehavior       string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData MappingBehavior,omitempty"`
+	OtherResourceType     string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData OtherResourceType,omitempty"`
+	Parent                string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Parent,omitempty"`
+	PoolID                string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData PoolID,omitempty"`
+	Reservation           string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Reservation,omitempty"`
+	ResourceSubType       string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ResourceSubType,omitempty"`
+	ResourceType          string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData ResourceType,omitempty"`
+	VirtualQuantity       string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData VirtualQuantity,omitempty"`
+	VirtualQuantityUnits  string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData VirtualQuantityUnits,omitempty"`
+	Weight                string               `xml:"http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData Weight,omitempty"`
+	Other                 []*OvfRawElement     `xml:",any"`
+}
+
+// OvfItemConnection is the name of the network a network adapter connects to
+type OvfItemConnection struct {
+	Attributes  []xml.Attr `xml:",any,attr"`
+	NetworkName string     `xml:",chardata"`
+}
+
+// OvfProductSection describes the product installed in a virtual system, and the properties used to
+// configure it at deployment
+type OvfProductSection struct {
+	Class       string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 class,attr,omitempty"`
+	Instance    string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 instance,attr,omitempty"`
+	Attributes  []xml.Attr       `xml:",any,attr"`
+	Info        string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Product     string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Product,omitempty"`
+	Vendor      string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Vendor,omitempty"`
+	Version     string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 Version,omitempty"`
+	FullVersion string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 FullVersion,omitempty"`
+	ProductUrl  string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 ProductUrl,omitempty"`
+	VendorUrl   string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 VendorUrl,omitempty"`
+	AppUrl      string           `xml:"http://schemas.dmtf.org/ovf/envelope/1 AppUrl,omitempty"`
+	Icon        []*OvfRawElement `xml:"http://schemas.dmtf.org/ovf/envelope/1 Icon,omitempty"`
+	// Property are the properties of the product. In the descriptor, the properties of a category
+	// follow its Category element
+	Property []*OvfProductProperty `xml:"http://schemas.dmtf.org/ovf/envelope/1 Property,omitempty"`
+	Other    []*OvfRawElement      `xml:",any"`
+}
+
+// OvfProductProperty is a property of a product section. In the OVF environment of the virtual system,
+// its key is prefixed by the class and suffixed by the instance of the section
+type OvfProductProperty struct {
+	Key              string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 key,attr"`
+	Type             string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 type,attr"`
+	Qualifiers       string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 qualifiers,attr,omitempty"`
+	UserConfigurable bool                       `xml:"http://schemas.dmtf.org/ovf/envelope/1 userConfigurable,attr,omitempty"`
+	DefaultValue     string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 value,attr,omitempty"`
+	Password         bool                       `xml:"http://schemas.dmtf.org/ovf/envelope/1 password,attr,omitempty"`
+	Attributes       []xml.Attr                 `xml:",any,attr"`
+	Label            string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Label,omitempty"`
+	Description      string                     `xml:"http://schemas.dmtf.org/ovf/envelope/1 Description,omitempty"`
+	Value            []*OvfProductPropertyValue `xml:"http://schemas.dmtf.org/ovf/envelope/1 Value,omitempty"`
+	Other            []*OvfRawElement           `xml:",any"`
+	// Category is the name of the group of properties the property is shown in, or empty
+	Category string `xml:"-"`
+}
+
+// OvfProductPropertyValue is the value of a property for a deployment configuration
+type OvfProductPropertyValue struct {
+	Value         string `xml:"http://schemas.dmtf.org/ovf/envelope/1 value,attr"`
+	Configuration string `xml:"http://schemas.dmtf.org/ovf/envelope/1 configuration,attr,omitempty"`
+}
+
+// OvfRawElement is an element of the descriptor which is not modeled. Its content is kept as read,
+// and written back unchanged
+type OvfRawElement struct {
+	XMLName xml.Name
+	tokens  []xml.Token
+}
+
+// ovfNamespaceDeclaration is the namespace given to the namespace declarations of the descriptor
+// while it is marshaled, as the XML encoder doesn't write declarations itself
+const ovfNamespaceDeclaration = "urn:go-vcloud-director:xmlns"
+
+// xmlNamespace is the namespace of the xml prefix, which is never declared
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// ovfPreferredPrefixes are the prefixes of the namespaces which are not declared by the descriptor
+var ovfPreferredPrefixes = []struct{ prefix, namespace string }{
+	{"ovf", XMLNamespaceOVF},
+	{"rasd", XMLNamespaceRASD},
+	{"vssd", XMLNamespaceVSSD},
+	{"vmw", XMLNamespaceVMW},
+	{"xsi", XMLNamespaceXSI},
+	{"vcloud", XMLNamespaceVCloud},
+}
+
+// VirtualSystems returns all the virtual systems of the descriptor, including the ones of nested
+// virtual system collections
+func (envelope *OvfEnvelope) VirtualSystems() []*OvfVirtualSystem {
+	if envelope.VirtualSystem != nil {
+		return []*OvfVirtualSystem{envelope.VirtualSystem}
+	}
+	var virtualSystems []*OvfVirtualSystem
+	var collect func(collection *OvfVirtualSystemCollection)
+	collect = func(collection *OvfVirtualSystemCollection) {
+		if collection == nil {
+			return
+		}
+		virtualSystems = append(virtualSystems, collection.VirtualSystem...)
+		for _, nested := range collection.VirtualSystemCollection {
+			collect(nested)
+		}
+	}
+	collect(envelope.VirtualSystemCollection)
+	return virtualSystems
+}
+
+// MarshalXML writes the descriptor with namespace prefixes: the ones declared by the descriptor when
+// it was read, or else the usual ones, such as ovf and rasd
+func (envelope OvfEnvelope) MarshalXML(encoder *xml.Encoder, _ xml.StartElement) error {
+	// The encoder writes the namespace of every element in a xmlns attribute, and generates prefixes
+	// for the attributes: the encoded descriptor is read again to write it with the right prefixes
+	type plainEnvelope OvfEnvelope
+	plain := plainEnvelope(envelope)
+	plain.Attributes = markOvfNamespaceDeclarations(envelope.Attributes)
+	content, err := xml.Marshal(plain)
+	if err != nil {
+		return err
+	}
+	return writeOvfWithPrefixes(encoder, content)
+}
+
+// MarshalXML writes the element as it was read
+func (element OvfRawElement) MarshalXML(encoder *xml.Encoder, _ xml.StartElement) error {
+	if len(element.tokens) == 0 {
+		return encoder.EncodeElement("", xml.StartElement{Name: element.XMLName})
+	}
+	for _, token := range element.tokens {
+		if start, ok := token.(xml.StartElement); ok {
+			start.Attr = markOvfNamespaceDeclarations(start.Attr)
+			token = start
+		}
+		err := encoder.EncodeToken(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalXML keeps the tokens of the element
+func (element *OvfRawElement) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	element.XMLName = start.Name
+	element.tokens = []xml.Token{start.Copy()}
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+		element.tokens = append(element.tokens, xml.CopyToken(token))
+	}
+	return nil
+}
+
+// UnmarshalXML reads the product section, recording the category of every property
+func (section *OvfProductSection) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var raw OvfRawElement
+	err := raw.UnmarshalXML(decoder, start)
+	if err != nil {
+		return err
+	}
+	type plainSection OvfProductSection
+	var plain plainSection
+	err = xml.NewTokenDecoder(&ovfTokenReader{tokens: raw.tokens}).Decode(&plain)
+	if err != nil {
+		return err
+	}
+	*section = OvfProductSection(plain)
+	// The categories are recorded in the properties
+	section.Other = slices.DeleteFunc(section.Other, func(element *OvfRawElement) bool {
+		return element.XMLName == xml.Name{Space: XMLNamespaceOVF, Local: "Category"}
+	})
+
+	// The properties are in the order of the descriptor, after the category they belong to
+	category := ""
+	inCategory := false
+	property := 0
+	depth := 0
+	for _, token := range raw.tokens {
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth != 2 || token.Name.Space != XMLNamespaceOVF {
+				continue
+			}
+			switch token.Name.Local {
+			case "Category":
+				category = ""
+				inCategory = true
+			case "Property":
+				if property < len(section.Property) {
+					section.Property[property].Category = category
+					property++
+				}
+			}
+		case xml.CharData:
+			if inCategory {
+				category += string(token)
+			}
+		case xml.EndElement:
+			depth--
+			if inCategory && depth == 1 {
+				category = strings.TrimSpace(category)
+				inCategory = false
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalXML writes the product section, with a Category element before the first property of
+// every category
+func (section OvfProductSection) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	type ovfCategory struct {
+		XMLName xml.Name
+		Name    string `xml:",chardata"`
+	}
+	type ovfProperty struct {
+		XMLName xml.Name
+		*OvfProductProperty
+	}
+	type plainSection OvfProductSection
+	plain := plainSection(section)
+	plain.Property = nil
+	plain.Other = nil
+	// The entries are the categories and the properties, followed by the other elements
+	var entries []any
+	category := ""
+	for _, property := range section.Property {
+		if property.Category != category {
+			category = property.Category
+			entries = append(entries, ovfCategory{XMLName: xml.Name{Space: XMLNamespaceOVF, Local: "Category"}, Name: category})
+		}
+		entries = append(entries, ovfProperty{XMLName: xml.Name{Space: XMLNamespaceOVF, Local: "Property"}, OvfProductProperty: property})
+	}
+	for _, other := range section.Other {
+		entries = append(entries, other)
+	}
+	withEntries := struct {
+		plainSection
+		Entries []any `xml:",any"`
+	}{plain, entries}
+	return encoder.EncodeElement(withEntries, start)
+}
+
+// ovfTokenReader returns the tokens of an element which was already read
+type ovfTokenReader struct {
+	tokens []xml.Token
+}
+
+// Token returns the next token
+func (reader *ovfTokenReader) Token() (xml.Token, error) {
+	if len(reader.tokens) == 0 {
+		return nil, io.EOF
+	}
+	token := reader.tokens[0]
+	reader.tokens = reader.tokens[1:]
+	return token, nil
+}
+
+// markOvfNamespaceDeclarations returns the attributes with the namespace declarations moved to the
+// ovfNamespaceDeclaration namespace
+func markOvfNamespaceDeclarations(attributes []xml.Attr) []xml.Attr {
+	var marked []xml.Attr
+	for _, attribute := range attributes {
+		switch {
+		case attribute.Name.Space == "xmlns":
+			attribute.Name.Space = ovfNamespaceDeclaration
+		case attribute.Name.Space == "" && attribute.Name.Local == "xmlns":
+			// Every element is written with its prefix: the default namespace is not needed
+			continue
+		}
+		marked = append(marked, attribute)
+	}
+	return marked
+}
+
+// writeOvfWithPrefixes writes the encoded descriptor with prefixed names, declaring all the
+// namespaces on the root element
+func writeOvfWithPrefixes(encoder *xml.Encoder, content []byte) error {
+	var tokens []xml.Token
+	decoder := xml.NewDecoder(strings.NewReader(string(content)))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	// The prefixes declared by the descriptor come first, then the usual ones
+	prefixes := map[string]string{xmlNamespace: "xml"}
+	namespaces := map[string]string{"xml": xmlNamespace}
+	var declared []string
+	declare := func(prefix, namespace string) {
+		if prefixes[namespace] != "" || namespaces[prefix] != "" {
+			return
+		}
+		prefixes[namespace] = prefix
+		namespaces[prefix] = namespace
+		declared = append(declared, prefix)
+	}
+	var used []string
+	for _, token := range tokens {
+		if start, ok := token.(xml.StartElement); ok {
+			used = append(used, start.Name.Space)
+			for _, attribute := range start.Attr {
+				switch attribute.Name.Space {
+				case ovfNamespaceDeclaration:
+					declare(attribute.Name.Local, attribute.Value)
+				case "xmlns":
+				default:
+					used = append(used, attribute.Name.Space)
+				}
+			}
+		}
+	}
+	for _, preferred := range ovfPreferredPrefixes {
+		declare(preferred.prefix, preferred.namespace)
+	}
+	for _, namespace := range used {
+		for number := 1; namespace != "" && prefixes[namespace] == ""; number++ {
+			declare(fmt.Sprintf("ns%d", number), namespace)
+		}
+	}
+
+	prefixed := func(name xml.Name) xml.Name {
+		if name.Space == "" {
+			return name
+		}
+		return xml.Name{Local: prefixes[name.Space] + ":" + name.Local}
+	}
+	root := true
+	for _, token := range tokens {
+		switch typed := token.(type) {
+		case xml.StartElement:
+			start := xml.StartElement{Name: prefixed(typed.Name)}
+			if root {
+				for _, prefix := range declared {
+					start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: namespaces[prefix]})
+				}
+				root = false
+			}
+			for _, attribute := range typed.Attr {
+				if attribute.Name.Space == ovfNamespaceDeclaration || attribute.Name.Space == "xmlns" ||
+					(attribute.Name.Space == "" && attribute.Name.Local == "xmlns") {
+					continue
+				}
+				start.Attr = append(start.Attr, xml.Attr{Name: prefixed(attribute.Name), Value: attribute.Value})
+			}
+			token = start
+		case xml.EndElement:
+			token = xml.EndElement{Name: prefixed(typed.Name)}
+		case xml.CharData:
+			// The descriptor is indented by the encoder
+			if strings.TrimSpace(string(typed)) == "" {
+				continue
+			}
+		case xml.ProcInst:
+			continue
+		}
+		err := encoder.EncodeToken(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
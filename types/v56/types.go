@@ -1122,6 +1122,41 @@ type OrgLdapSettingsType struct {
 	CustomOrgLdapSettings *CustomOrgLdapSettings `xml:"CustomOrgLdapSettings,omitempty" json:"customOrgLdapSettings,omitempty"` // Needs to be set if user chooses custom mode
 }
 
+// OrgEmailSettings represents the email settings for a VMware Cloud Director organization.
+// Type: OrgEmailSettingsType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Description: Represents the email settings of a VMware Cloud Director organization.
+// Since: 0.9
+// Note. Order of these fields matter and API will error if it is changed
+type OrgEmailSettings struct {
+	XMLName xml.Name `xml:"OrgEmailSettings" json:"-"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty" json:"-"`
+	HREF    string   `xml:"href,attr,omitempty" json:"href,omitempty"` // The URI of the entity.
+	Type    string   `xml:"type,attr,omitempty" json:"type,omitempty"` // The MIME type of the entity.
+	Link    LinkList `xml:"Link,omitempty" json:"link,omitempty"`      // A reference to an entity or operation associated with this object.
+
+	IsDefaultSmtpServer     bool                `xml:"IsDefaultSmtpServer" json:"isDefaultSmtpServer"`                   // If true, use the system default SMTP server
+	IsDefaultOrgEmail       bool                `xml:"IsDefaultOrgEmail" json:"isDefaultOrgEmail"`                       // If true, use the system default email address as sender
+	FromEmailAddress        string              `xml:"FromEmailAddress" json:"fromEmailAddress"`                         // Sender address, if IsDefaultOrgEmail is false
+	DefaultSubjectPrefix    string              `xml:"DefaultSubjectPrefix" json:"defaultSubjectPrefix"`                 // Prefix for the subject of all emails
+	IsAlertEmailToAllAdmins bool                `xml:"IsAlertEmailToAllAdmins" json:"isAlertEmailToAllAdmins"`           // If true, alerts are sent to all the organization administrators
+	AlertEmailTo            string              `xml:"AlertEmailTo,omitempty" json:"alertEmailTo,omitempty"`             // Comma separated list of recipients, if IsAlertEmailToAllAdmins is false
+	SmtpServerSettings      *SmtpServerSettings `xml:"SmtpServerSettings,omitempty" json:"smtpServerSettings,omitempty"` // SMTP server, if IsDefaultSmtpServer is false
+}
+
+// SmtpServerSettings represents the SMTP server settings of an organization.
+// Type: SmtpServerSettingsType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Since: 0.9
+// Note. Order of these fields matter and API will error if it is changed
+type SmtpServerSettings struct {
+	IsUseAuthentication bool   `xml:"IsUseAuthentication" json:"isUseAuthentication"`
+	Host                string `xml:"Host" json:"host"`
+	Port                int    `xml:"Port,omitempty" json:"port,omitempty"`
+	Username            string `xml:"Username,omitempty" json:"username,omitempty"`
+	Password            string `xml:"Password,omitempty" json:"password,omitempty"`
+}
+
 // CustomOrgLdapSettings represents the custom ldap settings for a VMware Cloud Director organization.
 // Type: CustomOrgLdapSettingsType
 // Namespace: http://www.vmware.com/vcloud/v1.5
@@ -1641,6 +1676,7 @@ type Property struct {
 	Value            *Value `xml:"http://schemas.dmtf.org/ovf/envelope/1 Value,omitempty"`
 	Type             string `xml:"http://schemas.dmtf.org/ovf/envelope/1 type,attr,omitempty"`
 	UserConfigurable bool   `xml:"http://schemas.dmtf.org/ovf/envelope/1 userConfigurable,attr"`
+	Qualifiers       string `xml:"http://schemas.dmtf.org/ovf/envelope/1 qualifiers,attr,omitempty"` // Constraints on the value, such as MaxLen(64) or ValueMap{"a","b"}
 }
 
 type Value struct {
@@ -2005,6 +2041,72 @@ type SnapshotItem struct {
 	Size      int    `xml:"size,attr,omitempty"`
 }
 
+// CreateSnapshotParams contains the parameters for creating a snapshot of a VM or vApp
+// Type: CreateSnapshotParamsType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Description: Parameters for creating a snapshot.
+// Since: 5.1
+type CreateSnapshotParams struct {
+	XMLName     xml.Name `xml:"CreateSnapshotParams"`
+	Xmlns       string   `xml:"xmlns,attr,omitempty"`
+	Name        string   `xml:"name,attr,omitempty"`    // Name of the snapshot
+	Memory      *bool    `xml:"memory,attr,omitempty"`  // Whether to include the memory of powered on VMs
+	Quiesce     *bool    `xml:"quiesce,attr,omitempty"` // Whether to quiesce the guest file system (requires VMware Tools)
+	Description string   `xml:"Description,omitempty"`  // Description of the snapshot
+}
+
+// StartupSection defines the order in which the VMs of a vApp are started and stopped
+// Type: StartupSection_Type
+// Namespace: http://schemas.dmtf.org/ovf/envelope/1
+// Description: Specifies the order in which entities in a VirtualSystemCollection are powered on and shut down.
+// Since: 0.9
+type StartupSection struct {
+	XMLName xml.Name              `xml:"http://schemas.dmtf.org/ovf/envelope/1 StartupSection"`
+	HREF    string                `xml:"http://www.vmware.com/vcloud/v1.5 href,attr,omitempty"`
+	Type    string                `xml:"http://www.vmware.com/vcloud/v1.5 type,attr,omitempty"`
+	Info    string                `xml:"http://schemas.dmtf.org/ovf/envelope/1 Info"`
+	Item    []*StartupSectionItem `xml:"http://schemas.dmtf.org/ovf/envelope/1 Item,omitempty"`
+}
+
+// StartupSectionItem contains the startup settings of a VM of a vApp. VMs are started in
+// ascending Order and stopped in descending Order. VMs with the same Order start at the same time
+type StartupSectionItem struct {
+	ID              string `xml:"http://schemas.dmtf.org/ovf/envelope/1 id,attr"`              // Name of the VM
+	Order           int    `xml:"http://schemas.dmtf.org/ovf/envelope/1 order,attr"`           // Startup order
+	StartAction     string `xml:"http://schemas.dmtf.org/ovf/envelope/1 startAction,attr"`     // powerOn or none
+	StartDelay      int    `xml:"http://schemas.dmtf.org/ovf/envelope/1 startDelay,attr"`      // Seconds to wait before starting the next VM
+	WaitingForGuest bool   `xml:"http://schemas.dmtf.org/ovf/envelope/1 waitingForGuest,attr"` // Wait for the guest OS to start before starting the next VM
+	StopAction      string `xml:"http://schemas.dmtf.org/ovf/envelope/1 stopAction,attr"`      // powerOff or guestShutdown
+	StopDelay       int    `xml:"http://schemas.dmtf.org/ovf/envelope/1 stopDelay,attr"`       // Seconds to wait before stopping the next VM
+}
+
+// ScreenTicket is a ticket to access the console of a VM, in the form mks://host/vm-path/ticket
+// Type: ScreenTicketType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Description: Represents a screen ticket.
+// Since: 0.9
+type ScreenTicket struct {
+	XMLName xml.Name `xml:"ScreenTicket"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Value   string   `xml:",chardata"`
+}
+
+// MksTicket contains the data needed to open a WebMKS console connection to a VM
+// Type: MksTicketType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Description: Represents an MKS ticket.
+// Since: 5.5
+type MksTicket struct {
+	XMLName xml.Name `xml:"MksTicket"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	HREF    string   `xml:"href,attr,omitempty"`
+	Type    string   `xml:"type,attr,omitempty"`
+	Host    string   `xml:"Host"`   // Console proxy host
+	Vmx     string   `xml:"Vmx"`    // Path of the VMX file of the VM
+	Ticket  string   `xml:"Ticket"` // Single use ticket
+	Port    int      `xml:"Port"`   // Port of the console proxy
+}
+
 // OVFItem is a horrible kludge to process OVF, needs to be fixed with proper types.
 type OVFItem struct {
 	XMLName         xml.Name `xml:"vcloud:Item"`
@@ -2131,6 +2233,22 @@ type CloneVAppParams struct {
 	SourcedItem         *SourcedCompositionItemParam `xml:"SourcedItem,omitempty"`         // Composition item. One of: vApp vAppTemplate VM.
 }
 
+// MoveVAppParams is used to move a vApp to another VDC of the same organization
+// Type: MoveVAppParamsType
+// Namespace: http://www.vmware.com/vcloud/v1.5
+// Description: Parameters for moving a vApp to another VDC.
+// Since: 31.0
+type MoveVAppParams struct {
+	XMLName xml.Name `xml:"MoveVAppParams"`
+	Ovf     string   `xml:"xmlns:ovf,attr"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	// Elements
+	Source               *Reference                     `xml:"Source"`                         // A reference to the vApp to move.
+	NetworkConfigSection *NetworkConfigSection          `xml:"NetworkConfigSection,omitempty"` // vApp networks, with parent networks of the target VDC.
+	LeaseSettingsSection *LeaseSettingsSection          `xml:"LeaseSettingsSection,omitempty"` // Lease settings of the moved vApp.
+	SourcedItem          []*SourcedCompositionItemParam `xml:"SourcedItem,omitempty"`          // One item for each VM of the vApp, with its target storage profile and network connections.
+}
+
 // EdgeGateway represents a gateway.
 // Element: EdgeGateway
 // Type: GatewayType